@@ -0,0 +1,372 @@
+package cryobot
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 多账号
+//
+// 在配置的 accounts 中声明需要连接的账号后，AutoConnect 会并发连接所有启用的账号，而不是交互式地扫码登录
+// 某个账号连接失败只会记录在它的状态中，不会影响其他账号，也不会退出进程
+// 运行时可以通过 AddAccount、管理接口或修改配置文件继续添加账号
+
+// AccountLoginMethod 账号的登录方式
+type AccountLoginMethod string
+
+const (
+	AccountLoginAuto      AccountLoginMethod = "auto"      // 依次尝试保存的签名和密码登录，启用了 qrcode_fallback 时最后尝试扫码登录
+	AccountLoginSignature AccountLoginMethod = "signature" // 只使用保存的签名登录
+	AccountLoginPassword  AccountLoginMethod = "password"  // 使用配置中的密码登录
+	AccountLoginQRCode    AccountLoginMethod = "qrcode"    // 使用扫码登录，二维码会交给配置中的二维码展示器
+)
+
+// AccountConfig 在配置中声明的账号
+type AccountConfig struct {
+	Uin         int                `json:"uin"`                             // QQ号
+	Alias       string             `json:"alias,omitempty,omitzero"`        // 在日志和管理界面中显示的别名，为空时显示QQ昵称
+	Platform    string             `json:"platform,omitempty,omitzero"`     // 使用的平台，为空时按照 protocol 中的配置选择
+	Version     string             `json:"version,omitempty,omitzero"`      // 使用的协议版本，为空时使用该平台的默认版本
+	SignServers []string           `json:"sign_servers,omitempty,omitzero"` // 该账号单独使用的签名服务器，为空时使用Bot的签名服务器池
+	Enable      *bool              `json:"enable,omitempty,omitzero"`       // 是否启用该账号，默认开启
+	Login       AccountLoginMethod `json:"login,omitempty,omitzero"`        // 登录方式，默认为 auto
+	Password    string             `json:"password,omitempty,omitzero"`     // 使用密码登录时的密码
+
+	QRCodeFallback bool `json:"qrcode_fallback,omitempty,omitzero"` // auto：签名和密码都无法登录时是否回退到扫码登录，默认关闭以免无人值守时等待扫码
+}
+
+// IsEnabled 返回账号是否启用
+func (a AccountConfig) IsEnabled() bool {
+	return boolValue(a.Enable, true)
+}
+
+// GetLogin 返回账号的登录方式
+func (a AccountConfig) GetLogin() AccountLoginMethod {
+	if a.Login == "" {
+		return AccountLoginAuto
+	}
+	return a.Login
+}
+
+// validate 校验账号的配置
+func (a AccountConfig) validate(field string, invalid func(field, format string, args ...any)) {
+	if a.Uin <= 0 {
+		invalid(field+".uin", "必须是有效的QQ号")
+	}
+	switch a.GetLogin() {
+	case AccountLoginAuto, AccountLoginSignature, AccountLoginQRCode:
+	case AccountLoginPassword:
+		if a.Password == "" {
+			invalid(field+".password", "使用密码登录时不能为空")
+		}
+	default:
+		invalid(field+".login", "只能是 auto / signature / password / qrcode")
+	}
+	if a.Platform != "" || a.Version != "" {
+		platform := a.Platform
+		if platform == "" {
+			platform = DefaultPlatform
+		}
+		version := a.Version
+		if version == "" {
+			version = DefaultVersion(platform)
+		}
+		if _, err := ResolveAppInfo(platform, version); err != nil {
+			invalid(field, "%v", err)
+		}
+	}
+}
+
+// AccountState 账号的连接状态
+type AccountState string
+
+const (
+	AccountPending    AccountState = "pending"    // 等待连接
+	AccountConnecting AccountState = "connecting" // 正在连接
+	AccountOnline     AccountState = "online"     // 已连接
+	AccountFailed     AccountState = "failed"     // 连接失败
+	AccountOffline    AccountState = "offline"    // 已断开
+	AccountDisabled   AccountState = "disabled"   // 已在配置中禁用
+)
+
+// AccountStatus 账号的状态
+type AccountStatus struct {
+	Uin       int                `json:"uin"`
+	Alias     string             `json:"alias,omitempty,omitzero"`
+	Nickname  string             `json:"nickname,omitempty,omitzero"` // 连接成功后同步的QQ昵称
+	Login     AccountLoginMethod `json:"login"`
+	State     AccountState       `json:"state"`
+	ClientId  string             `json:"client_id,omitempty,omitzero"` // 连接成功后的客户端ID
+	Error     string             `json:"error,omitempty,omitzero"`     // 连接失败的原因
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// account 运行时的账号
+type account struct {
+	config AccountConfig
+	status AccountStatus
+}
+
+// ConnectAccounts 并发连接配置中所有启用的账号，等待所有账号连接结束后返回连接成功的数量
+func (b *Bot) ConnectAccounts() int {
+	var wg sync.WaitGroup
+	for _, a := range b.GetConfig().Accounts {
+		if !b.registerAccount(a) || !a.IsEnabled() {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.connectAccount(a)
+		}()
+	}
+	wg.Wait()
+	online := 0
+	for _, s := range b.GetAccountStatuses() {
+		if s.State == AccountOnline {
+			online++
+		}
+	}
+	return online
+}
+
+// AddAccount 在运行时添加一个账号并在后台开始连接，可以通过 GetAccountStatus 查询连接状态
+//
+// 添加的账号不会被写入配置文件，账号已经存在或配置不正确时返回错误
+func (b *Bot) AddAccount(a AccountConfig) error {
+	var errs []error
+	a.validate("account", func(field, format string, args ...any) {
+		errs = append(errs, &ConfigError{Field: field, Message: fmt.Sprintf(format, args...)})
+	})
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	if !b.registerAccount(a) {
+		return fmt.Errorf("账号 %d 已经存在", a.Uin)
+	}
+	if a.IsEnabled() {
+		go b.connectAccount(a)
+	}
+	return nil
+}
+
+// GetAccountStatus 返回指定账号的状态，账号不存在时返回 false
+func (b *Bot) GetAccountStatus(uin int) (AccountStatus, bool) {
+	b.accountsMutex.RLock()
+	defer b.accountsMutex.RUnlock()
+	for _, a := range b.accounts {
+		if a.config.Uin == uin {
+			return a.status, true
+		}
+	}
+	return AccountStatus{}, false
+}
+
+// GetAccountStatuses 返回所有账号的状态，按照添加的顺序排列
+func (b *Bot) GetAccountStatuses() []AccountStatus {
+	b.accountsMutex.RLock()
+	defer b.accountsMutex.RUnlock()
+	statuses := make([]AccountStatus, 0, len(b.accounts))
+	for _, a := range b.accounts {
+		statuses = append(statuses, a.status)
+	}
+	return statuses
+}
+
+// syncAccounts 添加重新加载的配置中新增的账号
+func (b *Bot) syncAccounts(accounts []AccountConfig) {
+	for _, a := range accounts {
+		if _, ok := b.GetAccountStatus(a.Uin); ok {
+			continue
+		}
+		if err := b.AddAccount(a); err != nil {
+			b.log().Error("添加账号时出现错误：", err)
+		}
+	}
+}
+
+// registerAccount 记录一个账号，账号已经存在时返回 false
+func (b *Bot) registerAccount(a AccountConfig) bool {
+	b.accountsMutex.Lock()
+	defer b.accountsMutex.Unlock()
+	if slices.ContainsFunc(b.accounts, func(acc *account) bool { return acc.config.Uin == a.Uin }) {
+		return false
+	}
+	state := AccountPending
+	if !a.IsEnabled() {
+		state = AccountDisabled
+	}
+	b.accounts = append(b.accounts, &account{
+		config: a,
+		status: AccountStatus{Uin: a.Uin, Alias: a.Alias, Login: a.GetLogin(), State: state, UpdatedAt: time.Now()},
+	})
+	return true
+}
+
+// setAccountState 更新账号的状态
+func (b *Bot) setAccountState(uin int, state AccountState, clientId string, err error) {
+	b.updateAccount(uin, func(a *account) {
+		a.status.State = state
+		a.status.ClientId = clientId
+		a.status.Error = ""
+		if err != nil {
+			a.status.Error = err.Error()
+		}
+	})
+}
+
+// setAccountNickname 更新账号同步到的QQ昵称
+func (b *Bot) setAccountNickname(uin int, nickname string) {
+	b.updateAccount(uin, func(a *account) {
+		a.status.Nickname = nickname
+	})
+}
+
+// updateAccount 修改指定账号的状态，账号不存在时不做任何处理
+func (b *Bot) updateAccount(uin int, update func(a *account)) {
+	b.accountsMutex.Lock()
+	defer b.accountsMutex.Unlock()
+	for _, a := range b.accounts {
+		if a.config.Uin == uin {
+			update(a)
+			a.status.UpdatedAt = time.Now()
+			return
+		}
+	}
+}
+
+// connectAccount 按照账号的登录方式连接账号，并更新账号的状态
+func (b *Bot) connectAccount(a AccountConfig) {
+	b.setAccountState(a.Uin, AccountConnecting, "", nil)
+	if c := b.GetClientByUin(a.Uin); c != nil {
+		b.setAccountState(a.Uin, AccountOnline, c.Id, nil)
+		return
+	}
+	b.log().Infof("%s[Cryo] 正在连接账号 %d", lavender, a.Uin)
+	c, err := b.loginAccount(a)
+	if err != nil {
+		b.log().Errorf("连接账号 %d 失败：%v", a.Uin, err)
+		b.setAccountState(a.Uin, AccountFailed, "", err)
+		return
+	}
+	b.addConnectedClient(c)
+}
+
+// loginAccount 依次尝试账号可用的登录方式，返回登录成功的客户端
+func (b *Bot) loginAccount(a AccountConfig) (*CryoClient, error) {
+	method := a.GetLogin()
+	if method == AccountLoginAuto || method == AccountLoginSignature {
+		info, ok, err := b.findSavedAccount(a.Uin)
+		if err != nil {
+			return nil, fmt.Errorf("读取Bot信息时出现错误：%w", err)
+		}
+		if ok {
+			c := b.newAccountClient(a)
+			if c.Rebuild(info) {
+				if a.Alias != "" {
+					c.setAlias(a.Alias)
+				}
+				if c.SignatureLogin() {
+					return c, nil
+				}
+				// 签名失效时，如果保存了密码且配置中没有密码，则使用保存的密码登录
+				if method == AccountLoginAuto && a.Password == "" && c.HasPassword() {
+					b.log().Infof("%s[Cryo] 签名登录失败，正在使用保存的密码登录 %d", lavender, c.Uin)
+					c.usePasswordMD5(c.Uin, c.passwordMD5)
+					if c.PasswordLogin() {
+						return c, nil
+					}
+				}
+			}
+			c.stopSignPool()
+		}
+		if method == AccountLoginSignature {
+			return nil, fmt.Errorf("没有可用的签名，请使用其他方式登录")
+		}
+	}
+	if (method == AccountLoginAuto || method == AccountLoginPassword) && a.Password != "" {
+		c := b.newAccountClient(a)
+		c.UsePassword(a.Uin, a.Password)
+		c.applyAccount(a)
+		if c.PasswordLogin() {
+			return c, nil
+		}
+		c.stopSignPool()
+		if method == AccountLoginPassword {
+			return nil, fmt.Errorf("密码登录失败")
+		}
+	}
+	if method == AccountLoginAuto && !a.QRCodeFallback {
+		return nil, fmt.Errorf("没有可用的签名或密码，请使用扫码登录或启用 qrcode_fallback")
+	}
+	c := b.newAccountClient(a)
+	c.applyAccount(a)
+	if !c.QRCodeLogin() {
+		c.stopSignPool()
+		return nil, fmt.Errorf("扫码登录失败")
+	}
+	if c.Uin != a.Uin {
+		// 扫码登录了其他账号，断开该客户端，不将它注册为配置中的账号
+		c.Client.Release()
+		c.stopSignPool()
+		SendBotDisconnectedEvent(c)
+		return nil, fmt.Errorf("扫码登录的账号 %d 与配置中的账号不一致", c.Uin)
+	}
+	return c, nil
+}
+
+// stopSignPool 停止客户端独立使用的签名服务器池，并移除客户端在签名服务器池中的分配
+func (c *CryoClient) stopSignPool() {
+	if pool := c.getSignPool(); pool != nil {
+		pool.Unassign(c.Id)
+	}
+	if c.signPool != nil {
+		c.signPool.Stop()
+	}
+}
+
+// findSavedAccount 在保存的客户端中查找指定账号
+func (b *Bot) findSavedAccount(uin int) (CryoClientInfo, bool, error) {
+	infos, err := b.GetCredentialStore().Load()
+	if err != nil {
+		return CryoClientInfo{}, false, err
+	}
+	for _, info := range infos {
+		if info.Uin == uin {
+			return info, true, nil
+		}
+	}
+	return CryoClientInfo{}, false, nil
+}
+
+// newAccountClient 为账号创建一个新的客户端，账号单独指定了签名服务器时使用独立的签名服务器池
+func (b *Bot) newAccountClient(a AccountConfig) *CryoClient {
+	c := NewCryoClient(b)
+	if len(a.SignServers) > 0 {
+		c.signPool = NewSignPool(b, b.GetConfig().SignPool, a.SignServers...)
+		c.signPool.Start()
+	}
+	c.Init()
+	return c
+}
+
+// applyAccount 将账号配置中的别名、平台和协议版本应用到新的客户端，需要在登录之前调用
+func (c *CryoClient) applyAccount(a AccountConfig) {
+	if a.Alias != "" {
+		c.setAlias(a.Alias)
+	}
+	if a.Platform != "" || a.Version != "" {
+		platform := a.Platform
+		if platform == "" {
+			platform = c.Platform
+		}
+		if platform == c.Platform && a.Version == c.Version {
+			return
+		}
+		if err := c.SetProtocol(platform, a.Version); err != nil {
+			c.log().Errorf("账号 %d 指定的协议版本不可用：%v", a.Uin, err)
+		}
+	}
+}
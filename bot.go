@@ -3,82 +3,260 @@ package cryobot
 import (
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"io"
 	"log"
+	"os"
+	"sync"
 )
 
 type Bot struct {
-	initFlag         bool                   // 是否初始化完成
-	ConnectedClients map[string]*CryoClient // 已连接的Bot客户端集合
+	initFlag bool            // 是否初始化完成
+	Clients  *ClientRegistry // Bot客户端集合
+	Bus      *CryoEventBus   // Bot使用的事件总线
+	Logger   Logger          // Bot使用的日志记录器，为空时使用全局日志记录器
+
+	conf           Config          // Bot的配置
+	prepareOnce    sync.Once       // 保证事件总线与日志记录器只分配一次
+	oneBotServers  []*OneBotServer // 随Bot启动的 OneBot 实现端
+	webhooksMutex  sync.RWMutex
+	webhooks       []*Webhook     // 随Bot启动的出站Webhook
+	webAdmin       *WebAdmin      // 随Bot启动的Web后台
+	manageApi      *ManageApi     // 随Bot启动的管理接口
+	metricsServer  *MetricsServer // 随Bot启动的指标接口
+	metrics        *botMetrics    // Bot的指标注册表
+	logStoreMutex  sync.RWMutex
+	logStore       LogStore       // Bot的日志存储
+	mongoConnector MongoConnector // 配置中使用 mongo 日志存储时连接MongoDB的函数
+	handlersMutex  sync.RWMutex
+	handlers       []*Handler // 已注册到Bot的事件处理器
+	loginsMutex    sync.Mutex
+	logins         map[string]*QRCodeLogin // 在后台进行的扫码登录
+
+	passwordLogins map[string]*PasswordLogin // 在后台进行的密码登录
+
+	qrCodePresenters []QRCodePresenter // 阻塞式扫码登录使用的二维码展示器
+	loginVerifiers   []LoginVerifier   // 阻塞式密码登录使用的登录验证器
+	credentialStore  CredentialStore   // 保存客户端凭据使用的存储
+
+	confMutex       sync.RWMutex
+	configLoader    *ConfigLoader  // 加载配置使用的加载器，在 Init 中确定后不再修改
+	reloadMutex     sync.Mutex     // 保证同时只有一次配置重新加载
+	configWatcher   *ConfigWatcher // 监视配置文件变化的监视器
+	configOverrides []Config       // 调用 Init 时传入的配置，重新加载配置时会覆盖在最上层
+
+	signPool     *SignPool // 所有客户端共用的签名服务器池
+	signPoolOnce sync.Once
+
+	healthMutex sync.Mutex
+	healthStop  chan struct{} // 停止定时健康检查
+
+	accountsMutex sync.RWMutex
+	accounts      []*account // 配置中声明和运行时添加的账号
 }
 
 // NewBot 创建一个新的CryoBot实例
 //
-// 非常不推荐同时创建多个Bot实例，因为事件总线是全局的，如果你实在要这么做那么请确保你知道自己在做什么
+// 每个Bot都拥有各自独立的事件总线和日志记录器，与创建的顺序无关，可以在同一个进程中运行多组相互隔离的Bot，也可以在并行的测试中使用
+// 需要通过包级别的 Subscribe、Publish 等函数操作Bot时，使用 NewDefaultBot
 func NewBot() *Bot {
-	return &Bot{}
+	b := &Bot{}
+	b.prepare()
+	return b
+}
+
+// NewDefaultBot 创建一个使用默认事件总线和全局日志记录器的Bot，包级别的 Subscribe、Publish、Info 等函数都会作用于它
+func NewDefaultBot() *Bot {
+	b := &Bot{Bus: DefaultBus(), Logger: GetLogger()}
+	b.prepare()
+	return b
+}
+
+// prepare 为Bot分配事件总线与日志记录器，已经手动设置的不会被覆盖
+func (b *Bot) prepare() {
+	b.prepareOnce.Do(func() {
+		if b.Bus == nil {
+			b.Bus = NewEventBus()
+		}
+		if b.Logger == nil {
+			l := &CryoLogger{}
+			_ = l.Init()
+			b.Logger = l
+		}
+		b.Bus.SetLogger(b.Logger)
+		b.metrics = newBotMetrics(b)
+		b.Bus.SetMetrics(b.metrics.Metrics)
+		b.conf = DefaultConfig()
+		if b.Clients == nil {
+			b.Clients = NewClientRegistry()
+		}
+		b.Clients.Watch(b.onClientChange)
+	})
+}
+
+// clients 返回Bot的客户端集合
+func (b *Bot) clients() *ClientRegistry {
+	b.prepare()
+	return b.Clients
+}
+
+// bus 返回Bot使用的事件总线
+func (b *Bot) bus() *CryoEventBus {
+	b.prepare()
+	return b.Bus
+}
+
+// log 返回Bot使用的日志记录器
+func (b *Bot) log() Logger {
+	b.prepare()
+	return b.Logger
+}
+
+// GetConfig 返回Bot当前使用的配置
+func (b *Bot) GetConfig() Config {
+	b.prepare()
+	b.confMutex.RLock()
+	defer b.confMutex.RUnlock()
+	return b.conf
 }
 
 // Init 初始化cryobot
 //
-// 可以传入配置项来覆写默认配置，空的配置项会自动使用默认配置
+// 配置按照 默认配置 → 配置文件 → 环境变量 → 传入的配置 的顺序逐层覆盖，空的配置项会自动使用下层的值
 //
-// 如果本地配置文件存在，且没有传入配置项，则会自动加载本地配置文件
+// 配置文件无法解析或配置校验不通过时会直接退出
 func (b *Bot) Init(c ...Config) {
-	defaultConfig := Config{
-		LogLevel:                     logrus.InfoLevel,
-		SignServers:                  []string{DefaultSignServer},
-		EnableClientAutoSave:         true,
-		EnablePrintLogo:              true,
-		EnableConnectPrintMiddleware: true,
-		EnableMessagePrintMiddleware: true,
-		EnableEventDebugMiddleware:   false,
+	b.prepare()
+	b.configOverrides = c
+	if b.configLoader == nil {
+		b.configLoader = NewConfigLoader()
+	}
+	loader := b.configLoader
+	conf, err := loader.Load(c...) // 依次合并默认配置、配置文件、环境变量和传入的配置
+	if err != nil {
+		log.Fatal("加载配置时出现错误：\n", err)
+	}
+	if _, err := os.Stat(loader.GetPath()); err == nil {
+		b.log().Info("已加载配置文件 ", loader.GetPath())
 	}
-	if len(c) == 0 { // 如果没有传入配置项，则尝试加载本地配置文件
-		co, err := ReadCryoConfig()
-		if err == nil {
-			c = append(c, co)
-			Info("已正在加载本地配置文件")
+	b.confMutex.Lock()
+	b.conf = conf // 初始化配置
+	b.confMutex.Unlock()
+
+	// 设置日志等级
+	if cl, ok := b.log().(*CryoLogger); ok {
+		cl.InitTextLogger(b.conf.LogLevel)
+	} else {
+		b.log().Warn("使用了自定义的日志记录器，已跳过默认的终端日志记录器初始化流程")
+	}
+	if b.conf.IsPrintLogoEnabled() {
+		fmt.Print(logo)
+	}
+	b.log().Infof("%s[Cryo] 🧊cryobot 正在初始化...", lavender)
+	b.Bus.SetLogger(b.Logger)
+	// 按照配置重建事件总线的异步工作池
+	b.Bus.SetWorkerPool(WorkerPoolConfig{
+		Workers:        b.conf.AsyncWorkers,
+		QueueSize:      b.conf.AsyncQueueSize,
+		OverflowPolicy: b.conf.AsyncOverflowPolicy,
+		Ordering:       b.conf.AsyncOrdering,
+	})
+	// 设置连接打印中间件
+	b.setConnectPrintMiddleware()
+	// 设置消息打印中间件
+	b.setMessagePrintMiddleware()
+	// 设置事件调试中间件
+	b.setEventDebugMiddleware()
+	// 启动 OneBot 实现端
+	if len(b.oneBotServers) == 0 {
+		if b.conf.OneBotV11.Enable {
+			if _, err := b.StartOneBotV11(b.conf.OneBotV11); err != nil {
+				b.log().Error("启动 OneBot v11 实现端时出现错误：", err)
+			}
+		}
+		if b.conf.OneBotV12.Enable {
+			if _, err := b.StartOneBotV12(b.conf.OneBotV12); err != nil {
+				b.log().Error("启动 OneBot v12 实现端时出现错误：", err)
+			}
 		}
 	}
-	if len(c) > 0 {
-		if c[0].LogLevel != logrus.InfoLevel {
-			defaultConfig.LogLevel = c[0].LogLevel
+	// 启动出站Webhook
+	if len(b.getWebhooks()) == 0 {
+		for _, config := range b.conf.Webhooks {
+			b.AddWebhook(config)
 		}
-		if c[0].SignServers != nil {
-			defaultConfig.SignServers = c[0].SignServers
+	}
+	// 启动Web后台
+	if b.conf.WebAdmin.Enable && b.webAdmin == nil {
+		if _, err := b.StartWebAdmin(b.conf.WebAdmin); err != nil {
+			b.log().Error("启动Web后台时出现错误：", err)
 		}
-		if c[0].EnableClientAutoSave {
-			defaultConfig.EnableClientAutoSave = c[0].EnableClientAutoSave
+	}
+	// 启动管理接口
+	if b.conf.ManageApi.Enable && b.manageApi == nil {
+		if _, err := b.StartManageApi(b.conf.ManageApi); err != nil {
+			b.log().Error("启动管理接口时出现错误：", err)
 		}
-		if c[0].EnablePrintLogo {
-			defaultConfig.EnablePrintLogo = c[0].EnablePrintLogo
+	}
+	// 启动指标接口
+	if b.conf.Metrics.Enable && b.metricsServer == nil {
+		if _, err := b.StartMetricsServer(b.conf.Metrics); err != nil {
+			b.log().Error("启动指标接口时出现错误：", err)
 		}
-		if c[0].EnableConnectPrintMiddleware {
-			defaultConfig.EnableConnectPrintMiddleware = c[0].EnableConnectPrintMiddleware
+	}
+	// 启动签名服务器的健康检查
+	b.GetSignPool().Start()
+	// 启动客户端的健康检查
+	b.StartHealthCheck()
+	// 创建数据目录
+	if err := b.conf.GetDataLayout().Ensure(); err != nil {
+		b.log().Error("创建数据目录时出现错误：", err)
+	}
+	// 启用链路追踪
+	if b.conf.Tracing.Enable && b.GetTracer() == nil {
+		if t, err := NewTracerFromConfig(b.conf.Tracing, b.conf.GetDataLayout()); err != nil {
+			b.log().Error("启用链路追踪时出现错误：", err)
+		} else {
+			b.SetTracer(t)
 		}
-		if c[0].EnableMessagePrintMiddleware {
-			defaultConfig.EnableMessagePrintMiddleware = c[0].EnableMessagePrintMiddleware
+	}
+	// 启用日志存储
+	if b.conf.LogStore.Type != "" && b.GetLogStore() == nil {
+		if store, err := NewLogStoreFromConfig(b.conf.LogStore, b.conf.GetDataLayout(), b.getMongoConnector()); err != nil {
+			b.log().Error("启用日志存储时出现错误：", err)
+		} else {
+			level := logrus.InfoLevel
+			if b.conf.LogStore.Level != "" {
+				level, _ = logrus.ParseLevel(b.conf.LogStore.Level)
+			}
+			b.SetLogStore(store, level)
 		}
-		if c[0].EnableEventDebugMiddleware {
-			defaultConfig.EnableEventDebugMiddleware = c[0].EnableEventDebugMiddleware
+	}
+	// 将未加密的凭据文件迁移为加密存储
+	if s, ok := b.GetCredentialStore().(interface{ Migrate() (bool, error) }); ok {
+		if migrated, err := s.Migrate(); err != nil {
+			b.log().Error("迁移凭据文件时出现错误：", err)
+		} else if migrated {
+			b.log().Infof("%s[Cryo] 已将未加密的客户端凭据迁移为加密存储", lavender)
+		}
+	}
+	// 迁移协议版本已经不可用的客户端
+	b.migrateProtocolVersions()
+	// 创建二维码展示器
+	if len(b.qrCodePresenters) == 0 {
+		for _, config := range b.conf.QRCodeLogin.Presenters {
+			p, err := NewQRCodePresenter(b, config)
+			if err != nil {
+				b.log().Error("创建二维码展示器时出现错误：", err)
+				continue
+			}
+			b.AddQRCodePresenter(p)
 		}
 	}
-	conf = defaultConfig // 初始化配置
 
-	// 设置日志等级
-	InitTextLogger(conf.LogLevel)
-	// 初始化事件总线
-	fmt.Print(logo)
-	Infof("%s[Cryo] 🧊cryobot 正在初始化...", lavender)
-	Bus = NewEventBus() // 初始化事件总线
-	// 初始化连接的客户端集合
-	b.ConnectedClients = make(map[string]*CryoClient)
-	// 设置连接打印中间件
-	setConnectPrintMiddleware()
-	// 设置消息打印中间件
-	setMessagePrintMiddleware()
-	// 设置事件调试中间件
-	setEventDebugMiddleware()
+	// 监视配置文件的变化
+	if b.conf.IsWatchConfigEnabled() {
+		b.WatchConfig()
+	}
 
 	b.initFlag = true
 }
@@ -92,103 +270,217 @@ func (b *Bot) Start() {
 	select {} // 阻塞主线程，运行事件循环
 }
 
+// Close 关闭Bot的事件总线以及随Bot启动的协议实现端、Webhook、Web后台、管理接口、指标接口、二维码页面和链路追踪的导出器，等待已入队的事件处理完成
+//
+// 关闭后Bot将无法再处理异步事件，通常只在测试或需要释放资源时调用
+func (b *Bot) Close() {
+	b.StopHealthCheck()
+	for _, s := range b.oneBotServers {
+		s.Stop()
+	}
+	for _, w := range b.getWebhooks() {
+		w.Close()
+	}
+	if b.webAdmin != nil {
+		b.webAdmin.Stop()
+	}
+	if b.manageApi != nil {
+		b.manageApi.Stop()
+	}
+	if b.metricsServer != nil {
+		b.metricsServer.Stop()
+	}
+	for _, p := range b.qrCodePresenters {
+		if closer, ok := p.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+	b.bus().Close()
+	if t := b.GetTracer(); t != nil {
+		t.Close()
+	}
+	if store := b.GetLogStore(); store != nil {
+		b.SetLogStore(nil)
+		if closer, ok := store.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+}
+
 // AutoConnect 自动连接
+//
+// 配置中声明了账号时并发连接所有启用的账号，否则依次尝试连接已保存的客户端和扫码登录新的客户端
+// 所有客户端都连接失败时只会记录错误，不会退出进程，可以之后通过 AddAccount 或管理接口继续添加
 func (b *Bot) AutoConnect() {
 	if !b.initFlag {
 		// 没有进行初始化
 		log.Fatal("cryobot 没有进行初始化，请先调用 Init() 函数进行初始化！")
 	}
 	// 首先检测是否已经连接
-	if len(b.ConnectedClients) > 0 {
+	if b.clients().Len(ClientOnline) > 0 {
 		// 跳过自动连接
 		return
 	}
+	if len(b.GetConfig().Accounts) > 0 {
+		online := b.ConnectAccounts()
+		b.log().Infof("%s[Cryo] 账号连接完成，已连接 %d 个账号", lavender, online)
+		if online == 0 {
+			b.log().Error("配置中的账号均未连接成功，请检查网络或配置文件")
+		}
+		return
+	}
 	// 尝试连接所有已保存的bot客户端
 	b.ConnectAllSavedClient()
 	// 如果没有连接成功，则尝试连接新的bot客户端
 	retriedCount := 0
-	for len(b.ConnectedClients) == 0 && retriedCount < 3 {
+	for b.clients().Len(ClientOnline) == 0 && retriedCount < 3 {
 		b.ConnectNewClient()
 		retriedCount++
 	}
-	if len(b.ConnectedClients) == 0 {
-		log.Fatal("达到最大重试次数，cryobot 无法连接到bot客户端，请检查网络或配置文件")
+	if b.clients().Len(ClientOnline) == 0 {
+		b.log().Error("达到最大重试次数，cryobot 无法连接到bot客户端，请检查网络或配置文件")
+	}
+}
+
+// addConnectedClient 将已经登录成功的客户端加入客户端集合
+func (b *Bot) addConnectedClient(c *CryoClient) {
+	b.clients().Add(c, ClientOnline)
+}
+
+// connectClient 将客户端以 connecting 状态加入客户端集合后登录，登录成功时标记为 online，失败时移出集合
+//
+// 客户端正在重新登录时保持 reconnecting 状态
+func (b *Bot) connectClient(c *CryoClient, login func() bool) bool {
+	status := ClientConnecting
+	if old, ok := b.clients().GetStatus(c.Id); ok && old == ClientReconnecting {
+		status = ClientReconnecting
+	}
+	b.clients().Add(c, status)
+	if !login() {
+		c.stopSignPool()
+		b.clients().Remove(c.Id)
+		return false
+	}
+	b.clients().SetStatus(c.Id, ClientOnline)
+	return true
+}
+
+// onClientChange 客户端集合变化时同步更新配置中账号的状态
+func (b *Bot) onClientChange(change ClientChange) {
+	c := change.Client
+	switch {
+	case change.Removed || change.Status == ClientOffline:
+		b.setAccountState(c.Uin, AccountOffline, "", nil)
+	case change.Status == ClientOnline:
+		b.setAccountState(c.Uin, AccountOnline, c.Id, nil)
+		b.setAccountNickname(c.Uin, c.GetNickname())
+	case change.Status == ClientReconnecting:
+		b.setAccountState(c.Uin, AccountConnecting, c.Id, nil)
 	}
 }
 
 // ConnectSavedClient 尝试查询并连接到指定的bot客户端
 func (b *Bot) ConnectSavedClient(info CryoClientInfo) bool {
-	c := NewCryoClient()
+	c := NewCryoClient(b)
 	c.Init()
 	if !c.Rebuild(info) {
 		return false
 	}
-	Infof("%s[Cryo] 正在连接 %s：%s (%d)", lavender, c.Nickname, c.Id, c.Uin)
-	if !c.SignatureLogin() {
-		return false
-	}
-	b.ConnectedClients[c.Id] = c
-	return true
+	b.log().Infof("%s[Cryo] 正在连接 %s：%s (%d)", lavender, c.GetDisplayName(), c.Id, c.Uin)
+	return b.connectClient(c, func() bool {
+		if c.SignatureLogin() {
+			return true
+		}
+		// 签名失效时，如果保存了密码则尝试使用密码登录
+		if !c.HasPassword() {
+			return false
+		}
+		b.log().Infof("%s[Cryo] 签名登录失败，正在使用保存的密码登录 %d", lavender, c.Uin)
+		c.usePasswordMD5(c.Uin, c.passwordMD5)
+		return c.PasswordLogin()
+	})
 }
 
 // ConnectNewClient 尝试连接一个新的bot客户端
 func (b *Bot) ConnectNewClient() bool {
-	c := NewCryoClient()
+	c := NewCryoClient(b)
 	c.Init()
-	Infof("%s[Cryo] 正在连接 %s：%s (%d)", lavender, c.Nickname, c.Id, c.Uin)
-	if !c.QRCodeLogin() {
-		return false
+	b.log().Infof("%s[Cryo] 正在连接 %s：%s (%d)", lavender, c.GetDisplayName(), c.Id, c.Uin)
+	return b.connectClient(c, c.QRCodeLogin)
+}
+
+// DisconnectClient 断开指定ID的bot客户端并将其从已连接的客户端集合中移除，forget 为true时同时删除保存的客户端信息
+func (b *Bot) DisconnectClient(id string, forget bool) error {
+	c := b.GetClientById(id)
+	if c == nil {
+		return fmt.Errorf("找不到客户端：%s", id)
 	}
-	b.ConnectedClients[c.Id] = c
-	return true
+	c.Client.Release()
+	c.stopSignPool()
+	b.clients().Remove(id)
+	SendBotDisconnectedEvent(c)
+	b.log().Infof("%s[Cryo] 已断开 %s：%s (%d)", lavender, c.GetDisplayName(), c.Id, c.Uin)
+	if forget {
+		return b.GetCredentialStore().Remove(id)
+	}
+	return nil
+}
+
+// ReloginClient 断开指定ID的bot客户端，并使用它当前的签名重新登录
+func (b *Bot) ReloginClient(id string) error {
+	c := b.GetClientById(id)
+	if c == nil {
+		return fmt.Errorf("找不到客户端：%s", id)
+	}
+	info := c.GetClientInfo()
+	b.clients().SetStatus(id, ClientReconnecting)
+	c.Client.Release()
+	c.stopSignPool()
+	SendBotDisconnectedEvent(c)
+	if !b.ConnectSavedClient(info) {
+		return fmt.Errorf("重新登录失败，请重新扫码登录")
+	}
+	return nil
 }
 
 // ConnectAllSavedClient 尝试连接所有已保存的bot客户端
 func (b *Bot) ConnectAllSavedClient() {
 	// 读取历史连接的客户端
-	clientInfos, err := ReadClientInfos()
+	clientInfos, err := b.GetCredentialStore().Load()
 	if err != nil {
-		Error("读取Bot信息时出现错误：", err)
+		b.log().Error("读取Bot信息时出现错误：", err)
 		return
 	}
 	if len(clientInfos) == 0 {
-		Info("没有找到Bot信息")
+		b.log().Info("没有找到Bot信息")
 		return
 	}
 	for _, info := range clientInfos {
 		if !b.ConnectSavedClient(info) {
-			Error("通过历史记录连接Bot客户端失败")
-			Error("已自动清除失效的客户端信息，请重新登录")
+			b.log().Error("通过历史记录连接Bot客户端失败")
+			b.log().Error("已自动清除失效的客户端信息，请重新登录")
 		}
 	}
 }
 
 // GetClientById 获取指定ID的bot客户端
 func (b *Bot) GetClientById(id string) *CryoClient {
-	if client, ok := b.ConnectedClients[id]; ok {
-		return client
-	}
-	return nil
+	return b.clients().Get(id)
 }
 
 // GetClientByUin 获取指定Uin的bot客户端
 func (b *Bot) GetClientByUin(uin int) *CryoClient {
-	for _, client := range b.ConnectedClients {
-		if client.Uin == uin {
-			return client
-		}
-	}
-	return nil
+	return b.clients().GetByUin(uin)
 }
 
 // GetClientByUid 获取指定Uid的bot客户端
 func (b *Bot) GetClientByUid(uid string) *CryoClient {
-	for _, client := range b.ConnectedClients {
-		if client.Uid == uid {
-			return client
-		}
-	}
-	return nil
+	return b.clients().GetByUid(uid)
+}
+
+// GetClients 返回所有已登录的bot客户端，按照QQ号排序
+func (b *Bot) GetClients() []*CryoClient {
+	return b.clients().List(ClientOnline)
 }
 
 // GetClient 获取指定事件对应的bot客户端
@@ -0,0 +1,150 @@
+package cryobot
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 内置指标
+//
+// 事件总线记录收到的事件、处理器的耗时与错误以及异步工作池的队列状态，Bot记录消息发送、登录尝试、客户端数量和协程数量
+// 所有指标都以 cryobot_ 开头，bot 标签为客户端的QQ号
+// handler 标签为处理器或中间件的ID，每个处理器都有各自的序列，tags 标签为处理器的标签使用逗号连接的结果，便于按标签聚合
+
+// busMetrics 事件总线记录的指标
+type busMetrics struct {
+	events          *CounterVec
+	handlerDuration *HistogramVec
+	handlerErrors   *CounterVec
+}
+
+// SetMetrics 设置事件总线记录指标使用的注册表，为nil时不再记录指标
+func (bus *CryoEventBus) SetMetrics(m *Metrics) {
+	if m == nil {
+		bus.metrics = nil
+		return
+	}
+	m.NewGaugeFunc("cryobot_async_workers", "异步事件工作协程的数量", func(emit func(float64, ...string)) {
+		emit(float64(bus.Stats().Workers))
+	})
+	m.NewGaugeFunc("cryobot_async_queue_capacity", "异步事件队列的总容量", func(emit func(float64, ...string)) {
+		emit(float64(bus.Stats().QueueCapacity))
+	})
+	m.NewGaugeFunc("cryobot_async_queue_depth", "异步事件队列中等待处理的事件数", func(emit func(float64, ...string)) {
+		emit(float64(bus.Stats().QueueDepth))
+	})
+	m.NewCounterFunc("cryobot_async_events_submitted", "提交到异步事件队列的事件数", func(emit func(float64, ...string)) {
+		emit(float64(bus.Stats().Submitted))
+	})
+	m.NewCounterFunc("cryobot_async_events_processed", "异步事件队列中已处理完成的事件数", func(emit func(float64, ...string)) {
+		emit(float64(bus.Stats().Processed))
+	})
+	m.NewCounterFunc("cryobot_async_events_dropped", "因异步事件队列已满而被丢弃的事件数", func(emit func(float64, ...string)) {
+		emit(float64(bus.Stats().Dropped))
+	})
+	bus.metrics = &busMetrics{
+		events:          m.NewCounter("cryobot_events_received", "事件总线收到的事件数", "type", "bot"),
+		handlerDuration: m.NewHistogram("cryobot_handler_duration_seconds", "事件处理器每次调用的耗时", nil, "handler", "tags"),
+		handlerErrors:   m.NewCounter("cryobot_handler_errors", "事件处理器和中间件返回错误或出现panic的次数", "handler", "tags", "source"),
+	}
+}
+
+// observeEvent 记录收到了一个事件
+func (m *busMetrics) observeEvent(event CryoEvent) {
+	if m == nil {
+		return
+	}
+	m.events.Inc(eventTypeName(event), uinLabel(int(event.GetBaseEvent().BotUin)))
+}
+
+// observeHandler 记录一次处理器调用的耗时
+func (m *busMetrics) observeHandler(id string, tags []string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.handlerDuration.Observe(duration.Seconds(), id, strings.Join(tags, ","))
+}
+
+// observeError 记录一次处理器或中间件的错误
+func (m *busMetrics) observeError(id string, tags []string, source string) {
+	if m == nil {
+		return
+	}
+	m.handlerErrors.Inc(id, strings.Join(tags, ","), source)
+}
+
+// botMetrics Bot的指标注册表以及Bot记录的指标
+type botMetrics struct {
+	*Metrics
+	messagesSent  *CounterVec
+	loginAttempts *CounterVec
+}
+
+// newBotMetrics 创建Bot的指标注册表并注册Bot记录的指标
+func newBotMetrics(b *Bot) *botMetrics {
+	m := NewMetrics()
+	m.NewGaugeFunc("cryobot_clients", "各个状态的客户端数量", func(emit func(float64, ...string)) {
+		for _, status := range []ClientStatus{ClientConnecting, ClientOnline, ClientOffline, ClientReconnecting} {
+			emit(float64(b.clients().Len(status)), string(status))
+		}
+	}, "status")
+	m.NewGaugeFunc("cryobot_goroutines", "当前进程中的协程数量", func(emit func(float64, ...string)) {
+		emit(float64(runtime.NumGoroutine()))
+	})
+	return &botMetrics{
+		Metrics:       m,
+		messagesSent:  m.NewCounter("cryobot_messages_sent", "客户端发送消息的次数", "bot", "type", "result"),
+		loginAttempts: m.NewCounter("cryobot_login_attempts", "客户端尝试登录的次数", "bot", "method", "result"),
+	}
+}
+
+// GetMetrics 返回Bot的指标注册表，可以在其中注册自定义的指标
+func (b *Bot) GetMetrics() *Metrics {
+	b.prepare()
+	return b.metrics.Metrics
+}
+
+// recordSend 记录一次消息发送的结果，kind 为 private / group / temp
+func (c *CryoClient) recordSend(kind string, err error) {
+	c.health.recordSend(err)
+	if c.bot != nil {
+		c.bot.prepare()
+		c.bot.metrics.messagesSent.Inc(uinLabel(c.Uin), kind, resultLabel(err == nil))
+	}
+}
+
+// recordLogin 记录一次登录尝试的结果，method 为 signature / password / qrcode
+func (c *CryoClient) recordLogin(method string, ok bool) {
+	if c.bot != nil {
+		c.bot.prepare()
+		c.bot.metrics.loginAttempts.Inc(uinLabel(c.Uin), method, resultLabel(ok))
+	}
+}
+
+// eventTypeName 返回事件的类型名，如 GroupMessageEvent
+func eventTypeName(event CryoEvent) string {
+	t := reflect.TypeOf(event)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// uinLabel 将QQ号转换为标签值，为0时返回空字符串
+func uinLabel(uin int) string {
+	if uin == 0 {
+		return ""
+	}
+	return strconv.Itoa(uin)
+}
+
+// resultLabel 将结果转换为标签值
+func resultLabel(ok bool) string {
+	if ok {
+		return "success"
+	}
+	return "failure"
+}
@@ -0,0 +1,56 @@
+package cryobot
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// countingHandler 记录收到的事件数量的处理器
+type countingHandler struct {
+	id    string
+	count atomic.Int64
+}
+
+func (h *countingHandler) GetType() CryoEventType { return CustomEventType }
+func (h *countingHandler) GetId() string          { return h.id }
+func (h *countingHandler) GetTags() []string      { return nil }
+func (h *countingHandler) Handle(CryoEvent) error {
+	h.count.Add(1)
+	return nil
+}
+
+func TestBotIsolation(t *testing.T) {
+	if NewBot().Bus == NewBot().Bus {
+		t.Fatal("两个Bot共用了同一个事件总线")
+	}
+	if NewBot().Logger == NewBot().Logger {
+		t.Fatal("两个Bot共用了同一个日志记录器")
+	}
+	if b := NewDefaultBot(); b.Bus != DefaultBus() || b.Logger != GetLogger() {
+		t.Fatal("NewDefaultBot 没有使用默认的事件总线和全局日志记录器")
+	}
+
+	tests := []struct {
+		name   string
+		events int
+	}{
+		{name: "bot-a", events: 1},
+		{name: "bot-b", events: 5},
+		{name: "bot-c", events: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b := NewBot()
+			h := &countingHandler{id: tt.name}
+			b.Bus.Subscribe(h)
+			for i := range tt.events {
+				b.Bus.Publish(CustomEvent{BaseEvent: BaseEvent{EventId: fmt.Sprintf("%s-%d", tt.name, i)}})
+			}
+			if got := h.count.Load(); got != int64(tt.events) {
+				t.Errorf("收到了 %d 个事件，want %d", got, tt.events)
+			}
+		})
+	}
+}
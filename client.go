@@ -1,11 +1,15 @@
 package cryobot
 
 import (
+	"crypto/md5"
 	"encoding/base64"
 	"fmt"
 	"github.com/LagrangeDev/LagrangeGo/client"
 	"github.com/LagrangeDev/LagrangeGo/client/auth"
+	"github.com/LagrangeDev/LagrangeGo/message"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -16,82 +20,190 @@ type CryoClient struct {
 	Platform  string
 	Version   string
 	DeviceNum int
+	Device    *auth.DeviceInfo // 设备信息，会随客户端信息一起保存，保证重新登录时使用同一台设备
 	Uin       int
 	Uid       string
-	Nickname  string
+	Nickname  string // 账号的QQ昵称，登录成功后从服务器同步，登录后请通过 GetNickname 读取
+	Alias     string // 显示别名，为空时显示QQ昵称，详见 GetDisplayName，登录后请通过 GetAlias 读取
+	Avatar    string // 账号的头像地址，登录后请通过 GetAvatar 读取
 
-	initFlag bool // 是否初始化完成
+	ConnectedAt time.Time // 客户端登录成功的时间
+
+	initFlag    bool      // 是否初始化完成
+	bot         *Bot      // 客户端所属的Bot
+	passwordMD5 [16]byte  // 密码登录使用的密码的MD5
+	signPool    *SignPool // 客户端独立使用的签名服务器池，为空时使用Bot的签名服务器池
+	health      clientHealth
+
+	profileMutex sync.RWMutex // 保护 Nickname、Alias 和 Avatar，它们会在登录后被更新，同时被管理接口等读取
 }
 
 // NewCryoClient 创建一个新的CryoClient实例
-func NewCryoClient() *CryoClient {
-	return &CryoClient{}
+//
+// 可以传入客户端所属的Bot，客户端会使用该Bot的事件总线、配置和日志记录器，没有传入时使用默认的事件总线、配置和全局日志记录器
+func NewCryoClient(bot ...*Bot) *CryoClient {
+	c := &CryoClient{}
+	if len(bot) > 0 {
+		c.bot = bot[0]
+	}
+	return c
+}
+
+// bus 返回客户端发布事件使用的事件总线
+func (c *CryoClient) bus() *CryoEventBus {
+	if c.bot != nil {
+		return c.bot.bus()
+	}
+	return DefaultBus()
+}
+
+// config 返回客户端使用的配置
+func (c *CryoClient) config() Config {
+	if c.bot != nil {
+		return c.bot.GetConfig()
+	}
+	return DefaultConfig()
+}
+
+// log 返回客户端使用的日志记录器
+func (c *CryoClient) log() FieldLogger {
+	if c.bot != nil {
+		return LoggerWithFields(c.bot.log(), c.clientFields())
+	}
+	return LoggerWithFields(GetLogger(), c.clientFields())
 }
 
 // Init 初始化一个新的CryoClient客户端
 func (c *CryoClient) Init() {
 	c.Id = NewUUID() // 给Bot客户端分配一个唯一的UUID
 
-	// 默认平台和版本
+	// 没有指定平台和版本时使用配置中的默认值
 	if c.Platform == "" {
-		c.Platform = "linux"
+		c.Platform, c.Version = c.config().Protocol.Select(0)
 	}
 	if c.Version == "" {
-		c.Version = "3.2.15-30366"
+		c.Version = DefaultVersion(c.Platform)
 	}
 
-	appInfo := auth.AppList[c.Platform][c.Version]
-	c.Client = client.NewClient(0, "")
-	c.Client.SetLogger(pLogger) // 替换日志记录器，详见client/protocol_logger.go以及log/logger.go
-	c.Client.UseVersion(appInfo)
-	c.Client.AddSignServer(conf.SignServers...)
 	c.DeviceNum = RandomDeviceNumber()
-	c.Client.UseDevice(auth.NewDeviceInfo(c.DeviceNum))
-	c.Nickname = newNickname() // 生成一个默认的编号昵称
+	c.Device = auth.NewDeviceInfo(c.DeviceNum)
+	c.newQQClient(0, md5.Sum(nil))
 
 	c.initFlag = true
 }
 
+// newQQClient 使用当前的平台、版本和设备创建底层的协议客户端
+func (c *CryoClient) newQQClient(uin uint32, passwordMD5 [16]byte) {
+	c.Client = client.NewClientMD5(uin, passwordMD5)
+	c.Client.SetLogger(c.protocolLogger()) // 替换日志记录器，详见client/protocol_logger.go以及log/logger.go
+	c.Client.UseVersion(c.appInfo())
+	if c.signPool != nil {
+		c.Client.UseSignProvider(c.signPool.Provider(c)) // 使用账号单独指定的签名服务器
+	} else if c.bot != nil {
+		c.Client.UseSignProvider(c.bot.GetSignPool().Provider(c)) // 使用Bot的签名服务器池
+	} else {
+		c.Client.AddSignServer(c.config().SignServers...)
+	}
+	c.Client.UseDevice(c.Device)
+}
+
+// protocolLogger 创建协议层使用的日志记录器，错误会被转储到数据目录下该客户端的目录中
+func (c *CryoClient) protocolLogger() ProtocolLogger {
+	return NewProtocolLogger(c.log(), c.config().GetDataLayout().DumpDir(c.Id))
+}
+
 // Rebuild 重新构建CryoClient实例
 func (c *CryoClient) Rebuild(clientInfo CryoClientInfo) bool {
 	if !c.initFlag {
-		Error("cryobot客户端没有完成初始化，请先调用Init()方法")
+		c.log().Error("cryobot客户端没有完成初始化，请先调用Init()方法")
 		return false
 	}
 	var sig string
+	platform, version := clientInfo.Platform, clientInfo.Version
+	if platform == "" {
+		platform, version = DefaultPlatform, DefaultProtocolVersion
+	}
+	if _, err := ResolveAppInfo(platform, version); err != nil {
+		// 保存的协议版本已经被移除，按照配置迁移到新的版本
+		p, v, ok := c.config().Protocol.Migrate(platform, version)
+		if !ok {
+			c.log().Errorf("无法恢复客户端 %s：%v", clientInfo.Id, err)
+			return false
+		}
+		c.log().Warnf("客户端 %s 使用的协议版本 %s/%s 已不可用，已迁移到 %s/%s，保存的签名可能失效", clientInfo.Id, platform, version, p, v)
+		platform, version = p, v
+	}
 	c.Id = clientInfo.Id
-	c.Platform = clientInfo.Platform
-	c.Version = clientInfo.Version
+	c.Platform = platform
+	c.Version = version
 	c.DeviceNum = clientInfo.DeviceNum
+	c.Device = clientInfo.Device
+	if c.Device == nil { // 旧版本保存的客户端信息中没有设备信息，根据设备编号生成
+		c.Device = auth.NewDeviceInfo(c.DeviceNum)
+	}
 	c.Uin = clientInfo.Uin
 	c.Uid = clientInfo.Uid
+	c.profileMutex.Lock()
+	c.Nickname = clientInfo.Nickname
+	if clientInfo.Alias != "" {
+		c.Alias = clientInfo.Alias
+	}
+	c.profileMutex.Unlock()
 	sig = clientInfo.Signature
-	c.Client.UseDevice(auth.NewDeviceInfo(c.DeviceNum))
-	c.Client.UseVersion(auth.AppList[c.Platform][c.Version])
-	c.UseSignature(sig) // 使用指定的签名信息
+	c.Client.UseDevice(c.Device)
+	c.Client.UseVersion(c.appInfo())
+	c.Client.SetLogger(c.protocolLogger()) // 客户端ID已经改变，重新设置错误转储目录
+	c.UseSignature(sig)                    // 使用指定的签名信息
+	if clientInfo.Password != "" {
+		if key := c.config().credentialKey(); key == "" {
+			c.log().Warn("客户端信息中保存了密码，但没有设置用于解密的 CredentialKey")
+		} else if data, err := decryptCredential(key, clientInfo.Password); err != nil || len(data) != 16 {
+			c.log().Error("解密保存的密码时出现错误：", err)
+		} else {
+			c.passwordMD5 = [16]byte(data)
+		}
+	}
 	return true
 }
 
 // Save 将当前客户端的信息保存到文件中
 func (c *CryoClient) Save() error {
+	if c.bot != nil {
+		return c.bot.GetCredentialStore().Put(c.GetClientInfo())
+	}
+	return SaveClientInfo(c.GetClientInfo())
+}
+
+// GetClientInfo 返回当前客户端用于保存和重新登录的信息，设置了 CredentialKey 时会带上加密后的密码
+func (c *CryoClient) GetClientInfo() CryoClientInfo {
 	clientInfo := CryoClientInfo{
 		Id:        c.Id,
 		Signature: c.GetSignature(),
 		Platform:  c.Platform,
 		Version:   c.Version,
 		DeviceNum: c.DeviceNum,
+		Device:    c.Device,
 		Uin:       c.Uin,
 		Uid:       c.Uid,
+		Nickname:  c.GetNickname(),
+		Alias:     c.GetAlias(),
+	}
+	if key := c.config().credentialKey(); key != "" && c.HasPassword() {
+		password, err := encryptCredential(key, c.passwordMD5[:])
+		if err != nil {
+			c.log().Error("加密密码时出现错误：", err)
+		} else {
+			clientInfo.Password = password
+		}
 	}
-	err := SaveClientInfo(clientInfo)
-	return err
+	return clientInfo
 }
 
 // GetSignature 获取当前客户端的签名信息
 func (c *CryoClient) GetSignature() string {
 	data, err := c.Client.Sig().Marshal()
 	if err != nil {
-		Error("序列化签名时出现错误：", err)
+		c.log().Error("序列化签名时出现错误：", err)
 		return ""
 	}
 	// 将二进制的签名直接编码到字符串
@@ -104,13 +216,13 @@ func (c *CryoClient) UseSignature(sig string) {
 	// 将字符串解码为二进制
 	data, err := base64.StdEncoding.DecodeString(sig)
 	if err != nil {
-		Error("解码签名时出现错误：", err)
+		c.log().Error("解码签名时出现错误：", err)
 		return
 	}
 	// 反序列化签名
 	sigInfo, err := auth.UnmarshalSigInfo(data, true)
 	if err != nil {
-		Error("反序列化签名时出现错误：", err)
+		c.log().Error("反序列化签名时出现错误：", err)
 		return
 	}
 	c.Client.UseSig(sigInfo)
@@ -120,18 +232,42 @@ func (c *CryoClient) AfterLogin() {
 	// 登录成功后，保存签名
 	c.Uin = int(c.Client.Sig().Uin)
 	c.Uid = c.Client.Sig().UID
-	SendBotConnectedEvent(c)       // 发送登录成功事件
-	if conf.EnableClientAutoSave { // 如果启用了自动保存
-		err := c.Save()
-		if err != nil {
-			Error("保存登录信息时出现错误：", err)
-		} // 保存登录信息
+	c.ConnectedAt = time.Now()
+	if nickname := c.Client.NickName(); nickname != "" {
+		c.setNickname(nickname)
+	}
+	if err := c.SyncProfile(); err != nil { // 同步账号的QQ昵称和头像
+		c.log().Warnf("[Cryo] 同步 %d 的资料时出现错误：%v", c.Uin, err)
 	}
+	SendBotConnectedEvent(c) // 发送登录成功事件
+	c.autoSave()             // 如果启用了自动保存，保存登录信息
 
 	// 订阅事件
 	EventBind(c)
 }
 
+// GetUptime 返回客户端自登录成功以来的运行时长，尚未登录时返回0
+func (c *CryoClient) GetUptime() time.Duration {
+	if c.ConnectedAt.IsZero() {
+		return 0
+	}
+	return time.Since(c.ConnectedAt)
+}
+
+// GetStatus 返回客户端在所属Bot的客户端集合中的状态，不在集合中时返回空字符串
+func (c *CryoClient) GetStatus() ClientStatus {
+	if c.bot == nil {
+		return ""
+	}
+	status, _ := c.bot.clients().GetStatus(c.Id)
+	return status
+}
+
+// IsOnline 返回客户端当前是否在线
+func (c *CryoClient) IsOnline() bool {
+	return c.Client != nil && c.Client.Online.Load()
+}
+
 // GetQRCode 获取二维码信息
 func (c *CryoClient) GetQRCode() ([]byte, string, error) {
 	code, res, err := c.Client.FetchQRCodeDefault()
@@ -141,13 +277,16 @@ func (c *CryoClient) GetQRCode() ([]byte, string, error) {
 
 // SaveQRCode 保存二维码图片
 func (c *CryoClient) SaveQRCode(code []byte) bool {
-	qrcodePath := fmt.Sprintf("QRCode_%s.png", c.Id)
-	err := os.WriteFile(qrcodePath, code, 0644)
+	qrcodePath := c.config().GetDataLayout().QRCodeFile(c.Id)
+	err := os.MkdirAll(filepath.Dir(qrcodePath), 0755)
+	if err == nil {
+		err = os.WriteFile(qrcodePath, code, 0644)
+	}
 	if err != nil {
-		Error("写入二维码图片时出现错误：", err)
+		c.log().Error("写入二维码图片时出现错误：", err)
 		return false
 	}
-	Infof("登录二维码已保存到 %s", qrcodePath)
+	c.log().Infof("登录二维码已保存到 %s", qrcodePath)
 	return true
 }
 
@@ -162,56 +301,34 @@ func (c *CryoClient) SignatureLogin() (ok bool) {
 	sig := c.Client.Sig()
 	if sig != nil {
 		err := c.Client.FastLogin()
+		c.recordLogin("signature", err == nil)
 		if err == nil {
 			// 通过保存的签名快速登录成功
 			c.AfterLogin()
 			return true
 		}
+		c.warnIfSignUnavailable()
 	}
 	return false
 }
 
 // QRCodeLogin 使用二维码登录
+//
+// 二维码会交给Bot上添加的所有二维码展示器，没有所属的Bot或没有添加展示器时在终端打印二维码并保存到工作目录，二维码过期后会按照配置自动刷新
 func (c *CryoClient) QRCodeLogin() bool {
-	Info("正在使用二维码登录...")
-	code, url, err := c.GetQRCode()
+	c.log().Info("正在使用二维码登录...")
+	presenters := []QRCodePresenter{TerminalQRCodePresenter{}, FileQRCodePresenter{}}
+	if c.bot != nil {
+		presenters = c.bot.getQRCodePresenters()
+	}
+	login, err := newQRCodeLogin(c, presenters)
 	if err != nil {
-		Error("获取二维码时出现错误：", err)
+		c.log().Error("获取二维码时出现错误：", err)
 		return false
 	}
-	// 保存二维码图片
-	c.SaveQRCode(code)
-	// 向终端输出二维码
-	c.PrintQRCode(url)
-	if !c.watingForLoginResult() { // 等待扫码登录
-		Warn("扫码登录失败！")
-	}
-	c.AfterLogin()
-	return true
-}
-
-// watingForLoginResult 等待扫码登录结果
-func (c *CryoClient) watingForLoginResult() bool {
-	//轮询登录状态
-	for {
-		retCode, err := c.Client.GetQRCodeResult()
-		if err != nil {
-			Error("获取二维码登录结果时出现错误：", err)
-			return false
-		}
-		// 等待扫码
-		if retCode.Waitable() {
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		if !retCode.Success() {
-			return false
-		}
-		break
-	}
-	_, err := c.Client.QRCodeLogin()
-	if err != nil {
-		Error("二维码登录时出现错误：", err)
+	if !login.wait() { // 等待扫码登录
+		c.log().Warn("扫码登录失败！")
+		c.warnIfSignUnavailable()
 		return false
 	}
 	return true
@@ -220,9 +337,9 @@ func (c *CryoClient) watingForLoginResult() bool {
 // SendPrivateMessage 发送私聊消息
 func (c *CryoClient) SendPrivateMessage(userUin uint32, msg *CryoMessage) (ok bool, messageId uint32) {
 	// 发送私聊消息
-	message, err := c.Client.SendPrivateMessage(userUin, msg.ToIMessageElements())
+	message, err := c.sendPrivateMessage(userUin, msg)
 	if err != nil {
-		Errorf("向用户 %d 发送消息时出现错误：%v", userUin, err)
+		c.log().Errorf("向用户 %d 发送消息时出现错误：%v", userUin, err)
 		return false, 0
 	}
 	return true, message.ID
@@ -231,9 +348,9 @@ func (c *CryoClient) SendPrivateMessage(userUin uint32, msg *CryoMessage) (ok bo
 // SendGroupMessage 发送群消息
 func (c *CryoClient) SendGroupMessage(groupUin uint32, msg *CryoMessage) (ok bool, messageId uint32) {
 	// 发送群消息
-	message, err := c.Client.SendGroupMessage(groupUin, msg.ToIMessageElements())
+	message, err := c.sendGroupMessage(groupUin, msg)
 	if err != nil {
-		Errorf("向群 %d 发送消息时出现错误：%v", groupUin, err)
+		c.log().Errorf("向群 %d 发送消息时出现错误：%v", groupUin, err)
 		return false, 0
 	}
 	return true, message.ID
@@ -242,17 +359,53 @@ func (c *CryoClient) SendGroupMessage(groupUin uint32, msg *CryoMessage) (ok boo
 // SendTempMessage 发送临时消息
 func (c *CryoClient) SendTempMessage(groupUin, userUin uint32, msg *CryoMessage) (ok bool, messageId uint32) {
 	// 发送临时消息
-	message, err := c.Client.SendTempMessage(groupUin, userUin, msg.ToIMessageElements())
+	message, err := c.sendTempMessage(groupUin, userUin, msg)
 	if err != nil {
-		Errorf("向与用户 %d 的临时会话发送消息时出现错误：%v", groupUin, err)
+		c.log().Errorf("向与用户 %d 的临时会话发送消息时出现错误：%v", groupUin, err)
 		return false, 0
 	}
 	return true, message.ID
 }
 
+// sendPrivateMessage 发送私聊消息，返回LagrangeGo的完整消息回执
+func (c *CryoClient) sendPrivateMessage(userUin uint32, msg *CryoMessage) (*message.PrivateMessage, error) {
+	span := c.startSendSpan("private", userUin, msg)
+	m, err := c.Client.SendPrivateMessage(userUin, msg.ToIMessageElements())
+	if err == nil && m == nil {
+		err = fmt.Errorf("消息发送失败")
+	}
+	c.recordSend("private", err)
+	span.End(err)
+	return m, err
+}
+
+// sendGroupMessage 发送群消息，返回LagrangeGo的完整消息回执
+func (c *CryoClient) sendGroupMessage(groupUin uint32, msg *CryoMessage) (*message.GroupMessage, error) {
+	span := c.startSendSpan("group", groupUin, msg)
+	m, err := c.Client.SendGroupMessage(groupUin, msg.ToIMessageElements())
+	if err == nil && m == nil {
+		err = fmt.Errorf("消息发送失败")
+	}
+	c.recordSend("group", err)
+	span.End(err)
+	return m, err
+}
+
+// sendTempMessage 发送临时消息，返回LagrangeGo的完整消息回执
+func (c *CryoClient) sendTempMessage(groupUin, userUin uint32, msg *CryoMessage) (*message.TempMessage, error) {
+	span := c.startSendSpan("temp", userUin, msg)
+	m, err := c.Client.SendTempMessage(groupUin, userUin, msg.ToIMessageElements())
+	if err == nil && m == nil {
+		err = fmt.Errorf("消息发送失败")
+	}
+	c.recordSend("temp", err)
+	span.End(err)
+	return m, err
+}
+
 func (c *CryoClient) Send(event CryoMessageEvent, args ...interface{}) (ok bool, messageId uint32) {
 	// 处理消息内容
-	m := ProcessMessageContent(args...)
+	m := ProcessMessageContent(args...).traceFrom(c.bus().GetTracer(), event)
 	// 根据传入的事件来发送消息
 	switch event.Type() {
 	case PrivateMessageEventType:
@@ -283,14 +436,14 @@ func (c *CryoClient) Send(event CryoMessageEvent, args ...interface{}) (ok bool,
 			}
 		}
 	default:
-		Error("发送消息时传入了不支持的消息事件")
+		c.log().Error("发送消息时传入了不支持的消息事件")
 	}
 	return false, 0
 }
 
 func (c *CryoClient) Reply(event CryoMessageEvent, args ...interface{}) (ok bool, messageId uint32) {
 	// 处理消息内容
-	m := BuildMessage().Reply(event).Add(*ProcessMessageContent(args...))
+	m := BuildMessage().Reply(event).Add(*ProcessMessageContent(args...)).traceFrom(c.bus().GetTracer(), event)
 	// 根据传入的事件来发送消息
 	switch event.Type() {
 	case PrivateMessageEventType:
@@ -321,7 +474,7 @@ func (c *CryoClient) Reply(event CryoMessageEvent, args ...interface{}) (ok bool
 			}
 		}
 	default:
-		Error("发送消息时传入了不支持的消息事件")
+		c.log().Error("发送消息时传入了不支持的消息事件")
 	}
 	return false, 0
 }
@@ -0,0 +1,168 @@
+package cryobot
+
+import (
+	"fmt"
+	"github.com/LagrangeDev/LagrangeGo/client/entity"
+	"sort"
+)
+
+// 对LagrangeGo常用操作的封装，供协议适配器和插件直接调用
+//
+// 与发送消息的方法不同，这些方法会直接返回错误，由调用方决定如何处理
+
+// RecallGroupMessage 撤回群消息
+func (c *CryoClient) RecallGroupMessage(groupUin, seq uint32) error {
+	return c.Client.RecallGroupMessage(groupUin, seq)
+}
+
+// RecallPrivateMessage 撤回私聊消息，需要提供消息的序列号、随机数、客户端序列号以及发送时间
+func (c *CryoClient) RecallPrivateMessage(userUin, seq, random, clientSeq, time uint32) error {
+	return c.Client.RecallFriendMessage(userUin, seq, random, clientSeq, time)
+}
+
+// KickGroupMember 将成员移出群聊
+func (c *CryoClient) KickGroupMember(groupUin, userUin uint32, rejectAddRequest bool) error {
+	return c.Client.KickGroupMember(groupUin, userUin, rejectAddRequest)
+}
+
+// MuteGroupMember 禁言群成员，duration为禁言秒数，为0时解除禁言
+func (c *CryoClient) MuteGroupMember(groupUin, userUin, duration uint32) error {
+	return c.Client.SetGroupMemberMute(groupUin, userUin, duration)
+}
+
+// MuteGroupAll 开启或关闭全员禁言
+func (c *CryoClient) MuteGroupAll(groupUin uint32, mute bool) error {
+	return c.Client.SetGroupGlobalMute(groupUin, mute)
+}
+
+// SetGroupAdmin 设置或取消群管理员
+func (c *CryoClient) SetGroupAdmin(groupUin, userUin uint32, isAdmin bool) error {
+	return c.Client.SetGroupAdmin(groupUin, userUin, isAdmin)
+}
+
+// SetGroupMemberCard 设置群成员的群名片
+func (c *CryoClient) SetGroupMemberCard(groupUin, userUin uint32, card string) error {
+	return c.Client.SetGroupMemberName(groupUin, userUin, card)
+}
+
+// SetGroupMemberSpecialTitle 设置群成员的专属头衔
+func (c *CryoClient) SetGroupMemberSpecialTitle(groupUin, userUin uint32, title string) error {
+	return c.Client.SetGroupMemberSpecialTitle(groupUin, userUin, title)
+}
+
+// SetGroupName 修改群名称
+func (c *CryoClient) SetGroupName(groupUin uint32, name string) error {
+	return c.Client.SetGroupName(groupUin, name)
+}
+
+// LeaveGroup 退出群聊
+func (c *CryoClient) LeaveGroup(groupUin uint32) error {
+	return c.Client.SetGroupLeave(groupUin)
+}
+
+// HandleFriendRequest 处理好友申请
+func (c *CryoClient) HandleFriendRequest(userUid string, accept bool) error {
+	return c.Client.SetFriendRequest(accept, userUid)
+}
+
+// HandleGroupRequest 处理入群申请或加群邀请
+//
+// requestType 与 GroupMemberJoinRequestEvent 和 GroupInviteEvent 对应，入群申请为1，加群邀请为2
+func (c *CryoClient) HandleGroupRequest(groupUin uint32, requestSeq uint64, requestType uint32, accept bool, reason string) error {
+	return c.Client.SetGroupRequest(false, accept, requestSeq, requestType, groupUin, reason)
+}
+
+// SendLike 给用户点赞
+func (c *CryoClient) SendLike(userUin, times uint32) error {
+	return c.Client.SendFriendLike(userUin, times)
+}
+
+// Poke 戳一戳，groupUin为0时戳好友
+func (c *CryoClient) Poke(groupUin, userUin uint32) error {
+	if groupUin == 0 {
+		return c.Client.FriendPoke(userUin)
+	}
+	return c.Client.GroupPoke(groupUin, userUin)
+}
+
+// GetFriendList 获取好友列表，refresh为true时会重新拉取好友列表
+func (c *CryoClient) GetFriendList(refresh bool) ([]*entity.User, error) {
+	if refresh {
+		if err := c.Client.RefreshFriendCache(); err != nil {
+			return nil, err
+		}
+	}
+	friends := c.Client.GetCachedAllFriendsInfo()
+	if friends == nil {
+		return nil, fmt.Errorf("获取好友列表失败")
+	}
+	result := make([]*entity.User, 0, len(friends))
+	for _, friend := range friends {
+		result = append(result, friend)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Uin < result[j].Uin })
+	return result, nil
+}
+
+// GetGroupList 获取群列表，refresh为true时会重新拉取群列表
+func (c *CryoClient) GetGroupList(refresh bool) ([]*entity.Group, error) {
+	if refresh {
+		if err := c.Client.RefreshAllGroupsInfo(); err != nil {
+			return nil, err
+		}
+	}
+	groups := c.Client.GetCachedAllGroupsInfo()
+	if groups == nil {
+		return nil, fmt.Errorf("获取群列表失败")
+	}
+	result := make([]*entity.Group, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GroupUin < result[j].GroupUin })
+	return result, nil
+}
+
+// GetGroupInfo 获取群信息，refresh为true时会直接从服务器拉取
+func (c *CryoClient) GetGroupInfo(groupUin uint32, refresh bool) (*entity.Group, error) {
+	if !refresh {
+		if group := c.Client.GetCachedGroupInfo(groupUin); group != nil {
+			return group, nil
+		}
+	}
+	return c.Client.FetchGroupInfo(groupUin, false)
+}
+
+// GetGroupMemberList 获取群成员列表，refresh为true时会重新拉取群成员列表
+func (c *CryoClient) GetGroupMemberList(groupUin uint32, refresh bool) ([]*entity.GroupMember, error) {
+	if refresh {
+		if err := c.Client.RefreshGroupMembersCache(groupUin); err != nil {
+			return nil, err
+		}
+	}
+	members := c.Client.GetCachedMembersInfo(groupUin)
+	if members == nil {
+		return nil, fmt.Errorf("获取群 %d 的成员列表失败", groupUin)
+	}
+	result := make([]*entity.GroupMember, 0, len(members))
+	for _, member := range members {
+		result = append(result, member)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Uin < result[j].Uin })
+	return result, nil
+}
+
+// GetGroupMemberInfo 获取群成员信息，refresh为true时会直接从服务器拉取
+func (c *CryoClient) GetGroupMemberInfo(groupUin, userUin uint32, refresh bool) (*entity.GroupMember, error) {
+	if !refresh {
+		if member := c.Client.GetCachedMemberInfo(userUin, groupUin); member != nil {
+			return member, nil
+		}
+	}
+	return c.Client.FetchGroupMember(groupUin, userUin)
+}
+
+// GetUserInfo 获取用户的资料
+func (c *CryoClient) GetUserInfo(userUin uint32) (*entity.User, error) {
+	return c.Client.FetchUserInfoUin(userUin)
+}
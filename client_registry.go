@@ -0,0 +1,228 @@
+package cryobot
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ClientStatus 客户端在集合中的状态
+type ClientStatus string
+
+const (
+	ClientConnecting   ClientStatus = "connecting"   // 正在登录
+	ClientOnline       ClientStatus = "online"       // 已登录
+	ClientOffline      ClientStatus = "offline"      // 已经与服务器断开
+	ClientReconnecting ClientStatus = "reconnecting" // 正在重新登录
+)
+
+// ClientChange 客户端集合中的一次变化
+type ClientChange struct {
+	Client    *CryoClient
+	Status    ClientStatus // 变化后的状态，客户端被移除时为空
+	OldStatus ClientStatus // 变化前的状态，新加入的客户端为空
+	Removed   bool         // 客户端是否被移出集合
+}
+
+type registryEntry struct {
+	client *CryoClient
+	status ClientStatus
+	uin    int    // 建立索引时客户端的QQ号
+	uid    string // 建立索引时客户端的Uid
+}
+
+// ClientRegistry 并发安全的Bot客户端集合，可以通过客户端ID、QQ号和Uid查找客户端
+//
+// 客户端登录成功前QQ号和Uid可能为空，状态变化时会重新建立索引
+type ClientRegistry struct {
+	mutex    sync.RWMutex
+	entries  map[string]*registryEntry
+	byUin    map[int]*registryEntry
+	byUid    map[string]*registryEntry
+	watchers map[string]func(ClientChange)
+}
+
+// NewClientRegistry 创建一个空的客户端集合
+func NewClientRegistry() *ClientRegistry {
+	return &ClientRegistry{
+		entries:  make(map[string]*registryEntry),
+		byUin:    make(map[int]*registryEntry),
+		byUid:    make(map[string]*registryEntry),
+		watchers: make(map[string]func(ClientChange)),
+	}
+}
+
+// Add 将客户端以指定的状态加入集合，已经存在相同ID的客户端时会替换它
+func (r *ClientRegistry) Add(c *CryoClient, status ClientStatus) {
+	r.mutex.Lock()
+	var old ClientStatus
+	if e, ok := r.entries[c.Id]; ok {
+		old = e.status
+		r.unindex(e)
+	}
+	e := &registryEntry{client: c, status: status}
+	r.entries[c.Id] = e
+	r.index(e)
+	r.mutex.Unlock()
+	r.notify(ClientChange{Client: c, Status: status, OldStatus: old})
+}
+
+// SetStatus 修改指定客户端的状态并重新建立索引，客户端不存在时返回 false
+func (r *ClientRegistry) SetStatus(id string, status ClientStatus) bool {
+	r.mutex.Lock()
+	e, ok := r.entries[id]
+	if !ok {
+		r.mutex.Unlock()
+		return false
+	}
+	old := e.status
+	e.status = status
+	r.unindex(e)
+	r.index(e)
+	r.mutex.Unlock()
+	if old != status {
+		r.notify(ClientChange{Client: e.client, Status: status, OldStatus: old})
+	}
+	return true
+}
+
+// Remove 将指定客户端移出集合并返回它，客户端不存在时返回nil
+func (r *ClientRegistry) Remove(id string) *CryoClient {
+	r.mutex.Lock()
+	e, ok := r.entries[id]
+	if !ok {
+		r.mutex.Unlock()
+		return nil
+	}
+	delete(r.entries, id)
+	r.unindex(e)
+	r.mutex.Unlock()
+	r.notify(ClientChange{Client: e.client, OldStatus: e.status, Removed: true})
+	return e.client
+}
+
+// Get 返回指定ID的客户端
+func (r *ClientRegistry) Get(id string) *CryoClient {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if e, ok := r.entries[id]; ok {
+		return e.client
+	}
+	return nil
+}
+
+// GetByUin 返回指定QQ号的客户端
+func (r *ClientRegistry) GetByUin(uin int) *CryoClient {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if e, ok := r.byUin[uin]; ok {
+		return e.client
+	}
+	return nil
+}
+
+// GetByUid 返回指定Uid的客户端
+func (r *ClientRegistry) GetByUid(uid string) *CryoClient {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if e, ok := r.byUid[uid]; ok {
+		return e.client
+	}
+	return nil
+}
+
+// GetStatus 返回指定客户端的状态，客户端不存在时返回 false
+func (r *ClientRegistry) GetStatus(id string) (ClientStatus, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if e, ok := r.entries[id]; ok {
+		return e.status, true
+	}
+	return "", false
+}
+
+// List 返回集合中客户端的快照，按照QQ号和ID排序，可以传入状态只返回处于这些状态的客户端
+func (r *ClientRegistry) List(status ...ClientStatus) []*CryoClient {
+	r.mutex.RLock()
+	clients := make([]*CryoClient, 0, len(r.entries))
+	for _, e := range r.entries {
+		if len(status) == 0 || slices.Contains(status, e.status) {
+			clients = append(clients, e.client)
+		}
+	}
+	r.mutex.RUnlock()
+	slices.SortFunc(clients, func(a, b *CryoClient) int {
+		if a.Uin != b.Uin {
+			return a.Uin - b.Uin
+		}
+		return strings.Compare(a.Id, b.Id)
+	})
+	return clients
+}
+
+// Len 返回集合中的客户端数量，可以传入状态只统计处于这些状态的客户端
+func (r *ClientRegistry) Len(status ...ClientStatus) int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if len(status) == 0 {
+		return len(r.entries)
+	}
+	n := 0
+	for _, e := range r.entries {
+		if slices.Contains(status, e.status) {
+			n++
+		}
+	}
+	return n
+}
+
+// Watch 添加一个在集合变化时调用的函数，返回用于取消的ID
+//
+// 函数会在修改集合的协程中同步调用，不能在其中再修改集合
+func (r *ClientRegistry) Watch(fn func(ClientChange)) string {
+	id := NewUUID()
+	r.mutex.Lock()
+	r.watchers[id] = fn
+	r.mutex.Unlock()
+	return id
+}
+
+// Unwatch 取消指定ID的监听
+func (r *ClientRegistry) Unwatch(id string) {
+	r.mutex.Lock()
+	delete(r.watchers, id)
+	r.mutex.Unlock()
+}
+
+func (r *ClientRegistry) notify(change ClientChange) {
+	r.mutex.RLock()
+	watchers := make([]func(ClientChange), 0, len(r.watchers))
+	for _, fn := range r.watchers {
+		watchers = append(watchers, fn)
+	}
+	r.mutex.RUnlock()
+	for _, fn := range watchers {
+		fn(change)
+	}
+}
+
+// index 为客户端当前的QQ号和Uid建立索引，需要持有写锁
+func (r *ClientRegistry) index(e *registryEntry) {
+	e.uin, e.uid = e.client.Uin, e.client.Uid
+	if e.uin != 0 {
+		r.byUin[e.uin] = e
+	}
+	if e.uid != "" {
+		r.byUid[e.uid] = e
+	}
+}
+
+// unindex 移除客户端的索引，需要持有写锁
+func (r *ClientRegistry) unindex(e *registryEntry) {
+	if r.byUin[e.uin] == e {
+		delete(r.byUin, e.uin)
+	}
+	if r.byUid[e.uid] == e {
+		delete(r.byUid, e.uid)
+	}
+}
@@ -1,103 +1,57 @@
 package cryobot
 
-import (
-	"github.com/go-json-experiment/json"
-	"os"
-)
+import "github.com/LagrangeDev/LagrangeGo/client/auth"
 
 type CryoClientInfo struct {
-	Id        string `json:"id"`
-	Platform  string `json:"Platform"`
-	Version   string `json:"Version"`
-	DeviceNum int    `json:"device_num"`
-	Signature string `json:"signature"`
-	Uin       int    `json:"uin"`
-	Uid       string `json:"uid"`
+	Id        string           `json:"id"`
+	Platform  string           `json:"Platform"`
+	Version   string           `json:"Version"`
+	DeviceNum int              `json:"device_num"`
+	Device    *auth.DeviceInfo `json:"device,omitempty"` // 设备信息，旧版本保存的客户端信息中没有该字段
+	Signature string           `json:"signature"`
+	Uin       int              `json:"uin"`
+	Uid       string           `json:"uid"`
+	Nickname  string           `json:"nickname,omitempty"` // 账号的QQ昵称
+	Alias     string           `json:"alias,omitempty"`    // 显示别名
+	Password  string           `json:"password,omitempty"` // 加密后的密码MD5，只在设置了 CredentialKey 时保存
 }
 
-func ReadClientInfos() ([]CryoClientInfo, error) {
-	data, err := os.ReadFile("client_infos.json")
+// defaultCredentialStore 包级别的客户端信息函数使用的凭据存储，只能通过环境变量设置密钥和数据目录
+func defaultCredentialStore() CredentialStore {
+	s, err := DefaultConfig().newCredentialStore()
 	if err != nil {
-		return nil, err
-	}
-
-	var clientInfos []CryoClientInfo
-	err = json.Unmarshal(data, &clientInfos)
-	if err != nil {
-		return nil, err
+		GetLogger().Error("创建凭据存储时出现错误：", err)
+		return unavailableCredentialStore{err: err}
 	}
+	return s
+}
 
-	return clientInfos, nil
+// ReadClientInfos 读取默认凭据存储中保存的所有客户端信息
+func ReadClientInfos() ([]CryoClientInfo, error) {
+	return defaultCredentialStore().Load()
 }
 
+// WriteClientInfos 使用指定的客户端信息覆盖默认凭据存储
 func WriteClientInfos(clientInfos []CryoClientInfo) error {
-	data, err := json.Marshal(clientInfos)
-	if err != nil {
-		return err
-	}
-
-	err = os.WriteFile("client_infos.json", data, 0644)
-	if err != nil {
-		return err
+	switch s := defaultCredentialStore().(type) {
+	case *FileCredentialStore:
+		return s.withLock(func() error {
+			return s.write(clientInfos)
+		})
+	case *DirCredentialStore:
+		return s.replace(clientInfos)
+	case unavailableCredentialStore:
+		return s.err
 	}
-
 	return nil
 }
 
+// SaveClientInfo 将客户端信息保存到默认凭据存储，已经存在相同ID的信息时覆盖
 func SaveClientInfo(clientInfo CryoClientInfo) error {
-	// 首先尝试读取现有的客户端信息
-	clientInfos, err := ReadClientInfos()
-	if err != nil { // 读取失败，可能是文件不存在
-		if os.IsNotExist(err) {
-			// 文件不存在，创建一个新的切片
-			clientInfos = []CryoClientInfo{}
-		} else {
-			return err // 其他错误
-		}
-	}
-	// 检测是否已经存在botid相同的客户端信息
-	updateFlag := false
-	for _, info := range clientInfos {
-		if info.Id == clientInfo.Id {
-			// 如果存在，则更新该信息
-			updateFlag = true
-			break
-		}
-	}
-	if updateFlag {
-		// 如果存在，则更新该信息
-		for i, info := range clientInfos {
-			if info.Id == clientInfo.Id {
-				clientInfos[i] = clientInfo
-				break
-			}
-		}
-	} else {
-		// 如果不存在，则添加新的信息
-		clientInfos = append(clientInfos, clientInfo)
-	}
-	err = WriteClientInfos(clientInfos)
-	return err
+	return defaultCredentialStore().Put(clientInfo)
 }
 
+// RemoveClientInfo 从默认凭据存储中删除指定ID的客户端信息
 func RemoveClientInfo(botId string) error {
-	// 读取现有的客户端信息
-	clientInfos, err := ReadClientInfos()
-	if err != nil {
-		return err // 读取失败，可能是文件不存在
-	}
-
-	// 创建一个新的切片来存储更新后的客户端信息
-	var updatedClientInfos []CryoClientInfo
-
-	// 遍历现有的客户端信息，排除要删除的项
-	for _, info := range clientInfos {
-		if info.Id != botId {
-			updatedClientInfos = append(updatedClientInfos, info)
-		}
-	}
-
-	// 将更新后的客户端信息写回文件
-	err = WriteClientInfos(updatedClientInfos)
-	return err
+	return defaultCredentialStore().Remove(botId)
 }
@@ -4,43 +4,162 @@ import (
 	"github.com/go-json-experiment/json"
 	"github.com/sirupsen/logrus"
 	"os"
+	"path/filepath"
+	"time"
 )
 
-var conf Config
 var DefaultSignServer = "https://sign.lagrangecore.org/api/sign/30366"
 
+// Config cryobot的配置
+//
+// 配置按照 默认值 → 配置文件 → 环境变量 → 传入的配置 的顺序逐层覆盖，详见 ConfigLoader
+// 开关类的配置项使用 *bool，为nil时表示没有设置，这样才能在配置中显式地关闭默认开启的功能，可以使用 Bool 函数设置
 type Config struct {
-	LogLevel                     logrus.Level
-	LogFormat                    *logrus.Formatter
-	SignServers                  []string `json:"sign_servers,omitempty,omitzero"`                    // 签名服务器列表
-	EnableClientAutoSave         bool     `json:"enable_client_save,omitempty,omitzero"`              // 是否启用客户端信息自动保存
-	EnablePrintLogo              bool     `json:"enable_print_logo,omitempty,omitzero"`               // 是否启用logo打印
-	EnableConnectPrintMiddleware bool     `json:"enable_connect_print_middleware,omitempty,omitzero"` // 是否启用内置的Bot连接打印中间件
-	EnableMessagePrintMiddleware bool     `json:"enable_message_print_middleware,omitempty,omitzero"` // 是否启用内置的消息打印中间件
-	EnableEventDebugMiddleware   bool     `json:"enable_event_debug_middleware,omitempty,omitzero"`   // 是否启用内置的事件调试中间件
+	LogLevel                     logrus.Level      `json:"log_level,omitempty,omitzero"` // 日志等级，如 debug / info / warn
+	LogFormat                    *logrus.Formatter `json:"-"`
+	SignServers                  []string          `json:"sign_servers,omitempty,omitzero"`                    // 签名服务器列表
+	SignPool                     SignPoolConfig    `json:"sign_pool,omitempty,omitzero"`                       // 签名服务器池的配置
+	Protocol                     ProtocolConfig    `json:"protocol,omitempty,omitzero"`                        // 平台与协议版本的配置
+	Health                       HealthConfig      `json:"health,omitempty,omitzero"`                          // 客户端健康检查的配置
+	Accounts                     []AccountConfig   `json:"accounts,omitempty,omitzero"`                        // 需要连接的账号，设置后 AutoConnect 会并发连接这些账号
+	EnableClientAutoSave         *bool             `json:"enable_client_save,omitempty,omitzero"`              // 是否启用客户端信息自动保存，默认开启
+	EnablePrintLogo              *bool             `json:"enable_print_logo,omitempty,omitzero"`               // 是否启用logo打印，默认开启
+	EnableConnectPrintMiddleware *bool             `json:"enable_connect_print_middleware,omitempty,omitzero"` // 是否启用内置的Bot连接打印中间件，默认开启
+	EnableMessagePrintMiddleware *bool             `json:"enable_message_print_middleware,omitempty,omitzero"` // 是否启用内置的消息打印中间件，默认开启
+	EnableEventDebugMiddleware   *bool             `json:"enable_event_debug_middleware,omitempty,omitzero"`   // 是否启用内置的事件调试中间件，默认关闭
+
+	AsyncWorkers        int            `json:"async_workers,omitempty,omitzero"`         // 异步事件工作协程数量
+	AsyncQueueSize      int            `json:"async_queue_size,omitempty,omitzero"`      // 每个异步事件工作协程的队列长度
+	AsyncOverflowPolicy OverflowPolicy `json:"async_overflow_policy,omitempty,omitzero"` // 异步事件队列已满时的处理策略
+	AsyncOrdering       OrderingMode   `json:"async_ordering,omitempty,omitzero"`        // 异步事件的顺序保证粒度
+
+	OneBotV11 OneBotConfig `json:"onebot_v11,omitempty,omitzero"` // OneBot v11 实现端的配置
+	OneBotV12 OneBotConfig `json:"onebot_v12,omitempty,omitzero"` // OneBot v12 实现端的配置
+
+	Webhooks  []WebhookConfig `json:"webhooks,omitempty,omitzero"`   // 出站Webhook的配置
+	WebAdmin  WebAdminConfig  `json:"web_admin,omitempty,omitzero"`  // Web后台的配置
+	ManageApi ManageApiConfig `json:"manage_api,omitempty,omitzero"` // 管理接口的配置
+	Metrics   MetricsConfig   `json:"metrics,omitempty,omitzero"`    // 指标接口的配置
+	Tracing   TracingConfig   `json:"tracing,omitempty,omitzero"`    // 链路追踪的配置
+	LogStore  LogStoreConfig  `json:"log_store,omitempty,omitzero"`  // 日志存储的配置
+
+	QRCodeLogin       QRCodeLoginConfig `json:"qrcode_login,omitempty,omitzero"`        // 扫码登录的配置
+	CredentialKey     string            `json:"credential_key,omitempty,omitzero"`      // 用于加密客户端凭据的密钥，也可以通过环境变量 CRYOBOT_CREDENTIAL_KEY 设置，为空时凭据不加密且不保存密码
+	CredentialKeyFile string            `json:"credential_key_file,omitempty,omitzero"` // 保存加密密钥的文件，也可以通过环境变量 CRYOBOT_CREDENTIAL_KEY_FILE 设置
+
+	DataDir string `json:"data_dir,omitempty,omitzero"` // 数据目录，也可以通过环境变量 CRYOBOT_DATA_DIR 设置，为空时所有文件保存在工作目录中
+
+	WatchConfig         *bool `json:"watch_config,omitempty,omitzero"`          // 是否监视配置文件的变化并自动重新加载，默认关闭
+	ConfigWatchInterval int   `json:"config_watch_interval,omitempty,omitzero"` // 检查配置文件是否变化的间隔，单位为秒，默认为3
+
+	Plugins map[string]any `json:"plugins,omitempty,omitzero"` // 插件的配置，键为插件名，可以通过 GetPluginConfig 解析到插件自己的结构体中
 }
 
-func ReadCryoConfig() (Config, error) {
-	data, err := os.ReadFile("cryobot_config.json")
-	c := Config{}
+// Bool 返回指向传入值的指针，用于设置配置中的开关
+func Bool(v bool) *bool {
+	return &v
+}
+
+// boolValue 返回开关的值，没有设置时返回默认值
+func boolValue(v *bool, def bool) bool {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+// IsClientAutoSaveEnabled 返回是否启用了客户端信息自动保存
+func (c Config) IsClientAutoSaveEnabled() bool {
+	return boolValue(c.EnableClientAutoSave, true)
+}
+
+// IsPrintLogoEnabled 返回是否启用了logo打印
+func (c Config) IsPrintLogoEnabled() bool {
+	return boolValue(c.EnablePrintLogo, true)
+}
+
+// IsConnectPrintMiddlewareEnabled 返回是否启用了内置的Bot连接打印中间件
+func (c Config) IsConnectPrintMiddlewareEnabled() bool {
+	return boolValue(c.EnableConnectPrintMiddleware, true)
+}
+
+// IsMessagePrintMiddlewareEnabled 返回是否启用了内置的消息打印中间件
+func (c Config) IsMessagePrintMiddlewareEnabled() bool {
+	return boolValue(c.EnableMessagePrintMiddleware, true)
+}
+
+// IsEventDebugMiddlewareEnabled 返回是否启用了内置的事件调试中间件
+func (c Config) IsEventDebugMiddlewareEnabled() bool {
+	return boolValue(c.EnableEventDebugMiddleware, false)
+}
+
+// IsWatchConfigEnabled 返回是否启用了配置文件的自动重新加载
+func (c Config) IsWatchConfigEnabled() bool {
+	return boolValue(c.WatchConfig, false)
+}
+
+// GetConfigWatchInterval 返回检查配置文件是否变化的间隔
+func (c Config) GetConfigWatchInterval() time.Duration {
+	if c.ConfigWatchInterval <= 0 {
+		return 3 * time.Second
+	}
+	return time.Duration(c.ConfigWatchInterval) * time.Second
+}
+
+// GetPluginConfig 将指定插件的配置解析到传入的结构体指针中，配置中没有该插件的配置时不做任何处理
+func (c Config) GetPluginConfig(name string, v any) error {
+	section, ok := c.Plugins[name]
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(section)
 	if err != nil {
-		return c, err
+		return err
 	}
+	return json.Unmarshal(data, v)
+}
 
-	err = json.Unmarshal(data, &c)
+// DefaultConfig 返回cryobot的默认配置
+func DefaultConfig() Config {
+	return Config{
+		LogLevel:                     logrus.InfoLevel,
+		SignServers:                  []string{DefaultSignServer},
+		EnableClientAutoSave:         Bool(true),
+		EnablePrintLogo:              Bool(true),
+		EnableConnectPrintMiddleware: Bool(true),
+		EnableMessagePrintMiddleware: Bool(true),
+		EnableEventDebugMiddleware:   Bool(false),
+		AsyncWorkers:                 DefaultWorkerPoolConfig.Workers,
+		AsyncQueueSize:               DefaultWorkerPoolConfig.QueueSize,
+		AsyncOverflowPolicy:          DefaultWorkerPoolConfig.OverflowPolicy,
+		AsyncOrdering:                DefaultWorkerPoolConfig.Ordering,
+	}
+}
+
+// ReadCryoConfig 只读取配置文件中的配置，不合并默认值和环境变量
+//
+// 设置了环境变量 CRYOBOT_DATA_DIR 时从数据目录下的 config/ 中读取，支持 JSON、YAML 和 TOML 格式
+func ReadCryoConfig() (Config, error) {
+	c := Config{}
+	m, err := readConfigFile(EnvDataLayout().FindConfigFile())
 	if err != nil {
 		return c, err
 	}
-
-	return c, nil
+	return configFromMap(m)
 }
+
+// WriteCryoConfig 写入配置文件，配置中设置了数据目录时写入到数据目录下的 config/ 中
 func WriteCryoConfig(config Config) error {
 	data, err := json.Marshal(config)
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile("cryobot_config.json", data, 0644)
+	path := config.GetDataLayout().ConfigFile()
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	err = os.WriteFile(path, data, 0644)
 	if err != nil {
 		return err
 	}
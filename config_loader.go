@@ -0,0 +1,295 @@
+package cryobot
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/go-json-experiment/json"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 分层配置
+//
+// 配置按照以下顺序逐层覆盖，后面的层只覆盖自己设置了的配置项：
+//
+//	默认配置      DefaultConfig() 的返回值
+//	配置文件      数据目录中的 cryobot_config.json / .yaml / .yml / .toml
+//	环境变量      CRYOBOT_ 加上大写的配置项名，嵌套的配置项用下划线连接，如 CRYOBOT_LOG_LEVEL、CRYOBOT_WEB_ADMIN_ADDR
+//	传入的配置    调用 Init 或 Load 时传入的 Config，零值和为nil的开关视为没有设置
+//
+// 列表类型的环境变量使用逗号分隔，也可以直接使用JSON，如 CRYOBOT_SIGN_SERVERS=https://a,https://b
+
+// ConfigEnvPrefix 配置项对应的环境变量的默认前缀
+const ConfigEnvPrefix = "CRYOBOT_"
+
+// ConfigLoader 分层配置的加载器
+type ConfigLoader struct {
+	Path       string // 配置文件路径，为空时在数据目录中依次查找 JSON、YAML 和 TOML 格式的配置文件
+	EnvPrefix  string // 环境变量的前缀，为空时使用 CRYOBOT_
+	DisableEnv bool   // 是否不读取环境变量中的配置
+
+	pathMutex sync.RWMutex
+	path      string // 最近一次加载时使用的配置文件
+}
+
+// NewConfigLoader 创建一个配置加载器，可以传入配置文件的路径，格式由扩展名决定
+func NewConfigLoader(path ...string) *ConfigLoader {
+	l := &ConfigLoader{}
+	if len(path) > 0 {
+		l.Path = path[0]
+	}
+	return l
+}
+
+// LoadConfig 使用默认的配置加载器加载配置
+func LoadConfig(override ...Config) (Config, error) {
+	return NewConfigLoader().Load(override...)
+}
+
+// GetPath 返回最近一次加载时使用的配置文件的路径，文件不一定存在
+func (l *ConfigLoader) GetPath() string {
+	l.pathMutex.RLock()
+	defer l.pathMutex.RUnlock()
+	if l.path == "" {
+		return l.Path
+	}
+	return l.path
+}
+
+// Load 依次合并默认配置、配置文件、环境变量和传入的配置，并对结果进行校验
+//
+// 配置文件不存在时会跳过这一层，解析失败或校验不通过时返回错误
+func (l *ConfigLoader) Load(override ...Config) (Config, error) {
+	merged, err := configToMap(DefaultConfig())
+	if err != nil {
+		return DefaultConfig(), err
+	}
+
+	path := l.resolvePath(override)
+	l.pathMutex.Lock()
+	l.path = path
+	l.pathMutex.Unlock()
+	fileConfig, err := readConfigFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return DefaultConfig(), fmt.Errorf("读取配置文件 %s 时出现错误：%w", path, err)
+	}
+	mergeConfigMap(merged, fileConfig)
+
+	if !l.DisableEnv {
+		envConfig, err := envConfigMap(l.envPrefix())
+		if err != nil {
+			return DefaultConfig(), err
+		}
+		mergeConfigMap(merged, envConfig)
+	}
+
+	for _, o := range override {
+		m, err := configToMap(o)
+		if err != nil {
+			return DefaultConfig(), err
+		}
+		mergeConfigMap(merged, m)
+	}
+
+	c, err := configFromMap(merged)
+	if err != nil {
+		return DefaultConfig(), err
+	}
+	for _, o := range override {
+		if o.LogFormat != nil {
+			c.LogFormat = o.LogFormat
+		}
+	}
+	return c, c.Validate()
+}
+
+// resolvePath 返回需要读取的配置文件，没有指定路径时根据传入的配置或环境变量决定数据目录
+func (l *ConfigLoader) resolvePath(override []Config) string {
+	if l.Path != "" {
+		return l.Path
+	}
+	layout := EnvDataLayout()
+	for _, o := range override {
+		if o.DataDir != "" {
+			layout = NewDataLayout(o.DataDir)
+		}
+	}
+	return layout.FindConfigFile()
+}
+
+func (l *ConfigLoader) envPrefix() string {
+	if l.EnvPrefix == "" {
+		return ConfigEnvPrefix
+	}
+	return l.EnvPrefix
+}
+
+// readConfigFile 读取配置文件，根据扩展名选择 JSON、YAML 或 TOML 格式进行解析
+func readConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &m)
+	case ".toml":
+		err = toml.Unmarshal(data, &m)
+	default:
+		err = json.Unmarshal(data, &m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	normalized, _ := normalizeConfigValue(m).(map[string]any)
+	return normalized, nil
+}
+
+// normalizeConfigValue 将YAML中键不是字符串的映射转换为 map[string]any，便于之后按照JSON处理
+func normalizeConfigValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = normalizeConfigValue(item)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = normalizeConfigValue(item)
+		}
+		return m
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeConfigValue(item)
+		}
+		return v
+	}
+	return v
+}
+
+// configToMap 将配置转换为以JSON字段名为键的映射，零值和为nil的开关会被省略
+func configToMap(c Config) (map[string]any, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// configFromMap 将以JSON字段名为键的映射转换为配置
+func configFromMap(m map[string]any) (Config, error) {
+	c := Config{}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// mergeConfigMap 将 src 中的配置项合并到 dst 中，嵌套的配置会逐项合并，列表会被整体替换
+func mergeConfigMap(dst, src map[string]any) {
+	for k, v := range src {
+		if sv, ok := v.(map[string]any); ok {
+			if dv, ok := dst[k].(map[string]any); ok {
+				mergeConfigMap(dv, sv)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+// envConfigMap 读取所有配置项对应的环境变量
+func envConfigMap(prefix string) (map[string]any, error) {
+	m := map[string]any{}
+	var errs []error
+	collectEnvConfig(reflect.TypeFor[Config](), prefix, m, &errs)
+	return m, errors.Join(errs...)
+}
+
+// collectEnvConfig 按照结构体的JSON字段名拼接出环境变量名，读取设置了的环境变量
+func collectEnvConfig(t reflect.Type, prefix string, m map[string]any, errs *[]error) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		env := prefix + strings.ToUpper(name)
+		if f.Type.Kind() == reflect.Struct && !reflect.PointerTo(f.Type).Implements(textUnmarshalerType) {
+			sub := map[string]any{}
+			collectEnvConfig(f.Type, env+"_", sub, errs)
+			if len(sub) > 0 {
+				m[name] = sub
+			}
+			continue
+		}
+		raw, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		v, err := parseEnvValue(f.Type, raw)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("环境变量 %s 的值 %q 无效：%w", env, raw, err))
+			continue
+		}
+		m[name] = v
+	}
+}
+
+// parseEnvValue 将环境变量的值解析为与配置项类型对应的JSON值
+func parseEnvValue(t reflect.Type, raw string) (any, error) {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return raw, nil
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return parseEnvValue(t.Elem(), raw)
+	case reflect.Bool:
+		return strconv.ParseBool(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(raw, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(raw, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(raw, t.Bits())
+	case reflect.String:
+		return raw, nil
+	}
+	if trimmed := strings.TrimSpace(raw); strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		var v any
+		err := json.Unmarshal([]byte(trimmed), &v)
+		return v, err
+	}
+	if t.Kind() == reflect.Slice {
+		items := []any{}
+		for _, part := range strings.Split(raw, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			v, err := parseEnvValue(t.Elem(), part)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("该配置项只能使用JSON设置")
+}
@@ -0,0 +1,155 @@
+package cryobot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeConfigMap(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  map[string]any
+		src  map[string]any
+		want map[string]any
+	}{
+		{
+			name: "新增配置项",
+			dst:  map[string]any{"a": 1.0},
+			src:  map[string]any{"b": "x"},
+			want: map[string]any{"a": 1.0, "b": "x"},
+		},
+		{
+			name: "覆盖配置项",
+			dst:  map[string]any{"a": 1.0},
+			src:  map[string]any{"a": 2.0},
+			want: map[string]any{"a": 2.0},
+		},
+		{
+			name: "嵌套的配置逐项合并",
+			dst:  map[string]any{"web_admin": map[string]any{"enable": true, "addr": "127.0.0.1:8091"}},
+			src:  map[string]any{"web_admin": map[string]any{"addr": ":9000"}},
+			want: map[string]any{"web_admin": map[string]any{"enable": true, "addr": ":9000"}},
+		},
+		{
+			name: "列表整体替换",
+			dst:  map[string]any{"sign_servers": []any{"a", "b"}},
+			src:  map[string]any{"sign_servers": []any{"c"}},
+			want: map[string]any{"sign_servers": []any{"c"}},
+		},
+		{
+			name: "嵌套的配置替换非对象的值",
+			dst:  map[string]any{"plugins": "none"},
+			src:  map[string]any{"plugins": map[string]any{"echo": true}},
+			want: map[string]any{"plugins": map[string]any{"echo": true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergeConfigMap(tt.dst, tt.src)
+			if !reflect.DeepEqual(tt.dst, tt.want) {
+				t.Errorf("got %v, want %v", tt.dst, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     reflect.Type
+		raw     string
+		want    any
+		wantErr bool
+	}{
+		{name: "字符串", typ: reflect.TypeFor[string](), raw: "abc", want: "abc"},
+		{name: "布尔值", typ: reflect.TypeFor[bool](), raw: "true", want: true},
+		{name: "布尔指针", typ: reflect.TypeFor[*bool](), raw: "false", want: false},
+		{name: "整数", typ: reflect.TypeFor[int](), raw: "42", want: int64(42)},
+		{name: "无效的整数", typ: reflect.TypeFor[int](), raw: "x", wantErr: true},
+		{name: "无符号整数", typ: reflect.TypeFor[uint32](), raw: "7", want: uint64(7)},
+		{name: "浮点数", typ: reflect.TypeFor[float64](), raw: "0.5", want: 0.5},
+		{name: "逗号分隔的列表", typ: reflect.TypeFor[[]string](), raw: "a, b,,c", want: []any{"a", "b", "c"}},
+		{name: "逗号分隔的数字列表", typ: reflect.TypeFor[[]int](), raw: "1,2", want: []any{int64(1), int64(2)}},
+		{name: "JSON列表", typ: reflect.TypeFor[[]string](), raw: `["a","b"]`, want: []any{"a", "b"}},
+		{name: "JSON对象", typ: reflect.TypeFor[map[string]any](), raw: `{"a":1}`, want: map[string]any{"a": 1.0}},
+		{name: "只能使用JSON设置的配置项", typ: reflect.TypeFor[map[string]any](), raw: "a=1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEnvValue(tt.typ, tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvConfigMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name: "没有设置环境变量",
+			want: map[string]any{},
+		},
+		{
+			name: "顶层和嵌套的配置项",
+			env: map[string]string{
+				"TEST_CRYOBOT_DATA_DIR":         "/data",
+				"TEST_CRYOBOT_WEB_ADMIN_ENABLE": "true",
+				"TEST_CRYOBOT_SIGN_SERVERS":     "http://a,http://b",
+			},
+			want: map[string]any{
+				"data_dir":     "/data",
+				"web_admin":    map[string]any{"enable": true},
+				"sign_servers": []any{"http://a", "http://b"},
+			},
+		},
+		{
+			name:    "无效的值",
+			env:     map[string]string{"TEST_CRYOBOT_ASYNC_WORKERS": "many"},
+			want:    map[string]any{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := envConfigMap("TEST_CRYOBOT_")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigLoaderGetPathConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(DataDirEnv, "")
+	l := NewConfigLoader()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			_ = l.GetPath()
+		}
+	}()
+	for range 100 {
+		_, _ = l.Load(Config{DataDir: dir})
+	}
+	<-done
+	if got, want := l.GetPath(), NewDataLayout(dir).FindConfigFile(); got != want {
+		t.Fatalf("GetPath = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package cryobot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"slices"
+)
+
+// ConfigError 配置中的一处错误
+type ConfigError struct {
+	Field   string // 出错的配置项，如 web_admin.addr、webhooks[0].url
+	Message string // 错误说明
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("配置项 %s %s", e.Field, e.Message)
+}
+
+// Validate 校验配置，返回由所有 *ConfigError 组成的错误，可以通过 errors.As 取出第一处错误
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(field, format string, args ...any) {
+		errs = append(errs, &ConfigError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	checkUrl := func(field, raw string, schemes ...string) {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || !slices.Contains(schemes, u.Scheme) {
+			invalid(field, "不是有效的地址：%q", raw)
+		}
+	}
+
+	if c.LogLevel > logrus.TraceLevel {
+		invalid("log_level", "不是有效的日志等级")
+	}
+	for i, server := range c.SignServers {
+		checkUrl(fmt.Sprintf("sign_servers[%d]", i), server, "http", "https")
+	}
+	for i, server := range c.SignPool.Servers {
+		checkUrl(fmt.Sprintf("sign_pool.servers[%d].url", i), server.Url, "http", "https")
+		if server.Weight < 0 {
+			invalid(fmt.Sprintf("sign_pool.servers[%d].weight", i), "不能为负数")
+		}
+	}
+	c.Protocol.validate(invalid)
+	c.Health.validate(invalid)
+	uins := make(map[int]bool)
+	for i, a := range c.Accounts {
+		field := fmt.Sprintf("accounts[%d]", i)
+		a.validate(field, invalid)
+		for j, server := range a.SignServers {
+			checkUrl(fmt.Sprintf("%s.sign_servers[%d]", field, j), server, "http", "https")
+		}
+		if uins[a.Uin] {
+			invalid(field+".uin", "与其他账号重复：%d", a.Uin)
+		}
+		uins[a.Uin] = true
+	}
+	if c.AsyncWorkers < 0 {
+		invalid("async_workers", "不能为负数")
+	}
+	if c.AsyncQueueSize < 0 {
+		invalid("async_queue_size", "不能为负数")
+	}
+	if c.AsyncOverflowPolicy != "" && !slices.Contains([]OverflowPolicy{OverflowBlock, OverflowDropOldest, OverflowDropNewest}, c.AsyncOverflowPolicy) {
+		invalid("async_overflow_policy", "只能是 block / drop_oldest / drop_newest")
+	}
+	if c.AsyncOrdering != "" && !slices.Contains([]OrderingMode{OrderingNone, OrderingByBot, OrderingByGroup}, c.AsyncOrdering) {
+		invalid("async_ordering", "只能是 none / bot / group")
+	}
+
+	for _, onebot := range []struct {
+		name   string
+		config OneBotConfig
+	}{{"onebot_v11", c.OneBotV11}, {"onebot_v12", c.OneBotV12}} {
+		name, ob := onebot.name, onebot.config
+		if !ob.Enable {
+			continue
+		}
+		if ob.HttpAddr == "" && ob.WsAddr == "" && len(ob.HttpPostUrls) == 0 && len(ob.ReverseWsUrls) == 0 {
+			invalid(name, "已启用，但没有设置任何通信方式")
+		}
+		for i, u := range ob.HttpPostUrls {
+			checkUrl(fmt.Sprintf("%s.http_post_urls[%d]", name, i), u, "http", "https")
+		}
+		for i, u := range ob.ReverseWsUrls {
+			checkUrl(fmt.Sprintf("%s.reverse_ws_urls[%d]", name, i), u, "ws", "wss")
+		}
+	}
+
+	for i, w := range c.Webhooks {
+		checkUrl(fmt.Sprintf("webhooks[%d].url", i), w.Url, "http", "https")
+	}
+	if c.WebAdmin.Enable && c.WebAdmin.Token == "" {
+		invalid("web_admin.token", "不能为空")
+	}
+	if c.ManageApi.Enable && c.ManageApi.Token == "" {
+		invalid("manage_api.token", "不能为空")
+	}
+	c.Metrics.validate(invalid)
+	c.Tracing.validate(invalid)
+	c.LogStore.validate(invalid)
+
+	for i, p := range c.QRCodeLogin.Presenters {
+		field := fmt.Sprintf("qrcode_login.presenters[%d]", i)
+		switch p.Type {
+		case "terminal", "file", "http":
+		case "webhook":
+			checkUrl(field+".url", p.Url, "http", "https")
+		case "bot":
+			if p.GroupUin == 0 && p.UserUin == 0 {
+				invalid(field, "必须设置群号或好友QQ号")
+			}
+		default:
+			invalid(field+".type", "只能是 terminal / file / http / webhook / bot")
+		}
+	}
+
+	if c.ConfigWatchInterval < 0 {
+		invalid("config_watch_interval", "不能为负数")
+	}
+	return errors.Join(errs...)
+}
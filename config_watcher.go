@@ -0,0 +1,227 @@
+package cryobot
+
+import (
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 配置热重载
+//
+// 重新加载配置时，日志等级、内置中间件的开关、异步工作池和签名服务器池会立即生效，新增的账号会立即开始连接，其余配置项会在下次使用时读取新的值
+// OneBot 实现端、Webhook、Web后台、管理接口等在启动时就已经确定的配置需要重启后才能生效
+// 重新加载成功且配置发生变化时会发布 ConfigReloadedEvent
+
+// restartRequiredConfigKeys 修改后需要重启才能生效的配置项
+var restartRequiredConfigKeys = []string{"onebot_v11", "onebot_v12", "webhooks", "web_admin", "manage_api", "metrics", "tracing", "log_store", "data_dir", "credential_key", "credential_key_file"}
+
+// ConfigWatcher 定时检查配置文件的修改时间和大小，文件变化时重新加载配置
+type ConfigWatcher struct {
+	bot      *Bot
+	interval time.Duration // 为0时使用配置中的 ConfigWatchInterval
+	stop     chan struct{}
+	stopOnce sync.Once
+	modTime  time.Time
+	size     int64
+}
+
+// WatchConfig 开始监视配置文件的变化，可以传入检查间隔，没有传入时使用配置中的 ConfigWatchInterval
+//
+// 已经在监视时返回原有的 ConfigWatcher
+func (b *Bot) WatchConfig(interval ...time.Duration) *ConfigWatcher {
+	b.confMutex.Lock()
+	defer b.confMutex.Unlock()
+	if b.configWatcher != nil {
+		return b.configWatcher
+	}
+	w := &ConfigWatcher{bot: b, stop: make(chan struct{})}
+	if len(interval) > 0 {
+		w.interval = interval[0]
+	}
+	w.modTime, w.size = w.stat()
+	b.configWatcher = w
+	go w.run()
+	b.log().Infof("%s[Config] 正在监视配置文件 %s 的变化", lavender, b.getConfigLoader().GetPath())
+	return w
+}
+
+// StopWatchConfig 停止监视配置文件的变化
+func (b *Bot) StopWatchConfig() {
+	b.confMutex.Lock()
+	w := b.configWatcher
+	b.configWatcher = nil
+	b.confMutex.Unlock()
+	if w != nil {
+		w.Stop()
+	}
+}
+
+// Stop 停止监视
+func (w *ConfigWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+func (w *ConfigWatcher) run() {
+	for {
+		interval := w.interval
+		if interval <= 0 {
+			interval = w.bot.GetConfig().GetConfigWatchInterval()
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(interval):
+		}
+		modTime, size := w.stat()
+		if modTime.Equal(w.modTime) && size == w.size {
+			continue
+		}
+		w.modTime, w.size = modTime, size
+		_ = w.bot.ReloadConfig()
+	}
+}
+
+// stat 返回配置文件的修改时间和大小，文件不存在时返回零值
+func (w *ConfigWatcher) stat() (time.Time, int64) {
+	info, err := os.Stat(w.bot.getConfigLoader().GetPath())
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return info.ModTime(), info.Size()
+}
+
+// SetConfigLoader 设置Bot使用的配置加载器，需要在 Init 之前调用
+func (b *Bot) SetConfigLoader(l *ConfigLoader) {
+	b.configLoader = l
+}
+
+// getConfigLoader 返回Bot使用的配置加载器，加载器在 Init 中确定，调用 Init 之前返回一个新的默认加载器
+func (b *Bot) getConfigLoader() *ConfigLoader {
+	if b.configLoader == nil {
+		return NewConfigLoader()
+	}
+	return b.configLoader
+}
+
+// ReloadConfig 重新加载配置，调用 Init 时传入的配置仍然会覆盖在最上层
+//
+// 加载失败或校验不通过时继续使用原有的配置并返回错误，同时只会有一次重新加载在进行
+func (b *Bot) ReloadConfig() error {
+	b.reloadMutex.Lock()
+	defer b.reloadMutex.Unlock()
+	loader := b.getConfigLoader()
+	conf, err := loader.Load(b.configOverrides...)
+	if err != nil {
+		b.log().Error("重新加载配置时出现错误，将继续使用原有的配置：", err)
+		return err
+	}
+	old := b.GetConfig()
+	changed := diffConfig(old, conf)
+	if len(changed) == 0 {
+		return nil
+	}
+	b.confMutex.Lock()
+	b.conf = conf
+	b.confMutex.Unlock()
+	b.applyConfig(old, conf, changed)
+	b.log().Infof("%s[Config] 配置已重新加载，发生变化的配置项：%s", lavender, strings.Join(changed, ", "))
+	SendConfigReloadedEvent(b, loader.GetPath(), changed, old, conf)
+	return nil
+}
+
+// applyConfig 使重新加载后的配置立即生效
+func (b *Bot) applyConfig(old, conf Config, changed []string) {
+	if old.LogLevel != conf.LogLevel {
+		if cl, ok := b.log().(*CryoLogger); ok && cl.TextLogger != nil {
+			cl.TextLogger.SetLevel(conf.LogLevel)
+		}
+	}
+	if old.IsConnectPrintMiddlewareEnabled() != conf.IsConnectPrintMiddlewareEnabled() {
+		b.Bus.RemoveMiddlewareByTag("builtin", "connect_print")
+		b.setConnectPrintMiddleware()
+	}
+	if old.IsMessagePrintMiddlewareEnabled() != conf.IsMessagePrintMiddlewareEnabled() {
+		b.Bus.RemoveMiddlewareByTag("builtin", "message_print")
+		b.setMessagePrintMiddleware()
+	}
+	if old.IsEventDebugMiddlewareEnabled() != conf.IsEventDebugMiddlewareEnabled() {
+		b.Bus.RemoveMiddlewareByTag("builtin", "event_debug")
+		b.setEventDebugMiddleware()
+	}
+	if old.AsyncWorkers != conf.AsyncWorkers || old.AsyncQueueSize != conf.AsyncQueueSize ||
+		old.AsyncOverflowPolicy != conf.AsyncOverflowPolicy || old.AsyncOrdering != conf.AsyncOrdering {
+		b.Bus.SetWorkerPool(WorkerPoolConfig{
+			Workers:        conf.AsyncWorkers,
+			QueueSize:      conf.AsyncQueueSize,
+			OverflowPolicy: conf.AsyncOverflowPolicy,
+			Ordering:       conf.AsyncOrdering,
+		})
+	}
+	if slices.ContainsFunc(changed, func(key string) bool {
+		return strings.HasPrefix(key, "sign_servers") || strings.HasPrefix(key, "sign_pool")
+	}) {
+		b.GetSignPool().SetServers(conf.SignPool, conf.SignServers...)
+	}
+	if slices.ContainsFunc(changed, func(key string) bool { return strings.HasPrefix(key, "accounts") }) && b.initFlag {
+		b.syncAccounts(conf.Accounts)
+	}
+	if !conf.IsWatchConfigEnabled() && old.IsWatchConfigEnabled() {
+		b.StopWatchConfig()
+	}
+	var restart []string
+	for _, key := range changed {
+		root, _, _ := strings.Cut(key, ".")
+		root, _, _ = strings.Cut(root, "[")
+		if slices.Contains(restartRequiredConfigKeys, root) && !slices.Contains(restart, root) {
+			restart = append(restart, root)
+		}
+	}
+	if len(restart) > 0 {
+		b.log().Warnf("[Config] 以下配置项需要重启后才能生效：%s", strings.Join(restart, ", "))
+	}
+}
+
+// diffConfig 返回两份配置中值不同的配置项，嵌套的配置项使用点号连接
+func diffConfig(old, conf Config) []string {
+	oldMap, err := configToMap(old)
+	if err != nil {
+		return nil
+	}
+	newMap, err := configToMap(conf)
+	if err != nil {
+		return nil
+	}
+	var changed []string
+	diffConfigMap("", oldMap, newMap, &changed)
+	slices.Sort(changed)
+	return changed
+}
+
+func diffConfigMap(prefix string, old, conf map[string]any, changed *[]string) {
+	for k := range old {
+		if _, ok := conf[k]; !ok {
+			*changed = append(*changed, prefix+k)
+		}
+	}
+	for k, v := range conf {
+		ov, ok := old[k]
+		if !ok {
+			*changed = append(*changed, prefix+k)
+			continue
+		}
+		om, ok1 := ov.(map[string]any)
+		nm, ok2 := v.(map[string]any)
+		if ok1 && ok2 {
+			diffConfigMap(prefix+k+".", om, nm, changed)
+			continue
+		}
+		if !reflect.DeepEqual(ov, v) {
+			*changed = append(*changed, prefix+k)
+		}
+	}
+}
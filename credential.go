@@ -0,0 +1,123 @@
+package cryobot
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// CredentialKeyEnv 用于加密保存登录凭据的密钥的环境变量，配置文件中没有设置 CredentialKey 时使用
+const CredentialKeyEnv = "CRYOBOT_CREDENTIAL_KEY"
+
+// credentialKey 返回加密登录凭据使用的密钥，没有设置或读取密钥文件失败时返回空字符串
+func (c Config) credentialKey() string {
+	key, _ := c.loadCredentialKey()
+	return key
+}
+
+// 加密凭据使用的密钥派生参数
+//
+// 密钥通过 PBKDF2-HMAC-SHA256 和随机盐派生，盐与随机数一起保存在密文的前面
+const (
+	credentialKdfIterations = 600000
+	credentialSaltSize      = 16
+	credentialV2Prefix      = "v2:" // 使用派生密钥加密的凭据的前缀
+)
+
+// credentialKeyCache 缓存派生出的密钥，避免每次加解密都进行耗时的密钥派生
+var credentialKeyCache sync.Map // map[[32]byte][]byte，键为密钥和盐的摘要
+
+// credentialSalts 每个密钥在当前进程中加密时使用的盐
+var credentialSalts sync.Map // map[string][]byte
+
+// deriveCredentialKey 使用 PBKDF2 从密钥和盐派生AES-256的密钥
+func deriveCredentialKey(key string, salt []byte) ([]byte, error) {
+	id := sha256.Sum256(append([]byte(key+"\x00"), salt...))
+	if derived, ok := credentialKeyCache.Load(id); ok {
+		return derived.([]byte), nil
+	}
+	derived, err := pbkdf2.Key(sha256.New, key, salt, credentialKdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	credentialKeyCache.Store(id, derived)
+	return derived, nil
+}
+
+// credentialSalt 返回当前进程中加密时使用的盐，每个密钥第一次加密时随机生成
+func credentialSalt(key string) ([]byte, error) {
+	if salt, ok := credentialSalts.Load(key); ok {
+		return salt.([]byte), nil
+	}
+	salt := make([]byte, credentialSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	actual, _ := credentialSalts.LoadOrStore(key, salt)
+	return actual.([]byte), nil
+}
+
+// newCredentialCipher 使用派生出的密钥创建AES-256-GCM加密器
+func newCredentialCipher(derived []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptCredential 加密登录凭据，返回带有 v2: 前缀的base64编码的盐、随机数与密文
+func encryptCredential(key string, plaintext []byte) (string, error) {
+	salt, err := credentialSalt(key)
+	if err != nil {
+		return "", err
+	}
+	derived, err := deriveCredentialKey(key, salt)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newCredentialCipher(derived)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	raw := append(append([]byte{}, salt...), gcm.Seal(nonce, nonce, plaintext, nil)...)
+	return credentialV2Prefix + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// decryptCredential 解密 encryptCredential 加密的登录凭据
+func decryptCredential(key string, data string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(data, credentialV2Prefix)
+	if !ok {
+		return nil, fmt.Errorf("不支持的登录凭据格式")
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < credentialSaltSize {
+		return nil, fmt.Errorf("登录凭据的长度不正确")
+	}
+	derived, err := deriveCredentialKey(key, raw[:credentialSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	raw = raw[credentialSaltSize:]
+	gcm, err := newCredentialCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return nil, fmt.Errorf("登录凭据的长度不正确")
+	}
+	return gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+}
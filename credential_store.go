@@ -0,0 +1,429 @@
+package cryobot
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-json-experiment/json"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// 客户端凭据存储
+//
+// 客户端信息中包含可以直接登录账号的会话签名，因此默认以0600权限保存，设置了密钥时整个文件会使用AES-GCM加密
+// 写入时先写入同目录下的临时文件再重命名，读写期间会对 <文件名>.lock 加文件锁，避免多个进程同时修改
+// 设置了数据目录时每个客户端的凭据单独保存在 sessions/<客户端ID>/ 中，见 DirCredentialStore
+
+// DefaultCredentialFile 默认的客户端凭据文件
+const DefaultCredentialFile = "client_infos.json"
+
+// ClientCredentialFile 按客户端保存凭据时每个客户端的凭据文件
+const ClientCredentialFile = "client_info.json"
+
+// CredentialKeyFileEnv 保存加密密钥的文件路径的环境变量，配置文件中没有设置 CredentialKeyFile 时使用
+const CredentialKeyFileEnv = "CRYOBOT_CREDENTIAL_KEY_FILE"
+
+// CredentialStore 客户端凭据的存储
+type CredentialStore interface {
+	Load() ([]CryoClientInfo, error) // 读取所有保存的客户端信息，没有保存过时返回空切片
+	Put(info CryoClientInfo) error   // 保存一个客户端信息，已经存在相同ID的信息时覆盖
+	Remove(id string) error          // 删除指定ID的客户端信息
+}
+
+// encryptedCredentialFile 加密后的凭据文件的内容
+//
+// 未加密的凭据文件是客户端信息的JSON数组，加密的凭据文件是带有 version 字段的JSON对象，
+// 目前只支持 version 为2的格式，使用 PBKDF2 派生的密钥加密，派生使用的盐保存在 encrypted 的开头
+type encryptedCredentialFile struct {
+	Version   int    `json:"version"`
+	Encrypted string `json:"encrypted"`
+}
+
+// encryptedCredentialVersion 写入加密的凭据文件时使用的格式版本
+const encryptedCredentialVersion = 2
+
+// FileCredentialStore 使用本地文件保存客户端凭据，Key 不为空时对文件进行加密
+type FileCredentialStore struct {
+	Path string
+	Key  string
+}
+
+// NewFileCredentialStore 创建一个不加密的文件凭据存储
+func NewFileCredentialStore(path string) *FileCredentialStore {
+	return &FileCredentialStore{Path: path}
+}
+
+// NewEncryptedCredentialStore 创建一个使用指定密钥加密的文件凭据存储，可以读取并迁移未加密的旧文件
+func NewEncryptedCredentialStore(path, key string) *FileCredentialStore {
+	return &FileCredentialStore{Path: path, Key: key}
+}
+
+// Load 读取所有保存的客户端信息
+func (s *FileCredentialStore) Load() ([]CryoClientInfo, error) {
+	var infos []CryoClientInfo
+	err := s.withLock(func() (err error) {
+		infos, _, err = s.read()
+		return err
+	})
+	return infos, err
+}
+
+// Put 保存一个客户端信息，已经存在相同ID的信息时覆盖
+func (s *FileCredentialStore) Put(info CryoClientInfo) error {
+	return s.withLock(func() error {
+		infos, _, err := s.read()
+		if err != nil {
+			return err
+		}
+		for i := range infos {
+			if infos[i].Id == info.Id {
+				infos[i] = info
+				return s.write(infos)
+			}
+		}
+		return s.write(append(infos, info))
+	})
+}
+
+// Remove 删除指定ID的客户端信息
+func (s *FileCredentialStore) Remove(id string) error {
+	return s.withLock(func() error {
+		infos, _, err := s.read()
+		if err != nil {
+			return err
+		}
+		updated := make([]CryoClientInfo, 0, len(infos))
+		for _, info := range infos {
+			if info.Id != id {
+				updated = append(updated, info)
+			}
+		}
+		return s.write(updated)
+	})
+}
+
+// Migrate 将未加密的旧文件重新以加密的形式写入，没有设置密钥或文件已经加密时不做任何处理
+func (s *FileCredentialStore) Migrate() (migrated bool, err error) {
+	if s.Key == "" {
+		return false, nil
+	}
+	err = s.withLock(func() error {
+		infos, encrypted, err := s.read()
+		if err != nil || encrypted || infos == nil {
+			return err
+		}
+		migrated = true
+		return s.write(infos)
+	})
+	return migrated, err
+}
+
+// withLock 在持有文件锁时执行操作
+func (s *FileCredentialStore) withLock(fn func() error) error {
+	if dir := filepath.Dir(s.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(s.Path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("锁定凭据文件时出现错误：%w", err)
+	}
+	defer unlockFile(f)
+	return fn()
+}
+
+// read 读取凭据文件，返回文件中的客户端信息以及文件是否已经加密，文件不存在时返回nil
+func (s *FileCredentialStore) read() ([]CryoClientInfo, bool, error) {
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+	// 只有带有版本号的JSON对象才是加密的凭据文件，其他内容都按照未加密的客户端信息数组解析
+	var file encryptedCredentialFile
+	encrypted := json.Unmarshal(data, &file) == nil && file.Version > 0
+	if encrypted {
+		if file.Version != encryptedCredentialVersion {
+			return nil, true, fmt.Errorf("不支持的凭据文件版本：%d", file.Version)
+		}
+		if s.Key == "" {
+			return nil, true, fmt.Errorf("凭据文件 %s 已经加密，但没有设置用于解密的密钥", s.Path)
+		}
+		if data, err = decryptCredential(s.Key, file.Encrypted); err != nil {
+			return nil, true, fmt.Errorf("解密凭据文件 %s 时出现错误：%w", s.Path, err)
+		}
+	}
+	var infos []CryoClientInfo
+	if err := json.Unmarshal(data, &infos); err != nil {
+		return nil, encrypted, err
+	}
+	if infos == nil {
+		infos = []CryoClientInfo{}
+	}
+	return infos, encrypted, nil
+}
+
+// write 将客户端信息写入同目录下的临时文件，再重命名为凭据文件
+func (s *FileCredentialStore) write(infos []CryoClientInfo) error {
+	if infos == nil {
+		infos = []CryoClientInfo{}
+	}
+	data, err := json.Marshal(infos)
+	if err != nil {
+		return err
+	}
+	if s.Key != "" {
+		encrypted, err := encryptCredential(s.Key, data)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(encryptedCredentialFile{Version: encryptedCredentialVersion, Encrypted: encrypted}); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // 重命名成功后临时文件已经不存在
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// DirCredentialStore 为每个客户端单独保存凭据的存储，客户端的凭据保存在 <Dir>/<客户端ID>/client_info.json 中
+//
+// 每个客户端的凭据文件与 FileCredentialStore 的格式相同，Key 不为空时同样会被加密
+// Dir 中旧的共用凭据文件 client_infos.json 会在读取时拆分到各个客户端的目录中，已经单独保存的客户端以单独保存的为准
+type DirCredentialStore struct {
+	Dir string
+	Key string
+}
+
+// NewDirCredentialStore 创建一个为每个客户端单独保存凭据的存储，key 为空时不加密
+func NewDirCredentialStore(dir, key string) *DirCredentialStore {
+	return &DirCredentialStore{Dir: dir, Key: key}
+}
+
+// Load 读取所有客户端保存的信息
+func (s *DirCredentialStore) Load() ([]CryoClientInfo, error) {
+	if err := s.split(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return []CryoClientInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]CryoClientInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(s.client(entry.Name()).Path); err != nil {
+			continue
+		}
+		clientInfos, err := s.client(entry.Name()).Load()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, clientInfos...)
+	}
+	return infos, nil
+}
+
+// Put 保存一个客户端信息，已经存在时覆盖
+func (s *DirCredentialStore) Put(info CryoClientInfo) error {
+	if !isValidSessionId(info.Id) {
+		return fmt.Errorf("无效的客户端ID：%q", info.Id)
+	}
+	return s.client(info.Id).withLock(func() error {
+		return s.client(info.Id).write([]CryoClientInfo{info})
+	})
+}
+
+// Remove 删除指定ID的客户端的凭据目录
+func (s *DirCredentialStore) Remove(id string) error {
+	if !isValidSessionId(id) {
+		return fmt.Errorf("无效的客户端ID：%q", id)
+	}
+	if err := s.split(); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.Dir, id))
+}
+
+// Migrate 将未加密的旧文件重新以加密的形式写入，没有设置密钥或文件都已经加密时不做任何处理
+func (s *DirCredentialStore) Migrate() (migrated bool, err error) {
+	if s.Key == "" {
+		return false, nil
+	}
+	infos, err := s.Load()
+	if err != nil {
+		return false, err
+	}
+	for _, info := range infos {
+		ok, err := s.client(info.Id).Migrate()
+		if err != nil {
+			return migrated, err
+		}
+		migrated = migrated || ok
+	}
+	return migrated, nil
+}
+
+// replace 使用指定的客户端信息覆盖存储中的所有客户端
+func (s *DirCredentialStore) replace(infos []CryoClientInfo) error {
+	saved, err := s.Load()
+	if err != nil {
+		return err
+	}
+	for _, info := range saved {
+		if !slices.ContainsFunc(infos, func(i CryoClientInfo) bool { return i.Id == info.Id }) {
+			if err := s.Remove(info.Id); err != nil {
+				return err
+			}
+		}
+	}
+	for _, info := range infos {
+		if err := s.Put(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// client 返回保存指定客户端凭据的文件存储
+func (s *DirCredentialStore) client(id string) *FileCredentialStore {
+	return &FileCredentialStore{Path: filepath.Join(s.Dir, id, ClientCredentialFile), Key: s.Key}
+}
+
+// split 将旧的共用凭据文件拆分到各个客户端的目录中，拆分完成后删除共用的文件
+func (s *DirCredentialStore) split() error {
+	shared := &FileCredentialStore{Path: filepath.Join(s.Dir, DefaultCredentialFile), Key: s.Key}
+	if _, err := os.Stat(shared.Path); os.IsNotExist(err) {
+		return nil
+	}
+	return shared.withLock(func() error {
+		infos, _, err := shared.read()
+		if err != nil || infos == nil {
+			return err
+		}
+		for _, info := range infos {
+			if !isValidSessionId(info.Id) {
+				continue
+			}
+			if _, err := os.Stat(s.client(info.Id).Path); err == nil {
+				continue
+			}
+			if err := s.Put(info); err != nil {
+				return err
+			}
+		}
+		return os.Remove(shared.Path)
+	})
+}
+
+// isValidSessionId 返回客户端ID是否可以作为凭据目录的名称
+func isValidSessionId(id string) bool {
+	return id != "" && id != "." && id != ".." && filepath.Base(id) == id
+}
+
+// newCredentialStore 根据配置创建凭据存储，设置了密钥时使用加密的文件，设置了数据目录时为每个客户端单独保存凭据
+func (c Config) newCredentialStore() (CredentialStore, error) {
+	key, err := c.loadCredentialKey()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetDataLayout().credentialStore(key), nil
+}
+
+// unavailableCredentialStore 无法创建凭据存储时使用的存储，所有操作都返回创建时的错误
+type unavailableCredentialStore struct {
+	err error
+}
+
+func (s unavailableCredentialStore) Load() ([]CryoClientInfo, error) { return nil, s.err }
+func (s unavailableCredentialStore) Put(CryoClientInfo) error        { return s.err }
+func (s unavailableCredentialStore) Remove(string) error             { return s.err }
+
+// credentialStore 返回目录布局对应的凭据存储，key 为空时不加密
+func (l DataLayout) credentialStore(key string) CredentialStore {
+	if !l.IsLegacy() {
+		return NewDirCredentialStore(l.SessionDir(), key)
+	}
+	return &FileCredentialStore{Path: l.CredentialFile(), Key: key}
+}
+
+// loadCredentialKey 依次从配置、环境变量 CRYOBOT_CREDENTIAL_KEY 和密钥文件中读取加密密钥，都没有设置时返回空字符串
+func (c Config) loadCredentialKey() (string, error) {
+	if c.CredentialKey != "" {
+		return c.CredentialKey, nil
+	}
+	if key := os.Getenv(CredentialKeyEnv); key != "" {
+		return key, nil
+	}
+	path := c.CredentialKeyFile
+	if path == "" {
+		path = os.Getenv(CredentialKeyFileEnv)
+	}
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("读取密钥文件时出现错误：%w", err)
+	}
+	key := string(bytes.TrimSpace(data))
+	if key == "" {
+		return "", fmt.Errorf("密钥文件 %s 为空", path)
+	}
+	return key, nil
+}
+
+// SetCredentialStore 设置Bot保存客户端凭据使用的存储
+func (b *Bot) SetCredentialStore(s CredentialStore) {
+	b.credentialStore = s
+}
+
+// GetCredentialStore 返回Bot保存客户端凭据使用的存储，没有设置时根据配置创建
+//
+// 读取密钥失败时返回的存储在所有操作中都会返回该错误，不会退回到不加密的存储
+func (b *Bot) GetCredentialStore() CredentialStore {
+	if b.credentialStore == nil {
+		s, err := b.GetConfig().newCredentialStore()
+		if err != nil {
+			b.log().Error("创建凭据存储时出现错误：", err)
+			s = unavailableCredentialStore{err: err}
+		}
+		b.credentialStore = s
+	}
+	return b.credentialStore
+}
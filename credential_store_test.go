@@ -0,0 +1,87 @@
+package cryobot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirCredentialStoreEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	store := NewDirCredentialStore(dir, "key")
+	if err := store.Put(CryoClientInfo{Id: "c1", Signature: "secret-signature", Uin: 10001}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "c1", ClientCredentialFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret-signature")) {
+		t.Fatalf("凭据文件中包含明文的会话签名：%s", data)
+	}
+
+	infos, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Signature != "secret-signature" || infos[0].Uin != 10001 {
+		t.Fatalf("infos = %+v", infos)
+	}
+	if _, err := NewDirCredentialStore(dir, "").Load(); err == nil {
+		t.Fatal("没有设置密钥时读取加密的凭据没有返回错误")
+	}
+	if _, err := NewDirCredentialStore(dir, "wrong").Load(); err == nil {
+		t.Fatal("使用错误的密钥读取凭据没有返回错误")
+	}
+}
+
+func TestCredentialFileRejectsOldVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultCredentialFile)
+	if err := os.WriteFile(path, []byte(`{"version":1,"encrypted":"AAAA"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEncryptedCredentialStore(path, "key").Load(); err == nil {
+		t.Fatal("读取 version 为1的凭据文件没有返回错误")
+	}
+}
+
+func TestCredentialStoreFailsClosed(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(DataDirEnv, dir)
+	t.Setenv(CredentialKeyEnv, "")
+	t.Setenv(CredentialKeyFileEnv, "")
+	if err := SaveClientInfo(CryoClientInfo{Id: "c1", Signature: "old-signature"}); err != nil {
+		t.Fatal(err)
+	}
+	// 先用密钥加密保存一次，再让密钥文件无法读取
+	t.Setenv(CredentialKeyEnv, "key")
+	if _, err := NewDirCredentialStore(EnvDataLayout().SessionDir(), "key").Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(EnvDataLayout().SessionDir(), "c1", ClientCredentialFile)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(CredentialKeyEnv, "")
+	t.Setenv(CredentialKeyFileEnv, filepath.Join(dir, "missing.key"))
+
+	if err := SaveClientInfo(CryoClientInfo{Id: "c1", Signature: "new-signature"}); err == nil {
+		t.Fatal("读取密钥失败时保存凭据没有返回错误")
+	}
+	if err := WriteClientInfos([]CryoClientInfo{{Id: "c1", Signature: "new-signature"}}); err == nil {
+		t.Fatal("读取密钥失败时覆盖凭据没有返回错误")
+	}
+	if _, err := ReadClientInfos(); err == nil {
+		t.Fatal("读取密钥失败时读取凭据没有返回错误")
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("读取密钥失败时加密的凭据文件被改写为：%s", after)
+	}
+}
@@ -0,0 +1,87 @@
+package cryobot
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestCredentialRoundTrip(t *testing.T) {
+	plaintext := []byte(`[{"id":"a","signature":"secret"}]`)
+	encrypted, err := encryptCredential("key", plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, credentialV2Prefix) {
+		t.Fatalf("密文缺少 %s 前缀：%s", credentialV2Prefix, encrypted)
+	}
+	if strings.Contains(encrypted, "secret") {
+		t.Fatal("密文中包含明文")
+	}
+	decrypted, err := decryptCredential("key", encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("decrypted = %s, want %s", decrypted, plaintext)
+	}
+
+	// 每次加密使用新的随机数，相同的明文得到不同的密文
+	again, _ := encryptCredential("key", plaintext)
+	if again == encrypted {
+		t.Fatal("两次加密得到了相同的密文")
+	}
+
+	if _, err := decryptCredential("wrong", encrypted); err == nil {
+		t.Fatal("使用错误的密钥解密没有返回错误")
+	}
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, credentialV2Prefix))
+	raw[len(raw)-1] ^= 1
+	if _, err := decryptCredential("key", credentialV2Prefix+base64.StdEncoding.EncodeToString(raw)); err == nil {
+		t.Fatal("解密被篡改的密文没有返回错误")
+	}
+	if _, err := decryptCredential("key", credentialV2Prefix+"AAAA"); err == nil {
+		t.Fatal("解密过短的密文没有返回错误")
+	}
+}
+
+func TestCredentialSalt(t *testing.T) {
+	encrypted, err := encryptCredential("salted", []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, credentialV2Prefix))
+	salt := raw[:credentialSaltSize]
+	if bytes.Equal(salt, make([]byte, credentialSaltSize)) {
+		t.Fatal("盐全部为0")
+	}
+	derived, err := deriveCredentialKey("salted", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256([]byte("salted")); bytes.Equal(derived, sum[:]) {
+		t.Fatal("派生的密钥等于密钥的摘要")
+	}
+	other, _ := deriveCredentialKey("salted", bytes.Repeat([]byte{1}, credentialSaltSize))
+	if bytes.Equal(derived, other) {
+		t.Fatal("不同的盐派生出了相同的密钥")
+	}
+}
+
+func TestCredentialRejectsUnsaltedFormat(t *testing.T) {
+	// 直接使用密钥摘要加密、没有 v2: 前缀的数据不能被解密
+	sum := sha256.Sum256([]byte("key"))
+	block, _ := aes.NewCipher(sum[:])
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	_, _ = rand.Read(nonce)
+	data := base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte("x"), nil))
+	if _, err := decryptCredential("key", data); err == nil {
+		t.Fatal("没有盐的旧格式仍然可以被解密")
+	}
+}
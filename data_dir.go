@@ -0,0 +1,156 @@
+package cryobot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 数据目录
+//
+// 设置了数据目录时，cryobot运行时读写的所有文件都会保存在数据目录下：
+//
+//	config/cryobot_config.json   配置文件，也可以是 .yaml / .yml / .toml 格式
+//	sessions/<客户端ID>/client_info.json 客户端凭据
+//	qrcode/<客户端ID>/qrcode.png  登录二维码
+//	dumps/<客户端ID>/<时间戳>.dump 协议层的错误转储
+//	plugins/<插件名>/             插件的数据
+//	logs/traces.jsonl            链路追踪的Span
+//
+// 配置中 webhooks 的死信文件、tracing.file 和 log_store.file 为相对路径时同样位于数据目录下
+// 没有设置数据目录时沿用旧的布局，配置文件、客户端凭据和二维码直接保存在工作目录中，所有客户端的凭据保存在同一个文件中
+
+// DataDirEnv 数据目录的环境变量，配置中没有设置 DataDir 时使用
+const DataDirEnv = "CRYOBOT_DATA_DIR"
+
+// DataLayout 运行时文件的目录布局
+type DataLayout struct {
+	Root string // 数据目录，为空时使用旧的布局
+}
+
+// NewDataLayout 创建以指定目录为根的目录布局，传入空字符串时使用旧的布局
+func NewDataLayout(root string) DataLayout {
+	return DataLayout{Root: root}
+}
+
+// EnvDataLayout 返回由环境变量 CRYOBOT_DATA_DIR 决定的目录布局
+func EnvDataLayout() DataLayout {
+	return NewDataLayout(os.Getenv(DataDirEnv))
+}
+
+// IsLegacy 返回是否在使用旧的布局
+func (l DataLayout) IsLegacy() bool {
+	return l.Root == ""
+}
+
+// Resolve 将相对路径解析为数据目录下的路径，绝对路径、空路径以及使用旧的布局时原样返回
+func (l DataLayout) Resolve(path string) string {
+	if path == "" || l.IsLegacy() || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(l.Root, path)
+}
+
+// ConfigFile 返回配置文件的路径
+func (l DataLayout) ConfigFile() string {
+	if l.IsLegacy() {
+		return "cryobot_config.json"
+	}
+	return filepath.Join(l.Root, "config", "cryobot_config.json")
+}
+
+// ConfigFileExts 查找配置文件时依次尝试的扩展名
+var ConfigFileExts = []string{".json", ".yaml", ".yml", ".toml"}
+
+// FindConfigFile 依次查找 JSON、YAML 和 TOML 格式的配置文件，都不存在时返回 JSON 配置文件的路径
+func (l DataLayout) FindConfigFile() string {
+	path := l.ConfigFile()
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range ConfigFileExts {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return path
+}
+
+// SessionDir 返回保存各个客户端凭据的目录，使用旧的布局时返回空字符串
+func (l DataLayout) SessionDir() string {
+	if l.IsLegacy() {
+		return ""
+	}
+	return filepath.Join(l.Root, "sessions")
+}
+
+// CredentialFile 返回所有客户端共用的凭据文件的路径，设置了数据目录时该文件只会在迁移到 SessionDir 时被读取
+func (l DataLayout) CredentialFile() string {
+	if l.IsLegacy() {
+		return DefaultCredentialFile
+	}
+	return filepath.Join(l.Root, "sessions", DefaultCredentialFile)
+}
+
+// QRCodeFile 返回指定客户端的登录二维码图片的路径
+func (l DataLayout) QRCodeFile(clientId string) string {
+	if l.IsLegacy() {
+		return fmt.Sprintf("QRCode_%s.png", clientId)
+	}
+	return filepath.Join(l.Root, "qrcode", clientId, "qrcode.png")
+}
+
+// DumpDir 返回指定客户端的协议层错误转储目录
+func (l DataLayout) DumpDir(clientId string) string {
+	if l.IsLegacy() {
+		return "dump"
+	}
+	return filepath.Join(l.Root, "dumps", clientId)
+}
+
+// TraceFile 返回保存链路追踪Span的文件路径
+func (l DataLayout) TraceFile() string {
+	if l.IsLegacy() {
+		return "traces.jsonl"
+	}
+	return filepath.Join(l.Root, "logs", "traces.jsonl")
+}
+
+// LogFile 返回日志存储默认使用的JSON日志文件路径
+func (l DataLayout) LogFile() string {
+	if l.IsLegacy() {
+		return "cryobot.jsonl"
+	}
+	return filepath.Join(l.Root, "logs", "cryobot.jsonl")
+}
+
+// PluginDir 返回指定插件的数据目录
+func (l DataLayout) PluginDir(name string) string {
+	return filepath.Join(l.Root, "plugins", name)
+}
+
+// Ensure 创建数据目录下的各个子目录，使用旧的布局时不做任何处理
+func (l DataLayout) Ensure() error {
+	if l.IsLegacy() {
+		return nil
+	}
+	for _, dir := range []string{"config", "qrcode", "dumps", "plugins", "logs"} {
+		if err := os.MkdirAll(filepath.Join(l.Root, dir), 0755); err != nil {
+			return err
+		}
+	}
+	// 客户端凭据中包含会话签名，只允许当前用户访问
+	return os.MkdirAll(filepath.Join(l.Root, "sessions"), 0700)
+}
+
+// GetDataLayout 返回配置对应的目录布局，没有设置 DataDir 时使用环境变量 CRYOBOT_DATA_DIR
+func (c Config) GetDataLayout() DataLayout {
+	if c.DataDir != "" {
+		return NewDataLayout(c.DataDir)
+	}
+	return EnvDataLayout()
+}
+
+// GetDataLayout 返回Bot使用的目录布局
+func (b *Bot) GetDataLayout() DataLayout {
+	return b.GetConfig().GetDataLayout()
+}
@@ -10,7 +10,9 @@ import (
 // 总之是通过实现logrus.Formatter接口来实现的
 
 // DefaultDarkFormatter 默认的暗色格式化样式
-type DefaultDarkFormatter struct{}
+type DefaultDarkFormatter struct {
+	HideFields bool // 是否隐藏日志携带的结构化字段
+}
 
 func (f *DefaultDarkFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	// 根据日志级别设置不同的颜色
@@ -55,7 +57,7 @@ func (f *DefaultDarkFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 
 	// 构建日志格式,可以按需修改
 	logMsg := fmt.Sprintf(
-		"%s• %s [%s%s%s] %s%s%s\n",
+		"%s• %s [%s%s%s] %s%s%s%s\n",
 		gray,
 		entry.Time.Format("2006-01-02 15:04:05"),
 		levelColor,
@@ -63,12 +65,21 @@ func (f *DefaultDarkFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 		gray,
 		textColor,
 		entry.Message,
+		formatEntryFields(entry, f.HideFields),
 		reset,
 	)
 
 	return []byte(logMsg), nil
 }
 
+// formatEntryFields 以灰色的 key=value 形式格式化日志条目携带的结构化字段，没有字段或隐藏字段时返回空字符串
+func formatEntryFields(entry *logrus.Entry, hide bool) string {
+	if hide || len(entry.Data) == 0 {
+		return ""
+	}
+	return " " + gray + formatFields(entry.Data)
+}
+
 var black = RGB("#000000")       // 黑色
 var darkGray = RGB("#A9A9A9")    // 深灰色
 var lightBlue = RGB("#ADD8E6")   // 浅蓝色
@@ -78,7 +89,9 @@ var lightRed = RGB("#FFA07A")    // 浅红色
 var lightPurple = RGB("#DDA0DD") // 浅紫色
 
 // DefaultLightFormatter 默认的亮色格式化样式
-type DefaultLightFormatter struct{}
+type DefaultLightFormatter struct {
+	HideFields bool // 是否隐藏日志携带的结构化字段
+}
 
 func (f *DefaultLightFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	// 根据日志级别设置不同的颜色
@@ -123,7 +136,7 @@ func (f *DefaultLightFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 
 	// 构建日志格式,可以按需修改
 	logMsg := fmt.Sprintf(
-		"%s• %s [%s%s%s] %s%s%s\n",
+		"%s• %s [%s%s%s] %s%s%s%s\n",
 		gray,
 		entry.Time.Format("2006-01-02 15:04:05"),
 		levelColor,
@@ -131,6 +144,7 @@ func (f *DefaultLightFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 		gray,
 		textColor,
 		entry.Message,
+		formatEntryFields(entry, f.HideFields),
 		reset,
 	)
 
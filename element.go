@@ -109,6 +109,8 @@ func (e *MarketFaceElement) Type() ElementType {
 type CryoMessage struct {
 	// 消息元素列表
 	Elements []Element
+
+	trace *SpanContext // 通过 Send / Reply 发送时所在的处理器Span
 }
 
 // BuildMessage 构建一个新的CryoMessage实例
@@ -32,6 +32,12 @@ const (
 	BotConnectedEventType                                        // 机器人连接事件类型
 	BotDisconnectedEventType                                     // 机器人断开连接事件类型
 	CustomEventType                                              // 自定义事件类型
+	HandlerErrorEventType                                        // 事件处理器错误事件类型
+	QRCodeLoginEventType                                         // 扫码登录事件类型
+	LoginVerificationEventType                                   // 登录验证事件类型
+	ConfigReloadedEventType                                      // 配置重新加载事件类型
+	SignServerEventType                                          // 签名服务器状态变化事件类型
+	BotHealthEventType                                           // 机器人健康检查事件类型
 )
 
 type (
@@ -60,6 +66,8 @@ type (
 		Platform    string   // 机器人平台
 		Summary     string   // 事件摘要
 		Time        uint32   // 事件发生的时间戳
+
+		Trace SpanContext `json:"-"` // 正在处理该事件的处理器Span，只在启用了链路追踪时由事件总线设置
 	}
 
 	// MessageEvent 是CryoBot的消息事件结构体
@@ -260,6 +268,54 @@ type (
 		summury string      // 摘要
 		payload interface{} // 负载
 	}
+	// HandlerErrorEvent 事件处理器或中间件出现panic或返回错误时发布的事件
+	HandlerErrorEvent struct {
+		BaseEvent
+		Source          string   // 错误来源，handler 或 middleware
+		HandlerId       string   // 出错的事件处理器或中间件的ID
+		HandlerTags     []string // 出错的事件处理器或中间件的标签
+		OriginEventId   string   // 触发错误的事件ID
+		OriginEventType uint32   // 触发错误的事件类型
+		Error           string   // 错误信息
+		Stack           string   // panic时的调用栈，处理器返回错误时为空
+		Panicked        bool     // 是否是panic导致的错误
+	}
+	// QRCodeLoginEvent 扫码登录的状态发生变化或二维码刷新时发布的事件
+	QRCodeLoginEvent struct {
+		BaseEvent
+		State     QRCodeLoginState // 扫码登录当前的状态
+		Url       string           // 当前二维码指向的链接
+		Refreshed int              // 二维码已经自动刷新的次数
+	}
+	// LoginVerificationEvent 密码登录需要完成滑块验证码或新设备验证时发布的事件
+	LoginVerificationEvent struct {
+		BaseEvent
+		Kind         LoginVerificationKind // 验证的类型
+		Url          string                // 验证链接
+		Verification *LoginVerification    `json:"-"` // 可以通过它提交滑块验证码的结果
+	}
+	// ConfigReloadedEvent 配置重新加载并且发生变化时发布的事件
+	ConfigReloadedEvent struct {
+		BaseEvent
+		Path      string   // 配置文件的路径
+		Changed   []string // 发生变化的配置项，嵌套的配置项使用点号连接，如 web_admin.addr
+		OldConfig Config   `json:"-"` // 重新加载前的配置，包含密钥等敏感信息，不会被序列化
+		Config    Config   `json:"-"` // 重新加载后的配置
+	}
+	// SignServerEvent 签名服务器的状态发生变化时发布的事件
+	SignServerEvent struct {
+		BaseEvent
+		Url      string          // 签名服务器的地址
+		State    SignServerState // 当前的状态
+		OldState SignServerState // 变化前的状态
+		Latency  int64           // 最近一次成功请求的延迟，单位为毫秒
+		Error    string          // 导致状态变化的错误，恢复可用时为空
+	}
+	// BotHealthEvent 每次对客户端进行健康检查后发布的事件
+	BotHealthEvent struct {
+		BaseEvent
+		ClientHealth
+	}
 )
 
 func (e BaseEvent) GetBaseEvent() BaseEvent {
@@ -366,6 +422,30 @@ func (e CustomEvent) Type() CryoEventType {
 	return CustomEventType
 }
 
+func (e HandlerErrorEvent) Type() CryoEventType {
+	return HandlerErrorEventType
+}
+
+func (e QRCodeLoginEvent) Type() CryoEventType {
+	return QRCodeLoginEventType
+}
+
+func (e LoginVerificationEvent) Type() CryoEventType {
+	return LoginVerificationEventType
+}
+
+func (e ConfigReloadedEvent) Type() CryoEventType {
+	return ConfigReloadedEventType
+}
+
+func (e SignServerEvent) Type() CryoEventType {
+	return SignServerEventType
+}
+
+func (e BotHealthEvent) Type() CryoEventType {
+	return BotHealthEventType
+}
+
 func (e BaseEvent) ToJson() []byte {
 	res, err := json.Marshal(e)
 	if err != nil {
@@ -558,6 +638,54 @@ func (e CustomEvent) ToJson() []byte {
 	return res
 }
 
+func (e HandlerErrorEvent) ToJson() []byte {
+	res, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	return res
+}
+
+func (e QRCodeLoginEvent) ToJson() []byte {
+	res, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	return res
+}
+
+func (e LoginVerificationEvent) ToJson() []byte {
+	res, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	return res
+}
+
+func (e ConfigReloadedEvent) ToJson() []byte {
+	res, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	return res
+}
+
+func (e SignServerEvent) ToJson() []byte {
+	res, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	return res
+}
+
+func (e BotHealthEvent) ToJson() []byte {
+	res, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	return res
+}
+
 func (e BaseEvent) ToJsonString() string {
 	return string(e.ToJson())
 }
@@ -654,6 +782,30 @@ func (e CustomEvent) ToJsonString() string {
 	return string(e.ToJson())
 }
 
+func (e HandlerErrorEvent) ToJsonString() string {
+	return string(e.ToJson())
+}
+
+func (e QRCodeLoginEvent) ToJsonString() string {
+	return string(e.ToJson())
+}
+
+func (e LoginVerificationEvent) ToJsonString() string {
+	return string(e.ToJson())
+}
+
+func (e ConfigReloadedEvent) ToJsonString() string {
+	return string(e.ToJson())
+}
+
+func (e SignServerEvent) ToJsonString() string {
+	return string(e.ToJson())
+}
+
+func (e BotHealthEvent) ToJsonString() string {
+	return string(e.ToJson())
+}
+
 func (e MessageEvent) replyDetail() (uint32, uint32, uint32, []message.IMessageElement) {
 	return e.MessageId, e.SenderUin, e.Time, e.MessageElements.ToIMessageElements()
 }
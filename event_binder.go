@@ -10,22 +10,26 @@ import (
 // EventBind 绑定LagrangeGo的事件到cryobot的事件总线
 func EventBind(cc *CryoClient) {
 
-	Infof("%s[Cryo] 正在将 %d 的消息事件绑定到事件总线", lavender, cc.Client.Uin)
+	cc.log().Infof("%s[Cryo] 正在将 %d 的消息事件绑定到事件总线", lavender, cc.Client.Uin)
 	// 断开连接
 	cc.Client.DisconnectedEvent.Subscribe(func(client *client.QQClient, event *client.DisconnectedEvent) {
-		SendBotConnectedEvent(cc)
+		cc.handleDisconnected(event.Message)
 	})
 
+	// 好友或自身改名
+	cc.Client.RenameEvent.Subscribe(cc.handleRename)
+
 	// 私聊消息
 	cc.Client.PrivateMessageEvent.Subscribe(func(client *client.QQClient, event *message.PrivateMessage) {
-		PublishAsync(PrivateMessageEvent{
+		cc.health.recordEvent()
+		cc.bus().PublishAsync(PrivateMessageEvent{
 			MessageEvent: MessageEvent{
 				BaseEvent: BaseEvent{
 					EventType:   uint32(PrivateMessageEventType),
 					EventId:     uuid.NewV4().String(),
 					EventTags:   []string{"private_message", "message"},
 					BotId:       cc.Id,
-					BotNickname: cc.Nickname,
+					BotNickname: cc.GetNickname(),
 					BotUin:      uint32(cc.Uin),
 					BotUid:      cc.Uid,
 					Platform:    cc.Platform,
@@ -50,14 +54,15 @@ func EventBind(cc *CryoClient) {
 
 	// 群聊消息
 	cc.Client.GroupMessageEvent.Subscribe(func(client *client.QQClient, event *message.GroupMessage) {
-		PublishAsync(GroupMessageEvent{
+		cc.health.recordEvent()
+		cc.bus().PublishAsync(GroupMessageEvent{
 			MessageEvent: MessageEvent{
 				BaseEvent: BaseEvent{
 					EventType:   uint32(GroupMessageEventType),
 					EventId:     uuid.NewV4().String(),
 					EventTags:   []string{"group_message", "message"},
 					BotId:       cc.Id,
-					BotNickname: cc.Nickname,
+					BotNickname: cc.GetNickname(),
 					BotUin:      uint32(cc.Uin),
 					BotUid:      cc.Uid,
 					Platform:    cc.Platform,
@@ -79,14 +84,15 @@ func EventBind(cc *CryoClient) {
 	})
 
 	cc.Client.TempMessageEvent.Subscribe(func(client *client.QQClient, event *message.TempMessage) {
-		PublishAsync(TempMessageEvent{
+		cc.health.recordEvent()
+		cc.bus().PublishAsync(TempMessageEvent{
 			MessageEvent: MessageEvent{
 				BaseEvent: BaseEvent{
 					EventType:   uint32(TempMessageEventType),
 					EventId:     uuid.NewV4().String(),
 					EventTags:   []string{"temp_message", "message"},
 					BotId:       cc.Id,
-					BotNickname: cc.Nickname,
+					BotNickname: cc.GetNickname(),
 					BotUin:      uint32(cc.Uin),
 					BotUid:      cc.Uid,
 					Platform:    cc.Platform,
@@ -106,5 +112,5 @@ func EventBind(cc *CryoClient) {
 		})
 	})
 
-	Infof("%s[Cryo] %d 的消息事件绑定完成", lavender, cc.Client.Uin)
+	cc.log().Infof("%s[Cryo] %d 的消息事件绑定完成", lavender, cc.Client.Uin)
 }
@@ -1,22 +1,40 @@
 package cryobot
 
-import "sync"
-
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Bus 默认事件总线，包级别的 Subscribe、Publish、AddMiddleware 等函数都作用于它
+//
+// NewBot 创建的Bot拥有各自独立的事件总线，不会使用默认事件总线；需要通过包级别的函数操作Bot时，使用 NewDefaultBot 创建Bot
 var Bus *CryoEventBus
 
+var defaultBusMutex sync.Mutex
+
+// DefaultBus 返回默认事件总线，如果尚未创建则会自动创建
+func DefaultBus() *CryoEventBus {
+	defaultBusMutex.Lock()
+	defer defaultBusMutex.Unlock()
+	if Bus == nil {
+		Bus = NewEventBus()
+	}
+	return Bus
+}
+
 // CryoEventHandler 用于实现事件处理器的接口
 type CryoEventHandler interface {
 	GetType() CryoEventType
 	GetId() string
 	GetTags() []string // 新增：获取处理器标签
-	Handle(event CryoEvent)
+	Handle(event CryoEvent) error
 }
 
 // EventHandler 是一个泛型事件处理器，用于处理特定类型的事件
 type EventHandler[T CryoEvent] struct {
 	handlerType CryoEventType
 	handlerId   string
-	handler     func(event T)
+	handler     func(event T) error
 	tags        []string
 }
 
@@ -30,12 +48,13 @@ func (h EventHandler[T]) GetId() string {
 	return h.handlerId
 }
 
-// Handle 处理事件
-func (h EventHandler[T]) Handle(event CryoEvent) {
+// Handle 处理事件，返回处理函数产生的错误
+func (h EventHandler[T]) Handle(event CryoEvent) error {
 	// 使用类型断言来确保事件类型匹配
 	if typedEvent, ok := event.(T); ok {
-		h.handler(typedEvent)
+		return h.handler(typedEvent)
 	}
+	return nil
 }
 
 // GetTags 返回事件处理器的标签
@@ -43,23 +62,99 @@ func (h EventHandler[T]) GetTags() []string {
 	return h.tags
 }
 
+// NewEventHandler 创建一个新的事件处理器，会为其生成唯一标识符
+func NewEventHandler[T CryoEvent](eventType CryoEventType, handler func(event T) error, tag ...string) EventHandler[T] {
+	// 如果提供了标签，使用标签；否则使用空字符串
+	var handlerTag []string
+	if len(tag) > 0 {
+		handlerTag = tag
+	}
+	return EventHandler[T]{
+		handlerType: eventType,
+		handlerId:   NewUUID(),
+		tags:        handlerTag,
+		handler:     handler,
+	}
+}
+
 // Middleware 是一个函数类型，用于定义事件处理过程中的中间件函数
 type Middleware func(event CryoEvent) CryoEvent
 
+// middlewareEntry 事件总线上注册的中间件
+type middlewareEntry struct {
+	id         string     // 注册时生成的唯一标识符，同一次注册的中间件共享同一个标识符
+	tags       []string   // 中间件的标签
+	middleware Middleware // 中间件函数
+}
+
 // CryoEventBus 是一个事件总线，用于管理事件的订阅和发布
 type CryoEventBus struct {
 	subscriberMutex sync.RWMutex
 	middlewareMutex sync.RWMutex
 	subscriber      map[CryoEventType][]CryoEventHandler
-	middleware      map[CryoEventType][]Middleware
+	wildcards       []wildcardHandler // 按分类、标签订阅或订阅所有事件的处理器
+	middleware      map[CryoEventType][]middlewareEntry
+	pool            atomic.Pointer[WorkerPool] // 异步事件工作池
+	logger          Logger                     // 事件总线使用的日志记录器，为空时使用全局日志记录器
+	metrics         *busMetrics                // 事件总线记录的指标，为空时不记录
+	tracer          *Tracer                    // 事件总线使用的Tracer，为空时不进行链路追踪
 }
 
 // NewEventBus 创建一个新的事件总线
-func NewEventBus() *CryoEventBus {
-	return &CryoEventBus{
+//
+// 可以传入异步事件工作池的配置，没有传入时使用默认配置
+func NewEventBus(poolConfig ...WorkerPoolConfig) *CryoEventBus {
+	config := DefaultWorkerPoolConfig
+	if len(poolConfig) > 0 {
+		config = poolConfig[0]
+	}
+	bus := &CryoEventBus{
 		subscriber: make(map[CryoEventType][]CryoEventHandler),
-		middleware: make(map[CryoEventType][]Middleware),
+		middleware: make(map[CryoEventType][]middlewareEntry),
 	}
+	bus.pool.Store(NewWorkerPool(config))
+	return bus
+}
+
+// SetWorkerPool 使用新的配置替换事件总线的异步工作池，旧工作池中已入队的事件会被处理完成
+func (bus *CryoEventBus) SetWorkerPool(config WorkerPoolConfig) {
+	old := bus.pool.Swap(NewWorkerPool(config))
+	if old != nil {
+		old.Close()
+	}
+}
+
+// SetLogger 设置事件总线使用的日志记录器
+func (bus *CryoEventBus) SetLogger(l Logger) {
+	bus.logger = l
+}
+
+// log 返回事件总线使用的日志记录器
+func (bus *CryoEventBus) log() Logger {
+	if bus.logger != nil {
+		return bus.logger
+	}
+	return GetLogger()
+}
+
+// SetTracer 设置事件总线使用的Tracer，为nil时不再进行链路追踪
+func (bus *CryoEventBus) SetTracer(t *Tracer) {
+	bus.tracer = t
+}
+
+// GetTracer 返回事件总线使用的Tracer
+func (bus *CryoEventBus) GetTracer() *Tracer {
+	return bus.tracer
+}
+
+// Stats 返回事件总线异步工作池的运行指标
+func (bus *CryoEventBus) Stats() WorkerPoolStats {
+	return bus.pool.Load().Stats()
+}
+
+// Close 关闭事件总线的异步工作池，等待已入队的事件处理完成
+func (bus *CryoEventBus) Close() {
+	bus.pool.Load().Close()
 }
 
 // applyMiddleware 应用中间件
@@ -69,9 +164,9 @@ func (bus *CryoEventBus) applyMiddleware(event CryoEvent) CryoEvent {
 	bus.middlewareMutex.RLock()
 	middlewareSlice, exists := bus.middleware[eventType]
 	// 创建一个中间件切片的副本，以避免在应用中间件时发生并发修改
-	var middlewareCopy []Middleware
+	var middlewareCopy []middlewareEntry
 	if exists {
-		middlewareCopy = make([]Middleware, len(middlewareSlice))
+		middlewareCopy = make([]middlewareEntry, len(middlewareSlice))
 		copy(middlewareCopy, middlewareSlice)
 	}
 	bus.middlewareMutex.RUnlock()
@@ -82,8 +177,8 @@ func (bus *CryoEventBus) applyMiddleware(event CryoEvent) CryoEvent {
 
 	// 优化了一下，在不持有锁的时候应用中间件
 	currentEvent := event
-	for _, middleware := range middlewareCopy {
-		currentEvent = middleware(currentEvent)
+	for _, entry := range middlewareCopy {
+		currentEvent = bus.callMiddleware(entry, currentEvent)
 		if currentEvent == nil {
 			return nil
 		}
@@ -91,143 +186,237 @@ func (bus *CryoEventBus) applyMiddleware(event CryoEvent) CryoEvent {
 	return currentEvent
 }
 
-// Subscribe 注册一个事件处理器，用于处理特定类型的事件
-func Subscribe[T CryoEvent](eventType CryoEventType, handler func(event T), tag ...string) string {
-	Bus.subscriberMutex.Lock()
-	defer Bus.subscriberMutex.Unlock()
-
-	if _, exists := Bus.subscriber[eventType]; !exists {
-		Bus.subscriber[eventType] = []CryoEventHandler{}
-	}
-
-	// 如果提供了标签，使用标签；否则使用空字符串
-	var handlerTag []string
-	if len(tag) > 0 {
-		handlerTag = tag
-	}
-
-	// 生成唯一标识符
-	handlerId := NewUUID()
-
-	eventHandler := EventHandler[T]{
-		handlerType: eventType,
-		handlerId:   handlerId,
-		tags:        handlerTag,
-		handler:     handler,
-	}
+// Subscribe 在事件总线上注册一个事件处理器，返回处理器的唯一标识符
+func (bus *CryoEventBus) Subscribe(handler CryoEventHandler) string {
+	bus.subscriberMutex.Lock()
+	defer bus.subscriberMutex.Unlock()
 
-	Bus.subscriber[eventType] = append(Bus.subscriber[eventType], eventHandler)
+	eventType := handler.GetType()
+	bus.subscriber[eventType] = append(bus.subscriber[eventType], handler)
 
 	// 返回handlerId，以便用户可以选择使用id或tag来解除订阅
-	return handlerId
+	return handler.GetId()
 }
 
-// Publish 发布事件
-func Publish(event CryoEvent) {
-	Bus.subscriberMutex.RLock()
-	defer Bus.subscriberMutex.RUnlock()
+// SubscribeMatcher 在事件总线上注册一个通配事件处理器，所有满足匹配条件的事件都会交给它处理
+func (bus *CryoEventBus) SubscribeMatcher(matcher EventMatcher, handler CryoEventHandler) string {
+	bus.subscriberMutex.Lock()
+	defer bus.subscriberMutex.Unlock()
 
-	eventType := event.Type()
+	bus.wildcards = append(bus.wildcards, wildcardHandler{
+		matcher: matcher,
+		handler: handler,
+	})
+	return handler.GetId()
+}
 
+// Publish 同步发布事件
+func (bus *CryoEventBus) Publish(event CryoEvent) {
+	bus.metrics.observeEvent(event)
+	span := bus.startPublishSpan(event, false)
+	defer span.End()
 	// 应用中间件
-	processedEvent := Bus.applyMiddleware(event)
+	processedEvent := bus.applyTracedMiddleware(span, event)
 	if processedEvent == nil {
 		return // 事件被中间件截断
 	}
 
-	// 获取订阅内容
-	handlers, exists := Bus.subscriber[eventType]
-	if !exists {
+	// 依次调用处理器
+	bus.dispatch(span.Context(), processedEvent, bus.handlers(processedEvent))
+}
+
+// PublishAsync 异步发布事件
+//
+// 事件会被放入有界的工作池队列中，由固定数量的工作协程依次调用处理器，队列已满时按照配置的溢出策略处理
+func (bus *CryoEventBus) PublishAsync(event CryoEvent) {
+	bus.metrics.observeEvent(event)
+	span := bus.startPublishSpan(event, true)
+	defer span.End()
+	// 应用中间件
+	processedEvent := bus.applyTracedMiddleware(span, event)
+	if processedEvent == nil {
 		return
 	}
 
-	// 依次调用处理器
+	handlers := bus.handlers(processedEvent)
+	if len(handlers) == 0 {
+		return
+	}
+
+	// 交给工作池异步调用处理器，处理器的Span会在工作协程中作为发布Span的子Span创建
+	accepted, dropped := bus.pool.Load().submit(asyncTask{
+		bus:      bus,
+		event:    processedEvent,
+		handlers: handlers,
+		trace:    span.Context(),
+	})
+	if !accepted {
+		span.SetAttribute("dropped", true)
+	}
+	if dropped > 0 {
+		bus.log().Debugf("[Cryo] 异步事件队列已满，已丢弃 %d 个事件", dropped)
+	}
+}
+
+// handlers 返回需要处理指定事件的处理器列表的副本
+//
+// 先是订阅了该事件类型的处理器，然后是按注册顺序排列的、匹配该事件的通配处理器
+// 避免在锁内进行处理器调用，这样处理器内部也可以安全地订阅或发布事件
+func (bus *CryoEventBus) handlers(event CryoEvent) []CryoEventHandler {
+	bus.subscriberMutex.RLock()
+	defer bus.subscriberMutex.RUnlock()
+
+	handlers := bus.subscriber[event.Type()]
+	handlersCopy := make([]CryoEventHandler, len(handlers), len(handlers)+len(bus.wildcards))
+	copy(handlersCopy, handlers)
+	for _, wildcard := range bus.wildcards {
+		if wildcard.matcher.Match(event) {
+			handlersCopy = append(handlersCopy, wildcard.handler)
+		}
+	}
+	return handlersCopy
+}
+
+// dispatch 依次调用处理器处理事件，parent 为处理器Span的父Span
+func (bus *CryoEventBus) dispatch(parent SpanContext, event CryoEvent, handlers []CryoEventHandler) {
 	for _, handler := range handlers {
-		handler.Handle(processedEvent)
+		bus.callHandler(parent, handler, event)
 	}
 }
 
-// PublishAsync 异步发布事件
-func PublishAsync(event CryoEvent) {
-	eventType := event.Type()
+// startPublishSpan 开始事件的根Span，链路ID为事件的 EventId
+func (bus *CryoEventBus) startPublishSpan(event CryoEvent, async bool) *ActiveSpan {
+	base := event.GetBaseEvent()
+	return bus.tracer.StartRootSpan(base.EventId, "publish").
+		SetAttribute("event_type", eventTypeName(event)).
+		SetAttribute("bot", base.BotUin).
+		SetAttribute("async", async)
+}
 
-	// 应用中间件
-	processedEvent := Bus.applyMiddleware(event)
+// applyTracedMiddleware 应用中间件，并将所有中间件的耗时记录为一个子Span
+func (bus *CryoEventBus) applyTracedMiddleware(parent *ActiveSpan, event CryoEvent) CryoEvent {
+	span := bus.tracer.StartSpan(parent.Context(), "middleware")
+	defer span.End()
+	processedEvent := bus.applyMiddleware(event)
 	if processedEvent == nil {
-		return
+		span.SetAttribute("dropped", true)
 	}
+	return processedEvent
+}
 
-	// 复制处理器列表
-	Bus.subscriberMutex.RLock()
-	handlers, exists := Bus.subscriber[eventType]
-	if !exists {
-		Bus.subscriberMutex.RUnlock()
+// AddMiddleware 为特定事件类型添加中间件，返回这次注册的唯一标识符
+func (bus *CryoEventBus) AddMiddleware(eventType CryoEventType, middleware ...Middleware) string {
+	return bus.AddTaggedMiddleware(eventType, nil, middleware...)
+}
+
+// AddTaggedMiddleware 为特定事件类型添加带标签的中间件，返回这次注册的唯一标识符
+//
+// 可以使用返回的标识符或标签来移除这些中间件
+func (bus *CryoEventBus) AddTaggedMiddleware(eventType CryoEventType, tags []string, middleware ...Middleware) string {
+	id := NewUUID()
+	bus.addMiddleware(id, tags, []CryoEventType{eventType}, middleware)
+	return id
+}
+
+// AddGlobalMiddleware 为所有事件类型添加中间件，返回这次注册的唯一标识符
+func (bus *CryoEventBus) AddGlobalMiddleware(middleware ...Middleware) string {
+	return bus.AddTaggedGlobalMiddleware(nil, middleware...)
+}
+
+// AddTaggedGlobalMiddleware 为所有事件类型添加带标签的中间件，返回这次注册的唯一标识符
+func (bus *CryoEventBus) AddTaggedGlobalMiddleware(tags []string, middleware ...Middleware) string {
+	id := NewUUID()
+	bus.addMiddleware(id, tags, AllEventTypes(), middleware)
+	return id
+}
+
+// addMiddleware 以指定的标识符和标签为一组事件类型添加中间件
+func (bus *CryoEventBus) addMiddleware(id string, tags []string, eventTypes []CryoEventType, middleware []Middleware) {
+	if len(middleware) == 0 {
 		return
 	}
 
-	// 避免在锁内进行处理器调用，创建一个处理器列表的副本
-	handlersCopy := make([]CryoEventHandler, len(handlers))
-	copy(handlersCopy, handlers)
-	Bus.subscriberMutex.RUnlock()
-
-	// 使用 goroutine 异步调用处理器
-	go func() {
-		var wg sync.WaitGroup
-		for _, handler := range handlersCopy {
-			wg.Add(1)
-			go func(h CryoEventHandler, e CryoEvent) {
-				defer wg.Done()
-				h.Handle(e)
-			}(handler, processedEvent)
+	bus.middlewareMutex.Lock()
+	defer bus.middlewareMutex.Unlock()
+
+	for _, eventType := range eventTypes {
+		for _, m := range middleware {
+			bus.middleware[eventType] = append(bus.middleware[eventType], middlewareEntry{
+				id:         id,
+				tags:       tags,
+				middleware: m,
+			})
 		}
-		wg.Wait()
-	}()
+	}
 }
 
-// AddMiddleware 为特定事件类型添加中间件
-func AddMiddleware(eventType CryoEventType, middleware ...Middleware) {
-	Bus.middlewareMutex.Lock()
-	defer Bus.middlewareMutex.Unlock()
+// RemoveMiddlewareById 移除指定标识符的中间件
+func (bus *CryoEventBus) RemoveMiddlewareById(id string) {
+	bus.removeMiddleware(func(entry middlewareEntry) bool {
+		return entry.id == id
+	})
+}
 
-	if _, exists := Bus.middleware[eventType]; !exists {
-		Bus.middleware[eventType] = []Middleware{}
+// RemoveMiddlewareByTag 移除同时包含所有传入标签的中间件
+func (bus *CryoEventBus) RemoveMiddlewareByTag(tag ...string) {
+	if len(tag) == 0 {
+		return
 	}
-	Bus.middleware[eventType] = append(Bus.middleware[eventType], middleware...)
+	bus.removeMiddleware(func(entry middlewareEntry) bool {
+		return containsAllTags(entry.tags, tag)
+	})
 }
 
-// AddGlobalMiddleware 为所有事件类型添加中间件
-func AddGlobalMiddleware(middleware ...Middleware) {
-	for _, eventType := range AllEventTypes() {
-		AddMiddleware(eventType, middleware...)
+// removeMiddleware 移除所有满足条件的中间件
+func (bus *CryoEventBus) removeMiddleware(match func(entry middlewareEntry) bool) {
+	bus.middlewareMutex.Lock()
+	defer bus.middlewareMutex.Unlock()
+
+	for eventType, entries := range bus.middleware {
+		// 创建新的切片，以免影响正在应用中的副本
+		newEntries := make([]middlewareEntry, 0, len(entries))
+		for _, entry := range entries {
+			if !match(entry) {
+				newEntries = append(newEntries, entry)
+			}
+		}
+		if len(newEntries) != len(entries) {
+			bus.middleware[eventType] = newEntries
+		}
 	}
 }
 
 // UnsubscribeById 取消订阅事件处理器
-func UnsubscribeById(handlerId string) {
-	Bus.subscriberMutex.Lock()
-	defer Bus.subscriberMutex.Unlock()
+func (bus *CryoEventBus) UnsubscribeById(handlerId string) {
+	bus.subscriberMutex.Lock()
+	defer bus.subscriberMutex.Unlock()
 
-	for eventType, handlers := range Bus.subscriber {
+	for eventType, handlers := range bus.subscriber {
 		for i, handler := range handlers {
 			if handler.GetId() == handlerId {
-				// 删除处理器
-				Bus.subscriber[eventType] = append(handlers[:i], handlers[i+1:]...)
+				// 删除处理器，创建新的切片以免影响正在分发中的副本
+				newHandlers := make([]CryoEventHandler, 0, len(handlers)-1)
+				newHandlers = append(newHandlers, handlers[:i]...)
+				bus.subscriber[eventType] = append(newHandlers, handlers[i+1:]...)
 				return
 			}
 		}
 	}
+	bus.removeWildcards(func(handler CryoEventHandler) bool {
+		return handler.GetId() == handlerId
+	})
 }
 
 // UnsubscribeByTag 取消订阅事件处理器
-func UnsubscribeByTag(tag ...string) {
+func (bus *CryoEventBus) UnsubscribeByTag(tag ...string) {
 	if len(tag) == 0 {
 		return
 	}
 
-	Bus.subscriberMutex.Lock()
-	defer Bus.subscriberMutex.Unlock()
+	bus.subscriberMutex.Lock()
+	defer bus.subscriberMutex.Unlock()
 
-	for eventType, handlers := range Bus.subscriber {
+	for eventType, handlers := range bus.subscriber {
 		// 创建新的切片来存储不包含指定标签的处理器
 		newHandlers := make([]CryoEventHandler, 0, len(handlers))
 		for _, handler := range handlers {
@@ -238,9 +427,142 @@ func UnsubscribeByTag(tag ...string) {
 
 		// 只在处理器数量发生变化时更新
 		if len(newHandlers) != len(handlers) {
-			Bus.subscriber[eventType] = newHandlers
+			bus.subscriber[eventType] = newHandlers
+		}
+	}
+	bus.removeWildcards(func(handler CryoEventHandler) bool {
+		return containsAllTags(handler.GetTags(), tag)
+	})
+}
+
+// removeWildcards 移除所有满足条件的通配处理器，调用时需要持有订阅锁
+func (bus *CryoEventBus) removeWildcards(match func(handler CryoEventHandler) bool) {
+	newWildcards := make([]wildcardHandler, 0, len(bus.wildcards))
+	for _, wildcard := range bus.wildcards {
+		if !match(wildcard.handler) {
+			newWildcards = append(newWildcards, wildcard)
 		}
 	}
+	bus.wildcards = newWildcards
+}
+
+/*
+
+以下是作用于默认事件总线的全局快捷方式
+
+*/
+
+// Subscribe 在默认事件总线上注册一个事件处理器，用于处理特定类型的事件
+func Subscribe[T CryoEvent](eventType CryoEventType, handler func(event T), tag ...string) string {
+	return SubscribeTo(DefaultBus(), eventType, handler, tag...)
+}
+
+// SubscribeE 在默认事件总线上注册一个会返回错误的事件处理器，处理器返回的错误会以 HandlerErrorEvent 的形式发布到事件总线
+func SubscribeE[T CryoEvent](eventType CryoEventType, handler func(event T) error, tag ...string) string {
+	return SubscribeETo(DefaultBus(), eventType, handler, tag...)
+}
+
+// SubscribeTo 在指定的事件总线上注册一个事件处理器
+func SubscribeTo[T CryoEvent](bus *CryoEventBus, eventType CryoEventType, handler func(event T), tag ...string) string {
+	return SubscribeETo(bus, eventType, func(event T) error {
+		handler(event)
+		return nil
+	}, tag...)
+}
+
+// SubscribeETo 在指定的事件总线上注册一个会返回错误的事件处理器
+func SubscribeETo[T CryoEvent](bus *CryoEventBus, eventType CryoEventType, handler func(event T) error, tag ...string) string {
+	return bus.Subscribe(NewEventHandler(eventType, handler, tag...))
+}
+
+// SubscribeMatch 在默认事件总线上注册一个通配事件处理器，所有满足匹配条件的事件都会交给它处理
+//
+// 处理函数的参数类型可以是具体的事件类型，也可以是 CryoEvent、CryoMessageEvent 这样的接口类型，无法转换为该类型的事件会被忽略
+func SubscribeMatch[T CryoEvent](matcher EventMatcher, handler func(event T), tag ...string) string {
+	return SubscribeMatchTo(DefaultBus(), matcher, handler, tag...)
+}
+
+// SubscribeMatchTo 在指定的事件总线上注册一个通配事件处理器
+func SubscribeMatchTo[T CryoEvent](bus *CryoEventBus, matcher EventMatcher, handler func(event T), tag ...string) string {
+	return SubscribeMatchETo(bus, matcher, func(event T) error {
+		handler(event)
+		return nil
+	}, tag...)
+}
+
+// SubscribeMatchETo 在指定的事件总线上注册一个会返回错误的通配事件处理器
+func SubscribeMatchETo[T CryoEvent](bus *CryoEventBus, matcher EventMatcher, handler func(event T) error, tag ...string) string {
+	return bus.SubscribeMatcher(matcher, NewEventHandler(BaseEventType, handler, tag...))
+}
+
+// SubscribeCategory 在默认事件总线上订阅某一分类的所有事件
+func SubscribeCategory[T CryoEvent](category EventCategory, handler func(event T), tag ...string) string {
+	return SubscribeMatch(EventMatcher{Category: category}, handler, tag...)
+}
+
+// SubscribeEventTag 在默认事件总线上订阅所有带有指定事件标签的事件，如 group_message
+func SubscribeEventTag[T CryoEvent](eventTag string, handler func(event T), tag ...string) string {
+	return SubscribeMatch(EventMatcher{Tag: eventTag}, handler, tag...)
+}
+
+// SubscribeAny 在默认事件总线上订阅所有事件
+func SubscribeAny(handler func(event CryoEvent), tag ...string) string {
+	return SubscribeMatch(EventMatcher{}, handler, tag...)
+}
+
+// Publish 在默认事件总线上同步发布事件
+func Publish(event CryoEvent) {
+	DefaultBus().Publish(event)
+}
+
+// PublishAsync 在默认事件总线上异步发布事件
+func PublishAsync(event CryoEvent) {
+	DefaultBus().PublishAsync(event)
+}
+
+// PublishStats 返回默认事件总线异步工作池的运行指标
+func PublishStats() WorkerPoolStats {
+	return DefaultBus().Stats()
+}
+
+// AddMiddleware 在默认事件总线上为特定事件类型添加中间件
+func AddMiddleware(eventType CryoEventType, middleware ...Middleware) string {
+	return DefaultBus().AddMiddleware(eventType, middleware...)
+}
+
+// AddTaggedMiddleware 在默认事件总线上为特定事件类型添加带标签的中间件
+func AddTaggedMiddleware(eventType CryoEventType, tags []string, middleware ...Middleware) string {
+	return DefaultBus().AddTaggedMiddleware(eventType, tags, middleware...)
+}
+
+// AddGlobalMiddleware 在默认事件总线上为所有事件类型添加中间件
+func AddGlobalMiddleware(middleware ...Middleware) string {
+	return DefaultBus().AddGlobalMiddleware(middleware...)
+}
+
+// AddTaggedGlobalMiddleware 在默认事件总线上为所有事件类型添加带标签的中间件
+func AddTaggedGlobalMiddleware(tags []string, middleware ...Middleware) string {
+	return DefaultBus().AddTaggedGlobalMiddleware(tags, middleware...)
+}
+
+// RemoveMiddlewareById 在默认事件总线上移除指定标识符的中间件
+func RemoveMiddlewareById(id string) {
+	DefaultBus().RemoveMiddlewareById(id)
+}
+
+// RemoveMiddlewareByTag 在默认事件总线上移除同时包含所有传入标签的中间件
+func RemoveMiddlewareByTag(tag ...string) {
+	DefaultBus().RemoveMiddlewareByTag(tag...)
+}
+
+// UnsubscribeById 在默认事件总线上取消订阅事件处理器
+func UnsubscribeById(handlerId string) {
+	DefaultBus().UnsubscribeById(handlerId)
+}
+
+// UnsubscribeByTag 在默认事件总线上取消订阅事件处理器
+func UnsubscribeByTag(tag ...string) {
+	DefaultBus().UnsubscribeByTag(tag...)
 }
 
 // containsAllTags 检查处理器是否包含所有传入的标签
@@ -285,5 +607,11 @@ func AllEventTypes() []CryoEventType {
 		BotConnectedEventType,
 		BotDisconnectedEventType,
 		CustomEventType,
+		HandlerErrorEventType,
+		QRCodeLoginEventType,
+		LoginVerificationEventType,
+		ConfigReloadedEventType,
+		SignServerEventType,
+		BotHealthEventType,
 	}
 }
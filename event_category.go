@@ -0,0 +1,90 @@
+package cryobot
+
+// EventCategory 事件分类，用于按分类订阅一组事件
+type EventCategory string
+
+const (
+	MessageCategory EventCategory = "message" // 消息事件
+	NoticeCategory  EventCategory = "notice"  // 通知事件，如撤回、戳一戳、群成员变动等
+	RequestCategory EventCategory = "request" // 请求事件，如好友申请、入群申请、加群邀请等
+	SystemCategory  EventCategory = "system"  // 系统事件，如Bot连接状态、处理器错误等
+	CustomCategory  EventCategory = "custom"  // 自定义事件
+)
+
+// eventCategories 事件类型到事件分类的映射
+var eventCategories = map[CryoEventType]EventCategory{
+	MessageEventType:                        MessageCategory,
+	PrivateMessageEventType:                 MessageCategory,
+	GroupMessageEventType:                   MessageCategory,
+	TempMessageEventType:                    MessageCategory,
+	NewFriendRequestEventType:               RequestCategory,
+	GroupMemberJoinRequestEventType:         RequestCategory,
+	GroupInviteEventType:                    RequestCategory,
+	NewFriendEventType:                      NoticeCategory,
+	FriendRecallEventType:                   NoticeCategory,
+	FriendRenameEventType:                   NoticeCategory,
+	FriendPokeEventType:                     NoticeCategory,
+	GroupMemberPermissionUpdatedEventType:   NoticeCategory,
+	GroupNameUpdatedEventType:               NoticeCategory,
+	GroupMuteEventType:                      NoticeCategory,
+	GroupRecallEventType:                    NoticeCategory,
+	GroupMemberIncreaseEventType:            NoticeCategory,
+	GroupMemberDecreaseEventType:            NoticeCategory,
+	GroupDigestEventType:                    NoticeCategory,
+	GroupReactionEventType:                  NoticeCategory,
+	GroupMemberSpecialTitleUpdatedEventType: NoticeCategory,
+	BotConnectedEventType:                   SystemCategory,
+	BotDisconnectedEventType:                SystemCategory,
+	HandlerErrorEventType:                   SystemCategory,
+	QRCodeLoginEventType:                    SystemCategory,
+	LoginVerificationEventType:              SystemCategory,
+	ConfigReloadedEventType:                 SystemCategory,
+	SignServerEventType:                     SystemCategory,
+	BotHealthEventType:                      SystemCategory,
+	CustomEventType:                         CustomCategory,
+}
+
+// CategoryOf 返回事件类型所属的事件分类
+func CategoryOf(eventType CryoEventType) EventCategory {
+	return eventCategories[eventType]
+}
+
+// EventTypesOf 返回属于指定事件分类的所有事件类型
+func EventTypesOf(category EventCategory) []CryoEventType {
+	var types []CryoEventType
+	for _, eventType := range AllEventTypes() {
+		if eventCategories[eventType] == category {
+			types = append(types, eventType)
+		}
+	}
+	return types
+}
+
+// EventMatcher 通配订阅的匹配条件
+//
+// 所有非空的条件都满足时才会匹配，全部为空时匹配所有事件
+type EventMatcher struct {
+	Category EventCategory   // 事件分类
+	Tag      string          // 事件标签，对应 BaseEvent.EventTags，如 group_message
+	Types    []CryoEventType // 事件类型
+}
+
+// Match 检查事件是否满足匹配条件
+func (m EventMatcher) Match(event CryoEvent) bool {
+	if m.Category != "" && CategoryOf(event.Type()) != m.Category {
+		return false
+	}
+	if m.Tag != "" && !Contains(event.GetBaseEvent().EventTags, m.Tag) {
+		return false
+	}
+	if len(m.Types) > 0 && !Contains(m.Types, event.Type()) {
+		return false
+	}
+	return true
+}
+
+// wildcardHandler 通配订阅的事件处理器
+type wildcardHandler struct {
+	matcher EventMatcher
+	handler CryoEventHandler
+}
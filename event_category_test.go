@@ -0,0 +1,62 @@
+package cryobot
+
+import "testing"
+
+func TestEventMatcher(t *testing.T) {
+	groupMessage := GroupMessageEvent{MessageEvent: MessageEvent{BaseEvent: BaseEvent{EventTags: []string{"message", "group_message"}}}}
+	friendRecall := FriendRecallEvent{BaseEvent: BaseEvent{EventTags: []string{"notice"}}}
+
+	if !(EventMatcher{}).Match(groupMessage) || !(EventMatcher{}).Match(friendRecall) {
+		t.Fatal("空的匹配条件应该匹配所有事件")
+	}
+
+	byCategory := EventMatcher{Category: MessageCategory}
+	if !byCategory.Match(groupMessage) || byCategory.Match(friendRecall) {
+		t.Fatal("按分类匹配的结果不正确")
+	}
+
+	byTag := EventMatcher{Tag: "group_message"}
+	if !byTag.Match(groupMessage) || byTag.Match(friendRecall) {
+		t.Fatal("按标签匹配的结果不正确")
+	}
+
+	byTypes := EventMatcher{Types: []CryoEventType{FriendRecallEventType, GroupRecallEventType}}
+	if byTypes.Match(groupMessage) || !byTypes.Match(friendRecall) {
+		t.Fatal("按类型匹配的结果不正确")
+	}
+
+	// 多个条件需要同时满足
+	combined := EventMatcher{Category: MessageCategory, Tag: "private_message"}
+	if combined.Match(groupMessage) {
+		t.Fatal("标签不满足时仍然匹配了事件")
+	}
+	combined.Tag = "group_message"
+	if !combined.Match(groupMessage) {
+		t.Fatal("分类和标签都满足时没有匹配事件")
+	}
+}
+
+func TestSubscribeMatcher(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	var all, notices, custom int
+	anyId := SubscribeMatchTo(bus, EventMatcher{}, func(CryoEvent) { all++ })
+	SubscribeMatchTo(bus, EventMatcher{Category: NoticeCategory}, func(CryoEvent) { notices++ })
+	SubscribeMatchTo(bus, EventMatcher{Tag: "custom"}, func(CustomEvent) { custom++ })
+
+	bus.Publish(FriendRecallEvent{})
+	bus.Publish(GroupRecallEvent{})
+	bus.Publish(CustomEvent{BaseEvent: BaseEvent{EventTags: []string{"custom"}}})
+	bus.Publish(CustomEvent{})
+	if all != 4 || notices != 2 || custom != 1 {
+		t.Fatalf("all = %d, notices = %d, custom = %d, want 4, 2, 1", all, notices, custom)
+	}
+
+	// 通配订阅可以通过ID取消
+	bus.UnsubscribeById(anyId)
+	bus.Publish(CustomEvent{})
+	if all != 4 {
+		t.Fatalf("取消订阅后通配处理器仍然被调用，all = %d", all)
+	}
+}
@@ -1,19 +1,19 @@
 package cryobot
 
 import (
+	"fmt"
 	uuid "github.com/satori/go.uuid"
 	"time"
 )
 
 func SendBotConnectedEvent(cc *CryoClient) {
-	botClientCount += 1
-	PublishAsync(BotConnectedEvent{
+	cc.bus().PublishAsync(BotConnectedEvent{
 		BaseEvent: BaseEvent{
 			EventType:   uint32(BotConnectedEventType),
 			EventId:     uuid.NewV4().String(),
 			EventTags:   []string{"system", "bot"},
 			BotId:       cc.Id,
-			BotNickname: cc.Nickname,
+			BotNickname: cc.GetNickname(),
 			BotUin:      uint32(cc.Uin),
 			BotUid:      cc.Uid,
 			Platform:    cc.Platform,
@@ -25,14 +25,13 @@ func SendBotConnectedEvent(cc *CryoClient) {
 }
 
 func SendBotDisconnectedEvent(cc *CryoClient) {
-	botClientCount -= 1
-	PublishAsync(BotDisconnectedEvent{
+	cc.bus().PublishAsync(BotDisconnectedEvent{
 		BaseEvent: BaseEvent{
 			EventType:   uint32(BotDisconnectedEventType),
 			EventId:     uuid.NewV4().String(),
 			EventTags:   []string{"system", "bot"},
 			BotId:       cc.Id,
-			BotNickname: cc.Nickname,
+			BotNickname: cc.GetNickname(),
 			BotUin:      uint32(cc.Uin),
 			BotUid:      cc.Uid,
 			Platform:    cc.Platform,
@@ -41,3 +40,100 @@ func SendBotDisconnectedEvent(cc *CryoClient) {
 		},
 	})
 }
+
+// SendQRCodeLoginEvent 发布扫码登录状态变化的事件
+func SendQRCodeLoginEvent(login *QRCodeLogin) {
+	c := login.client
+	c.bus().PublishAsync(QRCodeLoginEvent{
+		BaseEvent: BaseEvent{
+			EventType:   uint32(QRCodeLoginEventType),
+			EventId:     uuid.NewV4().String(),
+			EventTags:   []string{"system", "login"},
+			BotId:       c.Id,
+			BotNickname: c.GetNickname(),
+			BotUin:      uint32(c.Uin),
+			BotUid:      c.Uid,
+			Platform:    c.Platform,
+			Summary:     fmt.Sprintf("QRCodeLoginEvent(%s)", login.GetState()),
+			Time:        uint32(time.Now().Unix()),
+		},
+		State:     login.GetState(),
+		Url:       login.GetUrl(),
+		Refreshed: login.GetRefreshed(),
+	})
+}
+
+// SendLoginVerificationEvent 发布密码登录需要完成验证的事件
+func SendLoginVerificationEvent(c *CryoClient, v *LoginVerification) {
+	c.bus().PublishAsync(LoginVerificationEvent{
+		BaseEvent: BaseEvent{
+			EventType:   uint32(LoginVerificationEventType),
+			EventId:     uuid.NewV4().String(),
+			EventTags:   []string{"system", "login"},
+			BotId:       c.Id,
+			BotNickname: c.GetNickname(),
+			BotUin:      uint32(c.Uin),
+			BotUid:      c.Uid,
+			Platform:    c.Platform,
+			Summary:     fmt.Sprintf("LoginVerificationEvent(%s)", v.Kind),
+			Time:        uint32(time.Now().Unix()),
+		},
+		Kind:         v.Kind,
+		Url:          v.Url,
+		Verification: v,
+	})
+}
+
+// SendBotHealthEvent 发布客户端健康检查的结果
+func SendBotHealthEvent(c *CryoClient, h ClientHealth) {
+	c.bus().PublishAsync(BotHealthEvent{
+		BaseEvent: BaseEvent{
+			EventType:   uint32(BotHealthEventType),
+			EventId:     uuid.NewV4().String(),
+			EventTags:   []string{"system", "health"},
+			BotId:       c.Id,
+			BotNickname: c.GetNickname(),
+			BotUin:      uint32(c.Uin),
+			BotUid:      c.Uid,
+			Platform:    c.Platform,
+			Summary:     fmt.Sprintf("BotHealthEvent(%t)", h.Healthy),
+			Time:        uint32(time.Now().Unix()),
+		},
+		ClientHealth: h,
+	})
+}
+
+// SendConfigReloadedEvent 发布配置重新加载的事件
+func SendConfigReloadedEvent(b *Bot, path string, changed []string, old, conf Config) {
+	b.Bus.PublishAsync(ConfigReloadedEvent{
+		BaseEvent: BaseEvent{
+			EventType: uint32(ConfigReloadedEventType),
+			EventId:   uuid.NewV4().String(),
+			EventTags: []string{"system", "config"},
+			Summary:   fmt.Sprintf("ConfigReloadedEvent(%d)", len(changed)),
+			Time:      uint32(time.Now().Unix()),
+		},
+		Path:      path,
+		Changed:   changed,
+		OldConfig: old,
+		Config:    conf,
+	})
+}
+
+// SendSignServerEvent 发布签名服务器状态变化的事件
+func SendSignServerEvent(b *Bot, url string, old, state SignServerState, latency int64, reason string) {
+	b.Bus.PublishAsync(SignServerEvent{
+		BaseEvent: BaseEvent{
+			EventType: uint32(SignServerEventType),
+			EventId:   uuid.NewV4().String(),
+			EventTags: []string{"system", "sign"},
+			Summary:   fmt.Sprintf("SignServerEvent(%s: %s)", url, state),
+			Time:      uint32(time.Now().Unix()),
+		},
+		Url:      url,
+		State:    state,
+		OldState: old,
+		Latency:  latency,
+		Error:    reason,
+	})
+}
@@ -0,0 +1,315 @@
+package cryobot
+
+import (
+	"bytes"
+	"hash/fnv"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy 异步事件队列已满时的处理策略
+type OverflowPolicy string
+
+const (
+	OverflowBlock      OverflowPolicy = "block"       // 阻塞发布者，直到队列有空位；在处理器中异步发布时不会阻塞，而是丢弃新事件，见 taskQueue.push
+	OverflowDropOldest OverflowPolicy = "drop_oldest" // 丢弃队列中最旧的事件，为新事件腾出位置
+	OverflowDropNewest OverflowPolicy = "drop_newest" // 直接丢弃新发布的事件
+)
+
+// OrderingMode 异步事件处理的顺序保证粒度
+type OrderingMode string
+
+const (
+	OrderingNone    OrderingMode = "none"  // 不保证顺序，事件会被轮流分配给各个工作协程
+	OrderingByBot   OrderingMode = "bot"   // 同一个Bot的事件按发布顺序依次处理
+	OrderingByGroup OrderingMode = "group" // 同一个Bot在同一个群（或私聊对象）中的事件按发布顺序依次处理
+)
+
+// WorkerPoolConfig 异步事件工作池的配置
+type WorkerPoolConfig struct {
+	Workers        int            // 工作协程数量
+	QueueSize      int            // 每个工作协程的队列长度
+	OverflowPolicy OverflowPolicy // 队列已满时的处理策略
+	Ordering       OrderingMode   // 顺序保证粒度
+}
+
+// DefaultWorkerPoolConfig 默认的异步事件工作池配置
+var DefaultWorkerPoolConfig = WorkerPoolConfig{
+	Workers:        16,
+	QueueSize:      256,
+	OverflowPolicy: OverflowBlock,
+	Ordering:       OrderingNone,
+}
+
+// WorkerPoolStats 异步事件工作池的运行指标
+type WorkerPoolStats struct {
+	Workers       int    // 工作协程数量
+	QueueCapacity int    // 所有队列的总容量
+	QueueDepth    int    // 当前所有队列中等待处理的事件总数
+	QueueDepths   []int  // 每个工作协程队列中等待处理的事件数
+	Submitted     uint64 // 已提交的事件数
+	Processed     uint64 // 已处理完成的事件数
+	Dropped       uint64 // 因队列已满而被丢弃的事件数
+}
+
+// asyncTask 一次异步发布产生的处理任务
+type asyncTask struct {
+	bus      *CryoEventBus
+	event    CryoEvent
+	handlers []CryoEventHandler
+	trace    SpanContext // 发布事件时的Span
+}
+
+// taskQueue 一个有界的环形任务队列
+type taskQueue struct {
+	mutex    sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    []asyncTask
+	head     int
+	size     int
+	closed   bool
+}
+
+func newTaskQueue(capacity int) *taskQueue {
+	q := &taskQueue{items: make([]asyncTask, capacity)}
+	q.notEmpty = sync.NewCond(&q.mutex)
+	q.notFull = sync.NewCond(&q.mutex)
+	return q
+}
+
+// push 将任务放入队列，返回是否成功放入以及被挤出的任务数量
+//
+// 处理器本身运行在工作协程中，如果它异步发布的事件被分配到已满的队列（包括它自己的队列），
+// 阻塞等待可能永远不会结束，因此工作协程发布时即使策略为 OverflowBlock 也会直接丢弃新事件
+func (q *taskQueue) push(task asyncTask, policy OverflowPolicy) (accepted bool, dropped int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for q.size == len(q.items) && !q.closed {
+		switch policy {
+		case OverflowDropNewest:
+			return false, 1
+		case OverflowDropOldest:
+			// 丢弃队首的任务
+			q.items[q.head] = asyncTask{}
+			q.head = (q.head + 1) % len(q.items)
+			q.size--
+			dropped++
+		default:
+			if isWorkerGoroutine() {
+				return false, 1
+			}
+			q.notFull.Wait()
+		}
+	}
+	if q.closed {
+		return false, dropped + 1
+	}
+	q.items[(q.head+q.size)%len(q.items)] = task
+	q.size++
+	q.notEmpty.Signal()
+	return true, dropped
+}
+
+// pop 从队列中取出一个任务，队列关闭且为空时返回false
+func (q *taskQueue) pop() (asyncTask, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for q.size == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.size == 0 {
+		return asyncTask{}, false
+	}
+	task := q.items[q.head]
+	q.items[q.head] = asyncTask{}
+	q.head = (q.head + 1) % len(q.items)
+	q.size--
+	q.notFull.Signal()
+	return task, true
+}
+
+// len 返回队列中等待处理的任务数
+func (q *taskQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.size
+}
+
+// close 关闭队列，唤醒所有等待中的协程
+func (q *taskQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// WorkerPool 有界的异步事件工作池
+//
+// 每个工作协程拥有自己的队列，拥有相同顺序键的事件总会被分配到同一个工作协程，从而保证它们的处理顺序
+type WorkerPool struct {
+	config    WorkerPoolConfig
+	queues    []*taskQueue
+	wg        sync.WaitGroup
+	next      atomic.Uint64 // 轮询分配的计数器
+	submitted atomic.Uint64
+	processed atomic.Uint64
+	dropped   atomic.Uint64
+	closeOnce sync.Once
+}
+
+// NewWorkerPool 创建并启动一个新的异步事件工作池，未设置的配置项会使用默认值
+func NewWorkerPool(config WorkerPoolConfig) *WorkerPool {
+	if config.Workers <= 0 {
+		config.Workers = DefaultWorkerPoolConfig.Workers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultWorkerPoolConfig.QueueSize
+	}
+	if config.OverflowPolicy == "" {
+		config.OverflowPolicy = DefaultWorkerPoolConfig.OverflowPolicy
+	}
+	if config.Ordering == "" {
+		config.Ordering = DefaultWorkerPoolConfig.Ordering
+	}
+
+	p := &WorkerPool{
+		config: config,
+		queues: make([]*taskQueue, config.Workers),
+	}
+	for i := range p.queues {
+		p.queues[i] = newTaskQueue(config.QueueSize)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// work 工作协程的主循环，依次处理队列中的任务
+func (p *WorkerPool) work(q *taskQueue) {
+	defer p.wg.Done()
+	id := goroutineId()
+	workerGoroutines.Store(id, struct{}{})
+	defer workerGoroutines.Delete(id)
+	for {
+		task, ok := q.pop()
+		if !ok {
+			return
+		}
+		task.bus.dispatch(task.trace, task.event, task.handlers)
+		p.processed.Add(1)
+	}
+}
+
+// submit 提交一个异步任务，返回任务是否被接受以及因此被丢弃的任务数量
+func (p *WorkerPool) submit(task asyncTask) (bool, int) {
+	p.submitted.Add(1)
+	q := p.queues[p.pick(task.event)]
+	accepted, dropped := q.push(task, p.config.OverflowPolicy)
+	if dropped > 0 {
+		p.dropped.Add(uint64(dropped))
+	}
+	return accepted, dropped
+}
+
+// pick 根据顺序保证粒度选择处理事件的工作协程
+func (p *WorkerPool) pick(event CryoEvent) int {
+	var key string
+	switch p.config.Ordering {
+	case OrderingByBot:
+		key = event.GetBaseEvent().BotId
+	case OrderingByGroup:
+		key = event.GetBaseEvent().BotId + ":" + strconv.FormatUint(uint64(eventGroupUin(event)), 10)
+	default:
+		return int((p.next.Add(1) - 1) % uint64(len(p.queues)))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// Stats 返回工作池当前的运行指标
+func (p *WorkerPool) Stats() WorkerPoolStats {
+	stats := WorkerPoolStats{
+		Workers:       len(p.queues),
+		QueueCapacity: len(p.queues) * p.config.QueueSize,
+		QueueDepths:   make([]int, len(p.queues)),
+		Submitted:     p.submitted.Load(),
+		Processed:     p.processed.Load(),
+		Dropped:       p.dropped.Load(),
+	}
+	for i, q := range p.queues {
+		stats.QueueDepths[i] = q.len()
+		stats.QueueDepth += stats.QueueDepths[i]
+	}
+	return stats
+}
+
+// Close 关闭工作池，等待所有已入队的事件处理完成
+func (p *WorkerPool) Close() {
+	p.closeOnce.Do(func() {
+		for _, q := range p.queues {
+			q.close()
+		}
+	})
+	p.wg.Wait()
+}
+
+// workerGoroutines 所有工作池中工作协程的ID
+var workerGoroutines sync.Map
+
+// isWorkerGoroutine 返回当前协程是否是工作池的工作协程
+func isWorkerGoroutine() bool {
+	_, ok := workerGoroutines.Load(goroutineId())
+	return ok
+}
+
+// goroutineId 从调用栈的第一行 "goroutine <ID> [...]" 中解析当前协程的ID，只在队列已满时使用
+func goroutineId() uint64 {
+	var buf [64]byte
+	line := buf[:runtime.Stack(buf[:], false)]
+	line = bytes.TrimPrefix(line, []byte("goroutine "))
+	line, _, _ = bytes.Cut(line, []byte(" "))
+	id, _ := strconv.ParseUint(string(line), 10, 64)
+	return id
+}
+
+// eventGroupUin 获取事件所属的群号，私聊类事件返回对方的Uin，无法确定时返回0
+func eventGroupUin(event CryoEvent) uint32 {
+	switch e := event.(type) {
+	case CryoMessageEvent:
+		return e.GetMessageEvent().GroupUin
+	case GroupMemberPermissionUpdatedEvent:
+		return e.GroupUin
+	case GroupNameUpdatedEvent:
+		return e.GroupUin
+	case GroupMuteEvent:
+		return e.GroupUin
+	case GroupRecallEvent:
+		return e.GroupUin
+	case GroupMemberJoinRequestEvent:
+		return e.GroupUin
+	case GroupMemberIncreaseEvent:
+		return e.GroupUin
+	case GroupMemberDecreaseEvent:
+		return e.GroupUin
+	case GroupDigestEvent:
+		return e.GroupUin
+	case GroupReactionEvent:
+		return e.GroupUin
+	case GroupMemberSpecialTitleUpdated:
+		return e.GroupUin
+	case GroupInviteEvent:
+		return e.GroupUin
+	case FriendRecallEvent:
+		return e.Uin
+	case FriendPokeEvent:
+		return e.SenderUin
+	}
+	return 0
+}
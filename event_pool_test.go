@@ -0,0 +1,270 @@
+package cryobot
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testTask(id string) asyncTask {
+	return asyncTask{event: BaseEvent{EventId: id}}
+}
+
+// funcHandler 调用指定函数处理自定义事件的处理器
+type funcHandler func(CryoEvent)
+
+func (h funcHandler) GetType() CryoEventType { return CustomEventType }
+func (h funcHandler) GetId() string          { return "func" }
+func (h funcHandler) GetTags() []string      { return nil }
+func (h funcHandler) Handle(e CryoEvent) error {
+	h(e)
+	return nil
+}
+
+// drainTaskQueue 取出队列中所有的任务并返回它们的事件ID
+func drainTaskQueue(q *taskQueue) []string {
+	var ids []string
+	for q.len() > 0 {
+		task, _ := q.pop()
+		ids = append(ids, task.event.GetBaseEvent().EventId)
+	}
+	return ids
+}
+
+func TestTaskQueueOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		policy   OverflowPolicy
+		push     []string
+		accepted []bool
+		dropped  int
+		remain   []string
+	}{
+		{
+			name:     "未满时按顺序入队",
+			capacity: 3,
+			policy:   OverflowDropNewest,
+			push:     []string{"a", "b"},
+			accepted: []bool{true, true},
+			remain:   []string{"a", "b"},
+		},
+		{
+			name:     "丢弃最新的事件",
+			capacity: 2,
+			policy:   OverflowDropNewest,
+			push:     []string{"a", "b", "c", "d"},
+			accepted: []bool{true, true, false, false},
+			dropped:  2,
+			remain:   []string{"a", "b"},
+		},
+		{
+			name:     "丢弃最旧的事件",
+			capacity: 2,
+			policy:   OverflowDropOldest,
+			push:     []string{"a", "b", "c", "d"},
+			accepted: []bool{true, true, true, true},
+			dropped:  2,
+			remain:   []string{"c", "d"},
+		},
+		{
+			name:     "丢弃最旧的事件后环形队列绕回开头",
+			capacity: 3,
+			policy:   OverflowDropOldest,
+			push:     []string{"a", "b", "c", "d", "e"},
+			accepted: []bool{true, true, true, true, true},
+			dropped:  2,
+			remain:   []string{"c", "d", "e"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTaskQueue(tt.capacity)
+			dropped := 0
+			for i, id := range tt.push {
+				accepted, n := q.push(testTask(id), tt.policy)
+				if accepted != tt.accepted[i] {
+					t.Errorf("push(%s) accepted = %v, want %v", id, accepted, tt.accepted[i])
+				}
+				dropped += n
+			}
+			if dropped != tt.dropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.dropped)
+			}
+			if got := drainTaskQueue(q); !slices.Equal(got, tt.remain) {
+				t.Errorf("remain = %v, want %v", got, tt.remain)
+			}
+		})
+	}
+}
+
+func TestTaskQueueBlock(t *testing.T) {
+	q := newTaskQueue(1)
+	q.push(testTask("a"), OverflowBlock)
+	pushed := make(chan bool)
+	go func() {
+		accepted, _ := q.push(testTask("b"), OverflowBlock)
+		pushed <- accepted
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("队列已满时 push 没有阻塞")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if task, _ := q.pop(); task.event.GetBaseEvent().EventId != "a" {
+		t.Fatalf("pop = %s, want a", task.event.GetBaseEvent().EventId)
+	}
+	select {
+	case accepted := <-pushed:
+		if !accepted {
+			t.Fatal("队列有空位后 push 没有成功")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("队列有空位后 push 仍然阻塞")
+	}
+}
+
+func TestTaskQueueClose(t *testing.T) {
+	q := newTaskQueue(1)
+	q.push(testTask("a"), OverflowBlock)
+	done := make(chan bool)
+	go func() {
+		accepted, _ := q.push(testTask("b"), OverflowBlock)
+		done <- accepted
+	}()
+	time.Sleep(20 * time.Millisecond)
+	q.close()
+	if accepted := <-done; accepted {
+		t.Fatal("关闭队列后 push 不应该成功")
+	}
+	if _, ok := q.pop(); !ok {
+		t.Fatal("关闭队列后仍然应该能取出已入队的任务")
+	}
+	if _, ok := q.pop(); ok {
+		t.Fatal("关闭且为空的队列 pop 应该返回false")
+	}
+}
+
+func TestWorkerPoolOrderingByBot(t *testing.T) {
+	bus := NewEventBus(WorkerPoolConfig{Workers: 4, QueueSize: 64, Ordering: OrderingByBot})
+	defer bus.Close()
+
+	var mutex sync.Mutex
+	got := map[string][]int{}
+	bus.Subscribe(funcHandler(func(e CryoEvent) {
+		base := e.GetBaseEvent()
+		var n int
+		_, _ = fmt.Sscanf(base.EventId, base.BotId+"-%d", &n)
+		if n%3 == 0 {
+			time.Sleep(time.Millisecond) // 让先发布的事件处理得更慢
+		}
+		mutex.Lock()
+		got[base.BotId] = append(got[base.BotId], n)
+		mutex.Unlock()
+	}))
+
+	bots := []string{"a", "b", "c", "d", "e"}
+	for i := range 20 {
+		for _, bot := range bots {
+			bus.PublishAsync(CustomEvent{BaseEvent: BaseEvent{BotId: bot, EventId: fmt.Sprintf("%s-%d", bot, i)}})
+		}
+	}
+	bus.Close()
+
+	for _, bot := range bots {
+		if len(got[bot]) != 20 || !slices.IsSorted(got[bot]) {
+			t.Errorf("Bot %s 的事件处理顺序为 %v", bot, got[bot])
+		}
+	}
+}
+
+func TestWorkerPoolPickByGroup(t *testing.T) {
+	p := NewWorkerPool(WorkerPoolConfig{Workers: 8, Ordering: OrderingByGroup})
+	defer p.Close()
+
+	event := func(bot string, group uint32) CryoEvent {
+		return GroupRecallEvent{BaseEvent: BaseEvent{BotId: bot}, GroupUin: group}
+	}
+	// 同一个Bot在同一个群中的事件总是分配到同一个工作协程
+	for range 10 {
+		if p.pick(event("a", 1001)) != p.pick(event("a", 1001)) {
+			t.Fatal("同一个群的事件被分配到了不同的工作协程")
+		}
+	}
+	// 不同的群应该被分散到多个工作协程
+	workers := map[int]bool{}
+	for group := range uint32(64) {
+		workers[p.pick(event("a", group))] = true
+	}
+	if len(workers) < 2 {
+		t.Fatalf("64个群的事件只被分配到了 %d 个工作协程", len(workers))
+	}
+}
+
+func TestWorkerPoolStats(t *testing.T) {
+	p := NewWorkerPool(WorkerPoolConfig{Workers: 1, QueueSize: 2, OverflowPolicy: OverflowDropNewest})
+	bus := NewEventBus()
+	defer bus.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	task := func(id string) asyncTask {
+		return asyncTask{bus: bus, event: BaseEvent{EventId: id}, handlers: []CryoEventHandler{funcHandler(func(e CryoEvent) {
+			if e.GetBaseEvent().EventId == "a" {
+				close(started)
+				<-release
+			}
+		})}}
+	}
+
+	p.submit(task("a"))
+	<-started // a 正在处理，之后的任务留在队列中
+	for _, id := range []string{"b", "c", "d"} {
+		p.submit(task(id))
+	}
+	stats := p.Stats()
+	if stats.Workers != 1 || stats.QueueCapacity != 2 {
+		t.Fatalf("Workers = %d, QueueCapacity = %d", stats.Workers, stats.QueueCapacity)
+	}
+	if stats.QueueDepth != 2 || !slices.Equal(stats.QueueDepths, []int{2}) {
+		t.Fatalf("QueueDepth = %d, QueueDepths = %v", stats.QueueDepth, stats.QueueDepths)
+	}
+	if stats.Submitted != 4 || stats.Dropped != 1 || stats.Processed != 0 {
+		t.Fatalf("Submitted = %d, Dropped = %d, Processed = %d", stats.Submitted, stats.Dropped, stats.Processed)
+	}
+
+	close(release)
+	p.Close()
+	if stats := p.Stats(); stats.Processed != 3 || stats.QueueDepth != 0 {
+		t.Fatalf("关闭后 Processed = %d, QueueDepth = %d", stats.Processed, stats.QueueDepth)
+	}
+}
+
+func TestWorkerPoolPublishFromWorker(t *testing.T) {
+	bus := NewEventBus(WorkerPoolConfig{Workers: 1, QueueSize: 1, OverflowPolicy: OverflowBlock})
+	defer bus.Close()
+
+	done := make(chan struct{})
+	bus.Subscribe(funcHandler(func(e CryoEvent) {
+		if e.GetBaseEvent().EventId != "parent" {
+			return
+		}
+		// 唯一的工作协程向自己已满的队列发布事件，阻塞等待会导致死锁
+		for i := range 3 {
+			bus.PublishAsync(CustomEvent{BaseEvent: BaseEvent{EventId: fmt.Sprintf("child-%d", i)}})
+		}
+		close(done)
+	}))
+	bus.PublishAsync(CustomEvent{BaseEvent: BaseEvent{EventId: "parent"}})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("处理器中异步发布事件时发生了死锁")
+	}
+	if dropped := bus.Stats().Dropped; dropped != 2 {
+		t.Fatalf("Dropped = %d, want 2", dropped)
+	}
+}
@@ -0,0 +1,99 @@
+package cryobot
+
+import (
+	"fmt"
+	uuid "github.com/satori/go.uuid"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// 事件处理器与中间件的错误恢复
+//
+// 每一次处理器和中间件的调用都会被recover包裹，单个处理器的panic不会再导致整个进程崩溃
+// 出现的panic以及处理器返回的错误会以 HandlerErrorEvent 的形式发布到事件总线上
+
+// callHandler 调用事件处理器，捕获处理器中的panic以及返回的错误
+//
+// parent 有效时会为这次调用创建一个子Span，处理器中通过 Send / Reply 发送的消息会关联到这个Span上
+func (bus *CryoEventBus) callHandler(parent SpanContext, handler CryoEventHandler, event CryoEvent) {
+	start := time.Now()
+	span := bus.tracer.StartSpan(parent, "handler").
+		SetAttribute("handler_id", handler.GetId()).
+		SetAttribute("handler_tags", handler.GetTags())
+	event = withTrace(event, span)
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+			bus.reportError(event, "handler", handler.GetId(), handler.GetTags(), err, string(debug.Stack()))
+		}
+		span.End(err)
+		bus.metrics.observeHandler(handler.GetId(), handler.GetTags(), time.Since(start))
+	}()
+	if err = handler.Handle(event); err != nil {
+		bus.reportError(event, "handler", handler.GetId(), handler.GetTags(), err, "")
+	}
+}
+
+// callMiddleware 调用中间件，中间件出现panic时丢弃该事件，避免用于拦截事件的中间件失效后事件被交给处理器
+func (bus *CryoEventBus) callMiddleware(entry middlewareEntry, event CryoEvent) (result CryoEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			bus.reportError(event, "middleware", entry.id, entry.tags, fmt.Errorf("%v", r), string(debug.Stack()))
+			result = nil
+		}
+	}()
+	return entry.middleware(event)
+}
+
+// reportError 记录错误日志，并将错误以 HandlerErrorEvent 的形式同步发布到事件总线
+func (bus *CryoEventBus) reportError(event CryoEvent, source string, handlerId string, handlerTags []string, err error, stack string) {
+	bus.metrics.observeError(handlerId, handlerTags, source)
+	fields := EventFields(event)
+	fields["source"] = source
+	fields["handler_id"] = handlerId
+	if len(handlerTags) > 0 {
+		fields["handler_tags"] = strings.Join(handlerTags, ",")
+	}
+	l := LoggerWithFields(bus.log(), fields)
+	if stack != "" {
+		l.Errorf("[Cryo] 事件 %s 的%s出现panic：%v\n%s", event.GetBaseEvent().EventId, source, err, stack)
+	} else {
+		l.Errorf("[Cryo] 事件 %s 的%s返回了错误：%v", event.GetBaseEvent().EventId, source, err)
+	}
+	// 错误事件的处理器自身出错时只记录日志，避免无限递归
+	if event.Type() == HandlerErrorEventType {
+		return
+	}
+
+	base := event.GetBaseEvent()
+	errorEvent := HandlerErrorEvent{
+		BaseEvent: BaseEvent{
+			EventType:   uint32(HandlerErrorEventType),
+			EventId:     uuid.NewV4().String(),
+			EventTags:   []string{"system", "error"},
+			BotId:       base.BotId,
+			BotNickname: base.BotNickname,
+			BotUin:      base.BotUin,
+			BotUid:      base.BotUid,
+			Platform:    base.Platform,
+			Summary:     "HandlerErrorEvent",
+			Time:        uint32(time.Now().Unix()),
+		},
+		Source:          source,
+		HandlerId:       handlerId,
+		HandlerTags:     handlerTags,
+		OriginEventId:   base.EventId,
+		OriginEventType: uint32(event.Type()),
+		Error:           err.Error(),
+		Stack:           stack,
+		Panicked:        stack != "",
+	}
+	// 同步发布，避免在工作协程内向已满的队列提交任务而阻塞
+	processedEvent := bus.applyMiddleware(errorEvent)
+	if processedEvent == nil {
+		return
+	}
+	bus.dispatch(SpanContext{}, processedEvent, bus.handlers(processedEvent))
+}
@@ -0,0 +1,86 @@
+package cryobot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHandlerPanicRecovered(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	var reports []HandlerErrorEvent
+	SubscribeTo(bus, HandlerErrorEventType, func(e HandlerErrorEvent) { reports = append(reports, e) })
+	SubscribeTo(bus, CustomEventType, func(CustomEvent) { panic("boom") }, "panicking")
+	called := false
+	SubscribeTo(bus, CustomEventType, func(CustomEvent) { called = true })
+
+	bus.Publish(CustomEvent{BaseEvent: BaseEvent{EventId: "origin"}})
+
+	if !called {
+		t.Fatal("前一个处理器panic后，后面的处理器没有被调用")
+	}
+	if len(reports) != 1 {
+		t.Fatalf("收到了 %d 个错误事件，want 1", len(reports))
+	}
+	r := reports[0]
+	if r.Source != "handler" || !r.Panicked || r.Error != "boom" || r.Stack == "" {
+		t.Fatalf("错误事件 = %+v", r)
+	}
+	if r.OriginEventId != "origin" || r.OriginEventType != uint32(CustomEventType) {
+		t.Fatalf("错误事件的来源为 %s / %d", r.OriginEventId, r.OriginEventType)
+	}
+	if len(r.HandlerTags) != 1 || r.HandlerTags[0] != "panicking" {
+		t.Fatalf("HandlerTags = %v", r.HandlerTags)
+	}
+}
+
+func TestHandlerErrorReported(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	var reports []HandlerErrorEvent
+	SubscribeTo(bus, HandlerErrorEventType, func(e HandlerErrorEvent) { reports = append(reports, e) })
+	SubscribeETo(bus, CustomEventType, func(CustomEvent) error { return errors.New("failed") })
+
+	bus.Publish(CustomEvent{})
+	if len(reports) != 1 || reports[0].Panicked || reports[0].Stack != "" || reports[0].Error != "failed" {
+		t.Fatalf("错误事件 = %+v", reports)
+	}
+}
+
+func TestMiddlewarePanicDropsEvent(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	var reports []HandlerErrorEvent
+	SubscribeTo(bus, HandlerErrorEventType, func(e HandlerErrorEvent) { reports = append(reports, e) })
+	called := false
+	SubscribeTo(bus, CustomEventType, func(CustomEvent) { called = true })
+	bus.AddMiddleware(CustomEventType, func(CryoEvent) CryoEvent { panic("middleware boom") })
+
+	bus.Publish(CustomEvent{})
+	if called {
+		t.Fatal("中间件panic后事件仍然被交给了处理器")
+	}
+	if len(reports) != 1 || reports[0].Source != "middleware" || !reports[0].Panicked {
+		t.Fatalf("错误事件 = %+v", reports)
+	}
+}
+
+func TestErrorHandlerPanicDoesNotRecurse(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	calls := 0
+	SubscribeTo(bus, HandlerErrorEventType, func(HandlerErrorEvent) {
+		calls++
+		panic("error handler boom")
+	})
+	SubscribeTo(bus, CustomEventType, func(CustomEvent) { panic("boom") })
+
+	bus.Publish(CustomEvent{})
+	if calls != 1 {
+		t.Fatalf("错误事件的处理器被调用了 %d 次，want 1", calls)
+	}
+}
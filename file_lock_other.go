@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package cryobot
+
+import "os"
+
+// lockFile 当前平台不支持文件锁，只能保证单个进程内的写入是原子的
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile 当前平台不支持文件锁
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package cryobot
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+// lockFile 对文件加排他锁，其他进程持有锁时阻塞等待
+func lockFile(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, new(windows.Overlapped))
+}
+
+// unlockFile 释放文件锁
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, new(windows.Overlapped))
+}
@@ -3,11 +3,15 @@ module github.com/machinacanis/cryobot
 go 1.24
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/LagrangeDev/LagrangeGo v0.1.3
 	github.com/go-json-experiment/json v0.0.0-20250223041408-d3c622f1b874
+	github.com/gorilla/websocket v1.5.3
 	github.com/satori/go.uuid v1.2.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/sys v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -22,5 +26,4 @@ require (
 	golang.org/x/image v0.25.0 // indirect
 	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sync v0.12.0 // indirect
-	golang.org/x/sys v0.31.0 // indirect
 )
@@ -1,27 +1,107 @@
 package cryobot
 
+import "sync/atomic"
+
 type Subscription struct {
 	HandlerId   string
-	HandlerFunc func(CryoEvent)
+	HandlerFunc func(CryoEvent) error
 	HandlerType CryoEventType
+	Matcher     *EventMatcher // 不为空时作为通配订阅注册，此时会忽略 HandlerType
 }
 
 // TypedWrapper 带泛型的事件处理函数包装器
-func TypedWrapper[T CryoEvent](handler func(T)) func(CryoEvent) {
-	return func(e CryoEvent) {
+func TypedWrapper[T CryoEvent](handler func(T)) func(CryoEvent) error {
+	return func(e CryoEvent) error {
 		if evt, ok := e.(T); ok {
 			handler(evt)
 		}
+		return nil
+	}
+}
+
+// TypedErrorWrapper 带泛型的、会返回错误的事件处理函数包装器
+func TypedErrorWrapper[T CryoEvent](handler func(T) error) func(CryoEvent) error {
+	return func(e CryoEvent) error {
+		if evt, ok := e.(T); ok {
+			return handler(evt)
+		}
+		return nil
 	}
 }
 
 // Handler cryobot的事件处理器
+//
+// 事件处理器的中间件分为两种：
+// Middlewares 和 MessageMiddlewares 是局部中间件，只会在这个事件处理器自己的处理函数被调用前执行，返回nil时会跳过该处理函数；
+// BusMiddlewares 是总线中间件，会被注册到事件总线上，对所有订阅了对应事件类型的处理器生效
 type Handler struct {
+	Name               string          // 事件处理器的名称，用于在Web后台等地方展示
 	Tags               []string        // 事件处理器的标签，这些标签会被带入这个事件处理器生成的订阅中
 	Subscriptions      []Subscription  // 将被用于订阅的事件处理函数列表
-	Middlewares        []Middleware    // 中间件订阅列表
-	MessageMiddlewares []Middleware    // 消息中间件订阅列表
+	Middlewares        []Middleware    // 局部中间件列表
+	MessageMiddlewares []Middleware    // 局部消息中间件列表，只对消息事件生效
+	BusMiddlewares     []Middleware    // 总线中间件列表
 	MatchingTypes      []CryoEventType // 支持处理的事件类型
+
+	id            string        // 事件处理器的唯一标识符，注册时生成
+	bot           *Bot          // 事件处理器所属的Bot，注册时会注册到该Bot的事件总线
+	registeredBus *CryoEventBus // 事件处理器注册到的事件总线
+	middlewareIds []string      // 已注册到事件总线的总线中间件标识符
+	disabled      atomic.Bool   // 是否已停用，停用后处理函数不会被调用
+}
+
+// bus 返回事件处理器注册使用的事件总线
+func (h *Handler) bus() *CryoEventBus {
+	if h.bot != nil {
+		return h.bot.bus()
+	}
+	return DefaultBus()
+}
+
+// log 返回事件处理器使用的日志记录器
+func (h *Handler) log() Logger {
+	if h.bot != nil {
+		return h.bot.log()
+	}
+	return GetLogger()
+}
+
+// GetId 返回事件处理器的唯一标识符，未注册过的事件处理器返回空字符串
+func (h *Handler) GetId() string {
+	return h.id
+}
+
+// SetName 设置事件处理器的名称
+func (h *Handler) SetName(name string) *Handler {
+	h.Name = name
+	return h
+}
+
+// GetName 返回事件处理器的名称
+func (h *Handler) GetName() string {
+	return h.Name
+}
+
+// Enable 启用事件处理器
+func (h *Handler) Enable() *Handler {
+	h.disabled.Store(false)
+	return h
+}
+
+// Disable 停用事件处理器，停用期间处理函数不会被调用，但订阅和总线中间件会被保留
+func (h *Handler) Disable() *Handler {
+	h.disabled.Store(true)
+	return h
+}
+
+// IsEnabled 返回事件处理器是否处于启用状态
+func (h *Handler) IsEnabled() bool {
+	return !h.disabled.Load()
+}
+
+// IsRegistered 返回事件处理器是否已经注册到事件总线
+func (h *Handler) IsRegistered() bool {
+	return h.registeredBus != nil
 }
 
 // AddTags 用于向事件处理器添加标签
@@ -74,12 +154,25 @@ func (h *Handler) AddMiddlewares(middlewares ...Middleware) *Handler {
 	return h
 }
 
+// ClearMiddlewares 清空事件处理器的中间件
 func (h *Handler) ClearMiddlewares() *Handler {
 	// 清空事件处理器的中间件
 	h.Middlewares = []Middleware{}
 	return h
 }
 
+// AddBusMiddlewares 用于向事件处理器添加总线中间件，注册后会对事件总线上所有对应类型的处理器生效
+func (h *Handler) AddBusMiddlewares(middlewares ...Middleware) *Handler {
+	h.BusMiddlewares = append(h.BusMiddlewares, middlewares...)
+	return h
+}
+
+// ClearBusMiddlewares 清空事件处理器的总线中间件
+func (h *Handler) ClearBusMiddlewares() *Handler {
+	h.BusMiddlewares = []Middleware{}
+	return h
+}
+
 // AddMessageMiddlewares 用于向事件处理器添加消息中间件
 func (h *Handler) AddMessageMiddlewares(middlewares ...Middleware) *Handler {
 	// 将消息中间件添加到事件处理器
@@ -95,213 +188,264 @@ func (h *Handler) ClearMessageMiddlewares() *Handler {
 }
 
 // Handle 用于向事件处理器添加处理函数
+//
+// 处理函数可以是 func(事件) 或 func(事件) error 的形式，返回的错误会以 HandlerErrorEvent 的形式发布到事件总线
 func (h *Handler) Handle(handler interface{}) *Handler {
 	switch typedHandler := handler.(type) {
 	case func(PrivateMessageEvent):
-		typedHandler = handler.(func(PrivateMessageEvent)) // 类型断言
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: PrivateMessageEventType,
-		})
+		h.addSubscription(PrivateMessageEventType, TypedWrapper(typedHandler))
+	case func(PrivateMessageEvent) error:
+		h.addSubscription(PrivateMessageEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupMessageEvent):
-		typedHandler = handler.(func(GroupMessageEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupMessageEventType,
-		})
+		h.addSubscription(GroupMessageEventType, TypedWrapper(typedHandler))
+	case func(GroupMessageEvent) error:
+		h.addSubscription(GroupMessageEventType, TypedErrorWrapper(typedHandler))
 	case func(TempMessageEvent):
-		typedHandler = handler.(func(TempMessageEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: TempMessageEventType,
-		})
+		h.addSubscription(TempMessageEventType, TypedWrapper(typedHandler))
+	case func(TempMessageEvent) error:
+		h.addSubscription(TempMessageEventType, TypedErrorWrapper(typedHandler))
 	case func(NewFriendRequestEvent):
-		typedHandler = handler.(func(NewFriendRequestEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: NewFriendRequestEventType,
-		})
+		h.addSubscription(NewFriendRequestEventType, TypedWrapper(typedHandler))
+	case func(NewFriendRequestEvent) error:
+		h.addSubscription(NewFriendRequestEventType, TypedErrorWrapper(typedHandler))
 	case func(NewFriendEvent):
-		typedHandler = handler.(func(NewFriendEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: NewFriendEventType,
-		})
+		h.addSubscription(NewFriendEventType, TypedWrapper(typedHandler))
+	case func(NewFriendEvent) error:
+		h.addSubscription(NewFriendEventType, TypedErrorWrapper(typedHandler))
 	case func(FriendRecallEvent):
-		typedHandler = handler.(func(FriendRecallEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: FriendRecallEventType,
-		})
+		h.addSubscription(FriendRecallEventType, TypedWrapper(typedHandler))
+	case func(FriendRecallEvent) error:
+		h.addSubscription(FriendRecallEventType, TypedErrorWrapper(typedHandler))
 	case func(FriendRenameEvent):
-		typedHandler = handler.(func(FriendRenameEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: FriendRenameEventType,
-		})
+		h.addSubscription(FriendRenameEventType, TypedWrapper(typedHandler))
+	case func(FriendRenameEvent) error:
+		h.addSubscription(FriendRenameEventType, TypedErrorWrapper(typedHandler))
 	case func(FriendPokeEvent):
-		typedHandler = handler.(func(FriendPokeEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: FriendPokeEventType,
-		})
+		h.addSubscription(FriendPokeEventType, TypedWrapper(typedHandler))
+	case func(FriendPokeEvent) error:
+		h.addSubscription(FriendPokeEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupMemberPermissionUpdatedEvent):
-		typedHandler = handler.(func(GroupMemberPermissionUpdatedEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupMemberPermissionUpdatedEventType,
-		})
+		h.addSubscription(GroupMemberPermissionUpdatedEventType, TypedWrapper(typedHandler))
+	case func(GroupMemberPermissionUpdatedEvent) error:
+		h.addSubscription(GroupMemberPermissionUpdatedEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupNameUpdatedEvent):
-		typedHandler = handler.(func(GroupNameUpdatedEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupNameUpdatedEventType,
-		})
+		h.addSubscription(GroupNameUpdatedEventType, TypedWrapper(typedHandler))
+	case func(GroupNameUpdatedEvent) error:
+		h.addSubscription(GroupNameUpdatedEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupMuteEvent):
-		typedHandler = handler.(func(GroupMuteEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupMuteEventType,
-		})
+		h.addSubscription(GroupMuteEventType, TypedWrapper(typedHandler))
+	case func(GroupMuteEvent) error:
+		h.addSubscription(GroupMuteEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupRecallEvent):
-		typedHandler = handler.(func(GroupRecallEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupRecallEventType,
-		})
+		h.addSubscription(GroupRecallEventType, TypedWrapper(typedHandler))
+	case func(GroupRecallEvent) error:
+		h.addSubscription(GroupRecallEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupMemberJoinRequestEvent):
-		typedHandler = handler.(func(GroupMemberJoinRequestEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupMemberJoinRequestEventType,
-		})
+		h.addSubscription(GroupMemberJoinRequestEventType, TypedWrapper(typedHandler))
+	case func(GroupMemberJoinRequestEvent) error:
+		h.addSubscription(GroupMemberJoinRequestEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupMemberIncreaseEvent):
-		typedHandler = handler.(func(GroupMemberIncreaseEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupMemberIncreaseEventType,
-		})
+		h.addSubscription(GroupMemberIncreaseEventType, TypedWrapper(typedHandler))
+	case func(GroupMemberIncreaseEvent) error:
+		h.addSubscription(GroupMemberIncreaseEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupMemberDecreaseEvent):
-		typedHandler = handler.(func(GroupMemberDecreaseEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupMemberDecreaseEventType,
-		})
+		h.addSubscription(GroupMemberDecreaseEventType, TypedWrapper(typedHandler))
+	case func(GroupMemberDecreaseEvent) error:
+		h.addSubscription(GroupMemberDecreaseEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupDigestEvent):
-		typedHandler = handler.(func(GroupDigestEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupDigestEventType,
-		})
+		h.addSubscription(GroupDigestEventType, TypedWrapper(typedHandler))
+	case func(GroupDigestEvent) error:
+		h.addSubscription(GroupDigestEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupReactionEvent):
-		typedHandler = handler.(func(GroupReactionEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupReactionEventType,
-		})
+		h.addSubscription(GroupReactionEventType, TypedWrapper(typedHandler))
+	case func(GroupReactionEvent) error:
+		h.addSubscription(GroupReactionEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupMemberSpecialTitleUpdated):
-		typedHandler = handler.(func(GroupMemberSpecialTitleUpdated))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupMemberSpecialTitleUpdatedEventType,
-		})
+		h.addSubscription(GroupMemberSpecialTitleUpdatedEventType, TypedWrapper(typedHandler))
+	case func(GroupMemberSpecialTitleUpdated) error:
+		h.addSubscription(GroupMemberSpecialTitleUpdatedEventType, TypedErrorWrapper(typedHandler))
 	case func(GroupInviteEvent):
-		typedHandler = handler.(func(GroupInviteEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: GroupInviteEventType,
-		})
+		h.addSubscription(GroupInviteEventType, TypedWrapper(typedHandler))
+	case func(GroupInviteEvent) error:
+		h.addSubscription(GroupInviteEventType, TypedErrorWrapper(typedHandler))
 	case func(BotConnectedEvent):
-		typedHandler = handler.(func(BotConnectedEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: BotConnectedEventType,
-		})
+		h.addSubscription(BotConnectedEventType, TypedWrapper(typedHandler))
+	case func(BotConnectedEvent) error:
+		h.addSubscription(BotConnectedEventType, TypedErrorWrapper(typedHandler))
 	case func(BotDisconnectedEvent):
-		typedHandler = handler.(func(BotDisconnectedEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: BotDisconnectedEventType,
-		})
+		h.addSubscription(BotDisconnectedEventType, TypedWrapper(typedHandler))
+	case func(BotDisconnectedEvent) error:
+		h.addSubscription(BotDisconnectedEventType, TypedErrorWrapper(typedHandler))
 	case func(CustomEvent):
-		typedHandler = handler.(func(CustomEvent))
-		wrapper := TypedWrapper(typedHandler)
-		h.Subscriptions = append(h.Subscriptions, Subscription{
-			HandlerFunc: wrapper,
-			HandlerType: CustomEventType,
-		})
+		h.addSubscription(CustomEventType, TypedWrapper(typedHandler))
+	case func(CustomEvent) error:
+		h.addSubscription(CustomEventType, TypedErrorWrapper(typedHandler))
+	case func(HandlerErrorEvent):
+		h.addSubscription(HandlerErrorEventType, TypedWrapper(typedHandler))
+	case func(HandlerErrorEvent) error:
+		h.addSubscription(HandlerErrorEventType, TypedErrorWrapper(typedHandler))
+	case func(QRCodeLoginEvent):
+		h.addSubscription(QRCodeLoginEventType, TypedWrapper(typedHandler))
+	case func(QRCodeLoginEvent) error:
+		h.addSubscription(QRCodeLoginEventType, TypedErrorWrapper(typedHandler))
+	case func(LoginVerificationEvent):
+		h.addSubscription(LoginVerificationEventType, TypedWrapper(typedHandler))
+	case func(LoginVerificationEvent) error:
+		h.addSubscription(LoginVerificationEventType, TypedErrorWrapper(typedHandler))
+	case func(ConfigReloadedEvent):
+		h.addSubscription(ConfigReloadedEventType, TypedWrapper(typedHandler))
+	case func(ConfigReloadedEvent) error:
+		h.addSubscription(ConfigReloadedEventType, TypedErrorWrapper(typedHandler))
+	case func(SignServerEvent):
+		h.addSubscription(SignServerEventType, TypedWrapper(typedHandler))
+	case func(SignServerEvent) error:
+		h.addSubscription(SignServerEventType, TypedErrorWrapper(typedHandler))
+	case func(BotHealthEvent):
+		h.addSubscription(BotHealthEventType, TypedWrapper(typedHandler))
+	case func(BotHealthEvent) error:
+		h.addSubscription(BotHealthEventType, TypedErrorWrapper(typedHandler))
 	default:
-		Warn("传入了不支持的事件类型！")
+		h.log().Warn("传入了不支持的事件类型！")
 	}
 	return h
 }
 
-// HandleMessage 用于向事件处理器添加消息处理函数
-func (h *Handler) HandleMessage(handler func(MessageEvent)) *Handler {
-	h.MessageMiddlewares = append(h.MessageMiddlewares, func(e CryoEvent) CryoEvent {
-		// 尝试对事件进行类型断言
-		if msgEvent, ok := e.(CryoMessageEvent); ok {
-			handler(msgEvent.GetMessageEvent())
-		}
-		return e
+// addSubscription 向事件处理器添加一个待订阅的处理函数
+func (h *Handler) addSubscription(eventType CryoEventType, handlerFunc func(CryoEvent) error) {
+	h.Subscriptions = append(h.Subscriptions, Subscription{
+		HandlerFunc: handlerFunc,
+		HandlerType: eventType,
+	})
+}
+
+// HandleAny 用于向事件处理器添加一个处理所有事件的处理函数
+func (h *Handler) HandleAny(handler func(CryoEvent)) *Handler {
+	return h.HandleMatch(EventMatcher{}, handler)
+}
+
+// HandleCategory 用于向事件处理器添加一个处理某一分类所有事件的处理函数
+func (h *Handler) HandleCategory(category EventCategory, handler func(CryoEvent)) *Handler {
+	return h.HandleMatch(EventMatcher{Category: category}, handler)
+}
+
+// HandleEventTag 用于向事件处理器添加一个处理所有带有指定事件标签的事件的处理函数
+func (h *Handler) HandleEventTag(eventTag string, handler func(CryoEvent)) *Handler {
+	return h.HandleMatch(EventMatcher{Tag: eventTag}, handler)
+}
+
+// HandleMatch 用于向事件处理器添加一个处理所有满足匹配条件的事件的处理函数
+//
+// 事件处理器有匹配的事件类型时，只有同时属于这些类型的事件才会被处理
+func (h *Handler) HandleMatch(matcher EventMatcher, handler func(CryoEvent)) *Handler {
+	h.Subscriptions = append(h.Subscriptions, Subscription{
+		HandlerFunc: TypedWrapper(handler),
+		Matcher:     &matcher,
 	})
 	return h
 }
 
-// Register 将当前的事件处理器注册到事件总线
+// HandleMessage 用于向事件处理器添加消息处理函数，所有类型的消息事件都会以统一的 MessageEvent 传入
+func (h *Handler) HandleMessage(handler func(MessageEvent)) *Handler {
+	for _, et := range messageEventTypes {
+		h.addSubscription(et, func(e CryoEvent) error {
+			// 尝试对事件进行类型断言
+			if msgEvent, ok := e.(CryoMessageEvent); ok {
+				handler(msgEvent.GetMessageEvent())
+			}
+			return nil
+		})
+	}
+	return h
+}
+
+// Register 将当前的事件处理器注册到所属Bot的事件总线，没有所属Bot时注册到默认事件总线
+//
+// 已经注册的事件处理器再次调用时不做任何处理，需要重新注册时先调用 Unregister
 func (h *Handler) Register() {
+	if h.IsRegistered() {
+		return
+	}
+	bus := h.bus()
+	h.registeredBus = bus
+	if h.id == "" {
+		h.id = NewUUID()
+	}
+	if h.bot != nil {
+		h.bot.addHandler(h)
+	}
 	// 将事件处理器中的所有处理函数注册到事件总线
 	// 当事件处理器有匹配的事件类型时，只会注册拥有匹配的类型的处理函数
-	if len(h.MatchingTypes) == 0 {
-		// 如果没有匹配的事件类型，则注册所有的处理函数
-		for _, sub := range h.Subscriptions {
-			sub.HandlerId = Subscribe(sub.HandlerType, sub.HandlerFunc, h.Tags...)
+	for i, sub := range h.Subscriptions {
+		if sub.Matcher != nil {
+			// 通配订阅，匹配的事件类型会作为额外的匹配条件
+			matcher := *sub.Matcher
+			if len(h.MatchingTypes) > 0 {
+				matcher.Types = h.MatchingTypes
+			}
+			h.Subscriptions[i].HandlerId = SubscribeMatchETo(bus, matcher, h.withLocalMiddlewares(sub), h.Tags...)
+			continue
 		}
-		// 注册中间件
-		AddGlobalMiddleware(h.Middlewares...)
-		// 注册消息中间件
-		for _, et := range messageEventTypes {
-			AddMiddleware(et, h.MessageMiddlewares...)
+		if len(h.MatchingTypes) > 0 && !Contains(h.MatchingTypes, sub.HandlerType) {
+			continue
 		}
-	} else {
-		// 如果有匹配的事件类型，则只注册拥有匹配的类型的处理函数
-		for _, matchingType := range h.MatchingTypes { // 遍历所有匹配的事件类型
-			// 订阅所有拥有匹配的事件类型的处理函数
-			for _, sub := range h.Subscriptions {
-				if sub.HandlerType == matchingType {
-					sub.HandlerId = Subscribe(sub.HandlerType, sub.HandlerFunc, h.Tags...)
-				}
+		h.Subscriptions[i].HandlerId = SubscribeETo(bus, sub.HandlerType, h.withLocalMiddlewares(sub), h.Tags...)
+	}
+	// 注册总线中间件，总线中间件会带上事件处理器的标签
+	if len(h.BusMiddlewares) > 0 {
+		if len(h.MatchingTypes) == 0 {
+			h.middlewareIds = append(h.middlewareIds, bus.AddTaggedGlobalMiddleware(h.Tags, h.BusMiddlewares...))
+		} else {
+			for _, matchingType := range h.MatchingTypes {
+				h.middlewareIds = append(h.middlewareIds, bus.AddTaggedMiddleware(matchingType, h.Tags, h.BusMiddlewares...))
+			}
+		}
+	}
+}
+
+// Unregister 从事件总线上移除当前事件处理器注册的所有处理函数和总线中间件
+func (h *Handler) Unregister() {
+	if h.registeredBus == nil {
+		return
+	}
+	for i, sub := range h.Subscriptions {
+		if sub.HandlerId != "" {
+			h.registeredBus.UnsubscribeById(sub.HandlerId)
+			h.Subscriptions[i].HandlerId = ""
+		}
+	}
+	for _, id := range h.middlewareIds {
+		h.registeredBus.RemoveMiddlewareById(id)
+	}
+	h.middlewareIds = nil
+	h.registeredBus = nil
+	if h.bot != nil {
+		h.bot.removeHandler(h)
+	}
+}
+
+// withLocalMiddlewares 为处理函数包装上事件处理器的局部中间件，事件处理器停用时会跳过处理函数
+func (h *Handler) withLocalMiddlewares(sub Subscription) func(CryoEvent) error {
+	middlewares := append([]Middleware{}, h.Middlewares...)
+	messageMiddlewares := append([]Middleware{}, h.MessageMiddlewares...)
+	return func(e CryoEvent) error {
+		if h.disabled.Load() {
+			return nil
+		}
+		for _, middleware := range middlewares {
+			e = middleware(e)
+			if e == nil {
+				return nil // 事件被局部中间件截断，只跳过当前处理函数
 			}
-			// 注册中间件
-			AddMiddleware(matchingType, h.Middlewares...)
-			// 注册消息中间件，只有同时是匹配的事件类型和消息事件类型才会注册
-			for _, et := range messageEventTypes {
-				if et == matchingType {
-					AddMiddleware(et, h.MessageMiddlewares...)
+		}
+		// 消息中间件只对消息事件生效
+		if CategoryOf(e.Type()) == MessageCategory {
+			for _, middleware := range messageMiddlewares {
+				e = middleware(e)
+				if e == nil {
+					return nil
 				}
 			}
-
 		}
+		return sub.HandlerFunc(e)
 	}
 }
@@ -8,13 +8,14 @@ var messageEventTypes = []CryoEventType{
 
 // On 创建一个空的事件处理器
 func (b *Bot) On() *Handler {
-	return &Handler{}
+	return &Handler{bot: b}
 }
 
 // OnType 创建一个可以匹配类型的事件处理器
 func (b *Bot) OnType(eventType ...CryoEventType) *Handler {
 	return &Handler{
 		MatchingTypes: eventType, // 事件类型
+		bot:           b,
 	}
 }
 
@@ -33,9 +34,65 @@ func (b *Bot) OnMessage(eventType ...CryoEventType) *Handler {
 	}
 	return &Handler{
 		MatchingTypes: eventType, // 事件类型
+		bot:           b,
+	}
+}
+
+// OnCategory 创建一个匹配一个或多个事件分类中所有事件类型的事件处理器
+func (b *Bot) OnCategory(category ...EventCategory) *Handler {
+	var eventType []CryoEventType
+	for _, c := range category {
+		eventType = append(eventType, EventTypesOf(c)...)
+	}
+	return &Handler{
+		MatchingTypes: eventType, // 事件类型
+		bot:           b,
 	}
 }
 
 func (b *Bot) OnFullmatch(text ...string) *Handler {
-	return &Handler{}
+	return &Handler{bot: b}
+}
+
+// addHandler 记录一个已注册的事件处理器
+func (b *Bot) addHandler(h *Handler) {
+	b.handlersMutex.Lock()
+	defer b.handlersMutex.Unlock()
+	for _, handler := range b.handlers {
+		if handler == h {
+			return
+		}
+	}
+	b.handlers = append(b.handlers, h)
+}
+
+// removeHandler 移除一个已取消注册的事件处理器
+func (b *Bot) removeHandler(h *Handler) {
+	b.handlersMutex.Lock()
+	defer b.handlersMutex.Unlock()
+	for i, handler := range b.handlers {
+		if handler == h {
+			b.handlers = append(b.handlers[:i:i], b.handlers[i+1:]...)
+			return
+		}
+	}
+}
+
+// GetHandlers 返回所有已注册到Bot的事件处理器
+func (b *Bot) GetHandlers() []*Handler {
+	b.handlersMutex.RLock()
+	defer b.handlersMutex.RUnlock()
+	return append([]*Handler{}, b.handlers...)
+}
+
+// GetHandlerById 获取指定ID的事件处理器
+func (b *Bot) GetHandlerById(id string) *Handler {
+	b.handlersMutex.RLock()
+	defer b.handlersMutex.RUnlock()
+	for _, handler := range b.handlers {
+		if handler.id == id {
+			return handler
+		}
+	}
+	return nil
 }
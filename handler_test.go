@@ -0,0 +1,29 @@
+package cryobot
+
+import "testing"
+
+func TestHandlerRegisterTwice(t *testing.T) {
+	b := NewBot()
+	defer b.Close()
+	count := 0
+	h := b.OnType(CustomEventType).HandleAny(func(CryoEvent) { count++ })
+
+	h.Register()
+	h.Register()
+	b.Bus.Publish(CustomEvent{})
+	if count != 1 {
+		t.Fatalf("重复注册后处理函数被调用了 %d 次，want 1", count)
+	}
+
+	h.Unregister()
+	b.Bus.Publish(CustomEvent{})
+	if count != 1 {
+		t.Fatalf("取消注册后处理函数仍然被调用，count = %d", count)
+	}
+
+	h.Register()
+	b.Bus.Publish(CustomEvent{})
+	if count != 2 {
+		t.Fatalf("重新注册后 count = %d, want 2", count)
+	}
+}
@@ -0,0 +1,292 @@
+package cryobot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 客户端健康检查
+//
+// Bot会定时对所有在线的客户端进行健康检查，每次检查都会发送一次心跳请求并汇总最近收到事件的时间、消息发送的成功率和签名服务器的延迟
+// 每次检查后会发布 BotHealthEvent，客户端连续不健康的次数达到阈值后会断开该客户端，与服务器主动断开时的处理相同
+
+// HealthConfig 健康检查的配置
+type HealthConfig struct {
+	Interval            int     `json:"interval,omitempty,omitzero"`              // 健康检查的间隔，单位为秒，默认为60，负数表示不进行健康检查
+	Timeout             int     `json:"timeout,omitempty,omitzero"`               // 心跳请求的超时时间，单位为秒，默认为10
+	MaxHeartbeatLatency int     `json:"max_heartbeat_latency,omitempty,omitzero"` // 心跳延迟超过多少毫秒时视为不健康，默认为5000
+	MaxIdle             int     `json:"max_idle,omitempty,omitzero"`              // 超过多少秒没有收到事件时视为不健康，默认为0，表示不检查
+	MinSendSuccessRate  float64 `json:"min_send_success_rate,omitempty,omitzero"` // 消息发送成功率低于多少时视为不健康，取值为0到1，默认为0，表示不检查
+	MinSendSamples      int     `json:"min_send_samples,omitempty,omitzero"`      // 计算发送成功率至少需要的发送次数，默认为10
+	FailureThreshold    int     `json:"failure_threshold,omitempty,omitzero"`     // 连续多少次不健康后断开客户端，默认为3，负数表示不断开
+}
+
+// withDefaults 返回填充了默认值的配置
+func (c HealthConfig) withDefaults() HealthConfig {
+	if c.Interval == 0 {
+		c.Interval = 60
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10
+	}
+	if c.MaxHeartbeatLatency <= 0 {
+		c.MaxHeartbeatLatency = 5000
+	}
+	if c.MinSendSamples <= 0 {
+		c.MinSendSamples = 10
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = 3
+	}
+	return c
+}
+
+// validate 校验健康检查的配置
+func (c HealthConfig) validate(invalid func(field, format string, args ...any)) {
+	if c.Timeout < 0 {
+		invalid("health.timeout", "不能为负数")
+	}
+	if c.MaxHeartbeatLatency < 0 {
+		invalid("health.max_heartbeat_latency", "不能为负数")
+	}
+	if c.MaxIdle < 0 {
+		invalid("health.max_idle", "不能为负数")
+	}
+	if c.MinSendSuccessRate < 0 || c.MinSendSuccessRate > 1 {
+		invalid("health.min_send_success_rate", "必须在0到1之间")
+	}
+	if c.MinSendSamples < 0 {
+		invalid("health.min_send_samples", "不能为负数")
+	}
+}
+
+// ClientHealth 客户端的健康状态
+type ClientHealth struct {
+	Id               string   `json:"id"`
+	Uin              int      `json:"uin"`
+	Healthy          bool     `json:"healthy"`
+	Online           bool     `json:"online"`
+	HeartbeatLatency int64    `json:"heartbeat_latency"`                // 最近一次心跳的延迟，单位为毫秒，心跳失败时为-1
+	LastEventAt      int64    `json:"last_event_at,omitempty,omitzero"` // 最近一次收到事件的时间戳
+	SendTotal        uint64   `json:"send_total"`                       // 发送消息的总次数
+	SendFailed       uint64   `json:"send_failed"`                      // 发送消息失败的次数
+	SendSuccessRate  float64  `json:"send_success_rate"`                // 发送消息的成功率，还没有发送过消息时为1
+	SignServer       string   `json:"sign_server,omitempty,omitzero"`   // 分配给客户端的签名服务器
+	SignLatency      int64    `json:"sign_latency"`                     // 签名服务器最近一次成功请求的延迟，单位为毫秒
+	Failures         int      `json:"failures"`                         // 连续不健康的次数
+	Problems         []string `json:"problems,omitempty,omitzero"`      // 不健康的原因
+	CheckedAt        int64    `json:"checked_at,omitempty,omitzero"`    // 最近一次检查的时间戳
+}
+
+// clientHealth 客户端运行时记录的健康数据
+type clientHealth struct {
+	mutex       sync.Mutex
+	lastEventAt time.Time
+	sendTotal   uint64
+	sendFailed  uint64
+	last        ClientHealth // 最近一次检查的结果
+}
+
+// recordEvent 记录收到了一个事件
+func (h *clientHealth) recordEvent() {
+	h.mutex.Lock()
+	h.lastEventAt = time.Now()
+	h.mutex.Unlock()
+}
+
+// recordSend 记录一次消息发送的结果
+func (h *clientHealth) recordSend(err error) {
+	h.mutex.Lock()
+	h.sendTotal++
+	if err != nil {
+		h.sendFailed++
+	}
+	h.mutex.Unlock()
+}
+
+// Heartbeat 向服务器发送一次心跳请求，返回请求的延迟
+func (c *CryoClient) Heartbeat(timeout time.Duration) (time.Duration, error) {
+	if !c.IsOnline() {
+		return 0, fmt.Errorf("客户端不在线")
+	}
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Client.FetchUserInfoUin(uint32(c.Uin))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return time.Since(start), err
+	case <-time.After(timeout):
+		return 0, fmt.Errorf("心跳请求超时")
+	}
+}
+
+// GetHealth 返回客户端最近一次健康检查的结果，发送统计和最近收到事件的时间是实时的
+func (c *CryoClient) GetHealth() ClientHealth {
+	c.health.mutex.Lock()
+	defer c.health.mutex.Unlock()
+	h := c.health.last
+	h.Id, h.Uin, h.Online = c.Id, c.Uin, c.IsOnline()
+	c.fillHealth(&h)
+	return h
+}
+
+// CheckHealth 立即对客户端进行一次健康检查并返回结果，不会发布事件，也不会断开客户端
+func (c *CryoClient) CheckHealth() ClientHealth {
+	conf := c.config().Health.withDefaults()
+	h := ClientHealth{Id: c.Id, Uin: c.Uin, Online: c.IsOnline(), CheckedAt: time.Now().Unix()}
+	if !h.Online {
+		h.HeartbeatLatency = -1
+		h.Problems = append(h.Problems, "客户端不在线")
+	} else if latency, err := c.Heartbeat(time.Duration(conf.Timeout) * time.Second); err != nil {
+		h.HeartbeatLatency = -1
+		h.Problems = append(h.Problems, "心跳失败："+err.Error())
+	} else {
+		h.HeartbeatLatency = latency.Milliseconds()
+		if h.HeartbeatLatency > int64(conf.MaxHeartbeatLatency) {
+			h.Problems = append(h.Problems, fmt.Sprintf("心跳延迟过高：%dms", h.HeartbeatLatency))
+		}
+	}
+
+	c.health.mutex.Lock()
+	defer c.health.mutex.Unlock()
+	c.fillHealth(&h)
+	if last := c.health.lastEventAt; conf.MaxIdle > 0 {
+		if last.IsZero() {
+			last = c.ConnectedAt // 还没有收到过事件时从登录成功的时间开始计算
+		}
+		if idle := time.Since(last); !last.IsZero() && idle > time.Duration(conf.MaxIdle)*time.Second {
+			h.Problems = append(h.Problems, fmt.Sprintf("已经 %d 秒没有收到事件", int(idle.Seconds())))
+		}
+	}
+	if conf.MinSendSuccessRate > 0 && h.SendTotal >= uint64(conf.MinSendSamples) && h.SendSuccessRate < conf.MinSendSuccessRate {
+		h.Problems = append(h.Problems, fmt.Sprintf("消息发送成功率过低：%.2f", h.SendSuccessRate))
+	}
+	h.Healthy = len(h.Problems) == 0
+	if !h.Healthy {
+		h.Failures = c.health.last.Failures + 1
+	}
+	c.health.last = h
+	return h
+}
+
+// fillHealth 填充发送统计、最近收到事件的时间和签名服务器的延迟，需要持有 health.mutex
+func (c *CryoClient) fillHealth(h *ClientHealth) {
+	if !c.health.lastEventAt.IsZero() {
+		h.LastEventAt = c.health.lastEventAt.Unix()
+	}
+	h.SendTotal, h.SendFailed = c.health.sendTotal, c.health.sendFailed
+	h.SendSuccessRate = 1
+	if h.SendTotal > 0 {
+		h.SendSuccessRate = float64(h.SendTotal-h.SendFailed) / float64(h.SendTotal)
+	}
+	if pool := c.getSignPool(); pool != nil {
+		h.SignServer = pool.GetAssignment(c.Id)
+		h.SignLatency = pool.getLatency(h.SignServer)
+	}
+}
+
+// getSignPool 返回客户端使用的签名服务器池，没有所属的Bot时返回nil
+func (c *CryoClient) getSignPool() *SignPool {
+	if c.signPool != nil {
+		return c.signPool
+	}
+	if c.bot != nil {
+		return c.bot.GetSignPool()
+	}
+	return nil
+}
+
+// handleDisconnected 客户端与服务器断开连接时，在客户端集合中标记为 offline 并发布 BotDisconnectedEvent
+func (c *CryoClient) handleDisconnected(reason string) {
+	c.log().Warnf("[Cryo] %s：%s (%d) 与服务器断开连接：%s", c.GetDisplayName(), c.Id, c.Uin, reason)
+	if c.bot != nil {
+		c.bot.clients().SetStatus(c.Id, ClientOffline)
+	}
+	SendBotDisconnectedEvent(c)
+}
+
+// GetHealth 返回所有客户端最近一次健康检查的结果
+func (b *Bot) GetHealth() []ClientHealth {
+	clients := b.clients().List()
+	result := make([]ClientHealth, 0, len(clients))
+	for _, c := range clients {
+		result = append(result, c.GetHealth())
+	}
+	return result
+}
+
+// CheckHealth 立即对所有在线的客户端进行一次健康检查，发布 BotHealthEvent，连续不健康的次数达到阈值时断开客户端
+func (b *Bot) CheckHealth() []ClientHealth {
+	clients := b.GetClients()
+	result := make([]ClientHealth, len(clients))
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result[i] = b.checkClientHealth(c)
+		}()
+	}
+	wg.Wait()
+	return result
+}
+
+// checkClientHealth 检查单个客户端，并按照配置的阈值处理不健康的客户端
+func (b *Bot) checkClientHealth(c *CryoClient) ClientHealth {
+	h := c.CheckHealth()
+	SendBotHealthEvent(c, h)
+	if h.Healthy {
+		return h
+	}
+	threshold := b.GetConfig().Health.withDefaults().FailureThreshold
+	b.log().Warnf("[Health] %s：%s (%d) 健康检查未通过（%d/%d）：%s", c.GetDisplayName(), c.Id, c.Uin, h.Failures, threshold, strings.Join(h.Problems, "；"))
+	if threshold > 0 && h.Failures >= threshold {
+		if c.IsOnline() {
+			c.Client.Disconnect()
+		}
+		c.handleDisconnected(fmt.Sprintf("连续 %d 次健康检查未通过", h.Failures))
+	}
+	return h
+}
+
+// StartHealthCheck 开始定时对所有在线的客户端进行健康检查，已经开始或配置中关闭了健康检查时不做任何处理
+func (b *Bot) StartHealthCheck() {
+	b.healthMutex.Lock()
+	defer b.healthMutex.Unlock()
+	if b.healthStop != nil || b.GetConfig().Health.withDefaults().Interval < 0 {
+		return
+	}
+	stop := make(chan struct{})
+	b.healthStop = stop
+	go func() {
+		for {
+			interval := b.GetConfig().Health.withDefaults().Interval
+			if interval < 0 {
+				interval = 60
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Duration(interval) * time.Second):
+			}
+			if b.GetConfig().Health.Interval >= 0 {
+				b.CheckHealth()
+			}
+		}
+	}()
+}
+
+// StopHealthCheck 停止定时健康检查
+func (b *Bot) StopHealthCheck() {
+	b.healthMutex.Lock()
+	defer b.healthMutex.Unlock()
+	if b.healthStop != nil {
+		close(b.healthStop)
+		b.healthStop = nil
+	}
+}
@@ -0,0 +1,281 @@
+package cryobot
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// 结构化日志
+//
+// 通过 WithFields / With 可以得到一个携带结构化字段的日志记录器，字段会随每一条日志一起输出：
+// 终端日志以 key=value 的形式附加在消息后面，文本文件和JSON文件日志会作为独立的字段写入，Web后台的实时日志中也会带有这些字段
+//
+// 客户端的日志会自动带上 bot_id 和 bot_uin，可以通过 GetEventLogger 得到带有事件ID、事件类型、群号等字段的日志记录器
+//
+// 自定义的日志记录器可以实现 FieldLogger 接口来支持结构化字段，没有实现时字段会以 key=value 的形式附加在消息后面
+
+// Fields 结构化日志的字段
+type Fields map[string]any
+
+// FieldLogger 支持结构化字段的日志记录器
+type FieldLogger interface {
+	Logger
+	WithFields(fields Fields) FieldLogger // 返回一个携带这些字段的日志记录器，已有的同名字段会被覆盖
+	With(keyValues ...any) FieldLogger    // 以键值对的形式添加字段，如 With("group_uin", 123, "handler", "echo")
+}
+
+// LoggerWithFields 返回一个携带指定字段的日志记录器，日志记录器没有实现 FieldLogger 时字段会被附加在消息后面
+func LoggerWithFields(l Logger, fields Fields) FieldLogger {
+	if fl, ok := l.(FieldLogger); ok {
+		return fl.WithFields(fields)
+	}
+	return &suffixFieldLogger{Logger: l, fields: maps.Clone(fields)}
+}
+
+// LoggerWith 以键值对的形式为日志记录器添加字段，如 LoggerWith(l, "group_uin", 123, "handler", "echo")
+func LoggerWith(l Logger, keyValues ...any) FieldLogger {
+	return LoggerWithFields(l, pairsToFields(keyValues))
+}
+
+// WithFields 返回一个携带指定字段的全局日志记录器
+func WithFields(fields Fields) FieldLogger {
+	return LoggerWithFields(GetLogger(), fields)
+}
+
+// With 以键值对的形式为全局日志记录器添加字段
+func With(keyValues ...any) FieldLogger {
+	return LoggerWith(GetLogger(), keyValues...)
+}
+
+// pairsToFields 将键值对转换为字段，键不是字符串时使用 fmt.Sprint 转换，多出的键的值为nil
+func pairsToFields(keyValues []any) Fields {
+	fields := make(Fields, (len(keyValues)+1)/2)
+	for i := 0; i < len(keyValues); i += 2 {
+		key := fmt.Sprint(keyValues[i])
+		if i+1 < len(keyValues) {
+			fields[key] = keyValues[i+1]
+		} else {
+			fields[key] = nil
+		}
+	}
+	return fields
+}
+
+// formatFields 将字段按照键排序后格式化为 key=value 的形式
+func formatFields(fields map[string]any) string {
+	keys := slices.Sorted(maps.Keys(fields))
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := fmt.Sprint(fields[k])
+		if strings.ContainsAny(v, " \t\n\"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, " ")
+}
+
+// WithFields 返回一个携带指定字段的日志记录器，所有活跃的日志记录器都会输出这些字段
+func (cl *CryoLogger) WithFields(fields Fields) FieldLogger {
+	return &cryoFieldLogger{cl: cl, fields: logrus.Fields(maps.Clone(fields))}
+}
+
+// With 以键值对的形式添加字段
+func (cl *CryoLogger) With(keyValues ...any) FieldLogger {
+	return cl.WithFields(pairsToFields(keyValues))
+}
+
+// cryoFieldLogger 携带结构化字段的 CryoLogger
+type cryoFieldLogger struct {
+	cl     *CryoLogger
+	fields logrus.Fields
+}
+
+// each 为每个活跃的日志记录器创建携带字段的日志条目
+func (l *cryoFieldLogger) each(fn func(entry *logrus.Entry)) {
+	l.cl.loggersMutex.RLock()
+	defer l.cl.loggersMutex.RUnlock()
+	for _, logger := range l.cl.activeLoggers {
+		fn(logger.WithFields(l.fields))
+	}
+}
+
+// Init 字段日志记录器不需要初始化
+func (l *cryoFieldLogger) Init() error {
+	return nil
+}
+
+// WithFields 返回一个合并了指定字段的日志记录器
+func (l *cryoFieldLogger) WithFields(fields Fields) FieldLogger {
+	merged := maps.Clone(l.fields)
+	maps.Copy(merged, fields)
+	return &cryoFieldLogger{cl: l.cl, fields: merged}
+}
+
+// With 以键值对的形式添加字段
+func (l *cryoFieldLogger) With(keyValues ...any) FieldLogger {
+	return l.WithFields(pairsToFields(keyValues))
+}
+
+func (l *cryoFieldLogger) Trace(args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Trace(args...) })
+}
+
+func (l *cryoFieldLogger) Debug(args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Debug(args...) })
+}
+
+func (l *cryoFieldLogger) Info(args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Info(args...) })
+}
+
+func (l *cryoFieldLogger) Warn(args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Warn(args...) })
+}
+
+func (l *cryoFieldLogger) Error(args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Error(args...) })
+}
+
+func (l *cryoFieldLogger) Fatal(args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Fatal(args...) })
+}
+
+func (l *cryoFieldLogger) Panic(args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Panic(args...) })
+}
+
+func (l *cryoFieldLogger) Tracef(format string, args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Tracef(format, args...) })
+}
+
+func (l *cryoFieldLogger) Debugf(format string, args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Debugf(format, args...) })
+}
+
+func (l *cryoFieldLogger) Infof(format string, args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Infof(format, args...) })
+}
+
+func (l *cryoFieldLogger) Warnf(format string, args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Warnf(format, args...) })
+}
+
+func (l *cryoFieldLogger) Errorf(format string, args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Errorf(format, args...) })
+}
+
+func (l *cryoFieldLogger) Fatalf(format string, args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Fatalf(format, args...) })
+}
+
+func (l *cryoFieldLogger) Panicf(format string, args ...interface{}) {
+	l.each(func(e *logrus.Entry) { e.Panicf(format, args...) })
+}
+
+// suffixFieldLogger 为不支持结构化字段的日志记录器将字段附加在消息后面
+type suffixFieldLogger struct {
+	Logger
+	fields Fields
+}
+
+// WithFields 返回一个合并了指定字段的日志记录器
+func (l *suffixFieldLogger) WithFields(fields Fields) FieldLogger {
+	merged := maps.Clone(l.fields)
+	maps.Copy(merged, fields)
+	return &suffixFieldLogger{Logger: l.Logger, fields: merged}
+}
+
+// With 以键值对的形式添加字段
+func (l *suffixFieldLogger) With(keyValues ...any) FieldLogger {
+	return l.WithFields(pairsToFields(keyValues))
+}
+
+func (l *suffixFieldLogger) suffix(args []interface{}) string {
+	if len(l.fields) == 0 {
+		return fmt.Sprint(args...)
+	}
+	return fmt.Sprint(args...) + " " + formatFields(l.fields)
+}
+
+func (l *suffixFieldLogger) Trace(args ...interface{}) { l.Logger.Trace(l.suffix(args)) }
+func (l *suffixFieldLogger) Debug(args ...interface{}) { l.Logger.Debug(l.suffix(args)) }
+func (l *suffixFieldLogger) Info(args ...interface{})  { l.Logger.Info(l.suffix(args)) }
+func (l *suffixFieldLogger) Warn(args ...interface{})  { l.Logger.Warn(l.suffix(args)) }
+func (l *suffixFieldLogger) Error(args ...interface{}) { l.Logger.Error(l.suffix(args)) }
+func (l *suffixFieldLogger) Fatal(args ...interface{}) { l.Logger.Fatal(l.suffix(args)) }
+func (l *suffixFieldLogger) Panic(args ...interface{}) { l.Logger.Panic(l.suffix(args)) }
+
+func (l *suffixFieldLogger) Tracef(format string, args ...interface{}) {
+	l.Logger.Trace(l.suffix([]interface{}{fmt.Sprintf(format, args...)}))
+}
+
+func (l *suffixFieldLogger) Debugf(format string, args ...interface{}) {
+	l.Logger.Debug(l.suffix([]interface{}{fmt.Sprintf(format, args...)}))
+}
+
+func (l *suffixFieldLogger) Infof(format string, args ...interface{}) {
+	l.Logger.Info(l.suffix([]interface{}{fmt.Sprintf(format, args...)}))
+}
+
+func (l *suffixFieldLogger) Warnf(format string, args ...interface{}) {
+	l.Logger.Warn(l.suffix([]interface{}{fmt.Sprintf(format, args...)}))
+}
+
+func (l *suffixFieldLogger) Errorf(format string, args ...interface{}) {
+	l.Logger.Error(l.suffix([]interface{}{fmt.Sprintf(format, args...)}))
+}
+
+func (l *suffixFieldLogger) Fatalf(format string, args ...interface{}) {
+	l.Logger.Fatal(l.suffix([]interface{}{fmt.Sprintf(format, args...)}))
+}
+
+func (l *suffixFieldLogger) Panicf(format string, args ...interface{}) {
+	l.Logger.Panic(l.suffix([]interface{}{fmt.Sprintf(format, args...)}))
+}
+
+// EventFields 返回事件用于结构化日志的字段，包括事件ID、事件类型、Bot以及能确定时的群号和发送者
+func EventFields(event CryoEvent) Fields {
+	base := event.GetBaseEvent()
+	fields := Fields{
+		"event_id":   base.EventId,
+		"event_type": eventTypeName(event),
+	}
+	if base.BotId != "" {
+		fields["bot_id"] = base.BotId
+	}
+	if base.BotUin != 0 {
+		fields["bot_uin"] = base.BotUin
+	}
+	if groupUin := eventGroupUin(event); groupUin != 0 {
+		fields["group_uin"] = groupUin
+	}
+	if e, ok := event.(CryoMessageEvent); ok {
+		if senderUin := e.GetMessageEvent().SenderUin; senderUin != 0 {
+			fields["sender_uin"] = senderUin
+		}
+	}
+	return fields
+}
+
+// GetEventLogger 返回携带事件字段的日志记录器，可以在处理器中使用，日志可以按照Bot、群或事件进行过滤
+func (b *Bot) GetEventLogger(event CryoEvent) FieldLogger {
+	return LoggerWithFields(b.log(), EventFields(event))
+}
+
+// GetLogger 返回携带客户端字段的日志记录器
+func (c *CryoClient) GetLogger() FieldLogger {
+	return c.log()
+}
+
+// clientFields 返回客户端用于结构化日志的字段
+func (c *CryoClient) clientFields() Fields {
+	fields := Fields{"bot_id": c.Id}
+	if c.Uin != 0 {
+		fields["bot_uin"] = c.Uin
+	}
+	return fields
+}
@@ -0,0 +1,439 @@
+package cryobot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MongoDB日志存储
+//
+// cryobot本身不依赖MongoDB的驱动，也没有内置连接MongoDB的实现，MongoLogStore 只通过 MongoCollection 接口读写集合
+// 使用MongoDB时需要在自己的程序中引入官方驱动并实现 MongoCollection，只需要几行代码：
+//
+//	type mongoLogs struct{ coll *mongo.Collection }
+//
+//	func (m mongoLogs) InsertMany(ctx context.Context, records []cryobot.LogRecord) error {
+//		docs := make([]any, len(records))
+//		for i, r := range records {
+//			docs[i] = r
+//		}
+//		_, err := m.coll.InsertMany(ctx, docs)
+//		return err
+//	}
+//
+//	func (m mongoLogs) FindLogs(ctx context.Context, filter map[string]any, limit int) ([]cryobot.LogRecord, error) {
+//		opts := options.Find().SetSort(bson.D{{"time", -1}}).SetLimit(int64(limit))
+//		cur, err := m.coll.Find(ctx, bson.M(filter), opts)
+//		if err != nil {
+//			return nil, err
+//		}
+//		var records []cryobot.LogRecord
+//		return records, cur.All(ctx, &records)
+//	}
+//
+// 然后通过 CryoLogger.InitMongoLogger 或 Bot.SetLogStore 使用，建议为 time 字段建立索引
+// 也可以通过 Bot.SetMongoConnector 设置连接函数，在配置中将 log_store.type 设置为 mongo 时由Bot按照配置连接
+// MemoryMongoCollection 是一个在内存中模拟集合的实现，可以在没有MongoDB的环境下使用和测试
+
+// MongoConnector 按照配置连接MongoDB并返回用于保存日志的集合，由使用MongoDB驱动的程序提供
+type MongoConnector func(uri, database, collection string) (MongoCollection, error)
+
+// MongoCollection MongoDB集合的最小接口，filter 使用MongoDB的查询语法，FindLogs 需要按照 time 字段从新到旧排序
+type MongoCollection interface {
+	InsertMany(ctx context.Context, records []LogRecord) error
+	FindLogs(ctx context.Context, filter map[string]any, limit int) ([]LogRecord, error)
+}
+
+const (
+	mongoLogBatchSize     = 100             // 每次批量写入的最大日志数量
+	mongoLogFlushInterval = time.Second     // 定时写入的间隔
+	mongoLogQueueSize     = 4096            // 等待写入的日志队列容量
+	mongoLogTimeout       = 5 * time.Second // 每次读写的超时时间
+)
+
+// MongoLogStore 将日志批量写入MongoDB集合的日志存储
+//
+// 日志会先进入队列，由后台协程每秒或每攒够100条写入一次，队列已满时新的日志会被丢弃
+// 写入失败时不会再记录日志以免循环，可以通过 LastError 获取最近一次的错误
+type MongoLogStore struct {
+	coll      MongoCollection
+	records   chan LogRecord
+	flushReq  chan chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+	dropped   atomic.Uint64
+	lastErr   atomic.Pointer[error]
+}
+
+// NewMongoLogStore 创建一个写入指定集合的MongoDB日志存储，并启动后台写入协程
+func NewMongoLogStore(coll MongoCollection) *MongoLogStore {
+	s := &MongoLogStore{
+		coll:     coll,
+		records:  make(chan LogRecord, mongoLogQueueSize),
+		flushReq: make(chan chan struct{}),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// run 后台写入协程
+func (s *MongoLogStore) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(mongoLogFlushInterval)
+	defer ticker.Stop()
+	batch := make([]LogRecord, 0, mongoLogBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), mongoLogTimeout)
+		defer cancel()
+		if err := s.coll.InsertMany(ctx, slices.Clone(batch)); err != nil {
+			s.lastErr.Store(&err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case r := <-s.records:
+			batch = append(batch, r)
+			if len(batch) >= mongoLogBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case ch := <-s.flushReq:
+			s.drain(&batch, flush)
+			flush()
+			close(ch)
+		case <-s.done:
+			s.drain(&batch, flush)
+			flush()
+			return
+		}
+	}
+}
+
+// drain 取出队列中所有等待写入的日志
+func (s *MongoLogStore) drain(batch *[]LogRecord, flush func()) {
+	for {
+		select {
+		case r := <-s.records:
+			*batch = append(*batch, r)
+			if len(*batch) >= mongoLogBatchSize {
+				flush()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// WriteLog 将日志放入写入队列，队列已满时丢弃日志
+func (s *MongoLogStore) WriteLog(record LogRecord) error {
+	select {
+	case <-s.done:
+		return errors.New("日志存储已关闭")
+	default:
+	}
+	select {
+	case s.records <- record:
+	default:
+		s.dropped.Add(1)
+	}
+	return nil
+}
+
+// Flush 立即写入队列中所有等待写入的日志
+func (s *MongoLogStore) Flush() {
+	ch := make(chan struct{})
+	select {
+	case s.flushReq <- ch:
+		<-ch
+	case <-s.stopped:
+	}
+}
+
+// QueryLogs 写入队列中的日志后，按照时间从新到旧返回满足条件的日志
+func (s *MongoLogStore) QueryLogs(q LogQuery) ([]LogRecord, error) {
+	q = q.withDefaults()
+	filter, err := mongoLogFilter(q)
+	if err != nil {
+		return nil, err
+	}
+	s.Flush()
+	ctx, cancel := context.WithTimeout(context.Background(), mongoLogTimeout)
+	defer cancel()
+	return s.coll.FindLogs(ctx, filter, q.Limit)
+}
+
+// Dropped 返回因队列已满而被丢弃的日志数量
+func (s *MongoLogStore) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// LastError 返回最近一次写入失败的错误
+func (s *MongoLogStore) LastError() error {
+	if err := s.lastErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// Close 写入队列中剩余的日志并停止后台写入协程
+func (s *MongoLogStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	<-s.stopped
+	return s.LastError()
+}
+
+// mongoLogFilter 将查询条件转换为MongoDB的查询语法
+func mongoLogFilter(q LogQuery) (map[string]any, error) {
+	filter := map[string]any{}
+	levels, err := q.levels()
+	if err != nil {
+		return nil, err
+	}
+	if levels != nil {
+		filter["level"] = map[string]any{"$in": levels}
+	}
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		cond := map[string]any{}
+		if !q.Since.IsZero() {
+			cond["$gte"] = q.Since
+		}
+		if !q.Until.IsZero() {
+			cond["$lte"] = q.Until
+		}
+		filter["time"] = cond
+	}
+	if q.BotId != "" {
+		filter["bot_id"] = q.BotId
+	}
+	if q.BotUin != 0 {
+		filter["bot_uin"] = q.BotUin
+	}
+	if q.Text != "" {
+		filter["message"] = map[string]any{"$regex": regexp.QuoteMeta(q.Text), "$options": "i"}
+	}
+	return filter, nil
+}
+
+// InitMongoLogger 初始化MongoDB日志记录器，日志会写入指定的集合，返回的日志存储可以用于查询日志
+//
+// 你可以单独设置MongoDB日志的日志等级，如果没有传入，则默认使用InfoLevel
+//
+// 详细的日志等级说明请参考InitTextLogger函数
+//
+// 重复调用时会关闭之前的MongoDB日志存储，之前队列中的日志会在关闭前写入
+func (cl *CryoLogger) InitMongoLogger(coll MongoCollection, level ...logrus.Level) *MongoLogStore {
+	if len(level) <= 0 { // 如果没有传入日志等级，则默认使用InfoLevel
+		level = append(level, logrus.InfoLevel)
+	}
+	store := NewMongoLogStore(coll)
+	cl.loggersMutex.Lock()
+	previous := cl.mongoStore
+	cl.mongoStore = store
+	cl.MongoLogger = newSinkLogger(store, level[0])
+	cl.loggersMutex.Unlock()
+
+	cl.updateActiveLoggers() // 更新活跃日志记录器列表
+	if previous != nil {
+		_ = previous.Close()
+	}
+	return store
+}
+
+// SetMongoConnector 设置Bot连接MongoDB使用的函数，配置中的 log_store.type 为 mongo 时需要在 Init 之前设置
+func (b *Bot) SetMongoConnector(connector MongoConnector) {
+	b.logStoreMutex.Lock()
+	defer b.logStoreMutex.Unlock()
+	b.mongoConnector = connector
+}
+
+// getMongoConnector 返回Bot连接MongoDB使用的函数
+func (b *Bot) getMongoConnector() MongoConnector {
+	b.logStoreMutex.RLock()
+	defer b.logStoreMutex.RUnlock()
+	return b.mongoConnector
+}
+
+// MemoryMongoCollection 在内存中模拟的MongoDB集合，支持 MongoLogStore 使用的查询语法
+//
+// 支持字段的等值匹配以及 $gte / $gt / $lte / $lt / $in / $regex / $options 操作符，可以作为本地的替代品使用
+type MemoryMongoCollection struct {
+	mutex sync.RWMutex
+	docs  []LogRecord
+}
+
+// NewMemoryMongoCollection 创建一个空的内存集合
+func NewMemoryMongoCollection() *MemoryMongoCollection {
+	return &MemoryMongoCollection{}
+}
+
+// InsertMany 插入日志记录
+func (c *MemoryMongoCollection) InsertMany(_ context.Context, records []LogRecord) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.docs = append(c.docs, records...)
+	return nil
+}
+
+// FindLogs 按照时间从新到旧返回满足查询条件的日志记录，limit 不大于0时不限制数量
+func (c *MemoryMongoCollection) FindLogs(_ context.Context, filter map[string]any, limit int) ([]LogRecord, error) {
+	c.mutex.RLock()
+	var result []LogRecord
+	for _, doc := range c.docs {
+		ok, err := matchMongoFilter(doc, filter)
+		if err != nil {
+			c.mutex.RUnlock()
+			return nil, err
+		}
+		if ok {
+			result = append(result, doc)
+		}
+	}
+	c.mutex.RUnlock()
+	slices.SortStableFunc(result, func(a, b LogRecord) int {
+		return b.Time.Compare(a.Time)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// Len 返回集合中的日志数量
+func (c *MemoryMongoCollection) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.docs)
+}
+
+// mongoField 返回日志记录中对应字段的值
+func mongoField(doc LogRecord, key string) (any, bool) {
+	switch key {
+	case "time":
+		return doc.Time, true
+	case "level":
+		return doc.Level, true
+	case "message":
+		return doc.Message, true
+	case "bot_id":
+		return doc.BotId, true
+	case "bot_uin":
+		return doc.BotUin, true
+	}
+	v, ok := doc.Fields[key]
+	return v, ok
+}
+
+// matchMongoFilter 检查日志记录是否满足查询条件
+func matchMongoFilter(doc LogRecord, filter map[string]any) (bool, error) {
+	for key, cond := range filter {
+		value, _ := mongoField(doc, key)
+		ops, ok := cond.(map[string]any)
+		if !ok {
+			if !mongoEqual(value, cond) {
+				return false, nil
+			}
+			continue
+		}
+		for op, arg := range ops {
+			var matched bool
+			switch op {
+			case "$gte", "$gt", "$lte", "$lt":
+				c, ok := mongoCompare(value, arg)
+				if !ok {
+					return false, fmt.Errorf("字段 %s 不支持 %s 比较", key, op)
+				}
+				matched = op == "$gte" && c >= 0 || op == "$gt" && c > 0 || op == "$lte" && c <= 0 || op == "$lt" && c < 0
+			case "$in":
+				values, ok := arg.([]string)
+				if !ok {
+					return false, fmt.Errorf("%s 的参数必须是字符串数组", op)
+				}
+				matched = slices.ContainsFunc(values, func(v string) bool { return mongoEqual(value, v) })
+			case "$regex":
+				pattern := fmt.Sprint(arg)
+				if options, _ := ops["$options"].(string); options == "i" {
+					pattern = "(?i)" + pattern
+				}
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return false, err
+				}
+				matched = re.MatchString(fmt.Sprint(value))
+			case "$options":
+				matched = true
+			default:
+				return false, fmt.Errorf("不支持的操作符 %s", op)
+			}
+			if !matched {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// mongoEqual 比较两个值是否相等，数字按照数值比较
+func mongoEqual(a, b any) bool {
+	if c, ok := mongoCompare(a, b); ok {
+		return c == 0
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// mongoCompare 比较两个时间或数字
+func mongoCompare(a, b any) (int, bool) {
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Compare(tb), true
+		}
+		return 0, false
+	}
+	fa, ok1 := mongoNumber(a)
+	fb, ok2 := mongoNumber(b)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	switch {
+	case fa < fb:
+		return -1, true
+	case fa > fb:
+		return 1, true
+	}
+	return 0, true
+}
+
+// mongoNumber 将数字转换为float64
+func mongoNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
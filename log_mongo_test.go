@@ -0,0 +1,124 @@
+package cryobot
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMatchMongoFilter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	doc := LogRecord{
+		Time:    now,
+		Level:   "warning",
+		Message: "Sign Server Unavailable",
+		BotId:   "bot-1",
+		BotUin:  10001,
+		Fields:  map[string]any{"group_uin": uint32(20002), "handler": "echo"},
+	}
+	tests := []struct {
+		name    string
+		filter  map[string]any
+		want    bool
+		wantErr bool
+	}{
+		{name: "空的查询条件", filter: map[string]any{}, want: true},
+		{name: "字符串等值匹配", filter: map[string]any{"bot_id": "bot-1"}, want: true},
+		{name: "字符串不匹配", filter: map[string]any{"bot_id": "bot-2"}, want: false},
+		{name: "数字按数值比较", filter: map[string]any{"bot_uin": 10001}, want: true},
+		{name: "结构化字段", filter: map[string]any{"group_uin": int64(20002)}, want: true},
+		{name: "不存在的字段", filter: map[string]any{"missing": "x"}, want: false},
+		{name: "时间范围内", filter: map[string]any{"time": map[string]any{"$gte": now.Add(-time.Hour), "$lte": now}}, want: true},
+		{name: "早于开始时间", filter: map[string]any{"time": map[string]any{"$gt": now}}, want: false},
+		{name: "晚于结束时间", filter: map[string]any{"time": map[string]any{"$lt": now}}, want: false},
+		{name: "$in 匹配", filter: map[string]any{"level": map[string]any{"$in": []string{"warning", "error"}}}, want: true},
+		{name: "$in 不匹配", filter: map[string]any{"level": map[string]any{"$in": []string{"error"}}}, want: false},
+		{name: "$regex 区分大小写", filter: map[string]any{"message": map[string]any{"$regex": "server"}}, want: false},
+		{name: "$regex 不区分大小写", filter: map[string]any{"message": map[string]any{"$regex": "server", "$options": "i"}}, want: true},
+		{name: "多个条件需要同时满足", filter: map[string]any{"bot_id": "bot-1", "level": "error"}, want: false},
+		{name: "时间与字符串比较", filter: map[string]any{"time": map[string]any{"$gte": "2025"}}, wantErr: true},
+		{name: "$in 的参数不是字符串数组", filter: map[string]any{"level": map[string]any{"$in": "warning"}}, wantErr: true},
+		{name: "无效的正则表达式", filter: map[string]any{"message": map[string]any{"$regex": "("}}, wantErr: true},
+		{name: "不支持的操作符", filter: map[string]any{"level": map[string]any{"$ne": "info"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchMongoFilter(doc, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMongoLogStore(t *testing.T) {
+	coll := NewMemoryMongoCollection()
+	store := NewMongoLogStore(coll)
+	defer store.Close()
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []LogRecord{
+		{Time: base, Level: "info", Message: "bot connected", BotId: "a", BotUin: 1},
+		{Time: base.Add(time.Minute), Level: "warning", Message: "Sign server unavailable", BotId: "a", BotUin: 1},
+		{Time: base.Add(2 * time.Minute), Level: "error", Message: "login failed", BotId: "b", BotUin: 2},
+		{Time: base.Add(3 * time.Minute), Level: "debug", Message: "heartbeat", BotId: "b", BotUin: 2},
+	}
+	for _, r := range records {
+		if err := store.WriteLog(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query LogQuery
+		want  []string // 按时间从新到旧的日志消息
+	}{
+		{name: "全部日志", query: LogQuery{}, want: []string{"heartbeat", "login failed", "Sign server unavailable", "bot connected"}},
+		{name: "最低等级", query: LogQuery{Level: "warn"}, want: []string{"login failed", "Sign server unavailable"}},
+		{name: "客户端ID", query: LogQuery{BotId: "a"}, want: []string{"Sign server unavailable", "bot connected"}},
+		{name: "客户端QQ号", query: LogQuery{BotUin: 2}, want: []string{"heartbeat", "login failed"}},
+		{name: "文本不区分大小写", query: LogQuery{Text: "SIGN"}, want: []string{"Sign server unavailable"}},
+		{name: "文本中的正则字符按原样匹配", query: LogQuery{Text: "fail.d"}, want: nil},
+		{name: "时间范围", query: LogQuery{Since: base.Add(time.Minute), Until: base.Add(2 * time.Minute)}, want: []string{"login failed", "Sign server unavailable"}},
+		{name: "数量限制", query: LogQuery{Limit: 1}, want: []string{"heartbeat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := store.QueryLogs(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range result {
+				got = append(got, r.Message)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMongoLogStoreClose(t *testing.T) {
+	coll := NewMemoryMongoCollection()
+	store := NewMongoLogStore(coll)
+	for i := range 150 {
+		_ = store.WriteLog(LogRecord{Time: time.Unix(int64(i), 0), Level: "info", Message: "log"})
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if coll.Len() != 150 {
+		t.Errorf("关闭前应该写入队列中所有的日志，got %d", coll.Len())
+	}
+	if err := store.WriteLog(LogRecord{}); err == nil {
+		t.Error("关闭后写入日志应该返回错误")
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("重复关闭时返回了错误：%v", err)
+	}
+}
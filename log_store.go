@@ -0,0 +1,467 @@
+package cryobot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/go-json-experiment/json"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志存储与查询
+//
+// 实现了 LogSink 的日志接收器可以通过 CryoLogger.AddSink 接收所有满足日志等级的日志，实现了 LogStore 的日志存储还可以按条件查询日志
+// 内置了内存和JSON文件两种日志存储，也可以通过 QueryJsonLogFile 查询 InitJsonFileLogger 输出的JSON日志文件
+// MongoLogStore 可以将日志批量写入MongoDB，但需要由使用方通过 MongoCollection 接入MongoDB驱动，详见 log_mongo.go
+// 为Bot设置日志存储后，可以通过 Bot.QueryLogs 或管理接口的 GET /api/v1/logs 查询日志
+
+// LogRecord 一条日志记录
+type LogRecord struct {
+	Time    time.Time      `json:"time" bson:"time"`                                    // 记录日志的时间
+	Level   string         `json:"level" bson:"level"`                                  // 日志等级，如 info / warning / error
+	Message string         `json:"message" bson:"message"`                              // 去除了终端颜色控制符的日志消息
+	BotId   string         `json:"bot_id,omitempty,omitzero" bson:"bot_id,omitempty"`   // 日志所属的客户端ID
+	BotUin  int64          `json:"bot_uin,omitempty,omitzero" bson:"bot_uin,omitempty"` // 日志所属的客户端QQ号
+	Fields  map[string]any `json:"fields,omitempty,omitzero" bson:"fields,omitempty"`   // 日志携带的其他结构化字段
+}
+
+// LogQuery 日志的查询条件，为空的条件不参与过滤
+type LogQuery struct {
+	Level  string    `json:"level,omitempty,omitzero"`   // 最低的日志等级，如 warn 会返回 warning、error、fatal 和 panic 等级的日志
+	Since  time.Time `json:"since,omitempty,omitzero"`   // 开始时间，包含该时间
+	Until  time.Time `json:"until,omitempty,omitzero"`   // 结束时间，包含该时间
+	BotId  string    `json:"bot_id,omitempty,omitzero"`  // 客户端ID
+	BotUin int64     `json:"bot_uin,omitempty,omitzero"` // 客户端QQ号
+	Text   string    `json:"text,omitempty,omitzero"`    // 日志消息中包含的文本，不区分大小写
+	Limit  int       `json:"limit,omitempty,omitzero"`   // 最多返回的日志数量，默认为100，最大为1000
+}
+
+// withDefaults 返回填充了默认值的查询条件
+func (q LogQuery) withDefaults() LogQuery {
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+	q.Limit = min(q.Limit, 1000)
+	return q
+}
+
+// levels 返回满足最低日志等级的所有日志等级，没有设置最低等级时返回nil
+func (q LogQuery) levels() ([]string, error) {
+	if q.Level == "" {
+		return nil, nil
+	}
+	minLevel, err := logrus.ParseLevel(q.Level)
+	if err != nil {
+		return nil, err
+	}
+	var levels []string
+	for _, l := range logrus.AllLevels {
+		if l <= minLevel {
+			levels = append(levels, l.String())
+		}
+	}
+	return levels, nil
+}
+
+// Match 检查日志记录是否满足查询条件
+func (q LogQuery) Match(r LogRecord) bool {
+	if q.Level != "" {
+		minLevel, err := logrus.ParseLevel(q.Level)
+		level, err2 := logrus.ParseLevel(r.Level)
+		if err != nil || err2 != nil || level > minLevel {
+			return false
+		}
+	}
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.Time.After(q.Until) {
+		return false
+	}
+	if q.BotId != "" && r.BotId != q.BotId {
+		return false
+	}
+	if q.BotUin != 0 && r.BotUin != q.BotUin {
+		return false
+	}
+	if q.Text != "" && !strings.Contains(strings.ToLower(r.Message), strings.ToLower(q.Text)) {
+		return false
+	}
+	return true
+}
+
+// LogSink 日志接收器，会在记录日志的协程中同步调用，需要并发安全，耗时的写入应当自行缓冲
+type LogSink interface {
+	WriteLog(record LogRecord) error
+}
+
+// LogStore 可以查询的日志存储
+type LogStore interface {
+	LogSink
+	QueryLogs(q LogQuery) ([]LogRecord, error) // 按照时间从新到旧返回满足条件的日志
+}
+
+// logRecordFromEntry 将logrus的日志条目转换为日志记录
+func logRecordFromEntry(entry *logrus.Entry) LogRecord {
+	r := LogRecord{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: ansiPattern.ReplaceAllString(entry.Message, ""),
+	}
+	for k, v := range entry.Data {
+		switch k {
+		case "bot_id":
+			r.BotId = fmt.Sprint(v)
+			continue
+		case "bot_uin":
+			if uin, err := strconv.ParseInt(fmt.Sprint(v), 10, 64); err == nil {
+				r.BotUin = uin
+				continue
+			}
+		}
+		if r.Fields == nil {
+			r.Fields = make(map[string]any, len(entry.Data))
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		r.Fields[k] = v
+	}
+	return r
+}
+
+// logSinkHook 将日志条目转发给日志接收器的logrus钩子
+type logSinkHook struct {
+	sink LogSink
+}
+
+func (h *logSinkHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *logSinkHook) Fire(entry *logrus.Entry) error {
+	return h.sink.WriteLog(logRecordFromEntry(entry))
+}
+
+// nopFormatter 不输出任何内容的格式化样式，日志接收器使用的logrus日志记录器只通过钩子输出
+type nopFormatter struct{}
+
+func (nopFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// newSinkLogger 创建一个只将日志转发给日志接收器的logrus日志记录器
+func newSinkLogger(sink LogSink, level logrus.Level) *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	l.SetFormatter(nopFormatter{})
+	l.SetLevel(level)
+	l.AddHook(&logSinkHook{sink: sink})
+	return l
+}
+
+// AddSink 添加一个日志接收器，可以传入日志等级，没有传入时默认使用InfoLevel
+func (cl *CryoLogger) AddSink(sink LogSink, level ...logrus.Level) {
+	if len(level) <= 0 {
+		level = append(level, logrus.InfoLevel)
+	}
+	cl.loggersMutex.Lock()
+	cl.sinks = append(cl.sinks, logSinkEntry{sink: sink, logger: newSinkLogger(sink, level[0])})
+	cl.loggersMutex.Unlock()
+	cl.updateActiveLoggers()
+}
+
+// RemoveSink 移除通过 AddSink 添加的日志接收器
+func (cl *CryoLogger) RemoveSink(sink LogSink) {
+	cl.loggersMutex.Lock()
+	cl.sinks = slices.DeleteFunc(cl.sinks, func(e logSinkEntry) bool {
+		return e.sink == sink
+	})
+	cl.loggersMutex.Unlock()
+	cl.updateActiveLoggers()
+}
+
+// logSinkEntry 添加到 CryoLogger 上的日志接收器
+type logSinkEntry struct {
+	sink   LogSink
+	logger *logrus.Logger
+}
+
+// MemoryLogStore 在内存中保存最近日志的日志存储
+type MemoryLogStore struct {
+	mutex    sync.RWMutex
+	records  []LogRecord
+	head     int
+	size     int
+	capacity int
+}
+
+// NewMemoryLogStore 创建一个最多保存 capacity 条日志的内存日志存储，capacity 不大于0时保存1000条
+func NewMemoryLogStore(capacity int) *MemoryLogStore {
+	if capacity <= 0 {
+		capacity = 1000
+	}
+	return &MemoryLogStore{records: make([]LogRecord, capacity), capacity: capacity}
+}
+
+// WriteLog 保存一条日志，已满时覆盖最旧的日志
+func (s *MemoryLogStore) WriteLog(record LogRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[(s.head+s.size)%s.capacity] = record
+	if s.size < s.capacity {
+		s.size++
+	} else {
+		s.head = (s.head + 1) % s.capacity
+	}
+	return nil
+}
+
+// QueryLogs 按照时间从新到旧返回满足条件的日志
+func (s *MemoryLogStore) QueryLogs(q LogQuery) ([]LogRecord, error) {
+	q = q.withDefaults()
+	if _, err := q.levels(); err != nil {
+		return nil, err
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var result []LogRecord
+	for i := s.size - 1; i >= 0 && len(result) < q.Limit; i-- {
+		if r := s.records[(s.head+i)%s.capacity]; q.Match(r) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// JsonFileLogStore 以JSON Lines格式将日志追加到文件中的日志存储
+//
+// 写入的格式与logrus的 JSONFormatter 相同，因此也可以用于查询 InitJsonFileLogger 输出的日志文件
+type JsonFileLogStore struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+// NewJsonFileLogStore 创建一个写入指定文件的JSON文件日志存储，文件和所在的目录不存在时会自动创建
+func NewJsonFileLogStore(path string) (*JsonFileLogStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JsonFileLogStore{path: path, file: f}, nil
+}
+
+// WriteLog 将日志追加为一行JSON
+func (s *JsonFileLogStore) WriteLog(record LogRecord) error {
+	line := make(map[string]any, len(record.Fields)+5)
+	for k, v := range record.Fields {
+		line[k] = v
+	}
+	line["time"] = record.Time.Format(time.RFC3339Nano)
+	line["level"] = record.Level
+	line["msg"] = record.Message
+	if record.BotId != "" {
+		line["bot_id"] = record.BotId
+	}
+	if record.BotUin != 0 {
+		line["bot_uin"] = record.BotUin
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// QueryLogs 按照时间从新到旧返回满足条件的日志
+func (s *JsonFileLogStore) QueryLogs(q LogQuery) ([]LogRecord, error) {
+	return QueryJsonLogFile(s.path, q)
+}
+
+// Close 关闭日志文件
+func (s *JsonFileLogStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// QueryJsonLogFile 查询logrus的 JSONFormatter 格式的日志文件，按照时间从新到旧返回满足条件的日志，无法解析的行会被跳过
+func QueryJsonLogFile(path string, q LogQuery) ([]LogRecord, error) {
+	q = q.withDefaults()
+	if _, err := q.levels(); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// 日志文件按时间顺序追加，保留最近的 Limit 条满足条件的日志
+	var result []LogRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		r, ok := parseJsonLogLine(scanner.Bytes())
+		if !ok || !q.Match(r) {
+			continue
+		}
+		result = append(result, r)
+		if len(result) > q.Limit {
+			result = result[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.Reverse(result)
+	return result, nil
+}
+
+// parseJsonLogLine 解析一行logrus的JSON日志
+func parseJsonLogLine(line []byte) (LogRecord, bool) {
+	var data map[string]any
+	if err := json.Unmarshal(line, &data); err != nil {
+		return LogRecord{}, false
+	}
+	entry := &logrus.Entry{Data: logrus.Fields{}}
+	for k, v := range data {
+		switch k {
+		case "time":
+			t, err := time.Parse(time.RFC3339Nano, fmt.Sprint(v))
+			if err != nil {
+				return LogRecord{}, false
+			}
+			entry.Time = t
+		case "level":
+			level, err := logrus.ParseLevel(fmt.Sprint(v))
+			if err != nil {
+				return LogRecord{}, false
+			}
+			entry.Level = level
+		case "msg":
+			entry.Message = fmt.Sprint(v)
+		default:
+			if f, ok := v.(float64); ok && f == float64(int64(f)) {
+				v = int64(f)
+			}
+			entry.Data[k] = v
+		}
+	}
+	return logRecordFromEntry(entry), true
+}
+
+// LogStoreConfig 日志存储的配置
+type LogStoreConfig struct {
+	Type     string `json:"type,omitempty,omitzero"`     // 日志存储的类型，可以是 memory / file / mongo，为空时不启用
+	File     string `json:"file,omitempty,omitzero"`     // file：保存日志的文件，相对路径位于数据目录中，默认为数据目录中的 cryobot.jsonl
+	Level    string `json:"level,omitempty,omitzero"`    // 保存的最低日志等级，默认为 info
+	Capacity int    `json:"capacity,omitempty,omitzero"` // memory：最多保存的日志数量，默认为1000
+
+	MongoUri        string `json:"mongo_uri,omitempty,omitzero"`        // mongo：MongoDB的连接地址，需要通过 Bot.SetMongoConnector 设置连接函数
+	MongoDatabase   string `json:"mongo_database,omitempty,omitzero"`   // mongo：数据库名，默认为 cryobot
+	MongoCollection string `json:"mongo_collection,omitempty,omitzero"` // mongo：集合名，默认为 logs
+}
+
+// validate 校验日志存储的配置
+func (c LogStoreConfig) validate(invalid func(field, format string, args ...any)) {
+	switch c.Type {
+	case "", "memory", "file":
+	case "mongo":
+		if c.MongoUri == "" {
+			invalid("log_store.mongo_uri", "使用 mongo 日志存储时不能为空")
+		}
+	default:
+		invalid("log_store.type", "只能是 memory / file / mongo")
+	}
+	if c.Level != "" {
+		if _, err := logrus.ParseLevel(c.Level); err != nil {
+			invalid("log_store.level", "不是有效的日志等级")
+		}
+	}
+	if c.Capacity < 0 {
+		invalid("log_store.capacity", "不能为负数")
+	}
+}
+
+// NewLogStoreFromConfig 按照配置创建日志存储，file 类型的文件为相对路径时以及默认的文件位于指定的数据目录中，没有设置类型时返回nil
+//
+// mongo 类型使用传入的 connector 连接MongoDB，connector 为nil时返回错误
+func NewLogStoreFromConfig(config LogStoreConfig, layout DataLayout, connector MongoConnector) (LogStore, error) {
+	switch config.Type {
+	case "":
+		return nil, nil
+	case "memory":
+		return NewMemoryLogStore(config.Capacity), nil
+	case "file":
+		path := layout.Resolve(config.File)
+		if path == "" {
+			path = layout.LogFile()
+		}
+		return NewJsonFileLogStore(path)
+	case "mongo":
+		if connector == nil {
+			return nil, errors.New("没有设置MongoDB连接函数，请先调用 Bot.SetMongoConnector 接入MongoDB驱动")
+		}
+		database, collection := config.MongoDatabase, config.MongoCollection
+		if database == "" {
+			database = "cryobot"
+		}
+		if collection == "" {
+			collection = "logs"
+		}
+		coll, err := connector(config.MongoUri, database, collection)
+		if err != nil {
+			return nil, err
+		}
+		return NewMongoLogStore(coll), nil
+	}
+	return nil, fmt.Errorf("不支持的日志存储类型：%s", config.Type)
+}
+
+// SetLogStore 设置Bot的日志存储，Bot使用 CryoLogger 时日志存储会作为日志接收器添加到日志记录器上，可以传入保存的最低日志等级
+//
+// 使用其他日志记录器时需要自行将日志写入日志存储，为nil时移除已设置的日志存储
+func (b *Bot) SetLogStore(store LogStore, level ...logrus.Level) {
+	cl, _ := b.log().(*CryoLogger)
+	b.logStoreMutex.Lock()
+	defer b.logStoreMutex.Unlock()
+	if b.logStore != nil && cl != nil {
+		cl.RemoveSink(b.logStore)
+	}
+	b.logStore = store
+	if store != nil && cl != nil {
+		cl.AddSink(store, level...)
+	}
+}
+
+// GetLogStore 返回Bot的日志存储，没有设置时返回nil
+func (b *Bot) GetLogStore() LogStore {
+	b.logStoreMutex.RLock()
+	defer b.logStoreMutex.RUnlock()
+	return b.logStore
+}
+
+// QueryLogs 在Bot的日志存储中查询日志，按照时间从新到旧返回
+func (b *Bot) QueryLogs(q LogQuery) ([]LogRecord, error) {
+	store := b.GetLogStore()
+	if store == nil {
+		return nil, errors.New("没有设置日志存储")
+	}
+	return store.QueryLogs(q)
+}
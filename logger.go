@@ -14,9 +14,10 @@ import (
 // - 对终端进行文本输出（包含颜色和格式）
 // - 输出到log文件（包含格式）
 // - 输出到json文件
-// - （暂未实现）输出到MongoDB数据库
+// - 输出到MongoDB数据库
 //
-// 其中后两种输出方式可以提供日志查询/检索功能，并且有对应的函数封装可供调用
+// 其中后两种输出方式可以提供日志查询/检索功能，并且有对应的函数封装可供调用，详见 log_store.go
+// 也可以通过 AddSink 添加自定义的日志接收器，将日志写入其他数据库
 // 每种日志输出方式都可以单独设置日志等级，可以通过同一个日志函数自动调用
 //
 // 额外的，通过实现Logger接口并替换logger变量，你可以设置使用其他的日志记录器，如zap
@@ -60,6 +61,9 @@ type CryoLogger struct {
 	// 添加这些变量来跟踪活跃的日志记录器
 	loggersMutex  sync.RWMutex
 	activeLoggers []*logrus.Logger
+	hooks         []logrus.Hook  // 附加到终端日志记录器上的钩子，重新初始化终端日志时会被保留
+	sinks         []logSinkEntry // 通过 AddSink 添加的日志接收器
+	mongoStore    *MongoLogStore // MongoLogger 写入的日志存储
 }
 
 // Init 初始化日志记录器，默认使用单个终端日志记录器
@@ -91,10 +95,45 @@ func (cl *CryoLogger) InitTextLogger(level ...logrus.Level) {
 	cl.TextLogger.SetFormatter(&DefaultDarkFormatter{})
 	cl.TextLogger.SetLevel(level[0])
 	cl.TextLogger.SetOutput(logrus.StandardLogger().Out)
+	for _, hook := range cl.hooks {
+		cl.TextLogger.AddHook(hook)
+	}
 
 	cl.updateActiveLoggers() // 更新活跃日志记录器列表
 }
 
+// AddHook 向终端日志记录器添加一个logrus钩子，可以用于将日志转发到其他地方
+//
+// 钩子只会附加在终端日志记录器上，因此只会收到终端日志等级允许输出的日志
+func (cl *CryoLogger) AddHook(hook logrus.Hook) {
+	cl.loggersMutex.Lock()
+	defer cl.loggersMutex.Unlock()
+	cl.hooks = append(cl.hooks, hook)
+	if cl.TextLogger != nil {
+		cl.TextLogger.AddHook(hook)
+	}
+}
+
+// RemoveHook 移除通过 AddHook 添加的logrus钩子
+func (cl *CryoLogger) RemoveHook(hook logrus.Hook) {
+	cl.loggersMutex.Lock()
+	defer cl.loggersMutex.Unlock()
+	hooks := make([]logrus.Hook, 0, len(cl.hooks))
+	for _, h := range cl.hooks {
+		if h != hook {
+			hooks = append(hooks, h)
+		}
+	}
+	cl.hooks = hooks
+	if cl.TextLogger != nil {
+		levelHooks := make(logrus.LevelHooks)
+		for _, h := range hooks {
+			levelHooks.Add(h)
+		}
+		cl.TextLogger.ReplaceHooks(levelHooks)
+	}
+}
+
 // InitFileLogger 初始化文件日志记录器，需要传入一个io.Writer类型的文件对象
 //
 // 你可以使用os.OpenFile()函数打开一个文件，并将其传入该函数
@@ -184,6 +223,9 @@ func (cl *CryoLogger) updateActiveLoggers() {
 	if cl.MongoLogger != nil {
 		cl.activeLoggers = append(cl.activeLoggers, cl.MongoLogger)
 	}
+	for _, sink := range cl.sinks {
+		cl.activeLoggers = append(cl.activeLoggers, sink.logger)
+	}
 }
 
 // Trace 在所有活跃的日志记录器上以 Trace 级别记录一条消息
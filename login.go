@@ -0,0 +1,251 @@
+package cryobot
+
+import (
+	"github.com/LagrangeDev/LagrangeGo/client/packets/wtlogin/qrcodestate"
+	"sync"
+	"time"
+)
+
+// QRCodeLoginState 扫码登录的状态
+type QRCodeLoginState string
+
+const (
+	QRCodeLoginWaiting   QRCodeLoginState = "waiting"   // 等待扫码
+	QRCodeLoginScanned   QRCodeLoginState = "scanned"   // 已扫码，等待在手机上确认
+	QRCodeLoginRefreshed QRCodeLoginState = "refreshed" // 二维码已过期并自动刷新，等待扫描新的二维码
+	QRCodeLoginSuccess   QRCodeLoginState = "success"   // 登录成功
+	QRCodeLoginExpired   QRCodeLoginState = "expired"   // 二维码已过期且不再刷新
+	QRCodeLoginCanceled  QRCodeLoginState = "canceled"  // 在手机上取消了登录
+	QRCodeLoginTimeout   QRCodeLoginState = "timeout"   // 等待扫码超时
+	QRCodeLoginFailed    QRCodeLoginState = "failed"    // 登录失败
+)
+
+// IsFinished 返回扫码登录在该状态下是否已经结束
+func (s QRCodeLoginState) IsFinished() bool {
+	switch s {
+	case QRCodeLoginWaiting, QRCodeLoginScanned, QRCodeLoginRefreshed:
+		return false
+	}
+	return true
+}
+
+// QRCodeLoginConfig 扫码登录的配置
+type QRCodeLoginConfig struct {
+	Timeout    int                     `json:"timeout,omitempty,omitzero"`     // 等待扫码的总超时时间，单位为秒，默认为300秒，负数表示不限制
+	MaxRefresh int                     `json:"max_refresh,omitempty,omitzero"` // 二维码过期后自动刷新的最大次数，默认为3次，负数表示不刷新
+	Presenters []QRCodePresenterConfig `json:"presenters,omitempty,omitzero"`  // 二维码展示器的配置，为空时在终端打印二维码并保存到工作目录
+}
+
+// QRCodeLogin 一次扫码登录，记录了当前的二维码和登录状态
+type QRCodeLogin struct {
+	Id        string    // 登录使用的客户端ID
+	CreatedAt time.Time // 开始登录的时间
+
+	mutex      sync.RWMutex
+	url        string
+	qrcode     []byte
+	state      QRCodeLoginState
+	refreshed  int
+	client     *CryoClient
+	presenters []QRCodePresenter
+	done       chan struct{}
+}
+
+// GetUrl 返回当前二维码指向的链接，二维码刷新后会随之变化
+func (l *QRCodeLogin) GetUrl() string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.url
+}
+
+// GetQRCode 返回当前PNG格式的二维码图片，二维码刷新后会随之变化
+func (l *QRCodeLogin) GetQRCode() []byte {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.qrcode
+}
+
+// GetState 返回扫码登录当前的状态
+func (l *QRCodeLogin) GetState() QRCodeLoginState {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.state
+}
+
+// GetRefreshed 返回二维码已经自动刷新的次数
+func (l *QRCodeLogin) GetRefreshed() int {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.refreshed
+}
+
+// GetClient 返回登录使用的客户端，登录成功后可以通过它获取Uin、昵称等信息
+func (l *QRCodeLogin) GetClient() *CryoClient {
+	return l.client
+}
+
+// Done 返回一个在登录结束时关闭的通道
+func (l *QRCodeLogin) Done() <-chan struct{} {
+	return l.done
+}
+
+// setState 设置扫码登录的状态，状态发生变化时会发布 QRCodeLoginEvent
+func (l *QRCodeLogin) setState(state QRCodeLoginState) {
+	l.mutex.Lock()
+	changed := l.state != state
+	l.state = state
+	l.mutex.Unlock()
+	if changed || state == QRCodeLoginRefreshed {
+		SendQRCodeLoginEvent(l)
+	}
+}
+
+// fetch 获取一张新的二维码并交给所有的二维码展示器，refresh 为true时先增加刷新次数，展示器可以读取到刷新后的次数
+func (l *QRCodeLogin) fetch(refresh bool) error {
+	code, url, err := l.client.GetQRCode()
+	if err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	l.url = url
+	l.qrcode = code
+	if refresh {
+		l.refreshed++
+	}
+	l.mutex.Unlock()
+	for _, p := range l.presenters {
+		if err := p.Present(l); err != nil {
+			l.client.log().Errorf("展示二维码时出现错误：%v", err)
+		}
+	}
+	return nil
+}
+
+// wait 轮询扫码结果直到登录结束，二维码过期时会自动刷新，登录成功后会完成客户端的登录后处理
+func (l *QRCodeLogin) wait() (ok bool) {
+	defer close(l.done)
+	c := l.client
+	defer func() { c.recordLogin("qrcode", ok) }()
+	conf := c.config().QRCodeLogin
+	timeout := time.Duration(conf.Timeout) * time.Second
+	if conf.Timeout == 0 {
+		timeout = 300 * time.Second
+	}
+	maxRefresh := conf.MaxRefresh
+	if maxRefresh == 0 {
+		maxRefresh = 3
+	}
+	for {
+		if timeout > 0 && time.Since(l.CreatedAt) > timeout {
+			c.log().Warn("等待扫码超时！")
+			l.setState(QRCodeLoginTimeout)
+			return false
+		}
+		retCode, err := c.Client.GetQRCodeResult()
+		if err != nil {
+			c.log().Error("获取二维码登录结果时出现错误：", err)
+			l.setState(QRCodeLoginFailed)
+			return false
+		}
+		switch {
+		case retCode == qrcodestate.WaitingForConfirm:
+			l.setState(QRCodeLoginScanned)
+		case retCode.Waitable():
+		case retCode == qrcodestate.Expired:
+			if l.GetRefreshed() >= maxRefresh {
+				c.log().Warn("二维码已过期！")
+				l.setState(QRCodeLoginExpired)
+				return false
+			}
+			c.log().Info("二维码已过期，正在刷新...")
+			if err := l.fetch(true); err != nil {
+				c.log().Error("刷新二维码时出现错误：", err)
+				l.setState(QRCodeLoginFailed)
+				return false
+			}
+			l.setState(QRCodeLoginRefreshed)
+			continue
+		case retCode.Success():
+			if _, err := c.Client.QRCodeLogin(); err != nil {
+				c.log().Error("二维码登录时出现错误：", err)
+				l.setState(QRCodeLoginFailed)
+				return false
+			}
+			c.AfterLogin()
+			l.setState(QRCodeLoginSuccess)
+			return true
+		default:
+			c.log().Warn("扫码登录已被取消！")
+			l.setState(QRCodeLoginCanceled)
+			return false
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// newQRCodeLogin 为客户端创建一次扫码登录并获取第一张二维码
+func newQRCodeLogin(c *CryoClient, presenters []QRCodePresenter) (*QRCodeLogin, error) {
+	login := &QRCodeLogin{
+		Id:         c.Id,
+		CreatedAt:  time.Now(),
+		client:     c,
+		presenters: presenters,
+		done:       make(chan struct{}),
+	}
+	if err := login.fetch(false); err != nil {
+		return nil, err
+	}
+	login.setState(QRCodeLoginWaiting)
+	return login, nil
+}
+
+// StartQRCodeLogin 创建一个新的客户端并在后台开始扫码登录，登录成功的客户端会被加入已连接的客户端集合
+//
+// 可以传入二维码展示器，没有传入时不会使用配置中的展示器，调用方需要自行通过 GetQRCode 或 QRCodeLoginEvent 展示二维码
+func (b *Bot) StartQRCodeLogin(presenters ...QRCodePresenter) (*QRCodeLogin, error) {
+	c := NewCryoClient(b)
+	c.Init()
+	login, err := newQRCodeLogin(c, presenters)
+	if err != nil {
+		return nil, err
+	}
+	b.loginsMutex.Lock()
+	if b.logins == nil {
+		b.logins = make(map[string]*QRCodeLogin)
+	}
+	// 清理已经结束的登录
+	for id, l := range b.logins {
+		if l.GetState().IsFinished() {
+			delete(b.logins, id)
+		}
+	}
+	b.logins[login.Id] = login
+	b.loginsMutex.Unlock()
+
+	b.log().Infof("%s[Cryo] 正在后台扫码登录 %s", lavender, c.Id)
+	go b.connectClient(c, login.wait)
+	return login, nil
+}
+
+// GetQRCodeLogin 获取指定ID的扫码登录，已经结束的登录会在下一次开始扫码登录时被清理
+func (b *Bot) GetQRCodeLogin(id string) *QRCodeLogin {
+	b.loginsMutex.Lock()
+	defer b.loginsMutex.Unlock()
+	return b.logins[id]
+}
+
+// qrCodeLoginData 将扫码登录转换为Web后台和管理接口返回的数据
+func qrCodeLoginData(login *QRCodeLogin) map[string]any {
+	result := map[string]any{
+		"id":         login.Id,
+		"url":        login.GetUrl(),
+		"state":      login.GetState(),
+		"refreshed":  login.GetRefreshed(),
+		"created_at": login.CreatedAt.Unix(),
+	}
+	if login.GetState() == QRCodeLoginSuccess {
+		result["uin"] = login.GetClient().Uin
+		result["nickname"] = login.GetClient().GetNickname()
+	}
+	return result
+}
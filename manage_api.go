@@ -0,0 +1,546 @@
+package cryobot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-json-experiment/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 管理接口
+//
+// 提供一组JSON格式的HTTP接口，可以在不重启进程的情况下管理Bot客户端、以指定的Bot发送消息以及读取当前的配置
+// 所有接口都需要通过 Authorization 请求头或 access_token 查询参数携带配置中的访问令牌
+
+// ManageApiConfig 管理接口的配置
+type ManageApiConfig struct {
+	Enable bool   `json:"enable,omitempty,omitzero"` // 是否启用管理接口
+	Addr   string `json:"addr,omitempty,omitzero"`   // 监听地址，默认为 127.0.0.1:8091
+	Token  string `json:"token,omitempty,omitzero"`  // 访问令牌，不能为空
+}
+
+// ManageApi cryobot的管理接口
+type ManageApi struct {
+	bot    *Bot
+	config ManageApiConfig
+	server *http.Server
+}
+
+// NewManageApi 创建一个管理接口，调用 Start 后开始监听
+func NewManageApi(bot *Bot, config ManageApiConfig) *ManageApi {
+	if config.Addr == "" {
+		config.Addr = "127.0.0.1:8091"
+	}
+	return &ManageApi{bot: bot, config: config}
+}
+
+// GetConfig 返回管理接口使用的配置
+func (m *ManageApi) GetConfig() ManageApiConfig {
+	return m.config
+}
+
+// Handler 返回管理接口的HTTP处理器，可以用于挂载到自定义的HTTP服务上，没有设置访问令牌时所有接口都会返回403
+func (m *ManageApi) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/clients", m.serveClients)
+	mux.HandleFunc("POST /api/v1/clients", m.serveAddClient)
+	mux.HandleFunc("GET /api/v1/clients/saved", m.serveSavedClients)
+	mux.HandleFunc("DELETE /api/v1/clients/saved/{id}", m.serveRemoveSavedClient)
+	mux.HandleFunc("GET /api/v1/clients/{id}", m.serveClient)
+	mux.HandleFunc("DELETE /api/v1/clients/{id}", m.serveRemoveClient)
+	mux.HandleFunc("POST /api/v1/clients/{id}/relogin", m.serveRelogin)
+	mux.HandleFunc("POST /api/v1/clients/{id}/messages", m.serveSendMessage)
+	mux.HandleFunc("GET /api/v1/clients/{id}/friends", m.serveFriends)
+	mux.HandleFunc("GET /api/v1/clients/{id}/groups", m.serveGroups)
+	mux.HandleFunc("GET /api/v1/clients/{id}/health", m.serveClientHealth)
+	mux.HandleFunc("POST /api/v1/clients/{id}/health", m.serveClientHealth)
+	mux.HandleFunc("GET /api/v1/logins/{id}", m.serveLogin)
+	mux.HandleFunc("GET /api/v1/config", m.serveConfig)
+	mux.HandleFunc("GET /api/v1/sign_servers", m.serveSignServers)
+	mux.HandleFunc("GET /api/v1/health", m.serveHealth)
+	mux.HandleFunc("GET /api/v1/logs", m.serveLogs)
+	mux.HandleFunc("POST /api/v1/health", m.serveHealth)
+	mux.HandleFunc("GET /api/v1/accounts", m.serveAccounts)
+	mux.HandleFunc("POST /api/v1/accounts", m.serveAddAccount)
+	mux.HandleFunc("GET /api/v1/accounts/{uin}", m.serveAccount)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.config.Token == "" {
+			manageError(w, http.StatusForbidden, "管理接口没有设置访问令牌")
+			return
+		}
+		if code := checkOneBotToken(r, m.config.Token); code != http.StatusOK {
+			manageError(w, code, "%s", http.StatusText(code))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Start 启动管理接口
+func (m *ManageApi) Start() error {
+	if m.config.Token == "" {
+		return fmt.Errorf("管理接口必须设置访问令牌")
+	}
+	ln, err := net.Listen("tcp", m.config.Addr)
+	if err != nil {
+		return err
+	}
+	m.server = &http.Server{Handler: m.Handler()}
+	go func() {
+		if err := m.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			m.bot.log().Error("[ManageApi] 管理接口停止运行：", err)
+		}
+	}()
+	m.bot.log().Infof("%s[ManageApi] 管理接口已在 http://%s 上启动", lavender, m.config.Addr)
+	return nil
+}
+
+// Stop 停止管理接口
+func (m *ManageApi) Stop() {
+	if m.server == nil {
+		return
+	}
+	_ = m.server.Close()
+	m.server = nil
+}
+
+// manageError 以JSON格式返回错误
+func manageError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]any{"error": fmt.Sprintf(format, args...)})
+}
+
+// readManageBody 读取JSON格式的请求体，请求体为空时不做任何处理
+func readManageBody(r *http.Request, v any) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+// client 获取请求路径中指定的客户端，找不到时返回404
+func (m *ManageApi) client(w http.ResponseWriter, r *http.Request) *CryoClient {
+	c := m.bot.GetClientById(r.PathValue("id"))
+	if c == nil {
+		manageError(w, http.StatusNotFound, "找不到客户端：%s", r.PathValue("id"))
+	}
+	return c
+}
+
+// manageLogin 将扫码登录转换为接口返回的数据，二维码图片以base64编码的PNG返回
+func manageLogin(login *QRCodeLogin) map[string]any {
+	result := qrCodeLoginData(login)
+	result["qrcode"] = login.GetQRCode()
+	return result
+}
+
+func (m *ManageApi) serveClients(w http.ResponseWriter, r *http.Request) {
+	list := m.bot.clients().List()
+	clients := make([]map[string]any, 0, len(list))
+	for _, c := range list {
+		clients = append(clients, clientData(c))
+	}
+	writeJSON(w, http.StatusOK, clients)
+}
+
+func (m *ManageApi) serveClient(w http.ResponseWriter, r *http.Request) {
+	if c := m.client(w, r); c != nil {
+		writeJSON(w, http.StatusOK, clientData(c))
+	}
+}
+
+// serveAddClient 连接一个客户端，请求体中带有已保存的客户端ID时使用签名登录，否则开始扫码登录
+func (m *ManageApi) serveAddClient(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Id string `json:"id"`
+	}
+	if err := readManageBody(r, &req); err != nil {
+		manageError(w, http.StatusBadRequest, "无效的请求体：%v", err)
+		return
+	}
+	if req.Id == "" {
+		login, err := m.bot.StartQRCodeLogin()
+		if err != nil {
+			manageError(w, http.StatusBadGateway, "获取二维码时出现错误：%v", err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, manageLogin(login))
+		return
+	}
+	if m.bot.GetClientById(req.Id) != nil {
+		manageError(w, http.StatusConflict, "客户端已经连接：%s", req.Id)
+		return
+	}
+	infos, err := m.bot.GetCredentialStore().Load()
+	if err != nil {
+		manageError(w, http.StatusInternalServerError, "读取Bot信息时出现错误：%v", err)
+		return
+	}
+	for _, info := range infos {
+		if info.Id != req.Id {
+			continue
+		}
+		if !m.bot.ConnectSavedClient(info) {
+			manageError(w, http.StatusBadGateway, "使用签名登录失败，请重新扫码登录")
+			return
+		}
+		writeJSON(w, http.StatusOK, clientData(m.bot.GetClientById(req.Id)))
+		return
+	}
+	manageError(w, http.StatusNotFound, "找不到保存的客户端：%s", req.Id)
+}
+
+func (m *ManageApi) serveSavedClients(w http.ResponseWriter, r *http.Request) {
+	infos, err := m.bot.GetCredentialStore().Load()
+	if err != nil {
+		manageError(w, http.StatusInternalServerError, "读取Bot信息时出现错误：%v", err)
+		return
+	}
+	result := make([]map[string]any, 0, len(infos))
+	for _, info := range infos {
+		result = append(result, map[string]any{
+			"id":        info.Id,
+			"uin":       info.Uin,
+			"uid":       info.Uid,
+			"platform":  info.Platform,
+			"version":   info.Version,
+			"connected": m.bot.GetClientById(info.Id) != nil,
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (m *ManageApi) serveRemoveSavedClient(w http.ResponseWriter, r *http.Request) {
+	if err := m.bot.GetCredentialStore().Remove(r.PathValue("id")); err != nil {
+		manageError(w, http.StatusInternalServerError, "删除Bot信息时出现错误：%v", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveRemoveClient 断开客户端，查询参数 forget 为true时同时删除保存的客户端信息
+func (m *ManageApi) serveRemoveClient(w http.ResponseWriter, r *http.Request) {
+	if c := m.client(w, r); c == nil {
+		return
+	}
+	if err := m.bot.DisconnectClient(r.PathValue("id"), r.URL.Query().Get("forget") == "true"); err != nil {
+		manageError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *ManageApi) serveRelogin(w http.ResponseWriter, r *http.Request) {
+	if c := m.client(w, r); c == nil {
+		return
+	}
+	if err := m.bot.ReloginClient(r.PathValue("id")); err != nil {
+		manageError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, clientData(m.bot.GetClientById(r.PathValue("id"))))
+}
+
+// serveSendMessage 以指定的客户端发送文本消息
+//
+// 请求体中的 type 可以是 private、group 或 temp，临时会话需要同时指定 group_id 和 user_id
+func (m *ManageApi) serveSendMessage(w http.ResponseWriter, r *http.Request) {
+	c := m.client(w, r)
+	if c == nil {
+		return
+	}
+	var req struct {
+		Type    string `json:"type"`
+		UserId  uint32 `json:"user_id"`
+		GroupId uint32 `json:"group_id"`
+		Message string `json:"message"`
+	}
+	if err := readManageBody(r, &req); err != nil {
+		manageError(w, http.StatusBadRequest, "无效的请求体：%v", err)
+		return
+	}
+	if req.Message == "" {
+		manageError(w, http.StatusBadRequest, "消息内容为空")
+		return
+	}
+	msg := ProcessMessageContent(req.Message)
+	var messageId uint32
+	switch req.Type {
+	case "private":
+		sent, err := c.sendPrivateMessage(req.UserId, msg)
+		if err != nil {
+			manageError(w, http.StatusBadGateway, "%v", err)
+			return
+		}
+		messageId = sent.ID
+	case "group":
+		sent, err := c.sendGroupMessage(req.GroupId, msg)
+		if err != nil {
+			manageError(w, http.StatusBadGateway, "%v", err)
+			return
+		}
+		messageId = sent.ID
+	case "temp":
+		sent, err := c.sendTempMessage(req.GroupId, req.UserId, msg)
+		if err != nil {
+			manageError(w, http.StatusBadGateway, "%v", err)
+			return
+		}
+		messageId = sent.ID
+	default:
+		manageError(w, http.StatusBadRequest, "无效的消息类型：%s", req.Type)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"message_id": messageId})
+}
+
+func (m *ManageApi) serveFriends(w http.ResponseWriter, r *http.Request) {
+	c := m.client(w, r)
+	if c == nil {
+		return
+	}
+	friends, err := c.GetFriendList(r.URL.Query().Get("refresh") == "true")
+	if err != nil {
+		manageError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+	result := make([]map[string]any, 0, len(friends))
+	for _, friend := range friends {
+		result = append(result, map[string]any{
+			"uin":      friend.Uin,
+			"uid":      friend.UID,
+			"nickname": friend.Nickname,
+			"remarks":  friend.Remarks,
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (m *ManageApi) serveGroups(w http.ResponseWriter, r *http.Request) {
+	c := m.client(w, r)
+	if c == nil {
+		return
+	}
+	groups, err := c.GetGroupList(r.URL.Query().Get("refresh") == "true")
+	if err != nil {
+		manageError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+	result := make([]map[string]any, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, map[string]any{
+			"group_uin":    group.GroupUin,
+			"group_name":   group.GroupName,
+			"member_count": group.MemberCount,
+			"max_member":   group.MaxMember,
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (m *ManageApi) serveLogin(w http.ResponseWriter, r *http.Request) {
+	login := m.bot.GetQRCodeLogin(r.PathValue("id"))
+	if login == nil {
+		manageError(w, http.StatusNotFound, "找不到登录：%s", r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, manageLogin(login))
+}
+
+// serveConfig 返回当前的配置，其中的令牌和密钥会被隐去
+func (m *ManageApi) serveConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, redactConfig(m.bot.GetConfig()))
+}
+
+// serveSignServers 返回签名服务器池中所有服务器的状态
+func (m *ManageApi) serveSignServers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"available": m.bot.GetSignPool().Available(),
+		"servers":   m.bot.GetSignPool().Status(),
+	})
+}
+
+// serveHealth 返回所有客户端最近一次健康检查的结果，使用 POST 请求时立即进行一次检查
+func (m *ManageApi) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		writeJSON(w, http.StatusOK, m.bot.CheckHealth())
+		return
+	}
+	writeJSON(w, http.StatusOK, m.bot.GetHealth())
+}
+
+// serveLogs 在Bot的日志存储中查询日志
+//
+// 支持的查询参数：level 最低日志等级，since / until RFC3339格式的时间范围，bot 客户端的ID或QQ号，q 消息中包含的文本，limit 最多返回的数量
+func (m *ManageApi) serveLogs(w http.ResponseWriter, r *http.Request) {
+	if m.bot.GetLogStore() == nil {
+		manageError(w, http.StatusServiceUnavailable, "没有启用日志存储")
+		return
+	}
+	query := r.URL.Query()
+	q := LogQuery{Level: query.Get("level"), Text: query.Get("q")}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if v := query.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				manageError(w, http.StatusBadRequest, "%s 不是有效的RFC3339时间", p.name)
+				return
+			}
+			*p.dst = t
+		}
+	}
+	if bot := query.Get("bot"); bot != "" {
+		if uin, err := strconv.ParseInt(bot, 10, 64); err == nil {
+			q.BotUin = uin
+		} else {
+			q.BotId = bot
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			manageError(w, http.StatusBadRequest, "limit 不是有效的数字")
+			return
+		}
+		q.Limit = limit
+	}
+	records, err := m.bot.QueryLogs(q)
+	if err != nil {
+		manageError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if records == nil {
+		records = []LogRecord{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// serveClientHealth 返回指定客户端最近一次健康检查的结果，使用 POST 请求时立即进行一次检查
+func (m *ManageApi) serveClientHealth(w http.ResponseWriter, r *http.Request) {
+	c := m.client(w, r)
+	if c == nil {
+		return
+	}
+	if r.Method == http.MethodPost {
+		writeJSON(w, http.StatusOK, m.bot.checkClientHealth(c))
+		return
+	}
+	writeJSON(w, http.StatusOK, c.GetHealth())
+}
+
+// serveAccounts 返回所有账号的状态
+func (m *ManageApi) serveAccounts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, m.bot.GetAccountStatuses())
+}
+
+// serveAccount 返回指定账号的状态
+func (m *ManageApi) serveAccount(w http.ResponseWriter, r *http.Request) {
+	uin, err := strconv.Atoi(r.PathValue("uin"))
+	if err != nil {
+		manageError(w, http.StatusBadRequest, "无效的QQ号：%s", r.PathValue("uin"))
+		return
+	}
+	status, ok := m.bot.GetAccountStatus(uin)
+	if !ok {
+		manageError(w, http.StatusNotFound, "找不到账号：%d", uin)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// serveAddAccount 添加一个账号并在后台开始连接，请求体的格式与配置中的 accounts 相同
+func (m *ManageApi) serveAddAccount(w http.ResponseWriter, r *http.Request) {
+	var req AccountConfig
+	if err := readManageBody(r, &req); err != nil {
+		manageError(w, http.StatusBadRequest, "无效的请求体：%v", err)
+		return
+	}
+	if err := m.bot.AddAccount(req); err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			manageError(w, http.StatusBadRequest, "%v", err)
+		} else {
+			manageError(w, http.StatusConflict, "%v", err)
+		}
+		return
+	}
+	status, _ := m.bot.GetAccountStatus(req.Uin)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// redactUri 隐去连接地址中的密码，无法解析的地址会被整个隐去
+func redactUri(uri string) string {
+	if uri == "" {
+		return uri
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "******"
+	}
+	if _, ok := u.User.Password(); !ok {
+		return uri
+	}
+	user := url.User(u.User.Username()).String()
+	u.User = nil
+	prefix := u.Scheme + "://"
+	return prefix + user + ":******@" + strings.TrimPrefix(u.String(), prefix)
+}
+
+// redactConfig 隐去配置中的令牌和密钥
+func redactConfig(c Config) Config {
+	redact := func(s *string) {
+		if *s != "" {
+			*s = "******"
+		}
+	}
+	redact(&c.OneBotV11.AccessToken)
+	redact(&c.OneBotV11.Secret)
+	redact(&c.OneBotV12.AccessToken)
+	redact(&c.OneBotV12.Secret)
+	redact(&c.WebAdmin.Token)
+	redact(&c.ManageApi.Token)
+	redact(&c.Metrics.Token)
+	redact(&c.CredentialKey)
+	c.LogStore.MongoUri = redactUri(c.LogStore.MongoUri)
+	webhooks := make([]WebhookConfig, len(c.Webhooks))
+	for i, webhook := range c.Webhooks {
+		redact(&webhook.Secret)
+		webhooks[i] = webhook
+	}
+	c.Webhooks = webhooks
+	presenters := make([]QRCodePresenterConfig, len(c.QRCodeLogin.Presenters))
+	for i, presenter := range c.QRCodeLogin.Presenters {
+		redact(&presenter.Secret)
+		presenters[i] = presenter
+	}
+	c.QRCodeLogin.Presenters = presenters
+	accounts := make([]AccountConfig, len(c.Accounts))
+	for i, account := range c.Accounts {
+		redact(&account.Password)
+		accounts[i] = account
+	}
+	c.Accounts = accounts
+	return c
+}
+
+// StartManageApi 使用指定的配置启动管理接口
+func (b *Bot) StartManageApi(config ManageApiConfig) (*ManageApi, error) {
+	m := NewManageApi(b, config)
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	b.manageApi = m
+	return m, nil
+}
@@ -0,0 +1,75 @@
+package cryobot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestManageApiAuth(t *testing.T) {
+	b := NewBot()
+	serve := func(token, method, path, auth string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		w := httptest.NewRecorder()
+		NewManageApi(b, ManageApiConfig{Token: token}).Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+	// 没有设置访问令牌时，挂载到其他HTTP服务上的处理器也不能绕过鉴权
+	for _, path := range []string{"/api/v1/clients", "/api/v1/config", "/api/v1/health"} {
+		if code := serve("", http.MethodGet, path, ""); code != http.StatusForbidden {
+			t.Errorf("没有设置访问令牌时 GET %s code = %d, want 403", path, code)
+		}
+	}
+	if code := serve("", http.MethodDelete, "/api/v1/clients/x", ""); code != http.StatusForbidden {
+		t.Errorf("没有设置访问令牌时 DELETE code = %d, want 403", code)
+	}
+	if code := serve("secret", http.MethodGet, "/api/v1/clients", ""); code != http.StatusUnauthorized {
+		t.Errorf("没有携带访问令牌时 code = %d, want 401", code)
+	}
+	if code := serve("secret", http.MethodGet, "/api/v1/clients", "wrong"); code != http.StatusForbidden {
+		t.Errorf("访问令牌错误时 code = %d, want 403", code)
+	}
+	if code := serve("secret", http.MethodGet, "/api/v1/clients", "secret"); code != http.StatusOK {
+		t.Errorf("访问令牌正确时 code = %d, want 200", code)
+	}
+}
+
+func TestRedactConfig(t *testing.T) {
+	c := DefaultConfig()
+	c.WebAdmin.Token = "web"
+	c.ManageApi.Token = "manage"
+	c.Metrics.Token = "metrics"
+	c.CredentialKey = "key"
+	r := redactConfig(c)
+	for name, v := range map[string]string{
+		"web_admin.token":  r.WebAdmin.Token,
+		"manage_api.token": r.ManageApi.Token,
+		"metrics.token":    r.Metrics.Token,
+		"credential_key":   r.CredentialKey,
+	} {
+		if v != "******" {
+			t.Errorf("%s 没有被隐去：%q", name, v)
+		}
+	}
+	if c.Metrics.Token != "metrics" {
+		t.Error("redactConfig 修改了原有的配置")
+	}
+}
+
+func TestRedactUri(t *testing.T) {
+	tests := map[string]string{
+		"":                          "",
+		"mongodb://localhost:27017": "mongodb://localhost:27017",
+		"mongodb://admin:p%40ss@db:27017/?tls=true":  "mongodb://admin:******@db:27017/?tls=true",
+		"mongodb+srv://user@cluster.example.net/app": "mongodb+srv://user@cluster.example.net/app",
+		"mongodb://a:b@%zz":                          "******",
+	}
+	for uri, want := range tests {
+		if got := redactUri(uri); got != want {
+			t.Errorf("redactUri(%q) = %q, want %q", uri, got, want)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package cryobot
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 运行指标
+//
+// Metrics 是一个不依赖第三方库的指标注册表，支持带标签的计数器、仪表盘和直方图，可以按照 OpenMetrics 文本格式输出，供 Prometheus 抓取
+// 每个Bot都拥有一个注册表，内置的事件、处理器、消息发送、登录和客户端指标都记录在其中，插件也可以通过 Bot.GetMetrics 注册自己的指标
+
+// metricKind 指标的类型
+type metricKind string
+
+const (
+	counterMetric   metricKind = "counter"
+	gaugeMetric     metricKind = "gauge"
+	histogramMetric metricKind = "histogram"
+)
+
+// DefaultLatencyBuckets 直方图默认使用的分桶，单位为秒
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics 指标注册表
+type Metrics struct {
+	mutex    sync.RWMutex
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+// metricFamily 同名指标的集合，每一组标签值对应一个序列
+type metricFamily struct {
+	name    string
+	help    string
+	kind    metricKind
+	labels  []string
+	buckets []float64
+	collect func(emit func(value float64, labelValues ...string)) // 不为空时在输出时调用，用于在抓取时读取的指标
+
+	mutex  sync.Mutex
+	series map[string]*metricSeries
+}
+
+// metricSeries 一组标签值对应的指标序列
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // 直方图每个分桶中的观测次数，不累加
+	count       uint64
+	sum         float64
+}
+
+// NewMetrics 创建一个空的指标注册表
+func NewMetrics() *Metrics {
+	return &Metrics{byName: make(map[string]*metricFamily)}
+}
+
+// register 注册一个指标，已存在同名的指标时返回已有的指标
+func (m *Metrics) register(f *metricFamily) *metricFamily {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if old, ok := m.byName[f.name]; ok {
+		return old
+	}
+	f.series = make(map[string]*metricSeries)
+	m.families = append(m.families, f)
+	m.byName[f.name] = f
+	return f
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct{ family *metricFamily }
+
+// NewCounter 注册一个计数器，名称不需要带 _total 后缀，已存在同名的指标时返回已有的指标
+func (m *Metrics) NewCounter(name, help string, labels ...string) *CounterVec {
+	name = strings.TrimSuffix(name, "_total")
+	return &CounterVec{m.register(&metricFamily{name: name, help: help, kind: counterMetric, labels: labels})}
+}
+
+// Inc 将指定标签值的计数加一
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add 将指定标签值的计数增加 v，v 为负数时不做任何处理
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if c == nil || v < 0 {
+		return
+	}
+	c.family.update(labelValues, func(s *metricSeries) { s.value += v })
+}
+
+// GaugeVec 带标签的仪表盘
+type GaugeVec struct{ family *metricFamily }
+
+// NewGauge 注册一个仪表盘，已存在同名的指标时返回已有的指标
+func (m *Metrics) NewGauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{m.register(&metricFamily{name: name, help: help, kind: gaugeMetric, labels: labels})}
+}
+
+// Set 设置指定标签值的数值
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+	g.family.update(labelValues, func(s *metricSeries) { s.value = v })
+}
+
+// Add 将指定标签值的数值增加 v，v 可以为负数
+func (g *GaugeVec) Add(v float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+	g.family.update(labelValues, func(s *metricSeries) { s.value += v })
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct{ family *metricFamily }
+
+// NewHistogram 注册一个直方图，分桶为空时使用 DefaultLatencyBuckets，已存在同名的指标时返回已有的指标
+func (m *Metrics) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return &HistogramVec{m.register(&metricFamily{name: name, help: help, kind: histogramMetric, labels: labels, buckets: buckets})}
+}
+
+// Observe 记录指定标签值的一次观测
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	f := h.family
+	f.update(labelValues, func(s *metricSeries) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		if i, _ := slices.BinarySearch(f.buckets, v); i < len(f.buckets) {
+			s.counts[i]++
+		}
+		s.count++
+		s.sum += v
+	})
+}
+
+// NewGaugeFunc 注册一个在抓取时读取数值的仪表盘，collect 中通过 emit 输出每一组标签值的数值
+func (m *Metrics) NewGaugeFunc(name, help string, collect func(emit func(value float64, labelValues ...string)), labels ...string) {
+	m.register(&metricFamily{name: name, help: help, kind: gaugeMetric, labels: labels, collect: collect})
+}
+
+// NewCounterFunc 注册一个在抓取时读取数值的计数器，适用于已经在别处累计的计数
+func (m *Metrics) NewCounterFunc(name, help string, collect func(emit func(value float64, labelValues ...string)), labels ...string) {
+	name = strings.TrimSuffix(name, "_total")
+	m.register(&metricFamily{name: name, help: help, kind: counterMetric, labels: labels, collect: collect})
+}
+
+// update 在持有锁的情况下修改指定标签值的序列，标签值的数量与标签不一致时会补齐或截断
+func (f *metricFamily) update(labelValues []string, fn func(s *metricSeries)) {
+	labelValues = f.normalize(labelValues)
+	key := strings.Join(labelValues, "\xff")
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: labelValues}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+// normalize 使标签值的数量与标签一致
+func (f *metricFamily) normalize(labelValues []string) []string {
+	if len(labelValues) == len(f.labels) {
+		return slices.Clone(labelValues)
+	}
+	result := make([]string, len(f.labels))
+	copy(result, labelValues)
+	return result
+}
+
+// snapshot 返回按标签值排序的序列副本
+func (f *metricFamily) snapshot() []metricSeries {
+	var result []metricSeries
+	if f.collect != nil {
+		f.collect(func(value float64, labelValues ...string) {
+			result = append(result, metricSeries{labelValues: f.normalize(labelValues), value: value})
+		})
+	} else {
+		f.mutex.Lock()
+		for _, s := range f.series {
+			c := *s
+			c.counts = slices.Clone(s.counts)
+			result = append(result, c)
+		}
+		f.mutex.Unlock()
+	}
+	slices.SortFunc(result, func(a, b metricSeries) int {
+		return slices.Compare(a.labelValues, b.labelValues)
+	})
+	return result
+}
+
+// WriteTo 以 OpenMetrics 文本格式输出所有指标
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.RLock()
+	families := slices.Clone(m.families)
+	m.mutex.RUnlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	bw.WriteString("# EOF\n")
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// write 输出一个指标的元数据和所有序列
+func (f *metricFamily) write(w *bufio.Writer) {
+	w.WriteString("# TYPE " + f.name + " " + string(f.kind) + "\n")
+	if f.help != "" {
+		w.WriteString("# HELP " + f.name + " " + escapeMetricText(f.help) + "\n")
+	}
+	for _, s := range f.snapshot() {
+		switch f.kind {
+		case counterMetric:
+			writeMetricSample(w, f.name+"_total", f.labels, s.labelValues, "", "", s.value)
+		case gaugeMetric:
+			writeMetricSample(w, f.name, f.labels, s.labelValues, "", "", s.value)
+		case histogramMetric:
+			var cumulative uint64
+			for i, bound := range f.buckets {
+				if s.counts != nil {
+					cumulative += s.counts[i]
+				}
+				writeMetricSample(w, f.name+"_bucket", f.labels, s.labelValues, "le", formatMetricValue(bound), float64(cumulative))
+			}
+			writeMetricSample(w, f.name+"_bucket", f.labels, s.labelValues, "le", "+Inf", float64(s.count))
+			writeMetricSample(w, f.name+"_sum", f.labels, s.labelValues, "", "", s.sum)
+			writeMetricSample(w, f.name+"_count", f.labels, s.labelValues, "", "", float64(s.count))
+		}
+	}
+}
+
+// writeMetricSample 输出一行指标数据，extraLabel 不为空时追加一个额外的标签，如直方图的 le
+func writeMetricSample(w *bufio.Writer, name string, labels, labelValues []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label + `="` + escapeMetricText(labelValues[i]) + `"`)
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatMetricValue(value) + "\n")
+}
+
+// formatMetricValue 格式化指标的数值
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeMetricText 转义说明和标签值中的反斜杠、换行和双引号
+func escapeMetricText(s string) string {
+	if !strings.ContainsAny(s, "\\\n\"") {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '"':
+			b.WriteString(`\"`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// countingWriter 统计写入字节数的 io.Writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Handler 返回以 OpenMetrics 文本格式输出指标的HTTP处理器，可以用于挂载到自定义的HTTP服务上
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		if r.Method == http.MethodHead {
+			return
+		}
+		_, _ = m.WriteTo(w)
+	})
+}
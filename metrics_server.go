@@ -0,0 +1,103 @@
+package cryobot
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 指标接口
+//
+// 在独立的地址上以 OpenMetrics 文本格式提供Bot的运行指标，可以直接作为 Prometheus 的抓取目标
+// 设置了访问令牌时需要通过 Authorization 请求头（Prometheus 的 bearer_token）或 access_token 查询参数携带令牌
+
+// MetricsConfig 指标接口的配置
+type MetricsConfig struct {
+	Enable bool   `json:"enable,omitempty,omitzero"` // 是否启用指标接口
+	Addr   string `json:"addr,omitempty,omitzero"`   // 监听地址，默认为 127.0.0.1:8093
+	Path   string `json:"path,omitempty,omitzero"`   // 指标的路径，默认为 /metrics
+	Token  string `json:"token,omitempty,omitzero"`  // 访问令牌，为空时不校验
+}
+
+// withDefaults 返回填充了默认值的配置
+func (c MetricsConfig) withDefaults() MetricsConfig {
+	if c.Addr == "" {
+		c.Addr = "127.0.0.1:8093"
+	}
+	if c.Path == "" {
+		c.Path = "/metrics"
+	}
+	return c
+}
+
+// validate 校验指标接口的配置
+func (c MetricsConfig) validate(invalid func(field, format string, args ...any)) {
+	if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+		invalid("metrics.path", "必须以 / 开头")
+	}
+}
+
+// MetricsServer cryobot的指标接口
+type MetricsServer struct {
+	bot    *Bot
+	config MetricsConfig
+	server *http.Server
+}
+
+// NewMetricsServer 创建一个指标接口，调用 Start 后开始监听
+func NewMetricsServer(bot *Bot, config MetricsConfig) *MetricsServer {
+	return &MetricsServer{bot: bot, config: config.withDefaults()}
+}
+
+// GetConfig 返回指标接口使用的配置
+func (s *MetricsServer) GetConfig() MetricsConfig {
+	return s.config
+}
+
+// Handler 返回指标接口的HTTP处理器，可以用于挂载到自定义的HTTP服务上
+func (s *MetricsServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(s.config.Path, s.bot.GetMetrics().Handler())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code := checkOneBotToken(r, s.config.Token); code != http.StatusOK {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Start 启动指标接口
+func (s *MetricsServer) Start() error {
+	ln, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	s.server = &http.Server{Handler: s.Handler()}
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.bot.log().Error("[Metrics] 指标接口停止运行：", err)
+		}
+	}()
+	s.bot.log().Infof("%s[Metrics] 指标接口已在 http://%s%s 上启动", lavender, s.config.Addr, s.config.Path)
+	return nil
+}
+
+// Stop 停止指标接口
+func (s *MetricsServer) Stop() {
+	if s.server == nil {
+		return
+	}
+	_ = s.server.Close()
+	s.server = nil
+}
+
+// StartMetricsServer 使用指定的配置启动指标接口
+func (b *Bot) StartMetricsServer(config MetricsConfig) (*MetricsServer, error) {
+	s := NewMetricsServer(b, config)
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	b.metricsServer = s
+	return s, nil
+}
@@ -1,17 +1,20 @@
 package cryobot
 
+// 内置中间件都带有 builtin 标签以及各自的名称标签，可以通过 RemoveMiddlewareByTag 单独移除
+// 打印的日志会携带事件字段，Bot、群和发送者的ID只出现在字段中，消息中只包含对应的名称
+
 // setConnectPrintMiddleware 内置的连接打印中间件
-func setConnectPrintMiddleware() {
-	if conf.EnableConnectPrintMiddleware {
-		AddMiddleware(BotConnectedEventType, func(e CryoEvent) CryoEvent {
+func (b *Bot) setConnectPrintMiddleware() {
+	if b.GetConfig().IsConnectPrintMiddlewareEnabled() {
+		b.Bus.AddTaggedMiddleware(BotConnectedEventType, []string{"builtin", "connect_print"}, func(e CryoEvent) CryoEvent {
 			if typedEvent, ok := e.(BotConnectedEvent); ok {
-				Infof("%s[Cryo] %s：%s (%d) 已成功连接", lavender, typedEvent.BotNickname, typedEvent.BotId, typedEvent.BotUin)
+				b.GetEventLogger(typedEvent).Infof("%s[Cryo] %s 已成功连接", lavender, b.botDisplayName(typedEvent.BaseEvent))
 			}
 			return e
 		})
-		AddMiddleware(BotDisconnectedEventType, func(e CryoEvent) CryoEvent {
+		b.Bus.AddTaggedMiddleware(BotDisconnectedEventType, []string{"builtin", "connect_print"}, func(e CryoEvent) CryoEvent {
 			if typedEvent, ok := e.(BotDisconnectedEvent); ok {
-				Infof("%s[Cryo] %s：%s (%d) 已断开连接", lavender, typedEvent.BotNickname, typedEvent.BotId, typedEvent.BotUin)
+				b.GetEventLogger(typedEvent).Infof("%s[Cryo] %s 已断开连接", lavender, b.botDisplayName(typedEvent.BaseEvent))
 			}
 			return e
 		})
@@ -19,17 +22,17 @@ func setConnectPrintMiddleware() {
 }
 
 // setMessagePrintMiddleware 内置的消息打印中间件
-func setMessagePrintMiddleware() {
-	if conf.EnableMessagePrintMiddleware {
-		AddMiddleware(PrivateMessageEventType, func(e CryoEvent) CryoEvent {
+func (b *Bot) setMessagePrintMiddleware() {
+	if b.GetConfig().IsMessagePrintMiddlewareEnabled() {
+		b.Bus.AddTaggedMiddleware(PrivateMessageEventType, []string{"builtin", "message_print"}, func(e CryoEvent) CryoEvent {
 			if typedEvent, ok := e.(PrivateMessageEvent); ok {
-				Infof("[%s] [私聊] From %s(%d) - %s", typedEvent.BotNickname, typedEvent.SenderNickname, typedEvent.SenderUin, typedEvent.MessageElements.ToString())
+				b.GetEventLogger(typedEvent).Infof("[%s] [私聊] From %s - %s", b.botDisplayName(typedEvent.BaseEvent), typedEvent.SenderNickname, typedEvent.MessageElements.ToString())
 			}
 			return e
 		})
-		AddMiddleware(GroupMessageEventType, func(e CryoEvent) CryoEvent {
+		b.Bus.AddTaggedMiddleware(GroupMessageEventType, []string{"builtin", "message_print"}, func(e CryoEvent) CryoEvent {
 			if typedEvent, ok := e.(GroupMessageEvent); ok {
-				Infof("[%s] [%s(%d)] From %s(%d) - %s", typedEvent.BotNickname, typedEvent.GroupName, typedEvent.GroupUin, typedEvent.SenderNickname, typedEvent.SenderUin, typedEvent.MessageElements.ToString())
+				b.GetEventLogger(typedEvent).Infof("[%s] [%s] From %s - %s", b.botDisplayName(typedEvent.BaseEvent), typedEvent.GroupName, typedEvent.SenderNickname, typedEvent.MessageElements.ToString())
 			}
 			return e
 		})
@@ -37,10 +40,10 @@ func setMessagePrintMiddleware() {
 }
 
 // setEventDebugMiddleware 内置的事件调试中间件
-func setEventDebugMiddleware() {
-	if conf.EnableEventDebugMiddleware {
-		AddGlobalMiddleware(func(e CryoEvent) CryoEvent {
-			Debug(e.ToJsonString()) // 输出json
+func (b *Bot) setEventDebugMiddleware() {
+	if b.GetConfig().IsEventDebugMiddlewareEnabled() {
+		b.Bus.AddTaggedGlobalMiddleware([]string{"builtin", "event_debug"}, func(e CryoEvent) CryoEvent {
+			b.GetEventLogger(e).Debug(e.ToJsonString()) // 输出json
 			return e
 		})
 	}
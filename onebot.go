@@ -0,0 +1,540 @@
+package cryobot
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/go-json-experiment/json"
+	"github.com/gorilla/websocket"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// OneBot 协议适配器的公共部分
+//
+// 包括消息ID的映射、消息缓存、动作参数的解析、媒体文件的加载以及WebSocket连接的封装，
+// 由不同版本的 OneBot 适配器共同使用
+
+// OneBotSegment OneBot 的消息段
+type OneBotSegment struct {
+	Type string         `json:"type"`
+	Data map[string]any `json:"data"`
+}
+
+// OneBotMessageId 根据消息的上下文生成 OneBot 使用的消息ID
+//
+// 同一条消息总是会得到相同的ID，因此回复、撤回等动作可以直接使用事件中的消息ID
+func OneBotMessageId(selfUin uint32, isGroup bool, peerUin uint32, seq uint32) int32 {
+	h := fnv.New32a()
+	_, _ = fmt.Fprintf(h, "%d:%t:%d:%d", selfUin, isGroup, peerUin, seq)
+	return int32(h.Sum32() & 0x7fffffff)
+}
+
+// oneBotMessageRecord 消息缓存中的一条消息
+type oneBotMessageRecord struct {
+	Id             int32
+	BotId          string
+	SelfUin        uint32
+	IsGroup        bool
+	IsTemp         bool
+	PeerUin        uint32 // 群号或私聊对象的Uin
+	GroupUin       uint32 // 临时会话所在的群号
+	Seq            uint32
+	Random         uint32
+	ClientSeq      uint32
+	Time           uint32
+	SenderUin      uint32
+	SenderNickname string
+	SenderCardname string
+	Message        CryoMessage
+}
+
+// oneBotCache 有界的缓存，超过容量时淘汰最早放入的条目
+type oneBotCache[K comparable, V any] struct {
+	mutex    sync.Mutex
+	capacity int
+	items    map[K]V
+	order    []K
+}
+
+func newOneBotCache[K comparable, V any](capacity int) *oneBotCache[K, V] {
+	if capacity <= 0 {
+		capacity = 4096
+	}
+	return &oneBotCache[K, V]{
+		capacity: capacity,
+		items:    make(map[K]V, capacity),
+	}
+}
+
+// put 放入一个条目
+func (c *oneBotCache[K, V]) put(key K, value V) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.items[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.items[key] = value
+	for len(c.order) > c.capacity {
+		delete(c.items, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// get 查找一个条目
+func (c *oneBotCache[K, V]) get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	value, ok := c.items[key]
+	return value, ok
+}
+
+// oneBotMessageCache 消息缓存，用于通过消息ID查找回复、撤回以及获取消息所需的信息
+type oneBotMessageCache struct {
+	*oneBotCache[int32, oneBotMessageRecord]
+}
+
+func newOneBotMessageCache(capacity int) *oneBotMessageCache {
+	return &oneBotMessageCache{newOneBotCache[int32, oneBotMessageRecord](capacity)}
+}
+
+// record 记录一条消息
+func (c *oneBotMessageCache) record(record oneBotMessageRecord) {
+	c.put(record.Id, record)
+}
+
+// recordMessageEvent 将消息事件记录到消息缓存中，返回记录的消息
+func (c *oneBotMessageCache) recordMessageEvent(event CryoMessageEvent) oneBotMessageRecord {
+	e := event.GetMessageEvent()
+	record := oneBotMessageRecord{
+		BotId:          e.BotId,
+		SelfUin:        e.BotUin,
+		Seq:            e.MessageId,
+		Time:           e.Time,
+		SenderUin:      e.SenderUin,
+		SenderNickname: e.SenderNickname,
+		SenderCardname: e.SenderCardname,
+		Message:        e.MessageElements,
+	}
+	switch m := event.(type) {
+	case GroupMessageEvent:
+		record.IsGroup = true
+		record.PeerUin = m.GroupUin
+		record.Random = m.InternalId
+	case PrivateMessageEvent:
+		record.PeerUin = m.SenderUin
+		if m.SenderUin == m.BotUin { // 自己发出的消息
+			record.PeerUin = m.TargetUin
+		}
+		record.Random = m.InternalId
+		record.ClientSeq = m.ClientSeq
+	case TempMessageEvent:
+		record.IsTemp = true
+		record.PeerUin = m.SenderUin
+		record.GroupUin = m.GroupUin
+	default:
+		if Contains(e.EventTags, "group_message") {
+			record.IsGroup = true
+			record.PeerUin = e.GroupUin
+		} else {
+			record.PeerUin = e.SenderUin
+		}
+	}
+	record.Id = OneBotMessageId(record.SelfUin, record.IsGroup, record.PeerUin, record.Seq)
+	c.record(record)
+	return record
+}
+
+// replyElement 根据缓存的消息构建回复元素
+func (r oneBotMessageRecord) replyElement() *ReplyElement {
+	reply := &ReplyElement{}
+	reply.ReplySeq = r.Seq
+	reply.SenderUin = r.SenderUin
+	reply.Time = r.Time
+	reply.Elements = r.Message.ToIMessageElements()
+	return reply
+}
+
+// oneBotFile 文件缓存中的一个文件，Data、Path 和 Url 中至少有一个不为空
+type oneBotFile struct {
+	Id   string
+	Name string
+	Url  string
+	Path string
+	Data []byte
+}
+
+// load 读取文件的内容，本地文件和网络文件受加载器的访问限制
+func (f oneBotFile) load(loader oneBotMediaLoader) ([]byte, error) {
+	switch {
+	case f.Data != nil:
+		return f.Data, nil
+	case f.Path != "":
+		return loader.readLocal(f.Path)
+	}
+	return loader.load(f.Url)
+}
+
+// oneBotFileCache 文件缓存，用于 v12 中通过文件ID收发媒体文件
+type oneBotFileCache struct {
+	*oneBotCache[string, oneBotFile]
+}
+
+func newOneBotFileCache(capacity int) *oneBotFileCache {
+	return &oneBotFileCache{newOneBotCache[string, oneBotFile](capacity)}
+}
+
+// store 将文件放入缓存，返回文件ID
+func (c *oneBotFileCache) store(file oneBotFile) string {
+	if file.Id == "" {
+		file.Id = NewUUID()
+	}
+	c.put(file.Id, file)
+	return file.Id
+}
+
+// 动作执行结果的状态，由各版本的适配器转换为对应的返回码
+const (
+	oneBotStatusOk                = iota // 执行成功
+	oneBotStatusBadRequest               // 请求格式错误
+	oneBotStatusUnsupportedAction        // 不支持的动作
+	oneBotStatusBadParam                 // 参数错误
+	oneBotStatusBotNotFound              // 找不到对应的Bot客户端
+	oneBotStatusFailed                   // 动作执行失败
+)
+
+// oneBotResult 动作的执行结果
+type oneBotResult struct {
+	status int
+	data   any
+	err    error
+}
+
+func oneBotOk(data any) oneBotResult {
+	return oneBotResult{status: oneBotStatusOk, data: data}
+}
+
+func oneBotFailed(status int, format string, args ...any) oneBotResult {
+	return oneBotResult{status: status, err: fmt.Errorf(format, args...)}
+}
+
+// oneBotParams 动作的参数
+//
+// OneBot 实现中数字类型的参数经常以字符串的形式传递，这里的读取方法会同时兼容这两种形式
+type oneBotParams map[string]any
+
+// has 检查是否传入了指定的参数
+func (p oneBotParams) has(key string) bool {
+	v, ok := p[key]
+	return ok && v != nil
+}
+
+// getInt64 读取整数参数
+func (p oneBotParams) getInt64(key string) (int64, bool) {
+	switch v := p[key].(type) {
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// getUint32 读取Uin等无符号整数参数
+func (p oneBotParams) getUint32(key string) (uint32, bool) {
+	n, ok := p.getInt64(key)
+	if !ok || n < 0 || n > int64(^uint32(0)) {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+// getString 读取字符串参数
+func (p oneBotParams) getString(key string) string {
+	switch v := p[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatInt(int64(v), 10)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// getBool 读取布尔参数，没有传入时返回默认值
+func (p oneBotParams) getBool(key string, defaultValue bool) bool {
+	switch v := p[key].(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// oneBotClient 根据 self_id 获取Bot客户端，没有指定 self_id 且只有一个已连接的客户端时直接使用该客户端
+func oneBotClient(b *Bot, selfId uint32) (*CryoClient, error) {
+	if selfId != 0 {
+		if c := b.GetClientByUin(int(selfId)); c != nil {
+			return c, nil
+		}
+		return nil, fmt.Errorf("找不到 self_id 为 %d 的Bot客户端", selfId)
+	}
+	var found *CryoClient
+	for _, c := range b.GetClients() {
+		if found != nil {
+			return nil, fmt.Errorf("存在多个已连接的Bot客户端，请通过 self_id 指定")
+		}
+		found = c
+	}
+	if found == nil {
+		return nil, fmt.Errorf("没有已连接的Bot客户端")
+	}
+	return found, nil
+}
+
+// oneBotRequestSelfId 从请求的 X-Self-ID 请求头或 self_id 查询参数中读取 self_id
+func oneBotRequestSelfId(r *http.Request) uint32 {
+	s := r.Header.Get("X-Self-ID")
+	if s == "" {
+		s = r.URL.Query().Get("self_id")
+	}
+	n, _ := strconv.ParseUint(s, 10, 32)
+	return uint32(n)
+}
+
+// checkOneBotOrigin 检查浏览器请求的来源，没有 Origin 请求头或来源与请求的主机相同时允许访问
+//
+// 应用端通常不会携带 Origin 请求头，以此拒绝其他网页发起的跨站请求
+func checkOneBotOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// checkOneBotToken 检查请求中携带的访问令牌，令牌可以放在 Authorization 请求头或 access_token 查询参数中
+//
+// 返回对应的HTTP状态码，没有携带令牌时返回401，令牌错误时返回403
+func checkOneBotToken(r *http.Request, token string) int {
+	if token == "" {
+		return http.StatusOK
+	}
+	got := r.URL.Query().Get("access_token")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		got = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(auth, "Bearer"), "Token"))
+	}
+	if got == "" {
+		return http.StatusUnauthorized
+	}
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		return http.StatusForbidden
+	}
+	return http.StatusOK
+}
+
+// oneBotHttpClient 加载网络媒体文件时使用的HTTP客户端
+var oneBotHttpClient = &http.Client{Timeout: 30 * time.Second}
+
+// oneBotPublicHttpClient 只允许连接公网地址的HTTP客户端，在建立连接时检查解析出的地址，重定向和DNS重绑定也无法绕过
+var oneBotPublicHttpClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+					return fmt.Errorf("不允许访问内网地址：%s", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// isPrivateIP 检查是否是回环、内网、链路本地等非公网地址
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// oneBotMediaLoader 加载消息段中的媒体文件，并限制应用端可以访问的本地文件和网络地址
+type oneBotMediaLoader struct {
+	dir          string // 允许读取的本地目录，为空时不允许读取本地文件
+	allowPrivate bool   // 是否允许下载回环和内网地址上的文件
+}
+
+// load 加载媒体文件
+//
+// 支持 base64:// 、file:// 、http(s):// 以及本地文件路径，本地文件必须位于配置的媒体目录中
+func (l oneBotMediaLoader) load(file string) ([]byte, error) {
+	switch {
+	case file == "":
+		return nil, fmt.Errorf("没有指定媒体文件")
+	case strings.HasPrefix(file, "base64://"):
+		return base64.StdEncoding.DecodeString(strings.TrimPrefix(file, "base64://"))
+	case strings.HasPrefix(file, "file://"):
+		return l.readLocal(strings.TrimPrefix(file, "file://"))
+	case strings.HasPrefix(file, "http://"), strings.HasPrefix(file, "https://"):
+		client := oneBotPublicHttpClient
+		if l.allowPrivate {
+			client = oneBotHttpClient
+		}
+		resp, err := client.Get(file)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("下载 %s 时服务器返回了 %s", file, resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	}
+	return l.readLocal(file)
+}
+
+// readLocal 读取媒体目录中的本地文件，相对路径基于媒体目录，符号链接指向目录外时同样会被拒绝
+func (l oneBotMediaLoader) readLocal(path string) ([]byte, error) {
+	if l.dir == "" {
+		return nil, fmt.Errorf("没有配置 media_dir，不允许读取本地文件")
+	}
+	dir, err := filepath.Abs(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(dir, real); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("不允许读取媒体目录以外的文件：%s", path)
+	}
+	return os.ReadFile(real)
+}
+
+// oneBotConnQueueSize 每个连接的发送队列长度
+const oneBotConnQueueSize = 256
+
+// errOneBotQueueFull 连接的发送队列已满
+var errOneBotQueueFull = errors.New("发送队列已满")
+
+// oneBotConn 一个 OneBot WebSocket 连接，写入操作是并发安全的
+//
+// 每个连接有独立的发送队列和写入协程，写入较慢的应用端不会阻塞事件总线和其他连接
+type oneBotConn struct {
+	ws         *websocket.Conn
+	writeMutex sync.Mutex
+	selfUin    uint32 // 连接对应的Bot的Uin，为0时表示接收所有Bot的事件
+	role       string // 连接的角色，Universal、API 或 Event
+	queue      chan []byte
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// newOneBotConn 封装一个 WebSocket 连接并启动它的写入协程
+func newOneBotConn(ws *websocket.Conn, selfUin uint32, role string) *oneBotConn {
+	c := &oneBotConn{
+		ws:      ws,
+		selfUin: selfUin,
+		role:    role,
+		queue:   make(chan []byte, oneBotConnQueueSize),
+		done:    make(chan struct{}),
+	}
+	go c.writeLoop()
+	return c
+}
+
+// writeLoop 依次写入发送队列中的数据，写入失败时关闭连接
+func (c *oneBotConn) writeLoop() {
+	for {
+		select {
+		case data := <-c.queue:
+			c.writeMutex.Lock()
+			_ = c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			err := c.ws.WriteMessage(websocket.TextMessage, data)
+			c.writeMutex.Unlock()
+			if err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// writeJSON 将数据序列化为JSON并放入发送队列，队列已满或连接已关闭时返回错误
+func (c *oneBotConn) writeJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-c.done:
+		return websocket.ErrCloseSent
+	default:
+	}
+	select {
+	case c.queue <- data:
+		return nil
+	default:
+		return errOneBotQueueFull
+	}
+}
+
+// close 关闭连接并停止写入协程
+func (c *oneBotConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.writeMutex.Lock()
+		defer c.writeMutex.Unlock()
+		_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		_ = c.ws.Close()
+	})
+}
+
+// acceptsEvents 检查连接是否需要接收事件
+func (c *oneBotConn) acceptsEvents(selfUin uint32) bool {
+	if c.role == "API" {
+		return false
+	}
+	return selfUin == 0 || c.selfUin == 0 || c.selfUin == selfUin
+}
+
+// oneBotUpgrader 正向 WebSocket 使用的协议升级器
+var oneBotUpgrader = websocket.Upgrader{
+	CheckOrigin: checkOneBotOrigin,
+}
@@ -0,0 +1,496 @@
+package cryobot
+
+import (
+	"bytes"
+	"errors"
+	"github.com/go-json-experiment/json"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OneBotConfig OneBot 实现端的配置，各个版本的 OneBot 实现端共用同一套通信方式的配置
+//
+// 各个通信方式的地址为空时不会启用对应的通信方式
+type OneBotConfig struct {
+	Enable            bool     `json:"enable,omitempty,omitzero"`             // 是否启用该实现端
+	HttpAddr          string   `json:"http_addr,omitempty,omitzero"`          // HTTP API 的监听地址，如 127.0.0.1:5700
+	HttpPostUrls      []string `json:"http_post_urls,omitempty,omitzero"`     // HTTP POST（v12 中称为 HTTP Webhook）事件上报地址
+	Secret            string   `json:"secret,omitempty,omitzero"`             // v11 的 HTTP POST 上报时用于生成 X-Signature 签名的密钥
+	WsAddr            string   `json:"ws_addr,omitempty,omitzero"`            // 正向 WebSocket 的监听地址，如 127.0.0.1:8080
+	ReverseWsUrls     []string `json:"reverse_ws_urls,omitempty,omitzero"`    // 反向 WebSocket 的连接地址
+	ReconnectInterval int      `json:"reconnect_interval,omitempty,omitzero"` // 反向 WebSocket 的重连间隔，单位为秒
+	HeartbeatInterval int      `json:"heartbeat_interval,omitempty,omitzero"` // 心跳事件的发送间隔，单位为毫秒，为0时不发送心跳
+	AccessToken       string   `json:"access_token,omitempty,omitzero"`       // 访问令牌，为空时不进行鉴权
+	MediaDir          string   `json:"media_dir,omitempty,omitzero"`          // 允许应用端通过路径发送的本地媒体文件所在的目录，相对路径基于数据目录，为空时不允许读取本地文件
+	AllowPrivateUrls  bool     `json:"allow_private_urls,omitempty,omitzero"` // 是否允许应用端让Bot下载回环和内网地址上的媒体文件，默认关闭
+}
+
+// oneBotAction OneBot 动作的处理函数
+type oneBotAction func(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult
+
+// oneBotEnvelope 一个待推送的事件以及它所属的Bot的Uin，Uin为0时推送给所有连接
+type oneBotEnvelope struct {
+	selfUin uint32
+	payload map[string]any
+}
+
+// oneBotProtocol OneBot 的协议版本，负责事件与动作的转换，通信方式由 OneBotServer 统一处理
+type oneBotProtocol interface {
+	// name 协议的名称，用于日志输出
+	name() string
+	// event 将cryobot的事件转换为协议的事件，无法转换时返回nil
+	event(s *OneBotServer, event CryoEvent) map[string]any
+	// action 查找动作的处理函数
+	action(name string) (oneBotAction, bool)
+	// needsClient 动作是否需要指定Bot客户端，不需要时处理函数收到的客户端可能为nil
+	needsClient(name string) bool
+	// response 将动作的执行结果转换为协议的响应
+	response(result oneBotResult, echo any) map[string]any
+	// connectEvent 建立 WebSocket 连接后发送的元事件
+	connectEvent(s *OneBotServer, selfUin uint32) map[string]any
+	// heartbeatEvents 需要定时推送的心跳事件
+	heartbeatEvents(s *OneBotServer) []oneBotEnvelope
+	// reversePerBot 是否为每个Bot客户端单独建立反向 WebSocket 连接
+	reversePerBot() bool
+	// reverseHeader 建立反向 WebSocket 连接时使用的请求头
+	reverseHeader(s *OneBotServer, selfUin uint32) http.Header
+	// postHeader 设置 HTTP 上报请求的请求头
+	postHeader(s *OneBotServer, req *http.Request, selfUin uint32, body []byte)
+}
+
+// OneBotServer OneBot 实现端
+//
+// 将Bot事件总线上的事件转换为 OneBot 事件推送给应用端，并将应用端调用的动作映射到对应Bot客户端的方法上，
+// 支持 HTTP API、HTTP POST 上报、正向 WebSocket 与反向 WebSocket 四种通信方式
+type OneBotServer struct {
+	bot      *Bot
+	config   OneBotConfig
+	protocol oneBotProtocol
+	messages *oneBotMessageCache
+	files    *oneBotFileCache
+	media    oneBotMediaLoader // 加载应用端发送的媒体文件
+
+	mutex     sync.Mutex
+	servers   []*http.Server
+	conns     map[*oneBotConn]struct{}
+	reverse   map[string]chan struct{} // Bot客户端ID到反向 WebSocket 停止信号的映射
+	handlerId string
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newOneBotServer 创建一个使用指定协议版本的 OneBot 实现端
+func newOneBotServer(bot *Bot, config OneBotConfig, protocol oneBotProtocol) *OneBotServer {
+	if config.ReconnectInterval <= 0 {
+		config.ReconnectInterval = 5
+	}
+	return &OneBotServer{
+		bot:      bot,
+		config:   config,
+		protocol: protocol,
+		messages: newOneBotMessageCache(0),
+		files:    newOneBotFileCache(0),
+		media:    oneBotMediaLoader{dir: bot.GetConfig().GetDataLayout().Resolve(config.MediaDir), allowPrivate: config.AllowPrivateUrls},
+		conns:    make(map[*oneBotConn]struct{}),
+		reverse:  make(map[string]chan struct{}),
+		closed:   make(chan struct{}),
+	}
+}
+
+// log 返回实现端使用的日志记录器
+func (s *OneBotServer) log() Logger {
+	return s.bot.log()
+}
+
+// Start 启动 OneBot 实现端，开始监听配置中的地址并订阅Bot的事件
+func (s *OneBotServer) Start() error {
+	if s.config.HttpAddr != "" {
+		if err := s.listen(s.config.HttpAddr, http.HandlerFunc(s.serveHttp)); err != nil {
+			return err
+		}
+		s.log().Infof("%s[OneBot] %s HTTP API 已在 %s 上启动", lavender, s.protocol.name(), s.config.HttpAddr)
+	}
+	if s.config.WsAddr != "" {
+		if err := s.listen(s.config.WsAddr, http.HandlerFunc(s.serveWs)); err != nil {
+			s.Stop()
+			return err
+		}
+		s.log().Infof("%s[OneBot] %s 正向 WebSocket 已在 %s 上启动", lavender, s.protocol.name(), s.config.WsAddr)
+	}
+	s.handlerId = SubscribeMatchTo(s.bot.bus(), EventMatcher{}, s.onEvent, "onebot", "onebot_"+s.protocol.name())
+	if s.protocol.reversePerBot() {
+		// 为已经连接的Bot客户端建立反向 WebSocket 连接
+		for _, c := range s.bot.GetClients() {
+			s.startReverse(c.Id, uint32(c.Uin))
+		}
+	} else {
+		s.startReverse("", 0)
+	}
+	if s.config.HeartbeatInterval > 0 {
+		go s.heartbeat()
+	}
+	return nil
+}
+
+// listen 在指定地址上启动HTTP服务
+func (s *OneBotServer) listen(addr string, handler http.Handler) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: handler}
+	s.mutex.Lock()
+	s.servers = append(s.servers, server)
+	s.mutex.Unlock()
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log().Errorf("[OneBot] 位于 %s 的服务出现错误：%v", addr, err)
+		}
+	}()
+	return nil
+}
+
+// Stop 停止 OneBot 实现端，关闭所有的服务与连接
+func (s *OneBotServer) Stop() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		if s.handlerId != "" {
+			s.bot.bus().UnsubscribeById(s.handlerId)
+		}
+		s.mutex.Lock()
+		servers := s.servers
+		conns := make([]*oneBotConn, 0, len(s.conns))
+		for conn := range s.conns {
+			conns = append(conns, conn)
+		}
+		for id, stop := range s.reverse {
+			close(stop)
+			delete(s.reverse, id)
+		}
+		s.mutex.Unlock()
+		for _, server := range servers {
+			_ = server.Close()
+		}
+		for _, conn := range conns {
+			conn.close()
+		}
+	})
+}
+
+// onEvent 处理事件总线上的事件，转换后推送给所有的应用端
+func (s *OneBotServer) onEvent(event CryoEvent) {
+	base := event.GetBaseEvent()
+	if s.protocol.reversePerBot() {
+		switch event.Type() {
+		case BotConnectedEventType:
+			s.startReverse(base.BotId, base.BotUin)
+		case BotDisconnectedEventType:
+			s.stopReverse(base.BotId)
+		}
+	}
+	payload := s.protocol.event(s, event)
+	if payload == nil {
+		return
+	}
+	s.broadcast(base.BotUin, payload)
+	if len(s.config.HttpPostUrls) > 0 {
+		go s.post(base.BotUin, payload)
+	}
+}
+
+// broadcast 将事件放入所有接收该Bot事件的 WebSocket 连接的发送队列，队列已满的连接会丢弃该事件
+func (s *OneBotServer) broadcast(selfUin uint32, payload any) {
+	s.mutex.Lock()
+	var targets []*oneBotConn
+	for conn := range s.conns {
+		if conn.acceptsEvents(selfUin) {
+			targets = append(targets, conn)
+		}
+	}
+	s.mutex.Unlock()
+	for _, conn := range targets {
+		if err := conn.writeJSON(payload); err != nil {
+			s.log().Debugf("[OneBot] 推送事件时出现错误：%v", err)
+		}
+	}
+}
+
+// post 通过 HTTP POST 上报事件
+func (s *OneBotServer) post(selfUin uint32, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	for _, url := range s.config.HttpPostUrls {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+		if err != nil {
+			s.log().Errorf("[OneBot] 无效的上报地址 %s：%v", url, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		s.protocol.postHeader(s, req, selfUin, data)
+		resp, err := oneBotHttpClient.Do(req)
+		if err != nil {
+			s.log().Warnf("[OneBot] 向 %s 上报事件时出现错误：%v", url, err)
+			continue
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+}
+
+// heartbeat 定时向所有 WebSocket 连接发送心跳事件
+func (s *OneBotServer) heartbeat() {
+	ticker := time.NewTicker(time.Duration(s.config.HeartbeatInterval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			for _, envelope := range s.protocol.heartbeatEvents(s) {
+				s.broadcast(envelope.selfUin, envelope.payload)
+			}
+		}
+	}
+}
+
+// handle 执行一个动作，selfId 为0时会在只有一个Bot客户端的情况下自动选择该客户端
+func (s *OneBotServer) handle(action string, selfId uint32, params oneBotParams) oneBotResult {
+	name := strings.TrimSuffix(action, "_async")
+	handler, ok := s.protocol.action(name)
+	if !ok {
+		return oneBotFailed(oneBotStatusUnsupportedAction, "不支持的动作：%s", action)
+	}
+	if id, ok := params.getUint32("self_id"); ok && id != 0 {
+		selfId = id
+	}
+	c, err := oneBotClient(s.bot, selfId)
+	if err != nil && s.protocol.needsClient(name) {
+		return oneBotResult{status: oneBotStatusBotNotFound, err: err}
+	}
+	if strings.HasSuffix(action, "_async") {
+		go handler(s, c, params)
+		return oneBotResult{status: oneBotStatusOk}
+	}
+	return handler(s, c, params)
+}
+
+// oneBotRequest 通过 WebSocket 或 HTTP 请求体传入的动作请求
+//
+// v11 通过 self_id 指定Bot，v12 通过 self 对象指定Bot，这里同时兼容两种形式
+type oneBotRequest struct {
+	Action string         `json:"action"`
+	Params map[string]any `json:"params"`
+	Echo   any            `json:"echo"`
+	SelfId any            `json:"self_id"`
+	Self   map[string]any `json:"self"`
+}
+
+// selfId 返回请求中指定的Bot的Uin，没有指定时返回默认值
+func (r oneBotRequest) selfId(defaultValue uint32) uint32 {
+	if id, ok := (oneBotParams{"id": r.SelfId}).getUint32("id"); ok && id != 0 {
+		return id
+	}
+	if id, ok := oneBotParams(r.Self).getUint32("user_id"); ok && id != 0 {
+		return id
+	}
+	return defaultValue
+}
+
+// serveHttp 处理 HTTP API 请求
+//
+// 请求路径为动作名称时参数可以放在查询参数、表单或JSON请求体中；请求路径为根路径时请求体为完整的动作请求
+func (s *OneBotServer) serveHttp(w http.ResponseWriter, r *http.Request) {
+	if !checkOneBotOrigin(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if code := checkOneBotToken(r, s.config.AccessToken); code != http.StatusOK {
+		w.WriteHeader(code)
+		return
+	}
+	request := oneBotRequest{Action: strings.Trim(r.URL.Path, "/"), Params: map[string]any{}}
+	inPath := request.Action != ""
+	for key, values := range r.URL.Query() {
+		if key != "access_token" && len(values) > 0 {
+			request.Params[key] = values[0]
+		}
+	}
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded"):
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if err := r.ParseForm(); err == nil {
+				for key, values := range r.PostForm {
+					request.Params[key] = values[0]
+				}
+			}
+		case len(bytes.TrimSpace(body)) == 0:
+		case request.Action == "":
+			if err := json.Unmarshal(body, &request); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		default:
+			if err := json.Unmarshal(body, &request.Params); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if _, ok := s.protocol.action(strings.TrimSuffix(request.Action, "_async")); !ok && inPath { // 完整的动作请求由响应体返回错误
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	result := s.handle(request.Action, request.selfId(oneBotRequestSelfId(r)), oneBotParams(request.Params))
+	data, _ := json.Marshal(s.protocol.response(result, request.Echo))
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// serveWs 处理正向 WebSocket 连接，/api 只处理动作，/event 只推送事件，其它路径两者兼有
+func (s *OneBotServer) serveWs(w http.ResponseWriter, r *http.Request) {
+	if code := checkOneBotToken(r, s.config.AccessToken); code != http.StatusOK {
+		w.WriteHeader(code)
+		return
+	}
+	role := "Universal"
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/api":
+		role = "API"
+	case "/event":
+		role = "Event"
+	}
+	var header http.Header
+	if protocols := websocket.Subprotocols(r); len(protocols) > 0 {
+		header = http.Header{"Sec-WebSocket-Protocol": {protocols[0]}}
+	}
+	ws, err := oneBotUpgrader.Upgrade(w, r, header)
+	if err != nil {
+		return
+	}
+	conn := newOneBotConn(ws, oneBotRequestSelfId(r), role)
+	s.log().Infof("%s[OneBot] 应用端 %s 已通过 %s 正向 WebSocket 连接", lavender, r.RemoteAddr, s.protocol.name())
+	s.serveConn(conn)
+	s.log().Infof("%s[OneBot] 应用端 %s 已断开 %s 正向 WebSocket 连接", lavender, r.RemoteAddr, s.protocol.name())
+}
+
+// serveConn 注册连接并处理连接上的动作请求，直到连接断开
+func (s *OneBotServer) serveConn(conn *oneBotConn) {
+	s.mutex.Lock()
+	s.conns[conn] = struct{}{}
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.close()
+	}()
+
+	if conn.role != "API" {
+		_ = conn.writeJSON(s.protocol.connectEvent(s, conn.selfUin))
+	}
+	for {
+		_, data, err := conn.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if conn.role == "Event" {
+			continue
+		}
+		var request oneBotRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			_ = conn.writeJSON(s.protocol.response(oneBotFailed(oneBotStatusBadRequest, "无效的请求：%v", err), nil))
+			continue
+		}
+		if request.Params == nil {
+			request.Params = map[string]any{}
+		}
+		go func() {
+			result := s.handle(request.Action, request.selfId(conn.selfUin), oneBotParams(request.Params))
+			_ = conn.writeJSON(s.protocol.response(result, request.Echo))
+		}()
+	}
+}
+
+// startReverse 建立到所有反向 WebSocket 地址的连接，botId 为空时建立所有Bot共用的连接
+func (s *OneBotServer) startReverse(botId string, selfUin uint32) {
+	if len(s.config.ReverseWsUrls) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+	if _, ok := s.reverse[botId]; ok {
+		return
+	}
+	stop := make(chan struct{})
+	s.reverse[botId] = stop
+	for _, url := range s.config.ReverseWsUrls {
+		go s.runReverse(url, selfUin, stop)
+	}
+}
+
+// stopReverse 断开Bot客户端的所有反向 WebSocket 连接
+func (s *OneBotServer) stopReverse(botId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if stop, ok := s.reverse[botId]; ok {
+		close(stop)
+		delete(s.reverse, botId)
+	}
+}
+
+// runReverse 维持一个反向 WebSocket 连接，断开后按照重连间隔重新连接，直到收到停止信号
+func (s *OneBotServer) runReverse(url string, selfUin uint32, stop chan struct{}) {
+	header := s.protocol.reverseHeader(s, selfUin)
+	if s.config.AccessToken != "" {
+		header.Set("Authorization", "Bearer "+s.config.AccessToken)
+	}
+	for {
+		ws, _, err := websocket.DefaultDialer.Dial(url, header)
+		if err != nil {
+			s.log().Warnf("[OneBot] 连接反向 WebSocket %s 失败：%v", url, err)
+		} else {
+			s.log().Infof("%s[OneBot] 已连接到 %s 反向 WebSocket %s", lavender, s.protocol.name(), url)
+			conn := newOneBotConn(ws, selfUin, "Universal")
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-stop:
+					conn.close()
+				case <-done:
+				}
+			}()
+			s.serveConn(conn)
+			close(done)
+			s.log().Warnf("[OneBot] 与反向 WebSocket %s 的连接已断开", url)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Duration(s.config.ReconnectInterval) * time.Second):
+		}
+	}
+}
+
+// selfUinString 将Uin转换为字符串
+func selfUinString(uin uint32) string {
+	return strconv.FormatUint(uint64(uin), 10)
+}
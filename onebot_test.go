@@ -0,0 +1,75 @@
+package cryobot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOneBotMediaLoaderLocal(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "media")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(filepath.Join(dir, "sub", "a.png"), "inside")
+	writeFile(filepath.Join(root, "secret.txt"), "outside")
+	if err := os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Skip("无法创建符号链接：", err)
+	}
+
+	loader := oneBotMediaLoader{dir: dir}
+	for _, file := range []string{
+		"sub/a.png",
+		filepath.Join(dir, "sub", "a.png"),
+		"file://" + filepath.Join(dir, "sub", "a.png"),
+	} {
+		data, err := loader.load(file)
+		if err != nil || string(data) != "inside" {
+			t.Errorf("load(%s) = %q, %v", file, data, err)
+		}
+	}
+	for _, file := range []string{
+		"../secret.txt",
+		"sub/../../secret.txt",
+		filepath.Join(root, "secret.txt"),
+		"file://" + filepath.Join(root, "secret.txt"),
+		"link.txt", // 指向媒体目录以外的符号链接
+	} {
+		if data, err := loader.load(file); err == nil {
+			t.Errorf("load(%s) 读取到了媒体目录以外的文件：%q", file, data)
+		}
+	}
+
+	if _, err := (oneBotMediaLoader{}).load(filepath.Join(dir, "sub", "a.png")); err == nil {
+		t.Error("没有配置媒体目录时仍然可以读取本地文件")
+	}
+	if _, err := (oneBotFile{Path: "../secret.txt"}).load(loader); err == nil {
+		t.Error("通过文件路径读取到了媒体目录以外的文件")
+	}
+	if data, err := loader.load("base64://aW5saW5l"); err != nil || string(data) != "inline" {
+		t.Errorf("load(base64) = %q, %v", data, err)
+	}
+}
+
+func TestOneBotMediaLoaderPrivateUrl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("private"))
+	}))
+	defer server.Close()
+
+	if _, err := (oneBotMediaLoader{}).load(server.URL); err == nil {
+		t.Fatal("默认不应该允许下载回环地址上的文件")
+	}
+	data, err := (oneBotMediaLoader{allowPrivate: true}).load(server.URL)
+	if err != nil || string(data) != "private" {
+		t.Fatalf("允许内网地址时 load = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,127 @@
+package cryobot
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// oneBotV11Protocol OneBot v11 协议
+type oneBotV11Protocol struct{}
+
+func (oneBotV11Protocol) name() string {
+	return "v11"
+}
+
+func (oneBotV11Protocol) event(s *OneBotServer, event CryoEvent) map[string]any {
+	return oneBotV11Event(event, s.messages)
+}
+
+func (oneBotV11Protocol) action(name string) (oneBotAction, bool) {
+	action, ok := oneBotV11Actions[name]
+	return action, ok
+}
+
+// needsClient 获取版本信息等与Bot无关的动作不需要指定Bot客户端
+func (oneBotV11Protocol) needsClient(name string) bool {
+	switch name {
+	case "get_version_info", "can_send_image", "can_send_record":
+		return false
+	}
+	return true
+}
+
+// response 将动作的执行结果转换为 OneBot v11 的响应
+func (oneBotV11Protocol) response(result oneBotResult, echo any) map[string]any {
+	resp := map[string]any{
+		"status":  "ok",
+		"retcode": 0,
+		"data":    result.data,
+	}
+	if result.err != nil {
+		resp["status"] = "failed"
+		resp["msg"] = result.err.Error()
+		resp["wording"] = result.err.Error()
+		switch result.status {
+		case oneBotStatusBadRequest, oneBotStatusBadParam, oneBotStatusBotNotFound:
+			resp["retcode"] = 1400
+		case oneBotStatusUnsupportedAction:
+			resp["retcode"] = 1404
+		default:
+			resp["retcode"] = 100
+		}
+	}
+	if echo != nil {
+		resp["echo"] = echo
+	}
+	return resp
+}
+
+// connectEvent 构建 lifecycle 元事件
+func (oneBotV11Protocol) connectEvent(s *OneBotServer, selfUin uint32) map[string]any {
+	return map[string]any{
+		"time":            time.Now().Unix(),
+		"self_id":         int64(selfUin),
+		"post_type":       "meta_event",
+		"meta_event_type": "lifecycle",
+		"sub_type":        "connect",
+	}
+}
+
+// heartbeatEvents 为每个已连接的Bot客户端构建心跳元事件
+func (oneBotV11Protocol) heartbeatEvents(s *OneBotServer) []oneBotEnvelope {
+	var envelopes []oneBotEnvelope
+	for _, c := range s.bot.GetClients() {
+		envelopes = append(envelopes, oneBotEnvelope{
+			selfUin: uint32(c.Uin),
+			payload: map[string]any{
+				"time":            time.Now().Unix(),
+				"self_id":         int64(c.Uin),
+				"post_type":       "meta_event",
+				"meta_event_type": "heartbeat",
+				"status":          map[string]any{"online": c.Client != nil && c.Client.Online.Load(), "good": true},
+				"interval":        s.config.HeartbeatInterval,
+			},
+		})
+	}
+	return envelopes
+}
+
+// reversePerBot v11 的反向 WebSocket 需要为每个Bot客户端单独建立连接
+func (oneBotV11Protocol) reversePerBot() bool {
+	return true
+}
+
+func (oneBotV11Protocol) reverseHeader(s *OneBotServer, selfUin uint32) http.Header {
+	header := http.Header{}
+	header.Set("X-Self-ID", selfUinString(selfUin))
+	header.Set("X-Client-Role", "Universal")
+	header.Set("User-Agent", "cryobot/OneBot-v11")
+	return header
+}
+
+func (oneBotV11Protocol) postHeader(s *OneBotServer, req *http.Request, selfUin uint32, body []byte) {
+	req.Header.Set("X-Self-ID", selfUinString(selfUin))
+	if s.config.Secret != "" {
+		mac := hmac.New(sha1.New, []byte(s.config.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+	}
+}
+
+// NewOneBotV11Server 创建一个 OneBot v11 实现端，调用 Start 后开始工作
+func NewOneBotV11Server(bot *Bot, config OneBotConfig) *OneBotServer {
+	return newOneBotServer(bot, config, oneBotV11Protocol{})
+}
+
+// StartOneBotV11 使用指定的配置启动 OneBot v11 实现端
+func (b *Bot) StartOneBotV11(config OneBotConfig) (*OneBotServer, error) {
+	s := NewOneBotV11Server(b, config)
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	b.oneBotServers = append(b.oneBotServers, s)
+	return s, nil
+}
@@ -0,0 +1,600 @@
+package cryobot
+
+import (
+	"fmt"
+	"github.com/LagrangeDev/LagrangeGo/client/entity"
+	lagrangeMessage "github.com/LagrangeDev/LagrangeGo/message"
+	"strconv"
+	"time"
+)
+
+// OneBot v11 的动作实现，每个动作都会被映射到CryoClient的方法上
+
+// oneBotV11Actions 支持的 OneBot v11 动作
+var oneBotV11Actions = map[string]oneBotAction{
+	"send_private_msg":        oneBotV11SendPrivateMsg,
+	"send_group_msg":          oneBotV11SendGroupMsg,
+	"send_msg":                oneBotV11SendMsg,
+	"delete_msg":              oneBotV11DeleteMsg,
+	"get_msg":                 oneBotV11GetMsg,
+	"send_like":               oneBotV11SendLike,
+	"set_group_kick":          oneBotV11SetGroupKick,
+	"set_group_ban":           oneBotV11SetGroupBan,
+	"set_group_whole_ban":     oneBotV11SetGroupWholeBan,
+	"set_group_admin":         oneBotV11SetGroupAdmin,
+	"set_group_card":          oneBotV11SetGroupCard,
+	"set_group_name":          oneBotV11SetGroupName,
+	"set_group_leave":         oneBotV11SetGroupLeave,
+	"set_group_special_title": oneBotV11SetGroupSpecialTitle,
+	"set_friend_add_request":  oneBotV11SetFriendAddRequest,
+	"set_group_add_request":   oneBotV11SetGroupAddRequest,
+	"get_login_info":          oneBotV11GetLoginInfo,
+	"get_stranger_info":       oneBotV11GetStrangerInfo,
+	"get_friend_list":         oneBotV11GetFriendList,
+	"get_group_info":          oneBotV11GetGroupInfo,
+	"get_group_list":          oneBotV11GetGroupList,
+	"get_group_member_info":   oneBotV11GetGroupMemberInfo,
+	"get_group_member_list":   oneBotV11GetGroupMemberList,
+	"friend_poke":             oneBotV11FriendPoke,
+	"group_poke":              oneBotV11GroupPoke,
+	"can_send_image":          oneBotV11CanSend,
+	"can_send_record":         oneBotV11CanSend,
+	"get_status":              oneBotV11GetStatus,
+	"get_version_info":        oneBotV11GetVersionInfo,
+}
+
+// requireUint32 读取必填的整数参数
+func requireUint32(p oneBotParams, key string) (uint32, *oneBotResult) {
+	v, ok := p.getUint32(key)
+	if !ok {
+		r := oneBotFailed(oneBotStatusBadParam, "缺少参数或参数无效：%s", key)
+		return 0, &r
+	}
+	return v, nil
+}
+
+// actionError 将动作执行过程中出现的错误转换为执行结果
+func actionError(err error) oneBotResult {
+	return oneBotResult{status: oneBotStatusFailed, err: err}
+}
+
+// okOrError 没有错误时返回空的成功结果
+func okOrError(err error) oneBotResult {
+	if err != nil {
+		return actionError(err)
+	}
+	return oneBotOk(nil)
+}
+
+// oneBotV11Message 将 OneBot v11 的消息转换为CryoMessage
+//
+// 消息可以是消息段数组、单个消息段或CQ码字符串，auto_escape 为true时字符串会被当作纯文本
+func oneBotV11Message(s *OneBotServer, raw any, autoEscape bool) (*CryoMessage, error) {
+	var segments []OneBotSegment
+	switch v := raw.(type) {
+	case string:
+		if autoEscape {
+			segments = []OneBotSegment{{Type: "text", Data: map[string]any{"text": v}}}
+		} else {
+			segments = ParseCQCode(v)
+		}
+	case map[string]any:
+		segments = []OneBotSegment{segmentFromMap(v)}
+	case []any:
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok {
+				segments = append(segments, segmentFromMap(m))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("无效的消息格式")
+	}
+
+	msg := BuildMessage()
+	for _, segment := range segments {
+		data := oneBotParams(segment.Data)
+		switch segment.Type {
+		case "text":
+			msg.Text(data.getString("text"))
+		case "at":
+			qq := data.getString("qq")
+			if qq == "all" {
+				msg.At(0)
+				continue
+			}
+			uin, err := strconv.ParseUint(qq, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("无效的at对象：%s", qq)
+			}
+			if name := data.getString("name"); name != "" {
+				msg.At(uint32(uin), "@"+name)
+			} else {
+				msg.At(uint32(uin))
+			}
+		case "face":
+			id, ok := data.getUint32("id")
+			if !ok {
+				return nil, fmt.Errorf("无效的表情ID")
+			}
+			msg.Face(id)
+		case "reply":
+			id, _ := data.getInt64("id")
+			record, ok := s.messages.get(int32(id))
+			if !ok {
+				return nil, fmt.Errorf("找不到被回复的消息：%d", id)
+			}
+			msg.Elements = append(msg.Elements, record.replyElement())
+		case "image", "record":
+			file := data.getString("file")
+			if url := data.getString("url"); url != "" && !data.has("file") {
+				file = url
+			}
+			media, err := s.media.load(file)
+			if err != nil {
+				return nil, fmt.Errorf("加载媒体文件时出现错误：%v", err)
+			}
+			if segment.Type == "image" {
+				msg.Image(media)
+			} else {
+				msg.Elements = append(msg.Elements, &VoiceElement{*lagrangeMessage.NewRecord(media)})
+			}
+		case "json":
+			msg.Elements = append(msg.Elements, &LightAppElement{*lagrangeMessage.NewLightApp(data.getString("data"))})
+		case "xml":
+			msg.Elements = append(msg.Elements, &XMLElement{*lagrangeMessage.NewXML(data.getString("data"))})
+		default:
+			s.log().Debugf("[OneBot] 忽略了不支持的消息段：%s", segment.Type)
+		}
+	}
+	if len(msg.Elements) == 0 {
+		return nil, fmt.Errorf("消息内容为空")
+	}
+	return msg, nil
+}
+
+// segmentFromMap 将解码后的JSON对象转换为消息段
+func segmentFromMap(m map[string]any) OneBotSegment {
+	segment := OneBotSegment{Data: map[string]any{}}
+	segment.Type, _ = m["type"].(string)
+	if data, ok := m["data"].(map[string]any); ok {
+		segment.Data = data
+	}
+	return segment
+}
+
+// oneBotV11Send 发送消息并记录到消息缓存中，messageType 为空时根据是否传入 group_id 判断消息类型
+func oneBotV11Send(s *OneBotServer, c *CryoClient, messageType string, p oneBotParams) oneBotResult {
+	msg, err := oneBotV11Message(s, p["message"], p.getBool("auto_escape", false))
+	if err != nil {
+		return oneBotFailed(oneBotStatusBadParam, "%v", err)
+	}
+	if messageType == "" {
+		messageType = "private"
+		if p.has("group_id") && !p.has("user_id") {
+			messageType = "group"
+		}
+	}
+	record, bad := oneBotSendMessage(c, messageType, p, msg)
+	if bad != nil {
+		return *bad
+	}
+	s.messages.record(record)
+	return oneBotOk(map[string]any{"message_id": record.Id})
+}
+
+// oneBotSendMessage 发送已经转换好的消息，返回用于记录到消息缓存中的消息记录
+//
+// 私聊消息同时传入 group_id 时会通过群发起临时会话
+func oneBotSendMessage(c *CryoClient, messageType string, p oneBotParams, msg *CryoMessage) (oneBotMessageRecord, *oneBotResult) {
+	record := oneBotMessageRecord{
+		BotId:          c.Id,
+		SelfUin:        uint32(c.Uin),
+		SenderUin:      uint32(c.Uin),
+		SenderNickname: c.GetNickname(),
+		Message:        *msg,
+	}
+	switch messageType {
+	case "group":
+		groupUin, bad := requireUint32(p, "group_id")
+		if bad != nil {
+			return record, bad
+		}
+		m, err := c.sendGroupMessage(groupUin, msg)
+		if err != nil {
+			r := actionError(err)
+			return record, &r
+		}
+		record.IsGroup = true
+		record.PeerUin = groupUin
+		record.Seq = m.ID
+		record.Random = m.InternalID
+		record.Time = m.Time
+	case "private":
+		userUin, bad := requireUint32(p, "user_id")
+		if bad != nil {
+			return record, bad
+		}
+		if groupUin, ok := p.getUint32("group_id"); ok { // 通过群发起临时会话
+			m, err := c.sendTempMessage(groupUin, userUin, msg)
+			if err != nil {
+				r := actionError(err)
+				return record, &r
+			}
+			record.IsTemp = true
+			record.GroupUin = groupUin
+			record.PeerUin = userUin
+			record.Seq = m.ID
+			record.Time = uint32(time.Now().Unix())
+			break
+		}
+		m, err := c.sendPrivateMessage(userUin, msg)
+		if err != nil {
+			r := actionError(err)
+			return record, &r
+		}
+		record.PeerUin = userUin
+		record.Seq = m.ID
+		record.Random = m.InternalID
+		record.ClientSeq = m.ClientSeq
+		record.Time = m.Time
+	default:
+		r := oneBotFailed(oneBotStatusBadParam, "无效的消息类型：%s", messageType)
+		return record, &r
+	}
+	record.Id = OneBotMessageId(record.SelfUin, record.IsGroup, record.PeerUin, record.Seq)
+	return record, nil
+}
+
+func oneBotV11SendPrivateMsg(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotV11Send(s, c, "private", p)
+}
+
+func oneBotV11SendGroupMsg(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotV11Send(s, c, "group", p)
+}
+
+func oneBotV11SendMsg(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotV11Send(s, c, p.getString("message_type"), p)
+}
+
+func oneBotV11DeleteMsg(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	id, _ := p.getInt64("message_id")
+	record, ok := s.messages.get(int32(id))
+	if !ok {
+		return oneBotFailed(oneBotStatusFailed, "找不到消息：%d", id)
+	}
+	switch {
+	case record.IsGroup:
+		return okOrError(c.RecallGroupMessage(record.PeerUin, record.Seq))
+	case record.IsTemp:
+		return oneBotFailed(oneBotStatusFailed, "不支持撤回临时会话消息")
+	}
+	return okOrError(c.RecallPrivateMessage(record.PeerUin, record.Seq, record.Random, record.ClientSeq, record.Time))
+}
+
+func oneBotV11GetMsg(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	id, _ := p.getInt64("message_id")
+	record, ok := s.messages.get(int32(id))
+	if !ok {
+		return oneBotFailed(oneBotStatusFailed, "找不到消息：%d", id)
+	}
+	result := map[string]any{
+		"time":         int64(record.Time),
+		"message_type": "private",
+		"message_id":   record.Id,
+		"real_id":      int64(record.Seq),
+		"sender": map[string]any{
+			"user_id":  int64(record.SenderUin),
+			"nickname": record.SenderNickname,
+			"card":     record.SenderCardname,
+		},
+		"message": oneBotV11Segments(record.Message, record.SelfUin, record.IsGroup, record.PeerUin),
+	}
+	if record.IsGroup {
+		result["message_type"] = "group"
+		result["group_id"] = int64(record.PeerUin)
+	}
+	return oneBotOk(result)
+}
+
+func oneBotV11SendLike(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	times, ok := p.getUint32("times")
+	if !ok || times == 0 {
+		times = 1
+	}
+	return okOrError(c.SendLike(userUin, times))
+}
+
+func oneBotV11SetGroupKick(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	return okOrError(c.KickGroupMember(groupUin, userUin, p.getBool("reject_add_request", false)))
+}
+
+func oneBotV11SetGroupBan(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	duration, ok := p.getUint32("duration")
+	if !ok {
+		duration = 30 * 60
+	}
+	return okOrError(c.MuteGroupMember(groupUin, userUin, duration))
+}
+
+func oneBotV11SetGroupWholeBan(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	return okOrError(c.MuteGroupAll(groupUin, p.getBool("enable", true)))
+}
+
+func oneBotV11SetGroupAdmin(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	return okOrError(c.SetGroupAdmin(groupUin, userUin, p.getBool("enable", true)))
+}
+
+func oneBotV11SetGroupCard(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	return okOrError(c.SetGroupMemberCard(groupUin, userUin, p.getString("card")))
+}
+
+func oneBotV11SetGroupName(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	return okOrError(c.SetGroupName(groupUin, p.getString("group_name")))
+}
+
+func oneBotV11SetGroupLeave(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	return okOrError(c.LeaveGroup(groupUin))
+}
+
+func oneBotV11SetGroupSpecialTitle(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	return okOrError(c.SetGroupMemberSpecialTitle(groupUin, userUin, p.getString("special_title")))
+}
+
+func oneBotV11SetFriendAddRequest(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	flag := p.getString("flag")
+	if flag == "" {
+		return oneBotFailed(oneBotStatusBadParam, "缺少参数：flag")
+	}
+	return okOrError(c.HandleFriendRequest(flag, p.getBool("approve", true)))
+}
+
+func oneBotV11SetGroupAddRequest(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, seq, requestType, err := parseOneBotRequestFlag(p.getString("flag"))
+	if err != nil {
+		return oneBotFailed(oneBotStatusBadParam, "%v", err)
+	}
+	return okOrError(c.HandleGroupRequest(groupUin, seq, requestType, p.getBool("approve", true), p.getString("reason")))
+}
+
+func oneBotV11GetLoginInfo(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotOk(map[string]any{
+		"user_id":  int64(c.Uin),
+		"nickname": c.GetNickname(),
+	})
+}
+
+// oneBotV11Sex 将性别转换为 OneBot v11 的表示
+func oneBotV11Sex(sex uint32) string {
+	switch sex {
+	case 1:
+		return "male"
+	case 2:
+		return "female"
+	}
+	return "unknown"
+}
+
+func oneBotV11GetStrangerInfo(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	user, err := c.GetUserInfo(userUin)
+	if err != nil {
+		return actionError(err)
+	}
+	return oneBotOk(map[string]any{
+		"user_id":  int64(user.Uin),
+		"nickname": user.Nickname,
+		"sex":      oneBotV11Sex(user.Sex),
+		"age":      int64(user.Age),
+		"level":    int64(user.Level),
+	})
+}
+
+func oneBotV11GetFriendList(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	friends, err := c.GetFriendList(p.getBool("no_cache", false))
+	if err != nil {
+		return actionError(err)
+	}
+	result := make([]map[string]any, 0, len(friends))
+	for _, friend := range friends {
+		result = append(result, map[string]any{
+			"user_id":  int64(friend.Uin),
+			"nickname": friend.Nickname,
+			"remark":   friend.Remarks,
+		})
+	}
+	return oneBotOk(result)
+}
+
+// oneBotV11Group 将群信息转换为 OneBot v11 的表示
+func oneBotV11Group(group *entity.Group) map[string]any {
+	return map[string]any{
+		"group_id":         int64(group.GroupUin),
+		"group_name":       group.GroupName,
+		"member_count":     int64(group.MemberCount),
+		"max_member_count": int64(group.MaxMember),
+	}
+}
+
+func oneBotV11GetGroupInfo(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	group, err := c.GetGroupInfo(groupUin, p.getBool("no_cache", false))
+	if err != nil {
+		return actionError(err)
+	}
+	return oneBotOk(oneBotV11Group(group))
+}
+
+func oneBotV11GetGroupList(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groups, err := c.GetGroupList(p.getBool("no_cache", false))
+	if err != nil {
+		return actionError(err)
+	}
+	result := make([]map[string]any, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, oneBotV11Group(group))
+	}
+	return oneBotOk(result)
+}
+
+// oneBotV11Member 将群成员信息转换为 OneBot v11 的表示
+func oneBotV11Member(groupUin uint32, member *entity.GroupMember) map[string]any {
+	role := "member"
+	switch member.Permission {
+	case entity.Owner:
+		role = "owner"
+	case entity.Admin:
+		role = "admin"
+	}
+	return map[string]any{
+		"group_id":          int64(groupUin),
+		"user_id":           int64(member.Uin),
+		"nickname":          member.Nickname,
+		"card":              member.MemberCard,
+		"sex":               oneBotV11Sex(member.Sex),
+		"age":               int64(member.Age),
+		"area":              "",
+		"join_time":         int64(member.JoinTime),
+		"last_sent_time":    int64(member.LastMsgTime),
+		"level":             strconv.FormatUint(uint64(member.GroupLevel), 10),
+		"role":              role,
+		"unfriendly":        false,
+		"title":             member.SpecialTitle,
+		"title_expire_time": 0,
+		"card_changeable":   role != "member",
+		"shut_up_timestamp": int64(member.ShutUpTime),
+	}
+}
+
+func oneBotV11GetGroupMemberInfo(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	member, err := c.GetGroupMemberInfo(groupUin, userUin, p.getBool("no_cache", false))
+	if err != nil {
+		return actionError(err)
+	}
+	return oneBotOk(oneBotV11Member(groupUin, member))
+}
+
+func oneBotV11GetGroupMemberList(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	members, err := c.GetGroupMemberList(groupUin, p.getBool("no_cache", false))
+	if err != nil {
+		return actionError(err)
+	}
+	result := make([]map[string]any, 0, len(members))
+	for _, member := range members {
+		result = append(result, oneBotV11Member(groupUin, member))
+	}
+	return oneBotOk(result)
+}
+
+func oneBotV11FriendPoke(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	return okOrError(c.Poke(0, userUin))
+}
+
+func oneBotV11GroupPoke(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	return okOrError(c.Poke(groupUin, userUin))
+}
+
+func oneBotV11CanSend(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotOk(map[string]any{"yes": true})
+}
+
+func oneBotV11GetStatus(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotOk(map[string]any{
+		"online": c.Client != nil && c.Client.Online.Load(),
+		"good":   true,
+	})
+}
+
+func oneBotV11GetVersionInfo(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotOk(map[string]any{
+		"app_name":         "cryobot",
+		"app_version":      "dev",
+		"protocol_version": "v11",
+	})
+}
@@ -0,0 +1,350 @@
+package cryobot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OneBot v11 的消息段与事件转换
+
+// oneBotV11Segments 将CryoMessage转换为 OneBot v11 的消息段数组
+//
+// selfUin、isGroup 和 peerUin 用于计算回复消息段中被回复消息的ID
+func oneBotV11Segments(msg CryoMessage, selfUin uint32, isGroup bool, peerUin uint32) []OneBotSegment {
+	segments := make([]OneBotSegment, 0, len(msg.Elements))
+	for _, element := range msg.Elements {
+		switch e := element.(type) {
+		case *TextElement:
+			segments = append(segments, OneBotSegment{Type: "text", Data: map[string]any{"text": e.Content}})
+		case *AtElement:
+			qq := strconv.FormatUint(uint64(e.TargetUin), 10)
+			if e.TargetUin == 0 {
+				qq = "all"
+			}
+			segments = append(segments, OneBotSegment{Type: "at", Data: map[string]any{"qq": qq, "name": strings.TrimPrefix(e.Display, "@")}})
+		case *FaceElement:
+			segments = append(segments, OneBotSegment{Type: "face", Data: map[string]any{"id": strconv.FormatUint(uint64(e.FaceID), 10)}})
+		case *ReplyElement:
+			id := OneBotMessageId(selfUin, isGroup, peerUin, e.ReplySeq)
+			segments = append(segments, OneBotSegment{Type: "reply", Data: map[string]any{"id": strconv.FormatInt(int64(id), 10)}})
+		case *ImageElement:
+			segments = append(segments, OneBotSegment{Type: "image", Data: map[string]any{"file": e.ImageID, "url": e.URL, "summary": e.Summary}})
+		case *VoiceElement:
+			segments = append(segments, OneBotSegment{Type: "record", Data: map[string]any{"file": e.Name, "url": e.URL}})
+		case *ShortVideoElement:
+			segments = append(segments, OneBotSegment{Type: "video", Data: map[string]any{"file": e.Name, "url": e.URL}})
+		case *FileElement:
+			fileId := e.FileID
+			if fileId == "" {
+				fileId = e.FileUUID
+			}
+			segments = append(segments, OneBotSegment{Type: "file", Data: map[string]any{"file": e.FileName, "file_id": fileId, "file_size": strconv.FormatUint(e.FileSize, 10), "url": e.FileURL}})
+		case *LightAppElement:
+			segments = append(segments, OneBotSegment{Type: "json", Data: map[string]any{"data": e.Content}})
+		case *XMLElement:
+			segments = append(segments, OneBotSegment{Type: "xml", Data: map[string]any{"data": e.Content}})
+		case *ForwardMessageElement:
+			segments = append(segments, OneBotSegment{Type: "forward", Data: map[string]any{"id": e.ResID}})
+		case *MarketFaceElement:
+			segments = append(segments, OneBotSegment{Type: "text", Data: map[string]any{"text": e.Summary}})
+		}
+	}
+	return segments
+}
+
+// escapeCQText 转义CQ码中的纯文本
+func escapeCQText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "[", "&#91;", "]", "&#93;").Replace(s)
+}
+
+// escapeCQParam 转义CQ码中的参数值
+func escapeCQParam(s string) string {
+	return strings.NewReplacer("&", "&amp;", "[", "&#91;", "]", "&#93;", ",", "&#44;").Replace(s)
+}
+
+// unescapeCQ 反转义CQ码
+func unescapeCQ(s string) string {
+	return strings.NewReplacer("&#91;", "[", "&#93;", "]", "&#44;", ",", "&amp;", "&").Replace(s)
+}
+
+// EncodeCQCode 将 OneBot v11 的消息段数组编码为CQ码字符串
+func EncodeCQCode(segments []OneBotSegment) string {
+	var sb strings.Builder
+	for _, segment := range segments {
+		if segment.Type == "text" {
+			text, _ := segment.Data["text"].(string)
+			sb.WriteString(escapeCQText(text))
+			continue
+		}
+		sb.WriteString("[CQ:")
+		sb.WriteString(segment.Type)
+		keys := make([]string, 0, len(segment.Data))
+		for key := range segment.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			v := fmt.Sprint(segment.Data[key])
+			if v == "" {
+				continue
+			}
+			sb.WriteString(",")
+			sb.WriteString(key)
+			sb.WriteString("=")
+			sb.WriteString(escapeCQParam(v))
+		}
+		sb.WriteString("]")
+	}
+	return sb.String()
+}
+
+// ParseCQCode 将CQ码字符串解析为 OneBot v11 的消息段数组
+func ParseCQCode(s string) []OneBotSegment {
+	var segments []OneBotSegment
+	appendText := func(text string) {
+		if text != "" {
+			segments = append(segments, OneBotSegment{Type: "text", Data: map[string]any{"text": unescapeCQ(text)}})
+		}
+	}
+	for {
+		start := strings.Index(s, "[CQ:")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "]")
+		if end < 0 {
+			break
+		}
+		appendText(s[:start])
+		parts := strings.Split(s[start+4:start+end], ",")
+		segment := OneBotSegment{Type: parts[0], Data: map[string]any{}}
+		for _, part := range parts[1:] {
+			key, value, _ := strings.Cut(part, "=")
+			segment.Data[key] = unescapeCQ(value)
+		}
+		segments = append(segments, segment)
+		s = s[start+end+1:]
+	}
+	appendText(s)
+	return segments
+}
+
+// oneBotV11Base 构建 OneBot v11 事件的公共字段
+func oneBotV11Base(base BaseEvent, postType string) map[string]any {
+	return map[string]any{
+		"time":      int64(base.Time),
+		"self_id":   int64(base.BotUin),
+		"post_type": postType,
+	}
+}
+
+// oneBotV11Event 将cryobot的事件转换为 OneBot v11 的事件，无法转换的事件返回nil
+//
+// 消息事件会同时被记录到消息缓存中，以便之后通过消息ID进行回复、撤回等操作
+func oneBotV11Event(event CryoEvent, cache *oneBotMessageCache) map[string]any {
+	base := event.GetBaseEvent()
+	switch e := event.(type) {
+	case PrivateMessageEvent, GroupMessageEvent, TempMessageEvent:
+		record := cache.recordMessageEvent(e.(CryoMessageEvent))
+		m := e.(CryoMessageEvent).GetMessageEvent()
+		segments := oneBotV11Segments(m.MessageElements, record.SelfUin, record.IsGroup, record.PeerUin)
+		result := oneBotV11Base(base, "message")
+		result["message_id"] = record.Id
+		result["user_id"] = int64(m.SenderUin)
+		result["message"] = segments
+		result["raw_message"] = EncodeCQCode(segments)
+		result["font"] = 0
+		sender := map[string]any{
+			"user_id":  int64(m.SenderUin),
+			"nickname": m.SenderNickname,
+			"sex":      "unknown",
+			"age":      0,
+		}
+		result["sender"] = sender
+		switch {
+		case record.IsGroup:
+			result["message_type"] = "group"
+			result["sub_type"] = "normal"
+			result["group_id"] = int64(m.GroupUin)
+			result["anonymous"] = nil
+			sender["card"] = m.SenderCardname
+		case record.IsTemp:
+			result["message_type"] = "private"
+			result["sub_type"] = "group"
+			result["temp_source"] = 0
+			sender["group_id"] = int64(m.GroupUin)
+		default:
+			result["message_type"] = "private"
+			result["sub_type"] = "other"
+			if m.IsSenderFriend {
+				result["sub_type"] = "friend"
+			}
+			result["target_id"] = int64(record.PeerUin)
+		}
+		return result
+	case FriendRecallEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "friend_recall"
+		result["user_id"] = int64(e.Uin)
+		result["message_id"] = OneBotMessageId(base.BotUin, false, e.Uin, uint32(e.Seqence))
+		return result
+	case GroupRecallEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "group_recall"
+		result["group_id"] = int64(e.GroupUin)
+		result["user_id"] = int64(e.SenderUin)
+		result["operator_id"] = int64(e.OperatorUin)
+		result["message_id"] = OneBotMessageId(base.BotUin, true, e.GroupUin, uint32(e.Seqence))
+		return result
+	case GroupMemberIncreaseEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "group_increase"
+		result["sub_type"] = "approve"
+		if e.InviterUin != 0 {
+			result["sub_type"] = "invite"
+		}
+		result["group_id"] = int64(e.GroupUin)
+		result["user_id"] = int64(e.Uin)
+		result["operator_id"] = int64(e.InviterUin)
+		return result
+	case GroupMemberDecreaseEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "group_decrease"
+		result["sub_type"] = "leave"
+		if e.IsSelf {
+			result["sub_type"] = "kick_me"
+		}
+		result["group_id"] = int64(e.GroupUin)
+		result["user_id"] = int64(e.Uin)
+		result["operator_id"] = int64(0)
+		return result
+	case GroupMemberPermissionUpdatedEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "group_admin"
+		result["sub_type"] = "unset"
+		if e.IsAdmin {
+			result["sub_type"] = "set"
+		}
+		result["group_id"] = int64(e.GroupUin)
+		result["user_id"] = int64(e.Uin)
+		return result
+	case GroupMuteEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "group_ban"
+		result["sub_type"] = "lift_ban"
+		if e.Duration > 0 {
+			result["sub_type"] = "ban"
+		}
+		result["group_id"] = int64(e.GroupUin)
+		result["operator_id"] = int64(e.OperatorUin)
+		result["user_id"] = int64(e.TargetUin) // 全员禁言时为0
+		result["duration"] = int64(e.Duration)
+		return result
+	case NewFriendEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "friend_add"
+		result["user_id"] = int64(e.Uin)
+		return result
+	case FriendPokeEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "notify"
+		result["sub_type"] = "poke"
+		result["user_id"] = int64(e.SenderUin)
+		result["target_id"] = int64(e.TargetUin)
+		return result
+	case GroupNameUpdatedEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "notify"
+		result["sub_type"] = "group_name"
+		result["group_id"] = int64(e.GroupUin)
+		result["user_id"] = int64(e.Uin)
+		result["name_new"] = e.NewName
+		return result
+	case GroupMemberSpecialTitleUpdated:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "notify"
+		result["sub_type"] = "title"
+		result["group_id"] = int64(e.GroupUin)
+		result["user_id"] = int64(e.Uin)
+		result["title"] = e.NewTitle
+		return result
+	case GroupDigestEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "essence"
+		result["sub_type"] = "add"
+		if e.IsRemove {
+			result["sub_type"] = "delete"
+		}
+		result["group_id"] = int64(e.GroupUin)
+		result["sender_id"] = int64(e.SenderUin)
+		result["operator_id"] = int64(e.OperatorUin)
+		return result
+	case GroupReactionEvent:
+		result := oneBotV11Base(base, "notice")
+		result["notice_type"] = "group_msg_emoji_like"
+		result["group_id"] = int64(e.GroupUin)
+		result["user_id"] = int64(e.Uin)
+		result["message_id"] = OneBotMessageId(base.BotUin, true, e.GroupUin, e.TargetSeq)
+		result["is_add"] = e.IsAdd
+		result["likes"] = []map[string]any{{"emoji_id": e.Code, "count": int64(e.Count)}}
+		return result
+	case NewFriendRequestEvent:
+		result := oneBotV11Base(base, "request")
+		result["request_type"] = "friend"
+		result["user_id"] = int64(e.Uin)
+		result["comment"] = e.Message
+		result["flag"] = e.Uid
+		return result
+	case GroupMemberJoinRequestEvent:
+		result := oneBotV11Base(base, "request")
+		result["request_type"] = "group"
+		result["sub_type"] = "add"
+		result["group_id"] = int64(e.GroupUin)
+		result["user_id"] = int64(e.SenderUin)
+		result["comment"] = e.Answer
+		result["flag"] = oneBotRequestFlag(e.GroupUin, e.RequestSeqence, 1)
+		return result
+	case GroupInviteEvent:
+		result := oneBotV11Base(base, "request")
+		result["request_type"] = "group"
+		result["sub_type"] = "invite"
+		result["group_id"] = int64(e.GroupUin)
+		result["user_id"] = int64(e.InviterUin)
+		result["comment"] = ""
+		result["flag"] = oneBotRequestFlag(e.GroupUin, e.RequestSeqence, 2)
+		return result
+	case BotConnectedEvent:
+		result := oneBotV11Base(base, "meta_event")
+		result["meta_event_type"] = "lifecycle"
+		result["sub_type"] = "enable"
+		return result
+	case BotDisconnectedEvent:
+		result := oneBotV11Base(base, "meta_event")
+		result["meta_event_type"] = "lifecycle"
+		result["sub_type"] = "disable"
+		return result
+	}
+	return nil
+}
+
+// oneBotRequestFlag 生成群请求的 flag，处理请求时需要用到群号、请求序列号以及请求类型
+func oneBotRequestFlag(groupUin uint32, seq uint64, requestType uint32) string {
+	return fmt.Sprintf("%d:%d:%d", groupUin, seq, requestType)
+}
+
+// parseOneBotRequestFlag 解析群请求的 flag
+func parseOneBotRequestFlag(flag string) (groupUin uint32, seq uint64, requestType uint32, err error) {
+	parts := strings.Split(flag, ":")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("无效的请求 flag：%s", flag)
+	}
+	g, err1 := strconv.ParseUint(parts[0], 10, 32)
+	s, err2 := strconv.ParseUint(parts[1], 10, 64)
+	t, err3 := strconv.ParseUint(parts[2], 10, 32)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, 0, 0, fmt.Errorf("无效的请求 flag：%s", flag)
+	}
+	return uint32(g), s, uint32(t), nil
+}
@@ -0,0 +1,377 @@
+package cryobot
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// OneBot v12 协议
+//
+// v12 中所有的ID都使用字符串表示，平台特有的事件、动作和消息段使用 qq. 前缀进行扩展，
+// 图片、语音等媒体文件需要先通过 upload_file 动作上传得到文件ID后再发送
+
+// oneBotV12Platform v12 中使用的平台名称
+const oneBotV12Platform = "qq"
+
+// oneBotV12Protocol OneBot v12 协议
+type oneBotV12Protocol struct{}
+
+func (oneBotV12Protocol) name() string {
+	return "v12"
+}
+
+func (oneBotV12Protocol) event(s *OneBotServer, event CryoEvent) map[string]any {
+	return oneBotV12Event(s, event)
+}
+
+func (oneBotV12Protocol) action(name string) (oneBotAction, bool) {
+	action, ok := oneBotV12Actions[name]
+	return action, ok
+}
+
+// needsClient 获取版本、状态以及上传文件等与Bot无关的动作不需要指定Bot客户端
+func (oneBotV12Protocol) needsClient(name string) bool {
+	switch name {
+	case "get_version", "get_status", "get_supported_actions", "upload_file", "get_file":
+		return false
+	}
+	return true
+}
+
+// response 将动作的执行结果转换为 OneBot v12 的响应
+func (oneBotV12Protocol) response(result oneBotResult, echo any) map[string]any {
+	resp := map[string]any{
+		"status":  "ok",
+		"retcode": 0,
+		"data":    result.data,
+		"message": "",
+	}
+	if result.err != nil {
+		resp["status"] = "failed"
+		resp["message"] = result.err.Error()
+		switch result.status {
+		case oneBotStatusBadRequest:
+			resp["retcode"] = 10001
+		case oneBotStatusUnsupportedAction:
+			resp["retcode"] = 10002
+		case oneBotStatusBadParam:
+			resp["retcode"] = 10003
+		case oneBotStatusBotNotFound:
+			resp["retcode"] = 10101
+		default:
+			resp["retcode"] = 34000
+		}
+	}
+	if echo != nil {
+		resp["echo"] = echo
+	}
+	return resp
+}
+
+// connectEvent 构建 connect 元事件
+func (oneBotV12Protocol) connectEvent(s *OneBotServer, selfUin uint32) map[string]any {
+	result := oneBotV12Meta("connect")
+	result["version"] = oneBotV12Version()
+	return result
+}
+
+// heartbeatEvents 构建一个推送给所有连接的心跳元事件
+func (oneBotV12Protocol) heartbeatEvents(s *OneBotServer) []oneBotEnvelope {
+	result := oneBotV12Meta("heartbeat")
+	result["interval"] = int64(s.config.HeartbeatInterval)
+	return []oneBotEnvelope{{payload: result}}
+}
+
+// reversePerBot v12 中所有Bot客户端共用同一个反向 WebSocket 连接
+func (oneBotV12Protocol) reversePerBot() bool {
+	return false
+}
+
+func (oneBotV12Protocol) reverseHeader(s *OneBotServer, selfUin uint32) http.Header {
+	header := http.Header{}
+	header.Set("User-Agent", "OneBot/12 ("+oneBotV12Platform+") cryobot/dev")
+	header.Set("Sec-WebSocket-Protocol", "12.cryobot")
+	return header
+}
+
+func (oneBotV12Protocol) postHeader(s *OneBotServer, req *http.Request, selfUin uint32, body []byte) {
+	req.Header.Set("User-Agent", "OneBot/12 ("+oneBotV12Platform+") cryobot/dev")
+	req.Header.Set("X-OneBot-Version", "12")
+	req.Header.Set("X-Impl", "cryobot")
+	if s.config.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.AccessToken)
+	}
+}
+
+// oneBotV12Version 实现端的版本信息
+func oneBotV12Version() map[string]any {
+	return map[string]any{
+		"impl":           "cryobot",
+		"version":        "dev",
+		"onebot_version": "12",
+	}
+}
+
+// oneBotV12Self 构建Bot自身的标识
+func oneBotV12Self(uin uint32) map[string]any {
+	return map[string]any{"platform": oneBotV12Platform, "user_id": selfUinString(uin)}
+}
+
+// oneBotV12Status 构建实现端的运行状态
+func oneBotV12Status(b *Bot) map[string]any {
+	clients := b.GetClients()
+	bots := make([]map[string]any, 0, len(clients))
+	for _, c := range clients {
+		bots = append(bots, map[string]any{
+			"self":   oneBotV12Self(uint32(c.Uin)),
+			"online": c.Client != nil && c.Client.Online.Load(),
+		})
+	}
+	return map[string]any{"good": true, "bots": bots}
+}
+
+// oneBotV12Meta 构建元事件的公共字段
+func oneBotV12Meta(detailType string) map[string]any {
+	return map[string]any{
+		"id":          NewUUID(),
+		"time":        float64(time.Now().UnixNano()) / 1e9,
+		"type":        "meta",
+		"detail_type": detailType,
+		"sub_type":    "",
+	}
+}
+
+// oneBotV12Base 构建 OneBot v12 事件的公共字段
+func oneBotV12Base(base BaseEvent, eventType, detailType, subType string) map[string]any {
+	return map[string]any{
+		"id":          base.EventId,
+		"time":        float64(base.Time),
+		"type":        eventType,
+		"detail_type": detailType,
+		"sub_type":    subType,
+		"self":        oneBotV12Self(base.BotUin),
+	}
+}
+
+// uinString 将Uin转换为 v12 使用的字符串ID
+func uinString(uin uint32) string {
+	return strconv.FormatUint(uint64(uin), 10)
+}
+
+// messageIdString 将消息ID转换为 v12 使用的字符串ID
+func messageIdString(id int32) string {
+	return strconv.FormatInt(int64(id), 10)
+}
+
+// oneBotV12Segments 将CryoMessage转换为 OneBot v12 的消息段数组，媒体文件会被放入文件缓存中
+func oneBotV12Segments(s *OneBotServer, msg CryoMessage, selfUin uint32, isGroup bool, peerUin uint32) []OneBotSegment {
+	segments := make([]OneBotSegment, 0, len(msg.Elements))
+	file := func(segmentType, name, url string) {
+		id := s.files.store(oneBotFile{Name: name, Url: url})
+		segments = append(segments, OneBotSegment{Type: segmentType, Data: map[string]any{"file_id": id}})
+	}
+	for _, element := range msg.Elements {
+		switch e := element.(type) {
+		case *TextElement:
+			segments = append(segments, OneBotSegment{Type: "text", Data: map[string]any{"text": e.Content}})
+		case *AtElement:
+			if e.TargetUin == 0 {
+				segments = append(segments, OneBotSegment{Type: "mention_all", Data: map[string]any{}})
+			} else {
+				segments = append(segments, OneBotSegment{Type: "mention", Data: map[string]any{"user_id": uinString(e.TargetUin)}})
+			}
+		case *FaceElement:
+			segments = append(segments, OneBotSegment{Type: "qq.face", Data: map[string]any{"id": int64(e.FaceID)}})
+		case *ReplyElement:
+			id := OneBotMessageId(selfUin, isGroup, peerUin, e.ReplySeq)
+			segments = append(segments, OneBotSegment{Type: "reply", Data: map[string]any{"message_id": messageIdString(id), "user_id": uinString(e.SenderUin)}})
+		case *ImageElement:
+			file("image", e.ImageID, e.URL)
+		case *VoiceElement:
+			file("voice", e.Name, e.URL)
+		case *ShortVideoElement:
+			file("video", e.Name, e.URL)
+		case *FileElement:
+			file("file", e.FileName, e.FileURL)
+		case *LightAppElement:
+			segments = append(segments, OneBotSegment{Type: "qq.json", Data: map[string]any{"data": e.Content}})
+		case *XMLElement:
+			segments = append(segments, OneBotSegment{Type: "qq.xml", Data: map[string]any{"data": e.Content}})
+		case *ForwardMessageElement:
+			segments = append(segments, OneBotSegment{Type: "qq.forward", Data: map[string]any{"id": e.ResID}})
+		case *MarketFaceElement:
+			segments = append(segments, OneBotSegment{Type: "text", Data: map[string]any{"text": e.Summary}})
+		}
+	}
+	return segments
+}
+
+// oneBotV12Event 将cryobot的事件转换为 OneBot v12 的事件，无法转换的事件返回nil
+func oneBotV12Event(s *OneBotServer, event CryoEvent) map[string]any {
+	base := event.GetBaseEvent()
+	switch e := event.(type) {
+	case PrivateMessageEvent, GroupMessageEvent, TempMessageEvent:
+		record := s.messages.recordMessageEvent(e.(CryoMessageEvent))
+		m := e.(CryoMessageEvent).GetMessageEvent()
+		var result map[string]any
+		switch {
+		case record.IsGroup:
+			result = oneBotV12Base(base, "message", "group", "")
+			result["group_id"] = uinString(m.GroupUin)
+			result["qq.card"] = m.SenderCardname
+		case record.IsTemp:
+			result = oneBotV12Base(base, "message", "private", "qq.temp")
+			result["qq.group_id"] = uinString(m.GroupUin)
+		default:
+			result = oneBotV12Base(base, "message", "private", "")
+		}
+		result["message_id"] = messageIdString(record.Id)
+		result["message"] = oneBotV12Segments(s, m.MessageElements, record.SelfUin, record.IsGroup, record.PeerUin)
+		result["alt_message"] = m.MessageElements.ToString()
+		result["user_id"] = uinString(m.SenderUin)
+		result["qq.nickname"] = m.SenderNickname
+		return result
+	case NewFriendEvent:
+		result := oneBotV12Base(base, "notice", "friend_increase", "")
+		result["user_id"] = uinString(e.Uin)
+		return result
+	case FriendRecallEvent:
+		result := oneBotV12Base(base, "notice", "private_message_delete", "")
+		result["message_id"] = messageIdString(OneBotMessageId(base.BotUin, false, e.Uin, uint32(e.Seqence)))
+		result["user_id"] = uinString(e.Uin)
+		return result
+	case GroupRecallEvent:
+		subType := "delete"
+		if e.OperatorUin == e.SenderUin {
+			subType = "recall"
+		}
+		result := oneBotV12Base(base, "notice", "group_message_delete", subType)
+		result["group_id"] = uinString(e.GroupUin)
+		result["message_id"] = messageIdString(OneBotMessageId(base.BotUin, true, e.GroupUin, uint32(e.Seqence)))
+		result["user_id"] = uinString(e.SenderUin)
+		result["operator_id"] = uinString(e.OperatorUin)
+		return result
+	case GroupMemberIncreaseEvent:
+		subType := "join"
+		if e.InviterUin != 0 {
+			subType = "invite"
+		}
+		result := oneBotV12Base(base, "notice", "group_member_increase", subType)
+		result["group_id"] = uinString(e.GroupUin)
+		result["user_id"] = uinString(e.Uin)
+		result["operator_id"] = uinString(e.InviterUin)
+		return result
+	case GroupMemberDecreaseEvent:
+		subType := "leave"
+		if e.IsSelf {
+			subType = "kick"
+		}
+		result := oneBotV12Base(base, "notice", "group_member_decrease", subType)
+		result["group_id"] = uinString(e.GroupUin)
+		result["user_id"] = uinString(e.Uin)
+		result["operator_id"] = ""
+		return result
+	case FriendRenameEvent:
+		result := oneBotV12Base(base, "notice", "qq.friend_rename", "")
+		result["user_id"] = uinString(e.Uin)
+		result["qq.nickname"] = e.Nickname
+		result["qq.is_self"] = e.IsSelf
+		return result
+	case FriendPokeEvent:
+		result := oneBotV12Base(base, "notice", "qq.poke", "")
+		result["user_id"] = uinString(e.SenderUin)
+		result["qq.target_id"] = uinString(e.TargetUin)
+		return result
+	case GroupMemberPermissionUpdatedEvent:
+		subType := "unset"
+		if e.IsAdmin {
+			subType = "set"
+		}
+		result := oneBotV12Base(base, "notice", "qq.group_admin", subType)
+		result["group_id"] = uinString(e.GroupUin)
+		result["user_id"] = uinString(e.Uin)
+		return result
+	case GroupMuteEvent:
+		subType := "lift_ban"
+		if e.Duration > 0 {
+			subType = "ban"
+		}
+		result := oneBotV12Base(base, "notice", "qq.group_ban", subType)
+		result["group_id"] = uinString(e.GroupUin)
+		result["user_id"] = uinString(e.TargetUin)
+		result["operator_id"] = uinString(e.OperatorUin)
+		result["qq.duration"] = int64(e.Duration)
+		return result
+	case GroupNameUpdatedEvent:
+		result := oneBotV12Base(base, "notice", "qq.group_name_update", "")
+		result["group_id"] = uinString(e.GroupUin)
+		result["operator_id"] = uinString(e.Uin)
+		result["qq.group_name"] = e.NewName
+		return result
+	case GroupMemberSpecialTitleUpdated:
+		result := oneBotV12Base(base, "notice", "qq.group_title", "")
+		result["group_id"] = uinString(e.GroupUin)
+		result["user_id"] = uinString(e.Uin)
+		result["qq.title"] = e.NewTitle
+		return result
+	case GroupDigestEvent:
+		subType := "add"
+		if e.IsRemove {
+			subType = "delete"
+		}
+		result := oneBotV12Base(base, "notice", "qq.essence", subType)
+		result["group_id"] = uinString(e.GroupUin)
+		result["user_id"] = uinString(e.SenderUin)
+		result["operator_id"] = uinString(e.OperatorUin)
+		return result
+	case GroupReactionEvent:
+		result := oneBotV12Base(base, "notice", "qq.group_reaction", "")
+		result["group_id"] = uinString(e.GroupUin)
+		result["user_id"] = uinString(e.Uin)
+		result["message_id"] = messageIdString(OneBotMessageId(base.BotUin, true, e.GroupUin, e.TargetSeq))
+		result["qq.code"] = e.Code
+		result["qq.count"] = int64(e.Count)
+		result["qq.is_add"] = e.IsAdd
+		return result
+	case NewFriendRequestEvent:
+		result := oneBotV12Base(base, "request", "qq.friend", "")
+		result["user_id"] = uinString(e.Uin)
+		result["qq.comment"] = e.Message
+		result["qq.flag"] = e.Uid
+		return result
+	case GroupMemberJoinRequestEvent:
+		result := oneBotV12Base(base, "request", "qq.group", "add")
+		result["group_id"] = uinString(e.GroupUin)
+		result["user_id"] = uinString(e.SenderUin)
+		result["qq.comment"] = e.Answer
+		result["qq.flag"] = oneBotRequestFlag(e.GroupUin, e.RequestSeqence, 1)
+		return result
+	case GroupInviteEvent:
+		result := oneBotV12Base(base, "request", "qq.group", "invite")
+		result["group_id"] = uinString(e.GroupUin)
+		result["user_id"] = uinString(e.InviterUin)
+		result["qq.flag"] = oneBotRequestFlag(e.GroupUin, e.RequestSeqence, 2)
+		return result
+	case BotConnectedEvent, BotDisconnectedEvent:
+		result := oneBotV12Meta("status_update")
+		result["status"] = oneBotV12Status(s.bot)
+		return result
+	}
+	return nil
+}
+
+// NewOneBotV12Server 创建一个 OneBot v12 实现端，调用 Start 后开始工作
+func NewOneBotV12Server(bot *Bot, config OneBotConfig) *OneBotServer {
+	return newOneBotServer(bot, config, oneBotV12Protocol{})
+}
+
+// StartOneBotV12 使用指定的配置启动 OneBot v12 实现端
+func (b *Bot) StartOneBotV12(config OneBotConfig) (*OneBotServer, error) {
+	s := NewOneBotV12Server(b, config)
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	b.oneBotServers = append(b.oneBotServers, s)
+	return s, nil
+}
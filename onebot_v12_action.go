@@ -0,0 +1,359 @@
+package cryobot
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/LagrangeDev/LagrangeGo/client/entity"
+	lagrangeMessage "github.com/LagrangeDev/LagrangeGo/message"
+	"sort"
+)
+
+// OneBot v12 的动作实现，标准动作之外的QQ特有功能使用 qq. 前缀的扩展动作提供
+
+// oneBotV12Actions 支持的 OneBot v12 动作
+var oneBotV12Actions = map[string]oneBotAction{
+	"send_message":              oneBotV12SendMessage,
+	"delete_message":            oneBotV12DeleteMessage,
+	"get_self_info":             oneBotV12GetSelfInfo,
+	"get_user_info":             oneBotV12GetUserInfo,
+	"get_friend_list":           oneBotV12GetFriendList,
+	"get_group_info":            oneBotV12GetGroupInfo,
+	"get_group_list":            oneBotV12GetGroupList,
+	"get_group_member_info":     oneBotV12GetGroupMemberInfo,
+	"get_group_member_list":     oneBotV12GetGroupMemberList,
+	"set_group_name":            oneBotV11SetGroupName,
+	"leave_group":               oneBotV11SetGroupLeave,
+	"upload_file":               oneBotV12UploadFile,
+	"get_file":                  oneBotV12GetFile,
+	"get_status":                oneBotV12GetStatus,
+	"get_version":               oneBotV12GetVersion,
+	"qq.kick_group_member":      oneBotV11SetGroupKick,
+	"qq.ban_group_member":       oneBotV11SetGroupBan,
+	"qq.set_group_whole_ban":    oneBotV11SetGroupWholeBan,
+	"qq.set_group_admin":        oneBotV11SetGroupAdmin,
+	"qq.set_group_card":         oneBotV11SetGroupCard,
+	"qq.set_group_title":        oneBotV11SetGroupSpecialTitle,
+	"qq.set_friend_add_request": oneBotV11SetFriendAddRequest,
+	"qq.set_group_add_request":  oneBotV11SetGroupAddRequest,
+	"qq.poke":                   oneBotV12Poke,
+	"qq.send_like":              oneBotV11SendLike,
+}
+
+func init() {
+	// get_supported_actions 需要读取动作表本身，因此在初始化时单独注册
+	oneBotV12Actions["get_supported_actions"] = oneBotV12GetSupportedActions
+}
+
+// oneBotV12Message 将 OneBot v12 的消息段数组转换为CryoMessage，媒体消息段需要使用 upload_file 得到的文件ID
+func oneBotV12Message(s *OneBotServer, raw any) (*CryoMessage, error) {
+	var segments []OneBotSegment
+	switch v := raw.(type) {
+	case map[string]any:
+		segments = []OneBotSegment{segmentFromMap(v)}
+	case []any:
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok {
+				segments = append(segments, segmentFromMap(m))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("无效的消息格式")
+	}
+
+	msg := BuildMessage()
+	for _, segment := range segments {
+		data := oneBotParams(segment.Data)
+		switch segment.Type {
+		case "text":
+			msg.Text(data.getString("text"))
+		case "mention":
+			uin, ok := data.getUint32("user_id")
+			if !ok {
+				return nil, fmt.Errorf("无效的提及对象：%s", data.getString("user_id"))
+			}
+			msg.At(uin)
+		case "mention_all":
+			msg.At(0)
+		case "qq.face":
+			id, ok := data.getUint32("id")
+			if !ok {
+				return nil, fmt.Errorf("无效的表情ID")
+			}
+			msg.Face(id)
+		case "reply":
+			id, _ := data.getInt64("message_id")
+			record, ok := s.messages.get(int32(id))
+			if !ok {
+				return nil, fmt.Errorf("找不到被回复的消息：%d", id)
+			}
+			msg.Elements = append(msg.Elements, record.replyElement())
+		case "image", "voice":
+			fileId := data.getString("file_id")
+			file, ok := s.files.get(fileId)
+			if !ok {
+				return nil, fmt.Errorf("找不到文件：%s", fileId)
+			}
+			media, err := file.load(s.media)
+			if err != nil {
+				return nil, fmt.Errorf("加载媒体文件时出现错误：%v", err)
+			}
+			if segment.Type == "image" {
+				msg.Image(media)
+			} else {
+				msg.Elements = append(msg.Elements, &VoiceElement{*lagrangeMessage.NewRecord(media)})
+			}
+		case "qq.json":
+			msg.Elements = append(msg.Elements, &LightAppElement{*lagrangeMessage.NewLightApp(data.getString("data"))})
+		case "qq.xml":
+			msg.Elements = append(msg.Elements, &XMLElement{*lagrangeMessage.NewXML(data.getString("data"))})
+		default:
+			s.log().Debugf("[OneBot] 忽略了不支持的消息段：%s", segment.Type)
+		}
+	}
+	if len(msg.Elements) == 0 {
+		return nil, fmt.Errorf("消息内容为空")
+	}
+	return msg, nil
+}
+
+// oneBotV12SendMessage 发送消息，qq.temp 类型的消息通过 qq.group_id 指定的群发起临时会话
+func oneBotV12SendMessage(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	msg, err := oneBotV12Message(s, p["message"])
+	if err != nil {
+		return oneBotFailed(oneBotStatusBadParam, "%v", err)
+	}
+	messageType := "private"
+	params := oneBotParams{}
+	switch detailType := p.getString("detail_type"); detailType {
+	case "group":
+		messageType = "group"
+		params["group_id"] = p["group_id"]
+	case "private":
+		params["user_id"] = p["user_id"]
+	case "qq.temp":
+		params["user_id"] = p["user_id"]
+		params["group_id"] = p["qq.group_id"]
+	default:
+		return oneBotFailed(oneBotStatusBadParam, "无效的消息类型：%s", detailType)
+	}
+	record, bad := oneBotSendMessage(c, messageType, params, msg)
+	if bad != nil {
+		return *bad
+	}
+	s.messages.record(record)
+	return oneBotOk(map[string]any{"message_id": messageIdString(record.Id), "time": float64(record.Time)})
+}
+
+func oneBotV12DeleteMessage(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotV11DeleteMsg(s, c, p)
+}
+
+func oneBotV12GetSelfInfo(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotOk(map[string]any{
+		"user_id":          uinString(uint32(c.Uin)),
+		"user_name":        c.GetNickname(),
+		"user_displayname": "",
+	})
+}
+
+func oneBotV12GetUserInfo(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	user, err := c.GetUserInfo(userUin)
+	if err != nil {
+		return actionError(err)
+	}
+	return oneBotOk(oneBotV12User(user))
+}
+
+// oneBotV12User 将用户信息转换为 OneBot v12 的表示
+func oneBotV12User(user *entity.User) map[string]any {
+	return map[string]any{
+		"user_id":          uinString(user.Uin),
+		"user_name":        user.Nickname,
+		"user_displayname": "",
+		"user_remark":      user.Remarks,
+		"qq.sex":           oneBotV11Sex(user.Sex),
+		"qq.age":           int64(user.Age),
+		"qq.level":         int64(user.Level),
+	}
+}
+
+func oneBotV12GetFriendList(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	friends, err := c.GetFriendList(p.getBool("qq.no_cache", false))
+	if err != nil {
+		return actionError(err)
+	}
+	result := make([]map[string]any, 0, len(friends))
+	for _, friend := range friends {
+		result = append(result, oneBotV12User(friend))
+	}
+	return oneBotOk(result)
+}
+
+// oneBotV12Group 将群信息转换为 OneBot v12 的表示
+func oneBotV12Group(group *entity.Group) map[string]any {
+	return map[string]any{
+		"group_id":            uinString(group.GroupUin),
+		"group_name":          group.GroupName,
+		"qq.member_count":     int64(group.MemberCount),
+		"qq.max_member_count": int64(group.MaxMember),
+	}
+}
+
+func oneBotV12GetGroupInfo(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	group, err := c.GetGroupInfo(groupUin, p.getBool("qq.no_cache", false))
+	if err != nil {
+		return actionError(err)
+	}
+	return oneBotOk(oneBotV12Group(group))
+}
+
+func oneBotV12GetGroupList(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groups, err := c.GetGroupList(p.getBool("qq.no_cache", false))
+	if err != nil {
+		return actionError(err)
+	}
+	result := make([]map[string]any, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, oneBotV12Group(group))
+	}
+	return oneBotOk(result)
+}
+
+// oneBotV12Member 将群成员信息转换为 OneBot v12 的表示
+func oneBotV12Member(member *entity.GroupMember) map[string]any {
+	role := "member"
+	switch member.Permission {
+	case entity.Owner:
+		role = "owner"
+	case entity.Admin:
+		role = "admin"
+	}
+	return map[string]any{
+		"user_id":           uinString(member.Uin),
+		"user_name":         member.Nickname,
+		"user_displayname":  member.MemberCard,
+		"qq.role":           role,
+		"qq.title":          member.SpecialTitle,
+		"qq.join_time":      int64(member.JoinTime),
+		"qq.last_sent_time": int64(member.LastMsgTime),
+		"qq.level":          int64(member.GroupLevel),
+	}
+}
+
+func oneBotV12GetGroupMemberInfo(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	member, err := c.GetGroupMemberInfo(groupUin, userUin, p.getBool("qq.no_cache", false))
+	if err != nil {
+		return actionError(err)
+	}
+	return oneBotOk(oneBotV12Member(member))
+}
+
+func oneBotV12GetGroupMemberList(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	groupUin, bad := requireUint32(p, "group_id")
+	if bad != nil {
+		return *bad
+	}
+	members, err := c.GetGroupMemberList(groupUin, p.getBool("qq.no_cache", false))
+	if err != nil {
+		return actionError(err)
+	}
+	result := make([]map[string]any, 0, len(members))
+	for _, member := range members {
+		result = append(result, oneBotV12Member(member))
+	}
+	return oneBotOk(result)
+}
+
+// oneBotV12UploadFile 上传文件，文件可以通过 url、path 或 base64 编码的 data 提供，返回文件ID
+func oneBotV12UploadFile(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	file := oneBotFile{Name: p.getString("name")}
+	switch uploadType := p.getString("type"); uploadType {
+	case "url":
+		file.Url = p.getString("url")
+	case "path":
+		file.Path = p.getString("path")
+	case "data":
+		data, err := base64.StdEncoding.DecodeString(p.getString("data"))
+		if err != nil {
+			return oneBotFailed(oneBotStatusBadParam, "无效的文件数据：%v", err)
+		}
+		file.Data = data
+	default:
+		return oneBotFailed(oneBotStatusBadParam, "无效的上传方式：%s", uploadType)
+	}
+	return oneBotOk(map[string]any{"file_id": s.files.store(file)})
+}
+
+// oneBotV12GetFile 获取文件，type 为 data 时会读取文件的内容
+func oneBotV12GetFile(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	fileId := p.getString("file_id")
+	file, ok := s.files.get(fileId)
+	if !ok {
+		return oneBotFailed(oneBotStatusFailed, "找不到文件：%s", fileId)
+	}
+	result := map[string]any{"name": file.Name}
+	switch getType := p.getString("type"); getType {
+	case "url":
+		if file.Url == "" {
+			return oneBotFailed(oneBotStatusFailed, "文件没有可用的URL：%s", fileId)
+		}
+		result["url"] = file.Url
+	case "path":
+		if file.Path == "" {
+			return oneBotFailed(oneBotStatusFailed, "文件没有可用的路径：%s", fileId)
+		}
+		result["path"] = file.Path
+	case "data":
+		data, err := file.load(s.media)
+		if err != nil {
+			return actionError(err)
+		}
+		result["data"] = base64.StdEncoding.EncodeToString(data)
+	default:
+		return oneBotFailed(oneBotStatusBadParam, "无效的获取方式：%s", getType)
+	}
+	return oneBotOk(result)
+}
+
+func oneBotV12GetStatus(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotOk(oneBotV12Status(s.bot))
+}
+
+func oneBotV12GetVersion(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	return oneBotOk(oneBotV12Version())
+}
+
+func oneBotV12GetSupportedActions(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	actions := make([]string, 0, len(oneBotV12Actions))
+	for name := range oneBotV12Actions {
+		actions = append(actions, name)
+	}
+	sort.Strings(actions)
+	return oneBotOk(actions)
+}
+
+// oneBotV12Poke 戳一戳，不传入 group_id 时戳好友
+func oneBotV12Poke(s *OneBotServer, c *CryoClient, p oneBotParams) oneBotResult {
+	userUin, bad := requireUint32(p, "user_id")
+	if bad != nil {
+		return *bad
+	}
+	groupUin, _ := p.getUint32("group_id")
+	return okOrError(c.Poke(groupUin, userUin))
+}
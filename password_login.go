@@ -0,0 +1,447 @@
+package cryobot
+
+import (
+	"bufio"
+	"crypto/md5"
+	"fmt"
+	"github.com/LagrangeDev/LagrangeGo/client"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 账号密码登录
+//
+// 密码登录时可能需要完成滑块验证码或新设备验证，这些步骤会以 LoginVerification 的形式交给所有的登录验证器，同时发布 LoginVerificationEvent
+// 内置的终端验证器会在终端中输出验证链接并读取输入，Web后台也可以完成验证，也可以实现 LoginVerifier 接口自定义验证方式
+
+// loginVerificationTimeout 等待完成登录验证的超时时间
+const loginVerificationTimeout = 5 * time.Minute
+
+// LoginVerificationKind 登录验证的类型
+type LoginVerificationKind string
+
+const (
+	CaptchaVerification    LoginVerificationKind = "captcha"     // 滑块验证码，需要提交验证后得到的 ticket 和 randstr
+	DeviceLockVerification LoginVerificationKind = "device_lock" // 新设备验证，使用手机QQ扫描或打开验证链接后会自动继续登录
+)
+
+// LoginVerification 密码登录过程中需要完成的一次验证
+type LoginVerification struct {
+	Id        string                // 登录使用的客户端ID
+	Uin       int                   // 登录的账号
+	Kind      LoginVerificationKind // 验证的类型
+	Url       string                // 验证链接
+	CreatedAt time.Time             // 开始验证的时间
+
+	once   sync.Once
+	result chan [2]string
+	done   chan struct{} // 验证完成、取消或超时后关闭
+}
+
+// SubmitCaptcha 提交滑块验证码的结果，验证已经完成或不是滑块验证码时返回false
+func (v *LoginVerification) SubmitCaptcha(ticket, randStr string) bool {
+	if v.Kind != CaptchaVerification {
+		return false
+	}
+	ok := false
+	v.once.Do(func() {
+		v.result <- [2]string{ticket, randStr}
+		close(v.done)
+		ok = true
+	})
+	return ok
+}
+
+// Cancel 放弃验证，正在进行的密码登录会失败
+func (v *LoginVerification) Cancel() {
+	v.once.Do(func() {
+		close(v.result)
+		close(v.done)
+	})
+}
+
+// waitCaptcha 等待滑块验证码的结果
+func (v *LoginVerification) waitCaptcha() (ticket, randStr string, ok bool) {
+	select {
+	case result, ok := <-v.result:
+		return result[0], result[1], ok
+	case <-time.After(loginVerificationTimeout):
+		v.Cancel()
+		return "", "", false
+	}
+}
+
+// LoginVerifier 登录验证器，负责把验证交给操作者，可以异步地调用 SubmitCaptcha 或 Cancel 完成验证
+type LoginVerifier interface {
+	Verify(v *LoginVerification)
+}
+
+// LoginVerifierFunc 将一个函数包装为登录验证器
+type LoginVerifierFunc func(v *LoginVerification)
+
+func (f LoginVerifierFunc) Verify(v *LoginVerification) {
+	f(v)
+}
+
+// stdinLines 标准输入中读取到的行，由唯一的读取协程写入
+var stdinLines = make(chan string)
+
+var stdinOnce sync.Once
+
+// readStdinLine 等待标准输入中的下一行，验证在等待期间结束时返回 false
+//
+// 标准输入只由一个协程读取，没有验证在等待输入时读取到的行会被丢弃，超时或被取消的验证不会占用之后的输入
+func readStdinLine(done <-chan struct{}) (string, bool) {
+	stdinOnce.Do(func() {
+		go func() {
+			reader := bufio.NewReader(os.Stdin)
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil && line == "" {
+					return
+				}
+				select {
+				case stdinLines <- strings.TrimSpace(line):
+				default:
+				}
+			}
+		}()
+	})
+	select {
+	case line := <-stdinLines:
+		return line, true
+	case <-done:
+		return "", false
+	}
+}
+
+// TerminalLoginVerifier 在终端中输出验证链接，并从标准输入读取滑块验证码的结果
+type TerminalLoginVerifier struct{}
+
+func (TerminalLoginVerifier) Verify(v *LoginVerification) {
+	switch v.Kind {
+	case CaptchaVerification:
+		fmt.Printf("账号 %d 需要完成滑块验证，请在浏览器中打开以下链接：\n%s\n", v.Uin, v.Url)
+		fmt.Println("完成验证后，在开发者工具中找到 cap_union_new_verify 请求的响应，依次输入其中的 ticket 和 randstr")
+		go func() {
+			ticket, ok := readStdinLine(v.done)
+			if !ok {
+				return
+			}
+			randStr, ok := readStdinLine(v.done)
+			if !ok {
+				return
+			}
+			v.SubmitCaptcha(ticket, randStr)
+		}()
+	case DeviceLockVerification:
+		fmt.Printf("账号 %d 需要进行新设备验证，请使用手机QQ扫描以下二维码或打开链接：\n", v.Uin)
+		fmt.Println(*GetQRCodeString(v.Url)) // 注意使用了指针
+		fmt.Println(v.Url)
+	}
+}
+
+// PasswordLoginState 密码登录的状态
+type PasswordLoginState string
+
+const (
+	PasswordLoginRunning   PasswordLoginState = "running"   // 正在登录
+	PasswordLoginVerifying PasswordLoginState = "verifying" // 等待完成登录验证
+	PasswordLoginSuccess   PasswordLoginState = "success"   // 登录成功
+	PasswordLoginFailed    PasswordLoginState = "failed"    // 登录失败
+)
+
+// PasswordLogin 一次账号密码登录，记录了登录状态和当前需要完成的验证
+type PasswordLogin struct {
+	Id        string    // 登录使用的客户端ID
+	Uin       int       // 登录的账号
+	CreatedAt time.Time // 开始登录的时间
+
+	mutex        sync.RWMutex
+	state        PasswordLoginState
+	message      string
+	verification *LoginVerification
+	client       *CryoClient
+	verifiers    []LoginVerifier
+	done         chan struct{}
+}
+
+// GetState 返回密码登录当前的状态
+func (l *PasswordLogin) GetState() PasswordLoginState {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.state
+}
+
+// GetMessage 返回登录失败的原因
+func (l *PasswordLogin) GetMessage() string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.message
+}
+
+// GetVerification 返回当前需要完成的验证，不需要验证时返回nil
+func (l *PasswordLogin) GetVerification() *LoginVerification {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.verification
+}
+
+// GetClient 返回登录使用的客户端
+func (l *PasswordLogin) GetClient() *CryoClient {
+	return l.client
+}
+
+// Done 返回一个在登录结束时关闭的通道
+func (l *PasswordLogin) Done() <-chan struct{} {
+	return l.done
+}
+
+// fail 将登录标记为失败
+func (l *PasswordLogin) fail(format string, args ...any) bool {
+	message := fmt.Sprintf(format, args...)
+	l.client.log().Errorf("账号 %d 密码登录失败：%s", l.Uin, message)
+	l.client.warnIfSignUnavailable()
+	l.mutex.Lock()
+	l.state = PasswordLoginFailed
+	l.message = message
+	l.verification = nil
+	l.mutex.Unlock()
+	return false
+}
+
+// verify 创建一次登录验证并交给所有的登录验证器
+func (l *PasswordLogin) verify(kind LoginVerificationKind, verifyUrl string) *LoginVerification {
+	v := &LoginVerification{
+		Id:        l.Id,
+		Uin:       l.Uin,
+		Kind:      kind,
+		Url:       verifyUrl,
+		CreatedAt: time.Now(),
+		result:    make(chan [2]string, 1),
+		done:      make(chan struct{}),
+	}
+	l.mutex.Lock()
+	l.state = PasswordLoginVerifying
+	l.verification = v
+	l.mutex.Unlock()
+	SendLoginVerificationEvent(l.client, v)
+	for _, verifier := range l.verifiers {
+		verifier.Verify(v)
+	}
+	return v
+}
+
+// run 进行密码登录，按照服务器的要求完成滑块验证码和新设备验证
+func (l *PasswordLogin) run() (ok bool) {
+	defer close(l.done)
+	c := l.client
+	defer func() { c.recordLogin("password", ok) }()
+	res, err := c.Client.PasswordLogin()
+	// 每一轮最多完成一次验证，避免服务器反复要求验证时无限循环
+	for range 3 {
+		if res == nil {
+			return l.fail("%v", err)
+		}
+		if res.Success {
+			if err != nil {
+				return l.fail("%v", err)
+			}
+			return l.succeed()
+		}
+		switch res.Error {
+		case client.SliderNeededError:
+			v := l.verify(CaptchaVerification, res.VerifyURL)
+			ticket, randStr, ok := v.waitCaptcha()
+			if !ok {
+				return l.fail("没有完成滑块验证")
+			}
+			l.mutex.Lock()
+			l.state = PasswordLoginRunning
+			l.verification = nil
+			l.mutex.Unlock()
+			res, err = c.Client.SubmitCaptcha(ticket, randStr, captchaAid(res.VerifyURL))
+		case client.UnsafeDeviceError:
+			verifyUrl, err := c.Client.GetNewDeviceVerifyURL()
+			if err != nil {
+				return l.fail("获取新设备验证链接时出现错误：%v", err)
+			}
+			l.verify(DeviceLockVerification, verifyUrl)
+			if err := c.Client.NewDeviceVerify(verifyUrl); err != nil {
+				return l.fail("新设备验证失败：%v", err)
+			}
+			return l.succeed()
+		default:
+			if err != nil {
+				return l.fail("%v", err)
+			}
+			return l.fail("%s", res.ErrorMessage)
+		}
+	}
+	return l.fail("验证次数过多")
+}
+
+// succeed 完成客户端的登录后处理并将登录标记为成功
+func (l *PasswordLogin) succeed() bool {
+	l.client.AfterLogin()
+	l.mutex.Lock()
+	l.state = PasswordLoginSuccess
+	l.verification = nil
+	l.mutex.Unlock()
+	return true
+}
+
+// captchaAid 从滑块验证码的链接中取出提交验证结果时需要的 sid 参数
+func captchaAid(captchaUrl string) string {
+	u, err := url.Parse(captchaUrl)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("sid")
+}
+
+// newPasswordLogin 为客户端创建一次密码登录
+func newPasswordLogin(c *CryoClient, verifiers []LoginVerifier) *PasswordLogin {
+	return &PasswordLogin{
+		Id:        c.Id,
+		Uin:       c.Uin,
+		CreatedAt: time.Now(),
+		state:     PasswordLoginRunning,
+		client:    c,
+		verifiers: verifiers,
+		done:      make(chan struct{}),
+	}
+}
+
+// UsePassword 设置客户端登录使用的账号和密码，会重新创建底层的协议客户端
+//
+// 配置中为该账号单独指定了平台和协议版本时会切换到指定的版本
+func (c *CryoClient) UsePassword(uin int, password string) {
+	if platform, version := c.config().Protocol.Select(uin); platform != c.Platform || version != c.Version {
+		if err := c.SetProtocol(platform, version); err != nil {
+			c.log().Errorf("账号 %d 指定的协议版本不可用：%v", uin, err)
+		}
+	}
+	c.usePasswordMD5(uin, md5.Sum([]byte(password)))
+}
+
+// usePasswordMD5 使用账号和密码的MD5重新创建底层的协议客户端
+func (c *CryoClient) usePasswordMD5(uin int, passwordMD5 [16]byte) {
+	c.Uin = uin
+	c.passwordMD5 = passwordMD5
+	c.newQQClient(uint32(uin), passwordMD5)
+}
+
+// HasPassword 返回客户端是否设置了可以用于密码登录的密码
+func (c *CryoClient) HasPassword() bool {
+	return c.Uin != 0 && c.passwordMD5 != [16]byte{}
+}
+
+// PasswordLogin 使用 UsePassword 设置的账号密码登录
+//
+// 需要滑块验证或新设备验证时会交给Bot上添加的登录验证器，没有所属的Bot或没有添加验证器时在终端中完成验证
+func (c *CryoClient) PasswordLogin() bool {
+	if !c.HasPassword() {
+		c.log().Error("没有设置登录使用的账号和密码")
+		return false
+	}
+	c.log().Infof("正在使用密码登录 %d...", c.Uin)
+	verifiers := []LoginVerifier{TerminalLoginVerifier{}}
+	if c.bot != nil {
+		verifiers = c.bot.getLoginVerifiers()
+	}
+	return newPasswordLogin(c, verifiers).run()
+}
+
+// AddLoginVerifier 添加一个登录验证器，阻塞式的密码登录会使用所有已添加的验证器
+func (b *Bot) AddLoginVerifier(v LoginVerifier) {
+	b.loginVerifiers = append(b.loginVerifiers, v)
+}
+
+// getLoginVerifiers 返回阻塞式密码登录使用的验证器，没有添加任何验证器时在终端中完成验证
+func (b *Bot) getLoginVerifiers() []LoginVerifier {
+	if len(b.loginVerifiers) == 0 {
+		return []LoginVerifier{TerminalLoginVerifier{}}
+	}
+	return b.loginVerifiers
+}
+
+// ConnectPasswordClient 使用账号密码连接一个新的bot客户端
+//
+// 设置了 CredentialKey 或环境变量 CRYOBOT_CREDENTIAL_KEY 时，密码会被加密后与客户端信息一起保存，签名失效时可以自动使用密码重新登录
+func (b *Bot) ConnectPasswordClient(uin int, password string) bool {
+	if b.GetClientByUin(uin) != nil {
+		b.log().Warnf("账号 %d 已经连接", uin)
+		return false
+	}
+	c := NewCryoClient(b)
+	c.Init()
+	c.UsePassword(uin, password)
+	b.log().Infof("%s[Cryo] 正在连接 %s：%s (%d)", lavender, c.GetDisplayName(), c.Id, c.Uin)
+	return b.connectClient(c, c.PasswordLogin)
+}
+
+// StartPasswordLogin 创建一个新的客户端并在后台使用账号密码登录，登录成功的客户端会被加入已连接的客户端集合
+//
+// 可以传入登录验证器，没有传入时不会使用Bot上添加的验证器，调用方需要自行通过 GetVerification 或 LoginVerificationEvent 完成验证
+func (b *Bot) StartPasswordLogin(uin int, password string, verifiers ...LoginVerifier) (*PasswordLogin, error) {
+	if uin <= 0 || password == "" {
+		return nil, fmt.Errorf("账号和密码不能为空")
+	}
+	if b.GetClientByUin(uin) != nil {
+		return nil, fmt.Errorf("账号 %d 已经连接", uin)
+	}
+	c := NewCryoClient(b)
+	c.Init()
+	c.UsePassword(uin, password)
+	login := newPasswordLogin(c, verifiers)
+	b.loginsMutex.Lock()
+	if b.passwordLogins == nil {
+		b.passwordLogins = make(map[string]*PasswordLogin)
+	}
+	// 清理已经结束的登录
+	for id, l := range b.passwordLogins {
+		if state := l.GetState(); state == PasswordLoginSuccess || state == PasswordLoginFailed {
+			delete(b.passwordLogins, id)
+		}
+	}
+	b.passwordLogins[login.Id] = login
+	b.loginsMutex.Unlock()
+
+	b.log().Infof("%s[Cryo] 正在后台使用密码登录 %d", lavender, uin)
+	go b.connectClient(c, login.run)
+	return login, nil
+}
+
+// GetPasswordLogin 获取指定ID的密码登录，已经结束的登录会在下一次开始密码登录时被清理
+func (b *Bot) GetPasswordLogin(id string) *PasswordLogin {
+	b.loginsMutex.Lock()
+	defer b.loginsMutex.Unlock()
+	return b.passwordLogins[id]
+}
+
+// passwordLoginData 将密码登录转换为Web后台返回的数据
+func passwordLoginData(login *PasswordLogin) map[string]any {
+	result := map[string]any{
+		"id":         login.Id,
+		"uin":        login.Uin,
+		"state":      login.GetState(),
+		"created_at": login.CreatedAt.Unix(),
+	}
+	if message := login.GetMessage(); message != "" {
+		result["message"] = message
+	}
+	if v := login.GetVerification(); v != nil {
+		result["verification"] = map[string]any{
+			"kind": v.Kind,
+			"url":  v.Url,
+		}
+	}
+	if login.GetState() == PasswordLoginSuccess {
+		result["nickname"] = login.GetClient().GetNickname()
+	}
+	return result
+}
@@ -13,39 +13,62 @@ import (
 
 var dumpspath = "dump"
 
-var pLogger = ProtocolLogger{}
+// ProtocolLogger LagrangeGo协议层使用的日志记录器
+type ProtocolLogger struct {
+	logger  Logger // 输出使用的日志记录器，为空时使用全局日志记录器
+	dumpDir string // 错误转储目录，为空时使用 dump
+}
 
-type ProtocolLogger struct{}
+// NewProtocolLogger 创建一个输出到指定日志记录器的协议日志记录器，可以传入错误转储的目录
+func NewProtocolLogger(l Logger, dumpDir ...string) ProtocolLogger {
+	p := ProtocolLogger{logger: l}
+	if len(dumpDir) > 0 {
+		p.dumpDir = dumpDir[0]
+	}
+	return p
+}
+
+// log 返回协议日志记录器输出使用的日志记录器
+func (p ProtocolLogger) log() Logger {
+	if p.logger != nil {
+		return p.logger
+	}
+	return GetLogger()
+}
 
 var fromProtocol = deepskyblue + "[Lagrange] "
 
 func (p ProtocolLogger) Info(format string, arg ...any) {
-	Infof(fromProtocol+format, arg...)
+	p.log().Infof(fromProtocol+format, arg...)
 }
 
 func (p ProtocolLogger) Warning(format string, arg ...any) {
-	Warnf(fromProtocol+format, arg...)
+	p.log().Warnf(fromProtocol+format, arg...)
 }
 
 func (p ProtocolLogger) Debug(format string, arg ...any) {
-	Debugf(fromProtocol+format, arg...)
+	p.log().Debugf(fromProtocol+format, arg...)
 }
 
 func (p ProtocolLogger) Error(format string, arg ...any) {
-	Errorf(fromProtocol+format, arg...)
+	p.log().Errorf(fromProtocol+format, arg...)
 }
 
 // Dump 输出当前日志记录器的状态
 func (p ProtocolLogger) Dump(data []byte, format string, arg ...any) {
 	message := fmt.Sprintf(format, arg...)
-	if _, err := os.Stat(dumpspath); err != nil {
-		err = os.MkdirAll(dumpspath, 0o755)
+	dumpDir := p.dumpDir
+	if dumpDir == "" {
+		dumpDir = dumpspath
+	}
+	if _, err := os.Stat(dumpDir); err != nil {
+		err = os.MkdirAll(dumpDir, 0o755)
 		if err != nil {
-			Errorf("出现错误 %v. 详细信息转储失败", message)
+			p.log().Errorf("出现错误 %v. 详细信息转储失败", message)
 			return
 		}
 	}
-	dumpFile := path.Join(dumpspath, fmt.Sprintf("%v.dump", time.Now().Unix()))
-	Errorf("出现错误 %v. 详细信息已转储至文件 %v 请连同日志提交给开发者处理", message, dumpFile)
+	dumpFile := path.Join(dumpDir, fmt.Sprintf("%v.dump", time.Now().Unix()))
+	p.log().Errorf("出现错误 %v. 详细信息已转储至文件 %v 请连同日志提交给开发者处理", message, dumpFile)
 	_ = os.WriteFile(dumpFile, data, 0o644)
 }
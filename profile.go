@@ -0,0 +1,143 @@
+package cryobot
+
+import (
+	"fmt"
+	"github.com/LagrangeDev/LagrangeGo/client"
+	"github.com/LagrangeDev/LagrangeGo/client/event"
+	uuid "github.com/satori/go.uuid"
+	"time"
+)
+
+// 客户端资料
+//
+// 客户端的 Nickname 是账号真实的QQ昵称，登录成功后从服务器同步，账号改名时自动更新
+// Alias 是在配置或运行时设置的显示别名，只用于日志和管理界面，不会修改QQ昵称
+// 两者都会随客户端信息一起保存，重新登录前也能显示正确的名称
+
+// GetNickname 返回账号的QQ昵称
+func (c *CryoClient) GetNickname() string {
+	c.profileMutex.RLock()
+	defer c.profileMutex.RUnlock()
+	return c.Nickname
+}
+
+// GetAlias 返回客户端的显示别名
+func (c *CryoClient) GetAlias() string {
+	c.profileMutex.RLock()
+	defer c.profileMutex.RUnlock()
+	return c.Alias
+}
+
+// GetAvatar 返回账号的头像地址
+func (c *CryoClient) GetAvatar() string {
+	c.profileMutex.RLock()
+	defer c.profileMutex.RUnlock()
+	return c.Avatar
+}
+
+// GetDisplayName 返回客户端用于显示的名称，依次使用别名、QQ昵称和QQ号
+func (c *CryoClient) GetDisplayName() string {
+	c.profileMutex.RLock()
+	alias, nickname := c.Alias, c.Nickname
+	c.profileMutex.RUnlock()
+	switch {
+	case alias != "":
+		return alias
+	case nickname != "":
+		return nickname
+	case c.Uin != 0:
+		return fmt.Sprintf("Bot%d", c.Uin)
+	}
+	return "Bot"
+}
+
+// SetAlias 设置客户端的显示别名，为空时显示QQ昵称，启用了客户端信息自动保存时会立即保存
+func (c *CryoClient) SetAlias(alias string) {
+	c.setAlias(alias)
+	c.autoSave()
+}
+
+// setAlias 设置客户端的显示别名
+func (c *CryoClient) setAlias(alias string) {
+	c.profileMutex.Lock()
+	defer c.profileMutex.Unlock()
+	c.Alias = alias
+}
+
+// SyncProfile 从服务器获取账号的资料并更新客户端的QQ昵称和头像，需要在登录成功后调用
+func (c *CryoClient) SyncProfile() error {
+	if c.Client == nil || c.Uin == 0 {
+		return fmt.Errorf("客户端尚未登录")
+	}
+	user, err := c.Client.FetchUserInfoUin(uint32(c.Uin))
+	if err != nil {
+		return err
+	}
+	if user.Nickname != "" {
+		c.setNickname(user.Nickname)
+	}
+	c.profileMutex.Lock()
+	c.Avatar = user.Avatar
+	c.profileMutex.Unlock()
+	return nil
+}
+
+// setNickname 更新客户端的QQ昵称以及所属账号的状态
+func (c *CryoClient) setNickname(nickname string) {
+	c.profileMutex.Lock()
+	c.Nickname = nickname
+	c.profileMutex.Unlock()
+	if c.bot != nil {
+		c.bot.setAccountNickname(c.Uin, nickname)
+	}
+}
+
+// autoSave 启用了客户端信息自动保存且客户端已经登录时保存客户端信息
+func (c *CryoClient) autoSave() {
+	if c.Uin == 0 || !c.config().IsClientAutoSaveEnabled() {
+		return
+	}
+	if err := c.Save(); err != nil {
+		c.log().Error("保存登录信息时出现错误：", err)
+	}
+}
+
+// handleRename 处理好友或自身改名的事件，自身改名时更新客户端的QQ昵称
+func (c *CryoClient) handleRename(_ *client.QQClient, e *event.Rename) {
+	c.health.recordEvent()
+	isSelf := e.SubType == 0 || e.Uin == uint32(c.Uin)
+	if old := c.GetNickname(); isSelf && e.Nickname != "" && e.Nickname != old {
+		c.log().Infof("%s[Cryo] %d 的QQ昵称已从 %s 修改为 %s", lavender, c.Uin, old, e.Nickname)
+		c.setNickname(e.Nickname)
+		c.autoSave()
+	}
+	c.bus().PublishAsync(FriendRenameEvent{
+		BaseEvent: BaseEvent{
+			EventType:   uint32(FriendRenameEventType),
+			EventId:     uuid.NewV4().String(),
+			EventTags:   []string{"friend_rename", "notice"},
+			BotId:       c.Id,
+			BotNickname: c.GetNickname(),
+			BotUin:      uint32(c.Uin),
+			BotUid:      c.Uid,
+			Platform:    c.Platform,
+			Summary:     "FriendRenameEvent",
+			Time:        uint32(time.Now().Unix()),
+		},
+		IsSelf:   isSelf,
+		Uin:      e.Uin,
+		Uid:      e.UID,
+		Nickname: e.Nickname,
+	})
+}
+
+// botDisplayName 返回事件对应的客户端用于显示的名称，找不到客户端时使用事件中的昵称或QQ号
+func (b *Bot) botDisplayName(e BaseEvent) string {
+	if c := b.GetClientById(e.BotId); c != nil {
+		return c.GetDisplayName()
+	}
+	if e.BotNickname != "" {
+		return e.BotNickname
+	}
+	return fmt.Sprintf("Bot%d", e.BotUin)
+}
@@ -0,0 +1,243 @@
+package cryobot
+
+import (
+	"fmt"
+	"github.com/LagrangeDev/LagrangeGo/client/auth"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 协议版本
+//
+// 每个客户端使用的平台和协议版本必须是 LagrangeGo 的 auth.AppList 中存在的组合
+// 新客户端默认使用配置中的平台和版本，使用账号密码登录时可以按照账号单独指定
+// 保存的客户端所使用的协议版本被移除后，会按照配置中的迁移规则或同平台的最新版本进行迁移，迁移后签名可能失效，需要重新登录
+
+const (
+	DefaultPlatform        = "linux"        // 默认的平台
+	DefaultProtocolVersion = "3.2.15-30366" // 默认平台使用的协议版本
+)
+
+// ProtocolSelection 平台和协议版本
+type ProtocolSelection struct {
+	Platform string `json:"platform,omitempty,omitzero"` // 平台，可选 linux / macos / windows
+	Version  string `json:"version,omitempty,omitzero"`  // 协议版本，为空时使用该平台的默认版本
+}
+
+// ProtocolConfig 协议版本的配置
+type ProtocolConfig struct {
+	Platform    string                       `json:"platform,omitempty,omitzero"`     // 新客户端默认使用的平台，默认为 linux
+	Version     string                       `json:"version,omitempty,omitzero"`      // 新客户端默认使用的协议版本，为空时使用该平台的默认版本
+	Accounts    map[string]ProtocolSelection `json:"accounts,omitempty,omitzero"`     // 按账号指定的平台和协议版本，键为QQ号，只对使用账号密码登录的新客户端生效
+	Migrations  map[string]string            `json:"migrations,omitempty,omitzero"`   // 已移除的协议版本的迁移目标，键为 平台/版本，值为同平台的新版本
+	AutoMigrate *bool                        `json:"auto_migrate,omitempty,omitzero"` // 没有迁移规则时是否自动迁移到同平台的最新版本，默认开启
+}
+
+// ProtocolError 平台或协议版本不可用
+type ProtocolError struct {
+	Platform  string   // 请求的平台
+	Version   string   // 请求的协议版本
+	Available []string // 可用的平台，或该平台可用的协议版本
+}
+
+func (e *ProtocolError) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("不支持的平台 %q，可用的平台：%s", e.Platform, strings.Join(e.Available, ", "))
+	}
+	return fmt.Sprintf("平台 %s 不支持协议版本 %q，可用的版本：%s", e.Platform, e.Version, strings.Join(e.Available, ", "))
+}
+
+// AvailablePlatforms 返回所有可用的平台
+func AvailablePlatforms() []string {
+	return slices.Sorted(maps.Keys(auth.AppList))
+}
+
+// AvailableVersions 返回指定平台所有可用的协议版本，按照从旧到新的顺序排列
+func AvailableVersions(platform string) []string {
+	return slices.SortedFunc(maps.Keys(auth.AppList[platform]), compareProtocolVersion)
+}
+
+// LatestVersion 返回指定平台最新的协议版本，平台不存在时返回空字符串
+func LatestVersion(platform string) string {
+	versions := AvailableVersions(platform)
+	if len(versions) == 0 {
+		return ""
+	}
+	return versions[len(versions)-1]
+}
+
+// DefaultVersion 返回指定平台默认使用的协议版本，默认平台使用 DefaultProtocolVersion，其他平台使用最新的版本
+func DefaultVersion(platform string) string {
+	if platform == DefaultPlatform {
+		if _, ok := auth.AppList[platform][DefaultProtocolVersion]; ok {
+			return DefaultProtocolVersion
+		}
+	}
+	return LatestVersion(platform)
+}
+
+// ResolveAppInfo 返回指定平台和协议版本的应用信息，不存在时返回 *ProtocolError
+func ResolveAppInfo(platform, version string) (*auth.AppInfo, error) {
+	versions, ok := auth.AppList[platform]
+	if !ok {
+		return nil, &ProtocolError{Platform: platform, Available: AvailablePlatforms()}
+	}
+	app, ok := versions[version]
+	if !ok || app == nil {
+		return nil, &ProtocolError{Platform: platform, Version: version, Available: AvailableVersions(platform)}
+	}
+	return app, nil
+}
+
+// compareProtocolVersion 按照数字逐段比较两个协议版本，如 3.2.15-30366
+func compareProtocolVersion(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' })
+	}
+	pa, pb := split(a), split(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		if errA != nil || errB != nil {
+			if c := strings.Compare(pa[i], pb[i]); c != 0 {
+				return c
+			}
+			continue
+		}
+		if na != nb {
+			return na - nb
+		}
+	}
+	return len(pa) - len(pb)
+}
+
+// Select 返回指定账号应该使用的平台和协议版本，uin 为0或没有为该账号单独配置时使用默认的平台和版本
+func (c ProtocolConfig) Select(uin int) (platform, version string) {
+	platform, version = c.Platform, c.Version
+	if account, ok := c.Accounts[strconv.Itoa(uin)]; ok && uin != 0 {
+		if account.Platform != "" && account.Platform != platform {
+			platform, version = account.Platform, ""
+		}
+		if account.Version != "" {
+			version = account.Version
+		}
+	}
+	if platform == "" {
+		platform = DefaultPlatform
+	}
+	if version == "" {
+		version = DefaultVersion(platform)
+	}
+	return platform, version
+}
+
+// Migrate 返回已经不可用的协议版本应该迁移到的平台和版本，无法迁移时返回 false
+func (c ProtocolConfig) Migrate(platform, version string) (string, string, bool) {
+	if target, ok := c.Migrations[platform+"/"+version]; ok {
+		if _, err := ResolveAppInfo(platform, target); err == nil {
+			return platform, target, true
+		}
+	}
+	if !boolValue(c.AutoMigrate, true) {
+		return "", "", false
+	}
+	if latest := LatestVersion(platform); latest != "" {
+		return platform, latest, true
+	}
+	// 整个平台都已经被移除时，迁移到默认的平台
+	platform, version = c.Select(0)
+	if _, err := ResolveAppInfo(platform, version); err != nil {
+		return "", "", false
+	}
+	return platform, version, true
+}
+
+// validate 校验协议版本的配置
+func (c ProtocolConfig) validate(invalid func(field, format string, args ...any)) {
+	if c.Platform != "" || c.Version != "" {
+		platform, version := c.Select(0)
+		if _, err := ResolveAppInfo(platform, version); err != nil {
+			invalid("protocol", "%v", err)
+		}
+	}
+	for _, uin := range slices.Sorted(maps.Keys(c.Accounts)) {
+		if _, err := strconv.Atoi(uin); err != nil {
+			invalid("protocol.accounts."+uin, "的键必须是QQ号")
+			continue
+		}
+		n, _ := strconv.Atoi(uin)
+		platform, version := c.Select(n)
+		if _, err := ResolveAppInfo(platform, version); err != nil {
+			invalid("protocol.accounts."+uin, "%v", err)
+		}
+	}
+	for _, from := range slices.Sorted(maps.Keys(c.Migrations)) {
+		platform, _, ok := strings.Cut(from, "/")
+		if !ok {
+			invalid("protocol.migrations."+from, "的键必须是 平台/版本 的格式")
+			continue
+		}
+		if _, err := ResolveAppInfo(platform, c.Migrations[from]); err != nil {
+			invalid("protocol.migrations."+from, "%v", err)
+		}
+	}
+}
+
+// SetProtocol 设置客户端使用的平台和协议版本，版本为空时使用该平台的默认版本
+//
+// 需要在登录之前调用，平台或版本不可用时返回 *ProtocolError 且不做任何修改
+func (c *CryoClient) SetProtocol(platform, version string) error {
+	if version == "" {
+		version = DefaultVersion(platform)
+	}
+	app, err := ResolveAppInfo(platform, version)
+	if err != nil {
+		return err
+	}
+	c.Platform, c.Version = platform, version
+	if c.Client != nil {
+		c.Client.UseVersion(app)
+	}
+	return nil
+}
+
+// appInfo 返回客户端当前使用的应用信息，平台或版本不可用时回退到默认的平台和版本
+func (c *CryoClient) appInfo() *auth.AppInfo {
+	app, err := ResolveAppInfo(c.Platform, c.Version)
+	if err != nil {
+		c.log().Errorf("客户端 %s 的协议版本不可用，将使用默认的协议版本：%v", c.Id, err)
+		c.Platform, c.Version = DefaultPlatform, DefaultProtocolVersion
+		app = auth.AppList[DefaultPlatform][DefaultProtocolVersion]
+	}
+	return app
+}
+
+// migrateProtocolVersions 将保存的客户端中协议版本已经不可用的客户端迁移到新的版本
+func (b *Bot) migrateProtocolVersions() {
+	store := b.GetCredentialStore()
+	infos, err := store.Load()
+	if err != nil {
+		return
+	}
+	protocol := b.GetConfig().Protocol
+	for _, info := range infos {
+		if info.Platform == "" {
+			continue
+		}
+		if _, err := ResolveAppInfo(info.Platform, info.Version); err == nil {
+			continue
+		}
+		platform, version, ok := protocol.Migrate(info.Platform, info.Version)
+		if !ok {
+			b.log().Warnf("[Cryo] 客户端 %s 使用的协议版本 %s/%s 已不可用，且没有可以迁移到的版本", info.Id, info.Platform, info.Version)
+			continue
+		}
+		b.log().Warnf("[Cryo] 客户端 %s 使用的协议版本 %s/%s 已不可用，已迁移到 %s/%s，保存的签名可能失效", info.Id, info.Platform, info.Version, platform, version)
+		info.Platform, info.Version = platform, version
+		if err := store.Put(info); err != nil {
+			b.log().Error("保存迁移后的客户端信息时出现错误：", err)
+		}
+	}
+}
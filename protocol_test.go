@@ -0,0 +1,39 @@
+package cryobot
+
+import "testing"
+
+func TestCompareProtocolVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int // 只比较符号
+	}{
+		{"3.2.15-30366", "3.2.15-30366", 0},
+		{"3.2.15-30366", "3.2.10-25765", 1},
+		{"3.2.10-25765", "3.2.15-30366", -1},
+		{"3.2.9-25000", "3.2.10-25765", -1}, // 按数字比较而不是按字符串比较
+		{"3.10.0", "3.9.9", 1},
+		{"3.2.15", "3.2.15-30366", -1}, // 段数较少的版本更旧
+		{"3.2.15-30366", "3.2.15", 1},
+		{"3.2.a", "3.2.b", -1}, // 非数字的段按字符串比较
+		{"3.2.b", "3.2.a", 1},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			got := compareProtocolVersion(tt.a, tt.b)
+			if signOf(got) != tt.want {
+				t.Errorf("compareProtocolVersion(%q, %q) = %d, want sign %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func signOf(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
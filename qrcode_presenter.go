@@ -0,0 +1,273 @@
+package cryobot
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-json-experiment/json"
+	"html"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 二维码展示器
+//
+// 扫码登录时获取到的二维码（包括过期后自动刷新得到的新二维码）会依次交给所有的展示器
+// 内置了终端、文件、HTTP页面、Webhook推送以及通过已登录的Bot发送五种展示器，也可以实现 QRCodePresenter 接口自定义展示方式
+
+// QRCodePresenter 二维码展示器
+type QRCodePresenter interface {
+	Present(login *QRCodeLogin) error
+}
+
+// QRCodePresenterFunc 将一个函数包装为二维码展示器
+type QRCodePresenterFunc func(login *QRCodeLogin) error
+
+func (f QRCodePresenterFunc) Present(login *QRCodeLogin) error {
+	return f(login)
+}
+
+// QRCodePresenterConfig 二维码展示器的配置
+type QRCodePresenterConfig struct {
+	Type     string `json:"type,omitempty,omitzero"`      // 展示器类型，可选 terminal / file / http / webhook / bot
+	Dir      string `json:"dir,omitempty,omitzero"`       // file：二维码图片的保存目录，默认为数据目录下的 qrcode/<客户端ID>/
+	Addr     string `json:"addr,omitempty,omitzero"`      // http：二维码页面的监听地址，默认为 127.0.0.1:8092
+	Url      string `json:"url,omitempty,omitzero"`       // webhook：推送的地址
+	Secret   string `json:"secret,omitempty,omitzero"`    // webhook：用于HMAC-SHA256签名的密钥，为空时不签名
+	BotUin   uint32 `json:"bot_uin,omitempty,omitzero"`   // bot：用于发送二维码的Bot的Uin，为0时使用任意一个已登录的Bot
+	GroupUin uint32 `json:"group_uin,omitempty,omitzero"` // bot：发送到的群号
+	UserUin  uint32 `json:"user_uin,omitempty,omitzero"`  // bot：发送到的好友QQ号，设置了群号时忽略
+}
+
+// NewQRCodePresenter 根据配置创建二维码展示器
+func NewQRCodePresenter(bot *Bot, config QRCodePresenterConfig) (QRCodePresenter, error) {
+	switch config.Type {
+	case "terminal":
+		return TerminalQRCodePresenter{}, nil
+	case "file":
+		return FileQRCodePresenter{Dir: config.Dir}, nil
+	case "http":
+		return NewHttpQRCodePresenter(bot, config.Addr), nil
+	case "webhook":
+		if config.Url == "" {
+			return nil, fmt.Errorf("webhook 二维码展示器必须设置推送地址")
+		}
+		return &WebhookQRCodePresenter{Url: config.Url, Secret: config.Secret}, nil
+	case "bot":
+		if config.GroupUin == 0 && config.UserUin == 0 {
+			return nil, fmt.Errorf("bot 二维码展示器必须设置群号或好友QQ号")
+		}
+		return BotQRCodePresenter{Bot: bot, BotUin: config.BotUin, GroupUin: config.GroupUin, UserUin: config.UserUin}, nil
+	}
+	return nil, fmt.Errorf("未知的二维码展示器类型：%s", config.Type)
+}
+
+// TerminalQRCodePresenter 在终端中打印二维码
+type TerminalQRCodePresenter struct{}
+
+func (TerminalQRCodePresenter) Present(login *QRCodeLogin) error {
+	fmt.Println(*GetQRCodeString(login.GetUrl())) // 注意使用了指针
+	return nil
+}
+
+// FileQRCodePresenter 将二维码图片保存到文件
+type FileQRCodePresenter struct {
+	Dir string // 保存目录，二维码会被保存为 QRCode_<客户端ID>.png，为空时保存到数据目录下的 qrcode/<客户端ID>/ 中
+}
+
+func (p FileQRCodePresenter) Present(login *QRCodeLogin) error {
+	qrcodePath := login.GetClient().config().GetDataLayout().QRCodeFile(login.Id)
+	if p.Dir != "" {
+		qrcodePath = filepath.Join(p.Dir, fmt.Sprintf("QRCode_%s.png", login.Id))
+	}
+	if err := os.MkdirAll(filepath.Dir(qrcodePath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(qrcodePath, login.GetQRCode(), 0644); err != nil {
+		return err
+	}
+	login.GetClient().log().Infof("登录二维码已保存到 %s", qrcodePath)
+	return nil
+}
+
+// HttpQRCodePresenter 启动一个HTTP页面展示最近一次扫码登录的二维码，页面会自动刷新
+type HttpQRCodePresenter struct {
+	bot    *Bot
+	addr   string
+	mutex  sync.Mutex
+	login  *QRCodeLogin
+	server *http.Server
+}
+
+// NewHttpQRCodePresenter 创建一个HTTP二维码展示器，第一次展示二维码时开始监听
+func NewHttpQRCodePresenter(bot *Bot, addr string) *HttpQRCodePresenter {
+	if addr == "" {
+		addr = "127.0.0.1:8092"
+	}
+	return &HttpQRCodePresenter{bot: bot, addr: addr}
+}
+
+func (p *HttpQRCodePresenter) Present(login *QRCodeLogin) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.login = login
+	if p.server != nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", p.servePage)
+	mux.HandleFunc("GET /qrcode.png", p.serveQRCode)
+	p.server = &http.Server{Handler: mux}
+	go func(server *http.Server) {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			p.bot.log().Error("[QRCode] 二维码页面停止运行：", err)
+		}
+	}(p.server)
+	p.bot.log().Infof("%s[QRCode] 请在浏览器中打开 http://%s 扫码登录", lavender, p.addr)
+	return nil
+}
+
+// Close 停止二维码页面
+func (p *HttpQRCodePresenter) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.server == nil {
+		return nil
+	}
+	err := p.server.Close()
+	p.server = nil
+	return err
+}
+
+func (p *HttpQRCodePresenter) current() *QRCodeLogin {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.login
+}
+
+func (p *HttpQRCodePresenter) servePage(w http.ResponseWriter, r *http.Request) {
+	login := p.current()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	body := "<p>当前没有进行中的扫码登录</p>"
+	if login != nil {
+		state := login.GetState()
+		body = fmt.Sprintf("<p>客户端 %s：%s</p>", html.EscapeString(login.Id), state)
+		if !state.IsFinished() {
+			body += fmt.Sprintf("<img src=\"/qrcode.png?r=%d\" width=\"240\"><p>请使用手机QQ扫码登录</p>", login.GetRefreshed())
+		}
+	}
+	_, _ = fmt.Fprintf(w, `<!DOCTYPE html><html lang="zh-CN"><head><meta charset="utf-8"><meta http-equiv="refresh" content="3"><title>cryobot 扫码登录</title></head><body style="font-family: system-ui, sans-serif; text-align: center;">%s</body></html>`, body)
+}
+
+func (p *HttpQRCodePresenter) serveQRCode(w http.ResponseWriter, r *http.Request) {
+	login := p.current()
+	if login == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(login.GetQRCode())
+}
+
+// WebhookQRCodePresenter 将二维码以JSON的形式推送到指定的地址，可以用于转发到管理员的聊天软件
+//
+// 推送的内容包含客户端ID、二维码链接、base64编码的PNG图片以及已刷新的次数，设置了 Secret 时会在 X-Cryobot-Signature 请求头中携带签名
+type WebhookQRCodePresenter struct {
+	Url    string
+	Secret string
+}
+
+func (p *WebhookQRCodePresenter) Present(login *QRCodeLogin) error {
+	body, err := json.Marshal(map[string]any{
+		"id":        login.Id,
+		"url":       login.GetUrl(),
+		"qrcode":    login.GetQRCode(),
+		"refreshed": login.GetRefreshed(),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cryobot-webhook")
+	if p.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(p.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Cryobot-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// BotQRCodePresenter 通过一个已经登录的Bot把二维码发送到指定的群或好友
+type BotQRCodePresenter struct {
+	Bot      *Bot
+	BotUin   uint32 // 用于发送的Bot的Uin，为0时使用任意一个已登录的Bot
+	GroupUin uint32 // 发送到的群号
+	UserUin  uint32 // 发送到的好友QQ号，设置了群号时忽略
+}
+
+func (p BotQRCodePresenter) Present(login *QRCodeLogin) error {
+	var sender *CryoClient
+	if p.BotUin != 0 {
+		sender = p.Bot.GetClientByUin(int(p.BotUin))
+	} else {
+		for _, c := range p.Bot.GetClients() {
+			if c.Id != login.Id {
+				sender = c
+				break
+			}
+		}
+	}
+	if sender == nil {
+		return fmt.Errorf("没有可以用于发送二维码的Bot")
+	}
+	msg := BuildMessage().
+		Text(fmt.Sprintf("客户端 %s 正在扫码登录，请使用手机QQ扫描下方二维码\n", login.Id)).
+		Image(login.GetQRCode()).
+		Text(login.GetUrl())
+	var ok bool
+	if p.GroupUin != 0 {
+		ok, _ = sender.SendGroupMessage(p.GroupUin, msg)
+	} else {
+		ok, _ = sender.SendPrivateMessage(p.UserUin, msg)
+	}
+	if !ok {
+		return fmt.Errorf("通过 %d 发送二维码失败", sender.Uin)
+	}
+	return nil
+}
+
+// AddQRCodePresenter 添加一个二维码展示器，阻塞式的扫码登录会使用所有已添加的展示器
+func (b *Bot) AddQRCodePresenter(p QRCodePresenter) {
+	b.qrCodePresenters = append(b.qrCodePresenters, p)
+}
+
+// getQRCodePresenters 返回阻塞式扫码登录使用的展示器，没有添加任何展示器时在终端打印二维码，并保存到数据目录的 qrcode/<客户端ID>/ 中，没有设置数据目录时保存到工作目录
+func (b *Bot) getQRCodePresenters() []QRCodePresenter {
+	if len(b.qrCodePresenters) == 0 {
+		return []QRCodePresenter{TerminalQRCodePresenter{}, FileQRCodePresenter{}}
+	}
+	return b.qrCodePresenters
+}
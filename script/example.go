@@ -9,8 +9,8 @@ func main() {
 	bot := cryo.NewBot()
 	bot.Init(cryo.Config{
 		LogLevel:                     logrus.DebugLevel,
-		EnableMessagePrintMiddleware: true,
-		EnableEventDebugMiddleware:   true,
+		EnableMessagePrintMiddleware: cryo.Bool(true),
+		EnableEventDebugMiddleware:   cryo.Bool(true),
 	})
 
 	bot.OnMessage().
@@ -0,0 +1,622 @@
+package cryobot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/LagrangeDev/LagrangeGo/client/auth"
+	"github.com/LagrangeDev/LagrangeGo/client/sign"
+	"github.com/go-json-experiment/json"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 签名服务器池
+//
+// 同一个Bot的所有客户端共用一个签名服务器池，池会定时对每个签名服务器进行健康检查并记录延迟
+// 每个客户端会被分配到一个签名服务器，签名失败时会按照权重切换到其他可用的服务器，并把新的服务器作为该客户端的分配
+// 一个服务器连续失败达到阈值后会被熔断，冷却时间过后才会再次尝试，健康检查成功时会立即恢复
+// 服务器的状态发生变化时会发布 SignServerEvent
+// 健康检查会向服务器请求对一段固定的占位数据签名，只用来确认服务器能够正常返回签名，返回的签名不会被使用
+// 测试时可以使用 signtest 包中的模拟签名服务器代替真实的签名服务
+
+// SignServerConfig 带权重的签名服务器
+type SignServerConfig struct {
+	Url    string `json:"url"`                       // 签名服务器的地址
+	Weight int    `json:"weight,omitempty,omitzero"` // 权重，权重越大被选中的概率越高，默认为1
+}
+
+// SignPoolConfig 签名服务器池的配置
+type SignPoolConfig struct {
+	Servers          []SignServerConfig `json:"servers,omitempty,omitzero"`           // 带权重的签名服务器，会与 SignServers 中的服务器合并
+	ProbeInterval    int                `json:"probe_interval,omitempty,omitzero"`    // 健康检查的间隔，单位为秒，默认为60，负数表示不进行健康检查
+	Timeout          int                `json:"timeout,omitempty,omitzero"`           // 单次签名请求的超时时间，单位为秒，默认为8
+	FailureThreshold int                `json:"failure_threshold,omitempty,omitzero"` // 连续失败多少次后熔断，默认为3
+	Cooldown         int                `json:"cooldown,omitempty,omitzero"`          // 熔断后再次尝试前的冷却时间，单位为秒，默认为30
+}
+
+// withDefaults 返回填充了默认值的配置
+func (c SignPoolConfig) withDefaults() SignPoolConfig {
+	if c.ProbeInterval == 0 {
+		c.ProbeInterval = 60
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 8
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 3
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = 30
+	}
+	return c
+}
+
+// SignServerState 签名服务器的状态
+type SignServerState string
+
+const (
+	SignServerUnknown   SignServerState = "unknown"   // 还没有进行过签名或健康检查
+	SignServerHealthy   SignServerState = "healthy"   // 最近一次请求成功
+	SignServerUnhealthy SignServerState = "unhealthy" // 最近的请求失败，但还没有达到熔断的阈值
+	SignServerOpen      SignServerState = "open"      // 已熔断，冷却时间内不会被使用
+)
+
+// SignServerStatus 签名服务器的状态快照
+type SignServerStatus struct {
+	Url       string          `json:"url"`
+	Weight    int             `json:"weight"`
+	State     SignServerState `json:"state"`
+	Latency   int64           `json:"latency"`                       // 最近一次成功请求的延迟，单位为毫秒
+	Failures  int             `json:"failures"`                      // 连续失败的次数
+	Total     uint64          `json:"total"`                         // 请求的总次数，包括健康检查
+	Failed    uint64          `json:"failed"`                        // 失败的总次数
+	LastError string          `json:"last_error,omitempty,omitzero"` // 最近一次失败的原因
+	LastCheck int64           `json:"last_check,omitempty,omitzero"` // 最近一次请求的时间戳
+	OpenUntil int64           `json:"open_until,omitempty,omitzero"` // 熔断结束的时间戳
+	Clients   []string        `json:"clients,omitempty,omitzero"`    // 分配到该服务器的客户端ID
+}
+
+// signServer 签名服务器池中的一个服务器
+type signServer struct {
+	url    string
+	weight int
+
+	mutex     sync.Mutex
+	state     SignServerState
+	latency   time.Duration
+	failures  int
+	total     uint64
+	failed    uint64
+	lastError string
+	lastCheck time.Time
+	openUntil time.Time
+}
+
+// available 返回服务器当前是否可以使用，熔断的冷却时间过后可以再次尝试
+func (s *signServer) available(now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.state != SignServerOpen || now.After(s.openUntil)
+}
+
+// SignPool 签名服务器池
+type SignPool struct {
+	bot         *Bot
+	mutex       sync.RWMutex
+	config      SignPoolConfig
+	servers     []*signServer
+	assignments map[string]string // 客户端ID到签名服务器地址的分配
+	stop        chan struct{}
+}
+
+// NewSignPool 创建一个签名服务器池，bot 可以为nil，此时状态变化时不会发布事件
+//
+// 创建后需要调用 Start 才会开始定时健康检查
+func NewSignPool(bot *Bot, config SignPoolConfig, servers ...string) *SignPool {
+	p := &SignPool{bot: bot, assignments: make(map[string]string)}
+	p.SetServers(config, servers...)
+	return p
+}
+
+// SetServers 替换池中的签名服务器和配置，已经存在的服务器会保留原有的状态
+func (p *SignPool) SetServers(config SignPoolConfig, servers ...string) {
+	configs := make([]SignServerConfig, 0, len(servers)+len(config.Servers))
+	for _, server := range servers {
+		configs = append(configs, SignServerConfig{Url: server})
+	}
+	configs = append(configs, config.Servers...)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.config = config.withDefaults()
+	updated := make([]*signServer, 0, len(configs))
+	for _, sc := range configs {
+		if sc.Url == "" || slices.ContainsFunc(updated, func(s *signServer) bool { return s.url == sc.Url }) {
+			continue
+		}
+		weight := max(sc.Weight, 1)
+		i := slices.IndexFunc(p.servers, func(s *signServer) bool { return s.url == sc.Url })
+		if i >= 0 {
+			p.servers[i].weight = weight
+			updated = append(updated, p.servers[i])
+			continue
+		}
+		updated = append(updated, &signServer{url: sc.Url, weight: weight, state: SignServerUnknown})
+	}
+	p.servers = updated
+}
+
+// AddServer 向池中添加签名服务器
+func (p *SignPool) AddServer(servers ...string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, server := range servers {
+		if !slices.ContainsFunc(p.servers, func(s *signServer) bool { return s.url == server }) {
+			p.servers = append(p.servers, &signServer{url: server, weight: 1, state: SignServerUnknown})
+		}
+	}
+}
+
+// GetServers 返回池中所有签名服务器的地址
+func (p *SignPool) GetServers() []string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	urls := make([]string, len(p.servers))
+	for i, s := range p.servers {
+		urls[i] = s.url
+	}
+	return urls
+}
+
+// Start 开始定时进行健康检查，会立即进行第一次检查
+func (p *SignPool) Start() {
+	p.mutex.Lock()
+	if p.stop != nil || p.config.ProbeInterval < 0 {
+		p.mutex.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	p.stop = stop
+	p.mutex.Unlock()
+	go func() {
+		for {
+			p.Probe()
+			p.mutex.RLock()
+			interval := time.Duration(p.config.ProbeInterval) * time.Second
+			p.mutex.RUnlock()
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// Stop 停止定时健康检查
+func (p *SignPool) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
+// signProbeCmd 和 signProbeData 健康检查时请求签名的命令和占位数据
+//
+// 签名服务器只根据命令和数据计算签名，不会校验数据是否为真实的数据包，所以使用固定的几个字节即可
+var (
+	signProbeCmd  = "wtlogin.login"
+	signProbeData = []byte{11, 45, 14}
+)
+
+// Probe 立即对所有签名服务器进行一次健康检查，等待检查完成后返回
+func (p *SignPool) Probe() {
+	p.mutex.RLock()
+	servers := slices.Clone(p.servers)
+	p.mutex.RUnlock()
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			_, err := p.request(s, nil, signProbeCmd, 1, signProbeData)
+			if err != nil {
+				p.recordFailure(s, err)
+				return
+			}
+			p.recordSuccess(s, time.Since(start))
+		}()
+	}
+	wg.Wait()
+}
+
+// Status 返回池中所有签名服务器的状态
+func (p *SignPool) Status() []SignServerStatus {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	status := make([]SignServerStatus, 0, len(p.servers))
+	for _, s := range p.servers {
+		s.mutex.Lock()
+		st := SignServerStatus{
+			Url:       s.url,
+			Weight:    s.weight,
+			State:     s.state,
+			Latency:   s.latency.Milliseconds(),
+			Failures:  s.failures,
+			Total:     s.total,
+			Failed:    s.failed,
+			LastError: s.lastError,
+		}
+		if !s.lastCheck.IsZero() {
+			st.LastCheck = s.lastCheck.Unix()
+		}
+		if s.state == SignServerOpen {
+			st.OpenUntil = s.openUntil.Unix()
+		}
+		s.mutex.Unlock()
+		for id, server := range p.assignments {
+			if server == s.url {
+				st.Clients = append(st.Clients, id)
+			}
+		}
+		slices.Sort(st.Clients)
+		status = append(status, st)
+	}
+	return status
+}
+
+// getLatency 返回指定服务器最近一次成功请求的延迟，单位为毫秒，服务器不存在时返回0
+func (p *SignPool) getLatency(url string) int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for _, s := range p.servers {
+		if s.url == url {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			return s.latency.Milliseconds()
+		}
+	}
+	return 0
+}
+
+// Available 返回当前可以使用的签名服务器数量
+func (p *SignPool) Available() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	now := time.Now()
+	n := 0
+	for _, s := range p.servers {
+		if s.available(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// GetAssignment 返回分配给指定客户端的签名服务器地址，还没有分配时返回空字符串
+func (p *SignPool) GetAssignment(clientId string) string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.assignments[clientId]
+}
+
+// Unassign 移除指定客户端的分配
+func (p *SignPool) Unassign(clientId string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.assignments, clientId)
+}
+
+// Sign 为指定客户端的数据包签名，分配的服务器不可用时按照权重依次尝试其他服务器
+func (p *SignPool) Sign(clientId string, app *auth.AppInfo, header http.Header, cmd string, seq uint32, data []byte) (*sign.Response, error) {
+	tried := make(map[*signServer]bool)
+	var lastErr error
+	for {
+		s := p.pick(clientId, tried)
+		if s == nil {
+			break
+		}
+		tried[s] = true
+		start := time.Now()
+		resp, err := p.request(s, header, cmd, seq, data)
+		if err != nil {
+			p.recordFailure(s, err)
+			lastErr = err
+			continue
+		}
+		p.recordSuccess(s, time.Since(start))
+		p.assign(clientId, s)
+		if app != nil && resp.Version != app.CurrentVersion && resp.Value.Extra != app.SignExtraHexLower && resp.Value.Extra != app.SignExtraHexUpper {
+			return nil, sign.ErrVersionMismatch
+		}
+		return resp, nil
+	}
+	if lastErr == nil {
+		return nil, fmt.Errorf("没有可用的签名服务器")
+	}
+	return nil, fmt.Errorf("所有签名服务器均不可用：%w", lastErr)
+}
+
+// pick 选择一个签名服务器，优先使用分配给客户端的服务器，否则在可用的服务器中按照权重随机选择
+func (p *SignPool) pick(clientId string, tried map[*signServer]bool) *signServer {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	now := time.Now()
+	var candidates []*signServer
+	total := 0
+	for _, s := range p.servers {
+		if tried[s] || !s.available(now) {
+			continue
+		}
+		if s.url == p.assignments[clientId] {
+			return s
+		}
+		candidates = append(candidates, s)
+		total += s.weight
+	}
+	if total == 0 {
+		return nil
+	}
+	n := rand.IntN(total)
+	for _, s := range candidates {
+		if n < s.weight {
+			return s
+		}
+		n -= s.weight
+	}
+	return candidates[len(candidates)-1]
+}
+
+// assign 将客户端分配到指定的服务器
+func (p *SignPool) assign(clientId string, s *signServer) {
+	if clientId == "" {
+		return
+	}
+	p.mutex.Lock()
+	old := p.assignments[clientId]
+	p.assignments[clientId] = s.url
+	p.mutex.Unlock()
+	if old != "" && old != s.url {
+		p.log().Infof("%s[Sign] 客户端 %s 的签名服务器已从 %s 切换到 %s", lavender, clientId, old, s.url)
+	}
+}
+
+// recordSuccess 记录一次成功的请求
+func (p *SignPool) recordSuccess(s *signServer, latency time.Duration) {
+	s.mutex.Lock()
+	old := s.state
+	s.state = SignServerHealthy
+	s.latency = latency
+	s.failures = 0
+	s.total++
+	s.lastCheck = time.Now()
+	s.mutex.Unlock()
+	if old != SignServerHealthy {
+		p.stateChanged(s, old, SignServerHealthy, "")
+	}
+}
+
+// recordFailure 记录一次失败的请求，连续失败达到阈值时熔断
+func (p *SignPool) recordFailure(s *signServer, err error) {
+	p.mutex.RLock()
+	threshold, cooldown := p.config.FailureThreshold, time.Duration(p.config.Cooldown)*time.Second
+	p.mutex.RUnlock()
+	s.mutex.Lock()
+	old := s.state
+	s.failures++
+	s.total++
+	s.failed++
+	s.lastError = err.Error()
+	s.lastCheck = time.Now()
+	if s.failures >= threshold {
+		s.state = SignServerOpen
+		s.openUntil = s.lastCheck.Add(cooldown)
+	} else {
+		s.state = SignServerUnhealthy
+	}
+	state := s.state
+	s.mutex.Unlock()
+	if old != state {
+		p.stateChanged(s, old, state, err.Error())
+	}
+}
+
+// stateChanged 记录日志并发布签名服务器状态变化的事件
+func (p *SignPool) stateChanged(s *signServer, old, state SignServerState, reason string) {
+	switch state {
+	case SignServerHealthy:
+		p.log().Infof("%s[Sign] 签名服务器 %s 可用", lavender, s.url)
+	case SignServerOpen:
+		p.log().Warnf("[Sign] 签名服务器 %s 已熔断：%s", s.url, reason)
+	default:
+		p.log().Warnf("[Sign] 签名服务器 %s 请求失败：%s", s.url, reason)
+	}
+	if p.bot != nil {
+		s.mutex.Lock()
+		latency := s.latency.Milliseconds()
+		s.mutex.Unlock()
+		SendSignServerEvent(p.bot, s.url, old, state, latency, reason)
+	}
+}
+
+func (p *SignPool) log() Logger {
+	if p.bot != nil {
+		return p.bot.log()
+	}
+	return GetLogger()
+}
+
+// request 向签名服务器请求签名，POST请求失败时会使用GET请求重试
+func (p *SignPool) request(s *signServer, header http.Header, cmd string, seq uint32, data []byte) (*sign.Response, error) {
+	p.mutex.RLock()
+	timeout := time.Duration(p.config.Timeout) * time.Second
+	p.mutex.RUnlock()
+	src := fmt.Sprintf("%x", data)
+	body, _ := json.Marshal(map[string]any{"cmd": cmd, "seq": seq, "src": src})
+	resp, err := doSignRequest(http.MethodPost, s.url, body, header, timeout)
+	if err != nil || resp.Value.Sign == "" {
+		u, err := url.Parse(s.url)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set("cmd", cmd)
+		q.Set("seq", strconv.Itoa(int(seq)))
+		q.Set("src", src)
+		u.RawQuery = q.Encode()
+		if resp, err = doSignRequest(http.MethodGet, u.String(), nil, header, timeout); err != nil {
+			return nil, err
+		}
+	}
+	if resp.Value.Sign == "" {
+		return nil, fmt.Errorf("签名服务器返回了空的签名")
+	}
+	return resp, nil
+}
+
+// doSignRequest 发送一次签名请求，body 为nil时不携带请求体
+func doSignRequest(method, rawUrl string, body []byte, header http.Header, timeout time.Duration) (*sign.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, rawUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP状态码 %d", resp.StatusCode)
+	}
+	result := &sign.Response{}
+	if err := json.UnmarshalRead(resp.Body, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// signPoolProvider 使用签名服务器池为一个客户端签名，实现了 LagrangeGo 的 sign.Provider 接口
+type signPoolProvider struct {
+	pool   *SignPool
+	client *CryoClient
+
+	mutex  sync.RWMutex
+	app    *auth.AppInfo
+	header http.Header
+}
+
+// Provider 返回为指定客户端签名的 sign.Provider，可以通过 Client.UseSignProvider 使用
+func (p *SignPool) Provider(c *CryoClient) sign.Provider {
+	return &signPoolProvider{pool: p, client: c, header: http.Header{}}
+}
+
+func (sp *signPoolProvider) Sign(cmd string, seq uint32, data []byte) (*sign.Response, error) {
+	if _, ok := signCommands[cmd]; !ok {
+		return nil, nil
+	}
+	sp.mutex.RLock()
+	app, header := sp.app, sp.header.Clone()
+	sp.mutex.RUnlock()
+	return sp.pool.Sign(sp.client.Id, app, header, cmd, seq, data)
+}
+
+func (sp *signPoolProvider) AddRequestHeader(header map[string]string) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	for k, v := range header {
+		sp.header.Add(k, v)
+	}
+}
+
+func (sp *signPoolProvider) AddSignServer(signServers ...string) {
+	sp.pool.AddServer(signServers...)
+}
+
+func (sp *signPoolProvider) GetSignServer() []string {
+	return sp.pool.GetServers()
+}
+
+func (sp *signPoolProvider) SetAppInfo(app *auth.AppInfo) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.app = app
+	sp.header.Set("User-Agent", "qq/"+app.CurrentVersion)
+}
+
+// GetSignPool 返回Bot使用的签名服务器池，第一次调用时根据配置创建
+func (b *Bot) GetSignPool() *SignPool {
+	b.signPoolOnce.Do(func() {
+		conf := b.GetConfig()
+		b.signPool = NewSignPool(b, conf.SignPool, conf.SignServers...)
+	})
+	return b.signPool
+}
+
+// warnIfSignUnavailable 登录失败时检查签名服务器，没有可用的服务器时提示登录失败可能是签名导致的
+func (c *CryoClient) warnIfSignUnavailable() {
+	if c.bot == nil {
+		return
+	}
+	if c.bot.GetSignPool().Available() == 0 {
+		c.log().Warn("[Sign] 当前没有可用的签名服务器，登录失败可能是签名服务不可用导致的")
+	}
+}
+
+// signCommands 需要签名的命令，与 LagrangeGo 中的列表保持一致
+var signCommands = map[string]struct{}{
+	"trpc.o3.ecdh_access.EcdhAccess.SsoEstablishShareKey":              {},
+	"trpc.o3.ecdh_access.EcdhAccess.SsoSecureAccess":                   {},
+	"trpc.o3.report.Report.SsoReport":                                  {},
+	"MessageSvc.PbSendMsg":                                             {},
+	"wtlogin.login":                                                    {},
+	"trpc.login.ecdh.EcdhService.SsoNTLoginPasswordLogin":              {},
+	"trpc.login.ecdh.EcdhService.SsoNTLoginEasyLogin":                  {},
+	"trpc.login.ecdh.EcdhService.SsoNTLoginPasswordLoginNewDevice":     {},
+	"trpc.login.ecdh.EcdhService.SsoNTLoginEasyLoginUnusualDevice":     {},
+	"trpc.login.ecdh.EcdhService.SsoNTLoginPasswordLoginUnusualDevice": {},
+	"OidbSvcTrpcTcp.0x11ec_1":                                          {},
+	"OidbSvcTrpcTcp.0x758_1":                                           {},
+	"OidbSvcTrpcTcp.0x7c1_1":                                           {},
+	"OidbSvcTrpcTcp.0x7c2_5":                                           {},
+	"OidbSvcTrpcTcp.0x10db_1":                                          {},
+	"OidbSvcTrpcTcp.0x8a1_7":                                           {},
+	"OidbSvcTrpcTcp.0x89a_0":                                           {},
+	"OidbSvcTrpcTcp.0x89a_15":                                          {},
+	"OidbSvcTrpcTcp.0x88d_0":                                           {},
+	"OidbSvcTrpcTcp.0x88d_14":                                          {},
+	"OidbSvcTrpcTcp.0x112a_1":                                          {},
+	"OidbSvcTrpcTcp.0x587_74":                                          {},
+	"OidbSvcTrpcTcp.0x1100_1":                                          {},
+	"OidbSvcTrpcTcp.0x1102_1":                                          {},
+	"OidbSvcTrpcTcp.0x1103_1":                                          {},
+	"OidbSvcTrpcTcp.0x1107_1":                                          {},
+	"OidbSvcTrpcTcp.0x1105_1":                                          {},
+	"OidbSvcTrpcTcp.0xf88_1":                                           {},
+	"OidbSvcTrpcTcp.0xf89_1":                                           {},
+	"OidbSvcTrpcTcp.0xf57_1":                                           {},
+	"OidbSvcTrpcTcp.0xf57_106":                                         {},
+	"OidbSvcTrpcTcp.0xf57_9":                                           {},
+	"OidbSvcTrpcTcp.0xf55_1":                                           {},
+	"OidbSvcTrpcTcp.0xf67_1":                                           {},
+	"OidbSvcTrpcTcp.0xf67_5":                                           {},
+	"OidbSvcTrpcTcp.0x6d9_4":                                           {},
+}
@@ -0,0 +1,126 @@
+package cryobot
+
+import (
+	"github.com/machinacanis/cryobot/signtest"
+	"testing"
+)
+
+// signServerState 返回池中指定服务器的状态
+func signServerState(p *SignPool, url string) SignServerState {
+	for _, s := range p.Status() {
+		if s.Url == url {
+			return s.State
+		}
+	}
+	return ""
+}
+
+func TestSignPoolBreaker(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		failures  int // 让服务器失败后发起的签名次数
+		want      SignServerState
+	}{
+		{name: "未达到阈值", threshold: 3, failures: 2, want: SignServerUnhealthy},
+		{name: "达到阈值后熔断", threshold: 3, failures: 3, want: SignServerOpen},
+		{name: "阈值为1时第一次失败就熔断", threshold: 1, failures: 1, want: SignServerOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := signtest.NewServer()
+			defer server.Close()
+			pool := NewSignPool(nil, SignPoolConfig{FailureThreshold: tt.threshold, Cooldown: 60}, server.Url)
+
+			if _, err := pool.Sign("c1", nil, nil, "wtlogin.login", 1, []byte{1}); err != nil {
+				t.Fatalf("服务器正常时签名失败：%v", err)
+			}
+			if state := signServerState(pool, server.Url); state != SignServerHealthy {
+				t.Fatalf("state = %s, want %s", state, SignServerHealthy)
+			}
+
+			server.SetFailing(true)
+			for range tt.failures {
+				if _, err := pool.Sign("c1", nil, nil, "wtlogin.login", 1, []byte{1}); err == nil {
+					t.Fatal("服务器失败时签名没有返回错误")
+				}
+			}
+			if state := signServerState(pool, server.Url); state != tt.want {
+				t.Fatalf("state = %s, want %s", state, tt.want)
+			}
+			if tt.want != SignServerOpen {
+				return
+			}
+
+			// 熔断后冷却时间内不会再请求该服务器
+			requests := server.GetRequestCount()
+			if _, err := pool.Sign("c1", nil, nil, "wtlogin.login", 1, []byte{1}); err == nil {
+				t.Fatal("没有可用的服务器时签名没有返回错误")
+			}
+			if server.GetRequestCount() != requests {
+				t.Fatal("熔断的服务器在冷却时间内仍然收到了请求")
+			}
+			if pool.Available() != 0 {
+				t.Fatalf("Available = %d, want 0", pool.Available())
+			}
+
+			// 健康检查成功时立即恢复
+			server.SetFailing(false)
+			pool.Probe()
+			if state := signServerState(pool, server.Url); state != SignServerHealthy {
+				t.Fatalf("健康检查成功后 state = %s, want %s", state, SignServerHealthy)
+			}
+			if _, err := pool.Sign("c1", nil, nil, "wtlogin.login", 1, []byte{1}); err != nil {
+				t.Fatalf("恢复后签名失败：%v", err)
+			}
+		})
+	}
+}
+
+func TestSignPoolFailover(t *testing.T) {
+	primary := signtest.NewServer()
+	defer primary.Close()
+	backup := signtest.NewServer()
+	defer backup.Close()
+	pool := NewSignPool(nil, SignPoolConfig{Servers: []SignServerConfig{{Url: primary.Url, Weight: 1000}, {Url: backup.Url, Weight: 1}}})
+
+	// 先让客户端分配到主服务器
+	for pool.GetAssignment("c1") != primary.Url {
+		pool.Unassign("c1")
+		if _, err := pool.Sign("c1", nil, nil, "wtlogin.login", 1, []byte{1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	primary.SetFailing(true)
+	if _, err := pool.Sign("c1", nil, nil, "wtlogin.login", 1, []byte{1}); err != nil {
+		t.Fatalf("主服务器失败时没有切换到备用服务器：%v", err)
+	}
+	if got := pool.GetAssignment("c1"); got != backup.Url {
+		t.Fatalf("assignment = %s, want %s", got, backup.Url)
+	}
+
+	pool.Unassign("c1")
+	if got := pool.GetAssignment("c1"); got != "" {
+		t.Fatalf("Unassign 后 assignment = %s, want empty", got)
+	}
+	for _, s := range pool.Status() {
+		if len(s.Clients) > 0 {
+			t.Fatalf("Unassign 后服务器 %s 仍然记录了客户端 %v", s.Url, s.Clients)
+		}
+	}
+}
+
+func TestSignPoolVersionMismatch(t *testing.T) {
+	server := signtest.NewServer()
+	defer server.Close()
+	server.SetVersion("1.0.0")
+	pool := NewSignPool(nil, SignPoolConfig{}, server.Url)
+	app, err := ResolveAppInfo(DefaultPlatform, DefaultProtocolVersion)
+	if err != nil {
+		t.Skip(err)
+	}
+	if _, err := pool.Sign("c1", app, nil, "wtlogin.login", 1, []byte{1}); err == nil {
+		t.Fatal("签名服务器的协议版本与客户端不一致时没有返回错误")
+	}
+}
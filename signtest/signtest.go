@@ -0,0 +1,107 @@
+// Package signtest 提供在本地运行的模拟签名服务器，用于测试签名服务器池
+package signtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/LagrangeDev/LagrangeGo/client/sign"
+	"github.com/go-json-experiment/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server 在本地运行的模拟签名服务器，可以在测试中代替真实的签名服务
+//
+// 返回的签名是请求内容的SHA-256摘要，只能用于测试签名服务器池的调度、健康检查和熔断，无法用于真正的登录
+type Server struct {
+	Url string // 模拟签名服务器的地址
+
+	server   *httptest.Server
+	mutex    sync.Mutex
+	failing  bool
+	delay    time.Duration
+	version  string
+	requests atomic.Int64
+}
+
+// NewServer 创建并启动一个模拟签名服务器
+func NewServer() *Server {
+	m := &Server{}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serveSign))
+	m.Url = m.server.URL + "/api/sign"
+	return m
+}
+
+// SetFailing 设置是否让所有请求返回500错误
+func (m *Server) SetFailing(failing bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failing = failing
+}
+
+// SetDelay 设置每次响应前的延迟
+func (m *Server) SetDelay(delay time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.delay = delay
+}
+
+// SetVersion 设置响应中的协议版本，为空时使用请求头 User-Agent 中的版本
+func (m *Server) SetVersion(version string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.version = version
+}
+
+// GetRequestCount 返回收到的请求数量
+func (m *Server) GetRequestCount() int64 {
+	return m.requests.Load()
+}
+
+// Close 停止模拟签名服务器
+func (m *Server) Close() {
+	m.server.Close()
+}
+
+func (m *Server) serveSign(w http.ResponseWriter, r *http.Request) {
+	m.requests.Add(1)
+	m.mutex.Lock()
+	failing, delay, version := m.failing, m.delay, m.version
+	m.mutex.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if failing {
+		http.Error(w, "mock sign server failing", http.StatusInternalServerError)
+		return
+	}
+
+	var req struct {
+		Cmd string `json:"cmd"`
+		Seq uint32 `json:"seq"`
+		Src string `json:"src"`
+	}
+	if r.Method == http.MethodPost {
+		if err := json.UnmarshalRead(r.Body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		req.Cmd = r.URL.Query().Get("cmd")
+		req.Src = r.URL.Query().Get("src")
+	}
+	if version == "" {
+		version = strings.TrimPrefix(r.Header.Get("User-Agent"), "qq/")
+	}
+
+	sum := sha256.Sum256([]byte(req.Cmd + req.Src))
+	resp := sign.Response{Platform: "Linux", Version: version}
+	resp.Value.Sign = hex.EncodeToString(sum[:])
+	resp.Value.Token = hex.EncodeToString(sum[:8])
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.MarshalWrite(w, resp)
+}
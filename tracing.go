@@ -0,0 +1,420 @@
+package cryobot
+
+import (
+	"fmt"
+	"github.com/go-json-experiment/json"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// 链路追踪
+//
+// 事件总线上的每个事件都会产生一条调用链，链路ID即事件的 EventId，发布事件时创建根Span，中间件、每个处理器的调用以及处理器中通过 Send / Reply 发送的消息都是它的子Span
+// 完成的Span会交给Tracer上添加的所有导出器，内置了以JSON Lines格式输出到终端或文件的导出器，也可以实现 SpanExporter 接入其他的追踪系统
+// 没有设置Tracer或者Tracer没有任何导出器时不会创建Span
+// 每次处理器调用得到的都是事件的副本，处理器Span的标识保存在副本的 BaseEvent.Trace 中，同一个事件被多个处理器同时处理时也不会互相影响
+
+// SpanStatus Span的结束状态
+type SpanStatus string
+
+const (
+	SpanOk    SpanStatus = "ok"    // 正常结束
+	SpanError SpanStatus = "error" // 出现了错误
+)
+
+// SpanContext 用于在调用之间传递的Span标识
+type SpanContext struct {
+	TraceId string // 链路ID，即事件的 EventId
+	SpanId  string // Span的ID
+}
+
+// IsValid 返回是否是一个有效的Span标识
+func (s SpanContext) IsValid() bool {
+	return s.TraceId != "" && s.SpanId != ""
+}
+
+// Span 一段已经完成的调用
+type Span struct {
+	TraceId    string         `json:"trace_id"`                      // 链路ID，即事件的 EventId
+	SpanId     string         `json:"span_id"`                       // Span的ID
+	ParentId   string         `json:"parent_id,omitempty,omitzero"`  // 父Span的ID，根Span为空
+	Name       string         `json:"name"`                          // Span的名称，如 publish / middleware / handler / send
+	StartTime  int64          `json:"start_time"`                    // 开始时间，Unix纳秒时间戳
+	EndTime    int64          `json:"end_time"`                      // 结束时间，Unix纳秒时间戳
+	Duration   int64          `json:"duration"`                      // 耗时，单位为微秒
+	Status     SpanStatus     `json:"status"`                        // 结束状态
+	Error      string         `json:"error,omitempty,omitzero"`      // 出现的错误
+	Attributes map[string]any `json:"attributes,omitempty,omitzero"` // Span的属性，如事件类型、处理器标签、消息的发送对象
+}
+
+// SpanExporter 用于导出已经完成的Span的接口，会在结束Span的协程中同步调用，需要并发安全
+type SpanExporter interface {
+	ExportSpan(span Span) error
+}
+
+// SpanExporterFunc 将函数转换为 SpanExporter
+type SpanExporterFunc func(span Span) error
+
+// ExportSpan 调用函数本身
+func (f SpanExporterFunc) ExportSpan(span Span) error {
+	return f(span)
+}
+
+// JsonSpanExporter 以JSON Lines格式将Span写入 io.Writer 的导出器
+type JsonSpanExporter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	closer io.Closer
+}
+
+// NewJsonSpanExporter 创建一个将Span写入指定 io.Writer 的导出器
+func NewJsonSpanExporter(w io.Writer) *JsonSpanExporter {
+	return &JsonSpanExporter{writer: w}
+}
+
+// NewStdoutSpanExporter 创建一个将Span输出到标准输出的导出器
+func NewStdoutSpanExporter() *JsonSpanExporter {
+	return NewJsonSpanExporter(os.Stdout)
+}
+
+// NewJsonFileSpanExporter 创建一个将Span追加到指定文件的导出器，文件和所在的目录不存在时会自动创建
+func NewJsonFileSpanExporter(path string) (*JsonSpanExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JsonSpanExporter{writer: f, closer: f}, nil
+}
+
+// ExportSpan 将Span写入为一行JSON
+func (e *JsonSpanExporter) ExportSpan(span Span) error {
+	data, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, err = e.writer.Write(append(data, '\n'))
+	return err
+}
+
+// Close 关闭导出器打开的文件
+func (e *JsonSpanExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+// Tracer 创建Span并将完成的Span交给导出器
+type Tracer struct {
+	mutex      sync.RWMutex
+	exporters  []SpanExporter
+	sampleRate float64 // 根Span的采样率
+	logger     Logger
+}
+
+// NewTracer 创建一个Tracer，可以传入导出器
+func NewTracer(exporters ...SpanExporter) *Tracer {
+	return &Tracer{
+		exporters:  exporters,
+		sampleRate: 1,
+	}
+}
+
+// AddExporter 添加一个导出器
+func (t *Tracer) AddExporter(e SpanExporter) {
+	t.mutex.Lock()
+	t.exporters = append(t.exporters, e)
+	t.mutex.Unlock()
+}
+
+// SetSampleRate 设置根Span的采样率，取值为0到1，没有被采样的事件不会产生任何Span
+func (t *Tracer) SetSampleRate(rate float64) {
+	t.mutex.Lock()
+	t.sampleRate = max(0, min(1, rate))
+	t.mutex.Unlock()
+}
+
+// SetLogger 设置导出失败时记录错误使用的日志记录器
+func (t *Tracer) SetLogger(l Logger) {
+	t.logger = l
+}
+
+// Close 关闭所有实现了 io.Closer 的导出器
+func (t *Tracer) Close() {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	for _, e := range t.exporters {
+		if closer, ok := e.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+}
+
+// enabled 返回是否有可以使用的导出器
+func (t *Tracer) enabled() bool {
+	if t == nil {
+		return false
+	}
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.exporters) > 0
+}
+
+// sampled 按照采样率决定是否采样一条新的调用链
+func (t *Tracer) sampled() bool {
+	t.mutex.RLock()
+	rate := t.sampleRate
+	t.mutex.RUnlock()
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// StartRootSpan 开始一条新的调用链，traceId 为空时随机生成，Tracer不可用或没有被采样时返回nil
+func (t *Tracer) StartRootSpan(traceId, name string) *ActiveSpan {
+	if !t.enabled() || !t.sampled() {
+		return nil
+	}
+	if traceId == "" {
+		traceId = NewUUID()
+	}
+	return t.start(SpanContext{TraceId: traceId}, name)
+}
+
+// StartSpan 开始一个子Span，父Span无效时返回nil
+func (t *Tracer) StartSpan(parent SpanContext, name string) *ActiveSpan {
+	if !parent.IsValid() || !t.enabled() {
+		return nil
+	}
+	return t.start(parent, name)
+}
+
+// StartEventSpan 在正在处理指定事件的处理器Span下开始一个子Span，可以在处理器中用于追踪自定义的耗时操作
+func (t *Tracer) StartEventSpan(event CryoEvent, name string) *ActiveSpan {
+	return t.StartSpan(t.EventContext(event), name)
+}
+
+// EventContext 返回正在处理指定事件的处理器Span，事件没有被追踪时返回无效的Span标识
+func (t *Tracer) EventContext(event CryoEvent) SpanContext {
+	if t == nil || event == nil {
+		return SpanContext{}
+	}
+	return event.GetBaseEvent().Trace
+}
+
+// baseEventType BaseEvent 的类型
+var baseEventType = reflect.TypeFor[BaseEvent]()
+
+// withTrace 返回 BaseEvent.Trace 为指定Span的事件副本，事件中没有 BaseEvent 时原样返回
+func withTrace(event CryoEvent, span *ActiveSpan) CryoEvent {
+	if span == nil || event == nil {
+		return event
+	}
+	v := reflect.ValueOf(event)
+	isPointer := v.Kind() == reflect.Pointer
+	if isPointer {
+		if v.IsNil() {
+			return event
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return event
+	}
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+	base := copied
+	if v.Type() != baseEventType {
+		base = copied.FieldByName("BaseEvent")
+		if !base.IsValid() || base.Type() != baseEventType {
+			return event
+		}
+	}
+	base.FieldByName("Trace").Set(reflect.ValueOf(span.Context()))
+	if isPointer {
+		copied = copied.Addr()
+	}
+	result, ok := copied.Interface().(CryoEvent)
+	if !ok {
+		return event
+	}
+	return result
+}
+
+func (t *Tracer) start(parent SpanContext, name string) *ActiveSpan {
+	return &ActiveSpan{
+		tracer: t,
+		span: Span{
+			TraceId:  parent.TraceId,
+			SpanId:   newSpanId(),
+			ParentId: parent.SpanId,
+			Name:     name,
+		},
+		start: time.Now(),
+	}
+}
+
+// export 将完成的Span交给所有导出器
+func (t *Tracer) export(span Span) {
+	t.mutex.RLock()
+	exporters := t.exporters
+	t.mutex.RUnlock()
+	for _, e := range exporters {
+		if err := e.ExportSpan(span); err != nil {
+			l := t.logger
+			if l == nil {
+				l = GetLogger()
+			}
+			l.Warnf("[Trace] 导出Span时出现错误：%v", err)
+		}
+	}
+}
+
+// ActiveSpan 一个正在进行中的Span，所有方法都可以在nil上调用
+type ActiveSpan struct {
+	mutex  sync.Mutex
+	tracer *Tracer
+	span   Span
+	start  time.Time
+	ended  bool
+}
+
+// Context 返回Span的标识，可以用于创建子Span
+func (s *ActiveSpan) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceId: s.span.TraceId, SpanId: s.span.SpanId}
+}
+
+// SetAttribute 设置Span的一个属性
+func (s *ActiveSpan) SetAttribute(key string, value any) *ActiveSpan {
+	if s == nil {
+		return s
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.span.Attributes == nil {
+		s.span.Attributes = make(map[string]any)
+	}
+	s.span.Attributes[key] = value
+	return s
+}
+
+// End 结束Span并导出，err 不为nil时Span的状态为 error，重复调用不会重复导出
+func (s *ActiveSpan) End(err ...error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	end := time.Now()
+	s.span.StartTime = s.start.UnixNano()
+	s.span.EndTime = end.UnixNano()
+	s.span.Duration = end.Sub(s.start).Microseconds()
+	s.span.Status = SpanOk
+	if len(err) > 0 && err[0] != nil {
+		s.span.Status = SpanError
+		s.span.Error = err[0].Error()
+	}
+	span := s.span
+	s.mutex.Unlock()
+	s.tracer.export(span)
+}
+
+// newSpanId 生成一个16位十六进制的Span ID
+func newSpanId() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+// TracingConfig 链路追踪的配置
+type TracingConfig struct {
+	Enable     bool    `json:"enable,omitempty,omitzero"`      // 是否启用链路追踪
+	Exporter   string  `json:"exporter,omitempty,omitzero"`    // 导出器，可以是 stdout / file，默认为 file
+	File       string  `json:"file,omitempty,omitzero"`        // file：保存Span的文件，相对路径位于数据目录中，默认为数据目录中的 traces.jsonl
+	SampleRate float64 `json:"sample_rate,omitempty,omitzero"` // 根Span的采样率，取值为0到1，默认为1
+}
+
+// validate 校验链路追踪的配置
+func (c TracingConfig) validate(invalid func(field, format string, args ...any)) {
+	switch c.Exporter {
+	case "", "stdout", "file":
+	default:
+		invalid("tracing.exporter", "只能是 stdout / file")
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		invalid("tracing.sample_rate", "必须在0到1之间")
+	}
+}
+
+// NewTracerFromConfig 按照配置创建Tracer，file 导出器的文件为相对路径时以及默认的文件位于指定的数据目录中
+func NewTracerFromConfig(config TracingConfig, layout DataLayout) (*Tracer, error) {
+	var exporter SpanExporter
+	switch config.Exporter {
+	case "stdout":
+		exporter = NewStdoutSpanExporter()
+	case "", "file":
+		path := layout.Resolve(config.File)
+		if path == "" {
+			path = layout.TraceFile()
+		}
+		e, err := NewJsonFileSpanExporter(path)
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	default:
+		return nil, fmt.Errorf("不支持的导出器：%s", config.Exporter)
+	}
+	t := NewTracer(exporter)
+	if config.SampleRate > 0 {
+		t.SetSampleRate(config.SampleRate)
+	}
+	return t, nil
+}
+
+// GetTracer 返回Bot的事件总线使用的Tracer，没有启用链路追踪时返回nil
+func (b *Bot) GetTracer() *Tracer {
+	return b.bus().GetTracer()
+}
+
+// SetTracer 设置Bot的事件总线使用的Tracer
+func (b *Bot) SetTracer(t *Tracer) {
+	if t != nil && t.logger == nil {
+		t.SetLogger(b.Logger)
+	}
+	b.bus().SetTracer(t)
+}
+
+// startSendSpan 开始一次消息发送的Span，消息由 Send / Reply 发送时是处理器Span的子Span，否则开始一条新的调用链
+func (c *CryoClient) startSendSpan(kind string, target uint32, msg *CryoMessage) *ActiveSpan {
+	t := c.bus().GetTracer()
+	var span *ActiveSpan
+	if msg.trace != nil {
+		span = t.StartSpan(*msg.trace, "send")
+	} else {
+		span = t.StartRootSpan("", "send")
+	}
+	return span.SetAttribute("type", kind).SetAttribute("target", target).SetAttribute("bot", c.Uin)
+}
+
+// traceFrom 记录消息是在处理哪个事件时发送的，用于将消息发送的Span关联到事件的调用链上
+func (m *CryoMessage) traceFrom(t *Tracer, event CryoEvent) *CryoMessage {
+	if t.enabled() {
+		ctx := t.EventContext(event)
+		m.trace = &ctx
+	}
+	return m
+}
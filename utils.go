@@ -9,8 +9,6 @@ import (
 	"strings"
 )
 
-var botClientCount = 0
-
 // RGB 得到一个RGB颜色的ANSI颜色代码
 func RGB(rgb string) string {
 	// 如果RGB字符串以#开头则去掉
@@ -44,11 +42,6 @@ func NewUUID() string {
 	return uuid.NewV4().String()
 }
 
-// newNickname 生成一个新的昵称
-func newNickname() string {
-	return fmt.Sprintf("Bot%d", botClientCount)
-}
-
 // GetQRCodeString 生成二维码字符串
 //
 // 基于 https://github.com/Baozisoftware/qrcode-terminal-go 修改而来
@@ -85,7 +78,7 @@ func GetQRCodeString(content string) (result *string) {
 	return &str
 }
 
-func Contains[T string | uint32 | int | CryoEventType](slice []T, item T) bool {
+func Contains[T string | uint32 | int | CryoEventType | EventCategory](slice []T, item T) bool {
 	for _, v := range slice {
 		if v == item {
 			return true
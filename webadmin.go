@@ -0,0 +1,452 @@
+package cryobot
+
+import (
+	"fmt"
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Web后台
+//
+// 提供一个可选的HTTP服务，可以在浏览器中查看已连接的Bot客户端、启用或停用事件处理器、查看实时的日志和事件，以及扫码登录新的账号
+// 页面本身不需要鉴权，页面调用的接口需要通过 Authorization 请求头或 access_token 查询参数携带访问令牌，
+// 打开页面时在地址中带上 access_token 查询参数即可；来自其他网页的跨站请求会被拒绝
+
+// WebAdminConfig Web后台的配置
+type WebAdminConfig struct {
+	Enable bool   `json:"enable,omitempty,omitzero"` // 是否启用Web后台
+	Addr   string `json:"addr,omitempty,omitzero"`   // 监听地址，默认为 127.0.0.1:8090
+	Token  string `json:"token,omitempty,omitzero"`  // 访问令牌，不能为空
+}
+
+// webAdminHistorySize 新连接的日志流和事件流会先收到的历史记录条数
+const webAdminHistorySize = 200
+
+// webAdminHub 将日志或事件广播给所有订阅了实时流的浏览器，并保留最近的历史记录
+type webAdminHub struct {
+	mutex       sync.Mutex
+	subscribers map[chan []byte]struct{}
+	history     [][]byte
+	closed      bool
+}
+
+func newWebAdminHub() *webAdminHub {
+	return &webAdminHub{subscribers: make(map[chan []byte]struct{})}
+}
+
+// publish 广播一条记录，订阅者的缓冲区已满时会丢弃这条记录，以免阻塞日志和事件的发布者
+func (h *webAdminHub) publish(data []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closed {
+		return
+	}
+	h.history = append(h.history, data)
+	if len(h.history) > webAdminHistorySize {
+		h.history = h.history[len(h.history)-webAdminHistorySize:]
+	}
+	for ch := range h.subscribers {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+// subscribe 订阅实时记录，返回订阅通道和当前的历史记录
+func (h *webAdminHub) subscribe() (chan []byte, [][]byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	ch := make(chan []byte, 64)
+	if h.closed {
+		close(ch)
+		return ch, nil
+	}
+	h.subscribers[ch] = struct{}{}
+	return ch, append([][]byte{}, h.history...)
+}
+
+func (h *webAdminHub) unsubscribe(ch chan []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// close 关闭所有订阅通道
+func (h *webAdminHub) close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.closed = true
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// ansiPattern 终端颜色控制符
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// webAdminLogHook 将日志转发到Web后台的logrus钩子
+type webAdminLogHook struct {
+	hub *webAdminHub
+}
+
+func (h *webAdminLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *webAdminLogHook) Fire(entry *logrus.Entry) error {
+	log := map[string]any{
+		"time":    entry.Time.UnixMilli(),
+		"level":   entry.Level.String(),
+		"message": ansiPattern.ReplaceAllString(entry.Message, ""),
+	}
+	if len(entry.Data) > 0 {
+		fields := make(map[string]string, len(entry.Data))
+		for k, v := range entry.Data {
+			fields[k] = fmt.Sprint(v)
+		}
+		log["fields"] = fields
+	}
+	data, err := json.Marshal(log)
+	if err == nil {
+		h.hub.publish(data)
+	}
+	return nil
+}
+
+// WebAdmin cryobot的Web后台
+type WebAdmin struct {
+	bot       *Bot
+	config    WebAdminConfig
+	server    *http.Server
+	logs      *webAdminHub
+	events    *webAdminHub
+	logHook   *webAdminLogHook
+	handlerId string
+}
+
+// NewWebAdmin 创建一个Web后台，调用 Start 后开始监听
+func NewWebAdmin(bot *Bot, config WebAdminConfig) *WebAdmin {
+	if config.Addr == "" {
+		config.Addr = "127.0.0.1:8090"
+	}
+	return &WebAdmin{
+		bot:    bot,
+		config: config,
+		logs:   newWebAdminHub(),
+		events: newWebAdminHub(),
+	}
+}
+
+// GetConfig 返回Web后台使用的配置
+func (a *WebAdmin) GetConfig() WebAdminConfig {
+	return a.config
+}
+
+// Handler 返回Web后台的HTTP处理器，可以用于挂载到自定义的HTTP服务上，没有设置访问令牌时所有接口都会返回403
+func (a *WebAdmin) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", a.servePage)
+	mux.HandleFunc("GET /api/clients", a.auth(a.serveClients))
+	mux.HandleFunc("GET /api/handlers", a.auth(a.serveHandlers))
+	mux.HandleFunc("POST /api/handlers/{id}/enable", a.auth(a.serveToggleHandler(true)))
+	mux.HandleFunc("POST /api/handlers/{id}/disable", a.auth(a.serveToggleHandler(false)))
+	mux.HandleFunc("GET /api/logs", a.auth(a.serveStream(a.logs)))
+	mux.HandleFunc("GET /api/events", a.auth(a.serveStream(a.events)))
+	mux.HandleFunc("POST /api/login", a.auth(a.serveStartLogin))
+	mux.HandleFunc("GET /api/login/{id}", a.auth(a.serveLoginState))
+	mux.HandleFunc("GET /api/login/{id}/qrcode", a.auth(a.serveLoginQRCode))
+	mux.HandleFunc("POST /api/password_login", a.auth(a.serveStartPasswordLogin))
+	mux.HandleFunc("GET /api/password_login/{id}", a.auth(a.servePasswordLoginState))
+	mux.HandleFunc("POST /api/password_login/{id}/captcha", a.auth(a.serveSubmitCaptcha))
+	return mux
+}
+
+// Start 启动Web后台，开始转发日志和事件并监听配置中的地址
+func (a *WebAdmin) Start() error {
+	if a.config.Token == "" {
+		return fmt.Errorf("Web后台必须设置访问令牌")
+	}
+	ln, err := net.Listen("tcp", a.config.Addr)
+	if err != nil {
+		return err
+	}
+	if cl, ok := a.bot.log().(*CryoLogger); ok {
+		a.logHook = &webAdminLogHook{hub: a.logs}
+		cl.AddHook(a.logHook)
+	} else {
+		a.bot.log().Warn("[WebAdmin] 使用了自定义的日志记录器，Web后台将无法显示实时日志")
+	}
+	a.handlerId = SubscribeMatchTo(a.bot.bus(), EventMatcher{}, a.onEvent, "web_admin")
+	a.server = &http.Server{Handler: a.Handler()}
+	go func() {
+		if err := a.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			a.bot.log().Error("[WebAdmin] Web后台停止运行：", err)
+		}
+	}()
+	a.bot.log().Infof("%s[WebAdmin] Web后台已在 http://%s 上启动", lavender, a.config.Addr)
+	return nil
+}
+
+// Stop 停止Web后台
+func (a *WebAdmin) Stop() {
+	if a.server == nil {
+		return
+	}
+	a.bot.bus().UnsubscribeById(a.handlerId)
+	if a.logHook != nil {
+		if cl, ok := a.bot.log().(*CryoLogger); ok {
+			cl.RemoveHook(a.logHook)
+		}
+	}
+	a.logs.close()
+	a.events.close()
+	_ = a.server.Close()
+	a.server = nil
+}
+
+// onEvent 将事件广播给浏览器
+func (a *WebAdmin) onEvent(event CryoEvent) {
+	data, err := json.Marshal(WebhookPayload{
+		Type:     event.Type(),
+		Category: CategoryOf(event.Type()),
+		Event:    jsontext.Value(event.ToJson()),
+	})
+	if err == nil {
+		a.events.publish(data)
+	}
+}
+
+// auth 为接口添加鉴权，并拒绝来自其他网页的跨站请求，没有设置访问令牌时拒绝所有请求
+func (a *WebAdmin) auth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.config.Token == "" || !checkOneBotOrigin(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if code := checkOneBotToken(r, a.config.Token); code != http.StatusOK {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// writeJSON 以JSON格式返回数据
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func (a *WebAdmin) servePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(webAdminPage))
+}
+
+func (a *WebAdmin) serveClients(w http.ResponseWriter, r *http.Request) {
+	list := a.bot.clients().List()
+	clients := make([]map[string]any, 0, len(list))
+	for _, c := range list {
+		clients = append(clients, clientData(c))
+	}
+	writeJSON(w, http.StatusOK, clients)
+}
+
+// clientData 将客户端转换为Web后台和管理接口返回的数据
+func clientData(c *CryoClient) map[string]any {
+	return map[string]any{
+		"id":           c.Id,
+		"uin":          c.Uin,
+		"uid":          c.Uid,
+		"nickname":     c.GetNickname(),
+		"alias":        c.GetAlias(),
+		"status":       c.GetStatus(),
+		"platform":     c.Platform,
+		"version":      c.Version,
+		"online":       c.IsOnline(),
+		"connected_at": c.ConnectedAt.Unix(),
+		"uptime":       int64(c.GetUptime().Seconds()),
+	}
+}
+
+// webAdminHandler 将事件处理器转换为接口返回的数据
+func webAdminHandler(h *Handler) map[string]any {
+	return map[string]any{
+		"id":             h.GetId(),
+		"name":           h.GetName(),
+		"tags":           h.GetTags(),
+		"matching_types": h.GetMatchingTypes(),
+		"subscriptions":  len(h.Subscriptions),
+		"enabled":        h.IsEnabled(),
+	}
+}
+
+func (a *WebAdmin) serveHandlers(w http.ResponseWriter, r *http.Request) {
+	handlers := a.bot.GetHandlers()
+	result := make([]map[string]any, 0, len(handlers))
+	for _, h := range handlers {
+		result = append(result, webAdminHandler(h))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (a *WebAdmin) serveToggleHandler(enable bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := a.bot.GetHandlerById(r.PathValue("id"))
+		if h == nil {
+			http.Error(w, "找不到事件处理器", http.StatusNotFound)
+			return
+		}
+		if enable {
+			h.Enable()
+			a.bot.log().Infof("[WebAdmin] 已启用事件处理器 %s", h.GetId())
+		} else {
+			h.Disable()
+			a.bot.log().Infof("[WebAdmin] 已停用事件处理器 %s", h.GetId())
+		}
+		writeJSON(w, http.StatusOK, webAdminHandler(h))
+	}
+}
+
+// serveStream 以 Server-Sent Events 的形式推送实时的日志或事件
+func (a *WebAdmin) serveStream(hub *webAdminHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "不支持流式响应", http.StatusInternalServerError)
+			return
+		}
+		ch, history := hub.subscribe()
+		defer hub.unsubscribe(ch)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		for _, data := range history {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case data, ok := <-ch:
+				if !ok {
+					return
+				}
+				_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+			case <-ticker.C:
+				_, _ = fmt.Fprint(w, ": ping\n\n") // 保持连接
+			case <-r.Context().Done():
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// serveStartLogin 创建一个新的客户端并开始扫码登录
+func (a *WebAdmin) serveStartLogin(w http.ResponseWriter, r *http.Request) {
+	login, err := a.bot.StartQRCodeLogin()
+	if err != nil {
+		a.bot.log().Error("[WebAdmin] 获取二维码时出现错误：", err)
+		http.Error(w, "获取二维码时出现错误："+err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, qrCodeLoginData(login))
+}
+
+func (a *WebAdmin) serveLoginState(w http.ResponseWriter, r *http.Request) {
+	login := a.bot.GetQRCodeLogin(r.PathValue("id"))
+	if login == nil {
+		http.Error(w, "找不到登录", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, qrCodeLoginData(login))
+}
+
+func (a *WebAdmin) serveLoginQRCode(w http.ResponseWriter, r *http.Request) {
+	login := a.bot.GetQRCodeLogin(r.PathValue("id"))
+	if login == nil {
+		http.Error(w, "找不到登录", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(login.GetQRCode())
+}
+
+// serveStartPasswordLogin 创建一个新的客户端并开始使用账号密码登录
+func (a *WebAdmin) serveStartPasswordLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Uin      int    `json:"uin"`
+		Password string `json:"password"`
+	}
+	if err := json.UnmarshalRead(http.MaxBytesReader(w, r.Body, 1<<16), &req); err != nil {
+		http.Error(w, "无效的请求体："+err.Error(), http.StatusBadRequest)
+		return
+	}
+	login, err := a.bot.StartPasswordLogin(req.Uin, req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, passwordLoginData(login))
+}
+
+func (a *WebAdmin) servePasswordLoginState(w http.ResponseWriter, r *http.Request) {
+	login := a.bot.GetPasswordLogin(r.PathValue("id"))
+	if login == nil {
+		http.Error(w, "找不到登录", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, passwordLoginData(login))
+}
+
+// serveSubmitCaptcha 提交滑块验证码的结果
+func (a *WebAdmin) serveSubmitCaptcha(w http.ResponseWriter, r *http.Request) {
+	login := a.bot.GetPasswordLogin(r.PathValue("id"))
+	if login == nil {
+		http.Error(w, "找不到登录", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Ticket  string `json:"ticket"`
+		RandStr string `json:"randstr"`
+	}
+	if err := json.UnmarshalRead(http.MaxBytesReader(w, r.Body, 1<<16), &req); err != nil {
+		http.Error(w, "无效的请求体："+err.Error(), http.StatusBadRequest)
+		return
+	}
+	v := login.GetVerification()
+	if v == nil || !v.SubmitCaptcha(req.Ticket, req.RandStr) {
+		http.Error(w, "当前不需要提交滑块验证码", http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, passwordLoginData(login))
+}
+
+// StartWebAdmin 使用指定的配置启动Web后台
+func (b *Bot) StartWebAdmin(config WebAdminConfig) (*WebAdmin, error) {
+	a := NewWebAdmin(b, config)
+	if err := a.Start(); err != nil {
+		return nil, err
+	}
+	b.webAdmin = a
+	return a, nil
+}
@@ -0,0 +1,164 @@
+package cryobot
+
+// webAdminPage Web后台的页面，所有数据都通过 /api 下的接口获取
+const webAdminPage = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>cryobot 后台</title>
+<style>
+body { margin: 0; font-family: system-ui, sans-serif; background: #0f172a; color: #e2e8f0; }
+header { padding: 16px 24px; background: #1e293b; font-size: 20px; }
+main { display: grid; grid-template-columns: 1fr 1fr; gap: 16px; padding: 16px 24px; }
+section { background: #1e293b; border-radius: 8px; padding: 12px 16px; min-width: 0; }
+h2 { font-size: 16px; margin: 4px 0 12px; display: flex; justify-content: space-between; align-items: center; }
+table { width: 100%; border-collapse: collapse; font-size: 14px; }
+th, td { text-align: left; padding: 6px 4px; border-bottom: 1px solid #334155; }
+button { background: #4682b4; color: #fff; border: 0; border-radius: 4px; padding: 4px 10px; cursor: pointer; }
+button.off { background: #64748b; }
+.stream { height: 320px; overflow-y: auto; font-family: monospace; font-size: 12px; white-space: pre-wrap; word-break: break-all; }
+.online { color: #4ade80; } .offline { color: #f87171; }
+.level-warning { color: #facc15; } .level-error, .level-fatal, .level-panic { color: #f87171; } .level-debug, .level-trace { color: #94a3b8; }
+input { background: #0f172a; color: #e2e8f0; border: 1px solid #334155; border-radius: 4px; padding: 4px 6px; }
+#password { margin-bottom: 8px; }
+#login a { color: #7dd3fc; word-break: break-all; }
+#login img { display: block; margin: 8px 0; width: 200px; image-rendering: pixelated; background: #fff; }
+</style>
+</head>
+<body>
+<header>🧊 cryobot 后台</header>
+<main>
+<section>
+<h2>Bot客户端 <button onclick="startLogin()">扫码登录</button></h2>
+<form id="password" onsubmit="startPasswordLogin(); return false;">
+<input id="uin" placeholder="QQ号" inputmode="numeric"> <input id="pwd" type="password" placeholder="密码"> <button>密码登录</button>
+</form>
+<div id="login"></div>
+<table><thead><tr><th>状态</th><th>Uin</th><th>昵称</th><th>运行时长</th></tr></thead><tbody id="clients"></tbody></table>
+</section>
+<section>
+<h2>事件处理器</h2>
+<table><thead><tr><th>名称</th><th>标签</th><th>订阅数</th><th></th></tr></thead><tbody id="handlers"></tbody></table>
+</section>
+<section><h2>实时日志</h2><div class="stream" id="logs"></div></section>
+<section><h2>实时事件</h2><div class="stream" id="events"></div></section>
+</main>
+<script>
+const token = new URLSearchParams(location.search).get("access_token") || "";
+const withToken = url => token ? url + (url.includes("?") ? "&" : "?") + "access_token=" + encodeURIComponent(token) : url;
+const api = (url, options) => fetch(withToken(url), options).then(r => { if (!r.ok) throw new Error(r.status); return r.json(); });
+const escape = s => String(s ?? "").replace(/[&<>"]/g, c => ({"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"}[c]));
+
+function duration(seconds) {
+  const d = Math.floor(seconds / 86400), h = Math.floor(seconds % 86400 / 3600), m = Math.floor(seconds % 3600 / 60);
+  return (d ? d + "天" : "") + (h ? h + "小时" : "") + m + "分钟";
+}
+
+function loadClients() {
+  api("/api/clients").then(clients => {
+    document.getElementById("clients").innerHTML = clients.map(c =>
+      "<tr><td class='" + (c.online ? "online'>在线" : "offline'>离线") + "</td><td>" + c.uin + "</td><td>" +
+      escape(c.nickname) + "</td><td>" + duration(c.uptime) + "</td></tr>").join("");
+  }).catch(() => {});
+}
+
+function loadHandlers() {
+  api("/api/handlers").then(handlers => {
+    document.getElementById("handlers").innerHTML = handlers.map(h =>
+      "<tr><td>" + escape(h.name || h.id.slice(0, 8)) + "</td><td>" + escape((h.tags || []).join(", ")) + "</td><td>" +
+      h.subscriptions + "</td><td><button class='" + (h.enabled ? "" : "off") + "' onclick=\"toggle('" + h.id + "', " + !h.enabled + ")\">" +
+      (h.enabled ? "已启用" : "已停用") + "</button></td></tr>").join("");
+  }).catch(() => {});
+}
+
+function toggle(id, enable) {
+  api("/api/handlers/" + id + "/" + (enable ? "enable" : "disable"), {method: "POST"}).then(loadHandlers);
+}
+
+function startLogin() {
+  const box = document.getElementById("login");
+  box.textContent = "正在获取二维码...";
+  api("/api/login", {method: "POST"}).then(login => {
+    const qrcode = refreshed => withToken("/api/login/" + login.id + "/qrcode?r=" + refreshed);
+    box.innerHTML = "<img src='" + qrcode(0) + "'><span>请使用手机QQ扫码登录</span>";
+    let refreshed = 0;
+    const timer = setInterval(() => api("/api/login/" + login.id).then(state => {
+      if (state.refreshed !== refreshed) {
+        refreshed = state.refreshed;
+        box.querySelector("img").src = qrcode(refreshed);
+      }
+      if (state.state === "scanned") box.querySelector("span").textContent = "已扫码，请在手机上确认登录";
+      if (["waiting", "scanned", "refreshed"].includes(state.state)) return;
+      clearInterval(timer);
+      box.textContent = state.state === "success" ? "登录成功：" + state.nickname + " (" + state.uin + ")" : "登录失败（" + state.state + "），请重试";
+      loadClients();
+    }).catch(() => clearInterval(timer)), 2000);
+  }).catch(e => box.textContent = "获取二维码失败：" + e.message);
+}
+
+function post(url, body) {
+  return fetch(withToken(url), {method: "POST", headers: {"Content-Type": "application/json"}, body: JSON.stringify(body)})
+    .then(r => r.ok ? r.json() : r.text().then(t => { throw new Error(t); }));
+}
+
+function startPasswordLogin() {
+  const box = document.getElementById("login");
+  box.textContent = "正在登录...";
+  post("/api/password_login", {uin: Number(document.getElementById("uin").value), password: document.getElementById("pwd").value}).then(login => {
+    document.getElementById("pwd").value = "";
+    let shown = "";
+    const timer = setInterval(() => api("/api/password_login/" + login.id).then(state => {
+      if (state.state === "running") return;
+      if (state.state === "verifying") {
+        const v = state.verification;
+        if (shown === v.url) return;
+        shown = v.url;
+        const link = "<a href='" + escape(v.url) + "' target='_blank'>" + escape(v.url) + "</a>";
+        box.innerHTML = v.kind === "captcha"
+          ? "<div>请打开链接完成滑块验证，然后填入 cap_union_new_verify 响应中的 ticket 和 randstr：</div>" + link +
+            "<form onsubmit=\"submitCaptcha('" + login.id + "'); return false;\"><input id='ticket' placeholder='ticket'> <input id='randstr' placeholder='randstr'> <button>提交</button></form>"
+          : "<div>请使用手机QQ打开链接完成新设备验证，验证后会自动继续登录：</div>" + link;
+        return;
+      }
+      clearInterval(timer);
+      box.textContent = state.state === "success" ? "登录成功：" + state.nickname + " (" + state.uin + ")" : "登录失败：" + (state.message || "");
+      loadClients();
+    }).catch(() => clearInterval(timer)), 2000);
+  }).catch(e => box.textContent = "登录失败：" + e.message);
+}
+
+function submitCaptcha(id) {
+  post("/api/password_login/" + id + "/captcha", {ticket: document.getElementById("ticket").value, randstr: document.getElementById("randstr").value})
+    .then(() => document.getElementById("login").textContent = "正在登录...")
+    .catch(e => document.getElementById("login").textContent = "提交失败：" + e.message);
+}
+
+function stream(url, id, render) {
+  const box = document.getElementById(id);
+  const source = new EventSource(withToken(url));
+  source.onmessage = e => {
+    const line = document.createElement("div");
+    render(line, JSON.parse(e.data));
+    box.appendChild(line);
+    while (box.childNodes.length > 500) box.removeChild(box.firstChild);
+    box.scrollTop = box.scrollHeight;
+  };
+}
+
+stream("/api/logs", "logs", (line, log) => {
+  line.className = "level-" + log.level;
+  const fields = Object.entries(log.fields || {}).map(([k, v]) => k + "=" + v).join(" ");
+  line.textContent = new Date(log.time).toLocaleTimeString() + " [" + log.level + "] " + log.message + (fields ? " " + fields : "");
+});
+stream("/api/events", "events", (line, event) => {
+  line.textContent = "[" + event.category + "] " + (event.event.Summary || JSON.stringify(event.event));
+});
+loadClients();
+loadHandlers();
+setInterval(loadClients, 5000);
+setInterval(loadHandlers, 10000);
+</script>
+</body>
+</html>
+`
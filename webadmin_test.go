@@ -0,0 +1,35 @@
+package cryobot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebAdminAuth(t *testing.T) {
+	b := NewBot()
+	get := func(token, query, origin string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/clients"+query, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		NewWebAdmin(b, WebAdminConfig{Token: token}).Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := get("", "", ""); code != http.StatusForbidden {
+		t.Errorf("没有设置访问令牌时 code = %d, want 403", code)
+	}
+	if code := get("secret", "", ""); code != http.StatusUnauthorized {
+		t.Errorf("没有携带访问令牌时 code = %d, want 401", code)
+	}
+	if code := get("secret", "?access_token=wrong", ""); code != http.StatusForbidden {
+		t.Errorf("访问令牌错误时 code = %d, want 403", code)
+	}
+	if code := get("secret", "?access_token=secret", "http://evil.example"); code != http.StatusForbidden {
+		t.Errorf("跨站请求 code = %d, want 403", code)
+	}
+	if code := get("secret", "?access_token=secret", "http://example.com"); code != http.StatusOK {
+		t.Errorf("同源请求 code = %d, want 200", code)
+	}
+}
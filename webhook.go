@@ -0,0 +1,345 @@
+package cryobot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WebhookConfig 出站Webhook的配置
+//
+// 所有非空的过滤条件都满足时事件才会被推送，全部为空时推送所有事件
+type WebhookConfig struct {
+	Url            string          `json:"url"`                                 // 接收事件的HTTP地址
+	Secret         string          `json:"secret,omitempty,omitzero"`           // 签名密钥，不为空时会在请求头中附带 HMAC-SHA256 签名
+	Types          []CryoEventType `json:"types,omitempty,omitzero"`            // 需要推送的事件类型
+	Categories     []EventCategory `json:"categories,omitempty,omitzero"`       // 需要推送的事件分类
+	Tags           []string        `json:"tags,omitempty,omitzero"`             // 需要推送的事件标签，如 group_message，满足其一即可
+	Groups         []uint32        `json:"groups,omitempty,omitzero"`           // 需要推送的群号，只对能确定所属群的事件生效
+	Timeout        int             `json:"timeout,omitempty,omitzero"`          // 单次请求的超时时间，单位为秒，默认为10
+	MaxRetries     int             `json:"max_retries,omitempty,omitzero"`      // 推送失败后的最大重试次数，默认为3，为负数时不重试
+	RetryInterval  int             `json:"retry_interval,omitempty,omitzero"`   // 首次重试前的等待时间，单位为毫秒，之后每次翻倍，默认为1000
+	QueueSize      int             `json:"queue_size,omitempty,omitzero"`       // 待推送事件的队列长度，默认为256
+	DeadLetterFile string          `json:"dead_letter_file,omitempty,omitzero"` // 最终推送失败的事件会以JSON Lines的格式追加到该文件中，相对路径位于数据目录中
+	EnableReply    bool            `json:"enable_reply,omitempty,omitzero"`     // 是否根据响应体中的内容回复消息事件
+}
+
+// Match 检查事件是否满足Webhook的过滤条件
+func (c WebhookConfig) Match(event CryoEvent) bool {
+	if len(c.Types) > 0 && !Contains(c.Types, event.Type()) {
+		return false
+	}
+	if len(c.Categories) > 0 && !Contains(c.Categories, CategoryOf(event.Type())) {
+		return false
+	}
+	if len(c.Tags) > 0 {
+		matched := false
+		for _, tag := range event.GetBaseEvent().EventTags {
+			if Contains(c.Tags, tag) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(c.Groups) > 0 {
+		groupUin := eventGroupUin(event)
+		if groupUin == 0 || !Contains(c.Groups, groupUin) {
+			return false
+		}
+	}
+	return true
+}
+
+// WebhookPayload 推送给Webhook的请求体
+type WebhookPayload struct {
+	Type     CryoEventType  `json:"type"`     // 事件类型
+	Category EventCategory  `json:"category"` // 事件分类
+	Event    jsontext.Value `json:"event"`    // 事件本身，即 CryoEvent.ToJson 的结果
+}
+
+// WebhookReply Webhook响应体中可以携带的回复
+//
+// 只对消息事件生效，回复会通过接收到该事件的Bot客户端发送
+type WebhookReply struct {
+	Reply string `json:"reply"`                    // 回复的文本内容，为空时不回复
+	Quote *bool  `json:"quote,omitempty,omitzero"` // 是否引用原消息，默认为true
+}
+
+// webhookDeadLetter 死信文件中的一条记录
+type webhookDeadLetter struct {
+	Time    int64          `json:"time"`
+	Url     string         `json:"url"`
+	Error   string         `json:"error"`
+	Payload jsontext.Value `json:"payload"`
+}
+
+// deadLetterMutex 保证多个Webhook同时写入死信文件时不会交错
+var deadLetterMutex sync.Mutex
+
+// Webhook 出站Webhook，将事件总线上满足条件的事件以JSON的形式推送到指定的HTTP地址
+type Webhook struct {
+	bot       *Bot
+	config    WebhookConfig
+	client    *http.Client
+	queue     chan CryoEvent
+	handlerId string
+	closeOnce sync.Once
+	done      chan struct{}
+
+	queueMutex sync.RWMutex // 保证关闭队列后不会再有事件放入队列
+	closed     bool
+	ctx        context.Context // 关闭时取消，用于中断正在进行的推送和重试等待
+	cancel     context.CancelFunc
+}
+
+// NewWebhook 创建一个出站Webhook，调用 Start 后开始推送事件
+func NewWebhook(bot *Bot, config WebhookConfig) *Webhook {
+	if config.Timeout <= 0 {
+		config.Timeout = 10
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = 1000
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 256
+	}
+	config.DeadLetterFile = bot.GetDataLayout().Resolve(config.DeadLetterFile)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Webhook{
+		bot:    bot,
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.Timeout) * time.Second},
+		queue:  make(chan CryoEvent, config.QueueSize),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// GetConfig 返回Webhook使用的配置
+func (w *Webhook) GetConfig() WebhookConfig {
+	return w.config
+}
+
+// Start 订阅Bot的事件总线并启动推送协程
+func (w *Webhook) Start() {
+	w.handlerId = SubscribeMatchTo(w.bot.bus(), EventMatcher{}, w.onEvent, "webhook")
+	go w.run()
+	w.bot.log().Infof("%s[Webhook] 已开始向 %s 推送事件", lavender, w.config.Url)
+}
+
+// Close 停止推送事件，正在推送或等待重试的事件以及队列中剩余的事件会被写入死信文件
+func (w *Webhook) Close() {
+	w.closeOnce.Do(func() {
+		w.bot.bus().UnsubscribeById(w.handlerId)
+		w.queueMutex.Lock()
+		w.closed = true
+		close(w.queue)
+		w.queueMutex.Unlock()
+		w.cancel()
+		<-w.done
+	})
+}
+
+// onEvent 将满足条件的事件放入推送队列，队列已满时直接写入死信文件，Webhook已关闭时忽略事件
+func (w *Webhook) onEvent(event CryoEvent) {
+	if !w.config.Match(event) {
+		return
+	}
+	w.queueMutex.RLock()
+	defer w.queueMutex.RUnlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.queue <- event:
+	default:
+		payload, _ := w.payload(event)
+		w.deadLetter(payload, fmt.Errorf("推送队列已满"))
+	}
+}
+
+// run 依次推送队列中的事件
+func (w *Webhook) run() {
+	defer close(w.done)
+	for event := range w.queue {
+		w.deliver(event)
+	}
+}
+
+// payload 构建推送的请求体
+func (w *Webhook) payload(event CryoEvent) ([]byte, error) {
+	return json.Marshal(WebhookPayload{
+		Type:     event.Type(),
+		Category: CategoryOf(event.Type()),
+		Event:    jsontext.Value(event.ToJson()),
+	})
+}
+
+// deliver 推送一个事件，失败时按照指数退避进行重试，全部失败后写入死信文件
+func (w *Webhook) deliver(event CryoEvent) {
+	body, err := w.payload(event)
+	if err != nil {
+		w.bot.log().Error("[Webhook] 序列化事件时出现错误：", err)
+		return
+	}
+	interval := time.Duration(w.config.RetryInterval) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		var respBody []byte
+		respBody, err = w.post(event, body)
+		if err == nil {
+			w.reply(event, respBody)
+			return
+		}
+		if attempt >= w.config.MaxRetries {
+			break
+		}
+		w.bot.log().Debugf("[Webhook] 向 %s 推送事件失败，将在 %v 后重试：%v", w.config.Url, interval, err)
+		if !w.wait(interval) {
+			break
+		}
+		interval *= 2
+	}
+	w.bot.log().Errorf("[Webhook] 向 %s 推送事件失败：%v", w.config.Url, err)
+	w.deadLetter(body, err)
+}
+
+// wait 等待重试的间隔，Webhook在等待期间关闭时返回 false
+func (w *Webhook) wait(interval time.Duration) bool {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// post 发送一次推送请求，返回响应体
+func (w *Webhook) post(event CryoEvent, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.config.Url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	base := event.GetBaseEvent()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cryobot-webhook")
+	req.Header.Set("X-Cryobot-Event-Id", base.EventId)
+	req.Header.Set("X-Cryobot-Event-Type", strconv.FormatUint(uint64(event.Type()), 10))
+	req.Header.Set("X-Cryobot-Bot-Uin", strconv.FormatUint(uint64(base.BotUin), 10))
+	if w.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.config.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Cryobot-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP状态码 %d", resp.StatusCode)
+	}
+	return respBody, nil
+}
+
+// reply 根据响应体中的内容回复消息事件
+func (w *Webhook) reply(event CryoEvent, respBody []byte) {
+	if !w.config.EnableReply || len(bytes.TrimSpace(respBody)) == 0 {
+		return
+	}
+	messageEvent, ok := event.(CryoMessageEvent)
+	if !ok {
+		return
+	}
+	var reply WebhookReply
+	if err := json.Unmarshal(respBody, &reply); err != nil {
+		w.bot.log().Debug("[Webhook] 响应体不是有效的回复：", err)
+		return
+	}
+	if reply.Reply == "" {
+		return
+	}
+	c := w.bot.GetClient(event)
+	if c == nil {
+		w.bot.log().Warn("[Webhook] 找不到接收该事件的Bot客户端，无法回复")
+		return
+	}
+	if reply.Quote == nil || *reply.Quote {
+		c.Reply(messageEvent, reply.Reply)
+	} else {
+		c.Send(messageEvent, reply.Reply)
+	}
+}
+
+// deadLetter 将推送失败的事件追加到死信文件中
+func (w *Webhook) deadLetter(payload []byte, cause error) {
+	if w.config.DeadLetterFile == "" {
+		return
+	}
+	line, err := json.Marshal(webhookDeadLetter{
+		Time:    time.Now().Unix(),
+		Url:     w.config.Url,
+		Error:   cause.Error(),
+		Payload: jsontext.Value(payload),
+	})
+	if err != nil {
+		return
+	}
+	deadLetterMutex.Lock()
+	defer deadLetterMutex.Unlock()
+	if err := os.MkdirAll(filepath.Dir(w.config.DeadLetterFile), 0755); err != nil {
+		w.bot.log().Error("[Webhook] 创建死信文件的目录时出现错误：", err)
+		return
+	}
+	f, err := os.OpenFile(w.config.DeadLetterFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		w.bot.log().Error("[Webhook] 写入死信文件时出现错误：", err)
+		return
+	}
+	defer f.Close()
+	_, _ = f.Write(append(line, '\n'))
+}
+
+// AddWebhook 为Bot添加一个出站Webhook并立即开始推送事件
+func (b *Bot) AddWebhook(config WebhookConfig) *Webhook {
+	w := NewWebhook(b, config)
+	w.Start()
+	b.webhooksMutex.Lock()
+	b.webhooks = append(b.webhooks, w)
+	b.webhooksMutex.Unlock()
+	return w
+}
+
+// getWebhooks 返回Bot已添加的出站Webhook的副本
+func (b *Bot) getWebhooks() []*Webhook {
+	b.webhooksMutex.RLock()
+	defer b.webhooksMutex.RUnlock()
+	return slices.Clone(b.webhooks)
+}
@@ -0,0 +1,84 @@
+package cryobot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRequest Webhook测试服务器收到的一次请求
+type webhookRequest struct {
+	body      []byte
+	signature string
+}
+
+func TestWebhookSignature(t *testing.T) {
+	requests := make(chan webhookRequest, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{body: body, signature: r.Header.Get("X-Cryobot-Signature")}
+	}))
+	defer server.Close()
+
+	receive := func() webhookRequest {
+		select {
+		case req := <-requests:
+			return req
+		case <-time.After(5 * time.Second):
+			t.Fatal("Webhook没有推送事件")
+		}
+		return webhookRequest{}
+	}
+
+	b := NewBot()
+	defer b.Close()
+	signed := b.AddWebhook(WebhookConfig{Url: server.URL, Secret: "webhook-secret"})
+	b.Bus.Publish(CustomEvent{BaseEvent: BaseEvent{EventId: "signed"}})
+	req := receive()
+	signed.Close()
+
+	mac := hmac.New(sha256.New, []byte("webhook-secret"))
+	mac.Write(req.body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.signature != want {
+		t.Fatalf("signature = %q, want %q", req.signature, want)
+	}
+	other := hmac.New(sha256.New, []byte("other-secret"))
+	other.Write(req.body)
+	if req.signature == "sha256="+hex.EncodeToString(other.Sum(nil)) {
+		t.Fatal("使用其他密钥计算出了相同的签名")
+	}
+
+	// 没有设置密钥时不附带签名
+	b.AddWebhook(WebhookConfig{Url: server.URL})
+	b.Bus.Publish(CustomEvent{BaseEvent: BaseEvent{EventId: "unsigned"}})
+	if req := receive(); req.signature != "" {
+		t.Fatalf("没有设置密钥时附带了签名：%s", req.signature)
+	}
+}
+
+func TestAddWebhookConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	b := NewBot()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.AddWebhook(WebhookConfig{Url: server.URL})
+			_ = b.getWebhooks()
+		}()
+	}
+	wg.Wait()
+	if n := len(b.getWebhooks()); n != 8 {
+		t.Fatalf("添加了 %d 个Webhook，want 8", n)
+	}
+	b.Close()
+}